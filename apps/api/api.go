@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/storage"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/docai"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/server"
+)
+
+// api serves the REST API. Jobs are recorded in the refs bucket, their status is read from the
+// buckets of the ocr-worker and nlp-worker.
+type api struct {
+	topic *pubsub.Topic
+	// buckets are read for the document statuses. Jobs are recorded in the refs bucket
+	buckets        docai.StatusBuckets
+	refs           *storage.BucketHandle
+	uploads        *storage.BucketHandle
+	uploadBucket   string
+	jobsPrefix     string
+	maxDocuments   int
+	maxUploadBytes int64
+}
+
+func (a *api) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs", a.submitJob)
+	mux.HandleFunc("GET /jobs/{id}", a.getJob)
+	mux.HandleFunc("GET /jobs/{id}/documents/{n}/text", a.getText)
+	mux.HandleFunc("GET /jobs/{id}/documents/{n}/entities", a.getEntities)
+	mux.HandleFunc("GET /livez", func(w http.ResponseWriter, r *http.Request) {
+		server.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	return mux
+}
+
+// httpError is an error with the HTTP status code of its response.
+type httpError struct {
+	code int
+	msg  string
+}
+
+func (e *httpError) Error() string {
+	return e.msg
+}
+
+// writeError writes the error response of err. Errors other than httpError are internal errors,
+// logged and not exposed.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var he *httpError
+	if errors.As(err, &he) {
+		server.WriteError(w, he.code, he.msg)
+		return
+	}
+	log.Error().Err(err).Caller().Str("path", r.URL.Path).Msg("request failed")
+	server.WriteError(w, http.StatusInternalServerError, "internal error")
+}
+
+// documentIndex returns the index of the {n} path value in a job of count documents.
+func documentIndex(r *http.Request, count int) (int, error) {
+	n, err := strconv.Atoi(r.PathValue("n"))
+	if err != nil || n < 0 || n >= count {
+		return 0, &httpError{code: http.StatusNotFound, msg: "document not found"}
+	}
+	return n, nil
+}
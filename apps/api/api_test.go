@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateURIs(t *testing.T) {
+	tests := map[string]struct {
+		uris   []string
+		expect bool
+	}{
+		"valid":    {uris: []string{"gs://src/a.jpg", "gs://src/b/c.png"}, expect: true},
+		"empty":    {uris: nil},
+		"too many": {uris: []string{"gs://src/a.jpg", "gs://src/b.jpg", "gs://src/c.jpg"}},
+		"scheme":   {uris: []string{"https://src/a.jpg"}},
+		"object":   {uris: []string{"gs://src/"}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := validateURIs(tc.uris, 2); (err == nil) != tc.expect {
+				t.Fatalf("expected: %v, result: %v", tc.expect, err)
+			}
+		})
+	}
+}
+
+func TestAggregateStatus(t *testing.T) {
+	tests := map[string]struct {
+		statuses []string
+		expect   string
+	}{
+		"done":    {statuses: []string{statusDone, statusDone}, expect: statusDone},
+		"pending": {statuses: []string{statusDone, statusAnalyzing, statusOCRFailed}, expect: statusPending},
+		"failed":  {statuses: []string{statusDone, statusNLPFailed}, expect: statusFailed},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			docs := make([]documentStatus, len(tc.statuses))
+			for i, s := range tc.statuses {
+				docs[i].Status = s
+			}
+			res, counts := aggregateStatus(docs)
+			if res != tc.expect {
+				t.Fatalf("expected: %s, result: %s", tc.expect, res)
+			}
+			if counts[tc.statuses[0]] == 0 {
+				t.Fatalf("unexpected counts: %v", counts)
+			}
+		})
+	}
+}
+
+func TestSubmitJobValidation(t *testing.T) {
+	a := &api{maxDocuments: 2}
+
+	tests := map[string]struct {
+		contentType string
+		body        string
+		code        int
+	}{
+		"media type": {contentType: "text/plain", body: "gs://src/a.jpg", code: http.StatusUnsupportedMediaType},
+		"json":       {contentType: "application/json", body: "{", code: http.StatusBadRequest},
+		"uris":       {contentType: "application/json", body: `{"uris":["src/a.jpg"]}`, code: http.StatusBadRequest},
+		// no upload bucket
+		"upload": {contentType: "multipart/form-data; boundary=x", body: "--x--", code: http.StatusBadRequest},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/jobs", strings.NewReader(tc.body))
+			r.Header.Set("Content-Type", tc.contentType)
+			w := httptest.NewRecorder()
+			a.routes().ServeHTTP(w, r)
+			if w.Code != tc.code {
+				t.Fatalf("expected: %d, result: %d %s", tc.code, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestJobNotFound(t *testing.T) {
+	a := &api{}
+	w := httptest.NewRecorder()
+	a.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/jobs/..%2Fmanifests%2Fx", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected: 404, result: %d", w.Code)
+	}
+	if expect := "{\"error\":\"job not found\"}\n"; !reflect.DeepEqual(expect, w.Body.String()) {
+		t.Fatalf("expected: %q, result: %q", expect, w.Body.String())
+	}
+}
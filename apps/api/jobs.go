@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"cloud.google.com/go/storage"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/dispatch"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/logging"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/server"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/utils"
+	"google.golang.org/api/iterator"
+)
+
+// job is an ad-hoc OCR job, recorded in the refs bucket under the jobs prefix.
+type job struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	// MessageID is the id of the batch message published to the ocr-worker, empty until published.
+	MessageID string `json:"message_id"`
+	// Online is true when the batch is processed online, see dispatch.ModeOnline.
+	Online bool `json:"online"`
+	// Documents are the gs:// uris of the documents, uploaded files included.
+	Documents []string `json:"documents"`
+	// Label is the classification label of the documents, see dispatch.Document.
+	Label string `json:"label,omitempty"`
+	// Options are the process options of the batch, see dispatch.ProcessOptions.
+	Options *dispatch.ProcessOptions `json:"options,omitempty"`
+}
+
+// submitRequest is the JSON body of a job submission.
+type submitRequest struct {
+	URIs   []string `json:"uris"`
+	Online bool     `json:"online"`
+	// Label routes the documents to a Document AI processor, see the ocr-worker routes.
+	Label string `json:"label"`
+	// Options override the ocr-worker default process options, e.g. the language hints.
+	Options dispatch.ProcessOptions `json:"options"`
+}
+
+// jobIDRe matches the job ids returned by newJobID.
+var jobIDRe = regexp.MustCompile(`^[0-9a-f]{24}$`)
+
+// newJobID returns a random job id.
+func newJobID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validateURIs checks the gs:// uris of a submission.
+func validateURIs(uris []string, max int) error {
+	if len(uris) == 0 {
+		return &httpError{code: http.StatusBadRequest, msg: "no documents"}
+	}
+	if len(uris) > max {
+		return &httpError{code: http.StatusBadRequest, msg: fmt.Sprintf("too many documents, at most %d", max)}
+	}
+	for _, u := range uris {
+		bucket, name, ok := strings.Cut(strings.TrimPrefix(u, "gs://"), "/")
+		if !strings.HasPrefix(u, "gs://") || !ok || bucket == "" || name == "" {
+			return &httpError{code: http.StatusBadRequest, msg: fmt.Sprintf("invalid gs uri: %s", u)}
+		}
+	}
+	return nil
+}
+
+// submitJob records a job and publishes its batch to the ocr-worker. The body is either a JSON
+// submitRequest or a multipart form of files, uploaded to the upload bucket, and an optional
+// online field.
+func (a *api) submitJob(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := newJobID()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var req submitRequest
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	// the uploaded files of rejected submissions are deleted, see deleteUploads
+	fail := func(err error) {
+		if mediaType == "multipart/form-data" && a.uploads != nil {
+			a.deleteUploads(context.WithoutCancel(ctx), id)
+		}
+		writeError(w, r, err)
+	}
+
+	switch mediaType {
+	case "application/json":
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+			fail(&httpError{code: http.StatusBadRequest, msg: "invalid json body"})
+			return
+		}
+	case "multipart/form-data":
+		if req, err = a.upload(ctx, r, id); err != nil {
+			fail(err)
+			return
+		}
+	default:
+		fail(&httpError{code: http.StatusUnsupportedMediaType, msg: "expected application/json or multipart/form-data"})
+		return
+	}
+	if err := validateURIs(req.URIs, a.maxDocuments); err != nil {
+		fail(err)
+		return
+	}
+	if err := req.Options.Validate(); err != nil {
+		fail(&httpError{code: http.StatusBadRequest, msg: fmt.Sprintf("invalid options: %v", err)})
+		return
+	}
+
+	// record the job before publishing, so that a published batch always has a job
+	j := job{ID: id, Created: time.Now().UTC(), Online: req.Online, Documents: req.URIs, Label: req.Label}
+	if !req.Options.IsZero() {
+		j.Options = &req.Options
+	}
+	if err := a.writeJob(ctx, j); err != nil {
+		fail(err)
+		return
+	}
+
+	// publish
+	docs := make([]dispatch.Document, len(req.URIs))
+	for i, u := range req.URIs {
+		docs[i] = dispatch.Document{URI: u, Label: req.Label}
+	}
+	attrs := req.Options.Attributes()
+	if req.Online {
+		attrs[dispatch.AttrMode] = dispatch.ModeOnline
+	}
+	msgID, err := dispatch.PublishBatchWithAttributes(ctx, a.topic, docs, attrs)
+	if err != nil {
+		if derr := a.deleteJob(ctx, id); derr != nil {
+			log.Error().Err(derr).Caller().Str("job", id).Msg("failed to delete unpublished job")
+		}
+		fail(fmt.Errorf("failed to publish batch: %w", err))
+		return
+	}
+
+	j.MessageID = msgID
+	if err := a.writeJob(ctx, j); err != nil {
+		// the batch is published: the job is tracked, without its message id
+		log.Error().Err(err).Caller().Str("job", id).Str("message_id", msgID).Msg("failed to record message id")
+	}
+	log.Info().Str("job", id).Str("message_id", msgID).Int("documents", len(j.Documents)).Msg("job submitted")
+
+	w.Header().Set("Location", "/jobs/"+id)
+	server.WriteJSON(w, http.StatusAccepted, j)
+}
+
+// upload writes the files of a multipart submission to the upload bucket, under uploads/<job id>/.
+func (a *api) upload(ctx context.Context, r *http.Request, id string) (submitRequest, error) {
+	var req submitRequest
+	if a.uploads == nil {
+		return req, &httpError{code: http.StatusBadRequest, msg: "uploads are disabled"}
+	}
+
+	r.Body = http.MaxBytesReader(nil, r.Body, a.maxUploadBytes)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return req, &httpError{code: http.StatusBadRequest, msg: "invalid multipart body"}
+	}
+	for {
+		p, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return req, nil
+		}
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			return req, &httpError{code: http.StatusRequestEntityTooLarge, msg: "upload too large"}
+		}
+		if err != nil {
+			return req, &httpError{code: http.StatusBadRequest, msg: "invalid multipart body"}
+		}
+
+		if p.FileName() == "" {
+			switch p.FormName() {
+			case "online":
+				b, _ := io.ReadAll(io.LimitReader(p, 16))
+				req.Online, _ = strconv.ParseBool(strings.TrimSpace(string(b)))
+			case "label":
+				b, _ := io.ReadAll(io.LimitReader(p, 64))
+				req.Label = strings.TrimSpace(string(b))
+			case "options":
+				if err := json.NewDecoder(io.LimitReader(p, 4096)).Decode(&req.Options); err != nil {
+					return req, &httpError{code: http.StatusBadRequest, msg: "invalid options"}
+				}
+			}
+			continue
+		}
+		if len(req.URIs) >= a.maxDocuments {
+			return req, &httpError{code: http.StatusBadRequest, msg: fmt.Sprintf("too many documents, at most %d", a.maxDocuments)}
+		}
+		uri, err := a.uploadFile(ctx, p, fmt.Sprintf("%s%d-%s", uploadPrefix(id), len(req.URIs), path.Base(p.FileName())))
+		if err != nil {
+			return req, err
+		}
+		req.URIs = append(req.URIs, uri)
+	}
+}
+
+// uploadPrefix returns the upload bucket prefix of the files of a job.
+func uploadPrefix(id string) string {
+	return "uploads/" + id + "/"
+}
+
+// deleteUploads deletes the uploaded files of a rejected job. Failures are logged: the files are
+// not referenced by any job.
+func (a *api) deleteUploads(ctx context.Context, id string) {
+	itr := a.uploads.Objects(ctx, &storage.Query{Prefix: uploadPrefix(id)})
+	for {
+		attrs, err := itr.Next()
+		if err == iterator.Done {
+			return
+		}
+		if err != nil {
+			log.Error().Err(err).Caller().Str("job", id).Msg("failed to list uploads")
+			return
+		}
+		if err := a.uploads.Object(attrs.Name).Delete(ctx); err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+			log.Error().Err(err).Caller().Str("job", id).Str(logging.FieldObject, attrs.Name).Msg("failed to delete upload")
+		}
+	}
+}
+
+// uploadFile writes an uploaded file to the upload bucket object name and returns its gs:// uri.
+func (a *api) uploadFile(ctx context.Context, p *multipart.Part, name string) (string, error) {
+	if _, err := utils.GetMimeTypeFromExt(name); err != nil {
+		return "", &httpError{code: http.StatusBadRequest, msg: fmt.Sprintf("unsupported file type: %s", p.FileName())}
+	}
+
+	wc := a.uploads.Object(name).NewWriter(ctx)
+	if _, err := io.Copy(wc, p); err != nil {
+		wc.Close()
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			return "", &httpError{code: http.StatusRequestEntityTooLarge, msg: "upload too large"}
+		}
+		return "", fmt.Errorf("(%s) failed to upload: %w", name, err)
+	}
+	if err := wc.Close(); err != nil {
+		return "", fmt.Errorf("(%s) failed to upload: %w", name, err)
+	}
+	return fmt.Sprintf("gs://%s/%s", a.uploadBucket, name), nil
+}
+
+// writeJob records a job in the refs bucket.
+func (a *api) writeJob(ctx context.Context, j job) error {
+	key := a.jobsPrefix + j.ID + ".json"
+	wc := a.refs.Object(key).NewWriter(ctx)
+	wc.ContentType = "application/json"
+	if err := json.NewEncoder(wc).Encode(j); err != nil {
+		wc.Close()
+		return fmt.Errorf("(%s) failed to encode job: %w", key, err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("(%s) failed to write job: %w", key, err)
+	}
+	return nil
+}
+
+// deleteJob deletes a job record.
+func (a *api) deleteJob(ctx context.Context, id string) error {
+	key := a.jobsPrefix + id + ".json"
+	if err := a.refs.Object(key).Delete(ctx); err != nil {
+		return fmt.Errorf("(%s) failed to delete job: %w", key, err)
+	}
+	return nil
+}
+
+// readJob reads a job record. Unknown jobs are a not found httpError.
+func (a *api) readJob(ctx context.Context, id string) (job, error) {
+	var j job
+	if !jobIDRe.MatchString(id) {
+		return j, &httpError{code: http.StatusNotFound, msg: "job not found"}
+	}
+	key := a.jobsPrefix + id + ".json"
+	rd, err := a.refs.Object(key).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return j, &httpError{code: http.StatusNotFound, msg: "job not found"}
+	}
+	if err != nil {
+		return j, fmt.Errorf("(%s) failed to read job: %w", key, err)
+	}
+	defer rd.Close()
+	if err := json.NewDecoder(rd).Decode(&j); err != nil {
+		return j, fmt.Errorf("(%s) failed to decode job: %w", key, err)
+	}
+	return j, nil
+}
@@ -0,0 +1,124 @@
+// Package main is the api service. It exposes a REST API to submit ad-hoc OCR jobs, a list of gs://
+// uris or uploaded files, to poll their status and to fetch the OCR text and NLP entities of their
+// documents.
+package main
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/storage"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/docai"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/logging"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/server"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/utils"
+)
+
+func main() {
+	ctx := context.Background()
+
+	// logger
+	logging.Init("api")
+
+	// app config
+	cfg, err := getConfig()
+	if err != nil {
+		log.Fatal().Err(err).Caller().Msg("invalid config")
+	}
+
+	// pubsub client
+	c, err := pubsub.NewClient(ctx, cfg.ProjectID)
+	if err != nil {
+		log.Fatal().Err(err).Str("project", cfg.ProjectID).Caller().Msg("failed to create pubsub client")
+	}
+	defer c.Close()
+	t := c.Topic(cfg.PubsubTopicID)
+	defer t.Stop()
+
+	// create storage client
+	store, err := storage.NewClient(ctx)
+	if err != nil {
+		log.Fatal().Err(err).Caller().Msg("failed to create storage client")
+	}
+	defer store.Close()
+
+	a := &api{
+		topic: t,
+		buckets: docai.StatusBuckets{
+			Store:  store,
+			Refs:   store.Bucket(cfg.RefsBucketName),
+			OCRErr: store.Bucket(cfg.OCRErrBucketName),
+			NLPDst: store.Bucket(cfg.NLPDstBucketName),
+			NLPErr: store.Bucket(cfg.NLPErrBucketName),
+		},
+		refs:           store.Bucket(cfg.RefsBucketName),
+		uploadBucket:   cfg.UploadBucketName,
+		jobsPrefix:     cfg.JobsPrefix,
+		maxDocuments:   cfg.MaxDocuments,
+		maxUploadBytes: int64(cfg.MaxUploadBytes),
+	}
+	if cfg.UploadBucketName != "" {
+		a.uploads = store.Bucket(cfg.UploadBucketName)
+	}
+
+	server.Serve(a.routes(), cfg.Port)
+	log.Info().Caller().Msg("exit")
+}
+
+type appConfig struct {
+	Port             string
+	ProjectID        string
+	PubsubTopicID    string
+	OCRErrBucketName string
+	RefsBucketName   string
+	NLPDstBucketName string
+	NLPErrBucketName string
+	UploadBucketName string
+	JobsPrefix       string
+	MaxDocuments     int
+	MaxUploadBytes   int
+}
+
+func getConfig() (appConfig, error) {
+	var env utils.EnvReader
+
+	port := utils.GetStrEnvVar("PORT", "8080")
+
+	// gcp
+	projectID := env.Mandatory("GCP_PROJECT_ID")
+
+	// pubsub. the ocr-worker topic
+	pubsubTopicID := env.Mandatory("PUBSUB_TOPIC_ID")
+
+	// buckets of the ocr-worker and nlp-worker, read to report the job status
+	ocrErrBucketName := env.Mandatory("OCR_ERR_BUCKET_NAME")
+	refsBucketName := env.Mandatory("REFS_BUCKET_NAME")
+	nlpDstBucketName := env.Mandatory("NLP_DST_BUCKET_NAME")
+	nlpErrBucketName := env.Mandatory("NLP_ERR_BUCKET_NAME")
+
+	// uploadBucketName receives the uploaded files. Uploads are disabled when empty
+	uploadBucketName := utils.GetStrEnvVar("UPLOAD_BUCKET_NAME", "")
+
+	// jobsPrefix is the refs bucket prefix of the job records
+	jobsPrefix := utils.GetStrEnvVar("JOBS_PREFIX", "jobs/")
+
+	// limits
+	maxDocuments := env.Int("MAX_DOCUMENTS", 100)
+	maxUploadBytes := env.Int("MAX_UPLOAD_BYTES", 32<<20)
+
+	return appConfig{
+		Port:             port,
+		ProjectID:        projectID,
+		PubsubTopicID:    pubsubTopicID,
+		OCRErrBucketName: ocrErrBucketName,
+		RefsBucketName:   refsBucketName,
+		NLPDstBucketName: nlpDstBucketName,
+		NLPErrBucketName: nlpErrBucketName,
+		UploadBucketName: uploadBucketName,
+		JobsPrefix:       jobsPrefix,
+		MaxDocuments:     maxDocuments,
+		MaxUploadBytes:   maxUploadBytes,
+	}, env.Err()
+}
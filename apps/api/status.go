@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/docai"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/server"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+)
+
+// Document statuses, see docai.ReadStatus, and job statuses.
+const (
+	statusPending   = docai.StatusPending
+	statusOCRFailed = docai.StatusOCRFailed
+	statusAnalyzing = docai.StatusAnalyzing
+	statusNLPFailed = docai.StatusNLPFailed
+	statusDone      = docai.StatusDone
+	// statusFailed jobs have no pending document and at least a failed one.
+	statusFailed = "failed"
+)
+
+// documentStatus is the status of a document of a job.
+type documentStatus struct {
+	URI    string `json:"uri"`
+	Status string `json:"status"`
+	// OCROutput is the gs://<bucket>/<op-id>/<index> Document AI output of the document.
+	OCROutput string `json:"ocr_output,omitempty"`
+	// NLPOutput is the gs:// uri of the nlp-worker output.
+	NLPOutput string             `json:"nlp_output,omitempty"`
+	Error     *types.ErrorRecord `json:"error,omitempty"`
+
+	// outputs are the OCR output objects, one per shard, in ocrBucket
+	outputs   []string
+	ocrBucket string
+	// nlpName is the nlp-worker output object name
+	nlpName string
+}
+
+// jobStatus is the status of a job: done once every document is done or failed.
+type jobStatus struct {
+	job
+	Status    string           `json:"status"`
+	Counts    map[string]int   `json:"counts"`
+	Documents []documentStatus `json:"document_status"`
+}
+
+// aggregateStatus returns the status of a job from the status of its documents, and the number of
+// documents in each status.
+func aggregateStatus(docs []documentStatus) (string, map[string]int) {
+	counts := map[string]int{}
+	for _, d := range docs {
+		counts[d.Status]++
+	}
+	switch {
+	case counts[statusPending]+counts[statusAnalyzing] > 0:
+		return statusPending, counts
+	case counts[statusOCRFailed]+counts[statusNLPFailed] > 0:
+		return statusFailed, counts
+	}
+	return statusDone, counts
+}
+
+func (a *api) getJob(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	j, err := a.readJob(ctx, r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	res := jobStatus{job: j, Documents: make([]documentStatus, len(j.Documents))}
+	for i, uri := range j.Documents {
+		if res.Documents[i], err = a.documentStatus(ctx, uri); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+	res.Status, res.Counts = aggregateStatus(res.Documents)
+	server.WriteJSON(w, http.StatusOK, res)
+}
+
+// documentStatus reads the status of a document from the refs and err buckets of the ocr-worker
+// and the dst and err buckets of the nlp-worker.
+func (a *api) documentStatus(ctx context.Context, uri string) (documentStatus, error) {
+	st, err := docai.ReadStatus(ctx, a.buckets, strings.TrimPrefix(uri, "gs://"), "")
+	s := documentStatus{
+		URI:       uri,
+		Status:    st.Status,
+		OCROutput: st.OCROutput,
+		Error:     st.Error,
+		outputs:   st.Outputs,
+		ocrBucket: st.OCRBucket,
+		nlpName:   st.NLPName,
+	}
+	if err != nil {
+		return s, err
+	}
+	if s.Status == statusDone {
+		s.NLPOutput = fmt.Sprintf("gs://%s/%s", a.buckets.NLPDst.BucketName(), s.nlpName)
+	}
+	if s.Error != nil {
+		// stacks are not exposed
+		e := *s.Error
+		e.Stack = ""
+		s.Error = &e
+	}
+	return s, nil
+}
+
+// getText writes the OCR text of a document, as plain text.
+func (a *api) getText(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	s, err := a.jobDocument(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if len(s.outputs) == 0 {
+		writeError(w, r, &httpError{code: http.StatusConflict, msg: fmt.Sprintf("document not OCR'd: %s", s.Status)})
+		return
+	}
+
+	doc, complete, err := docai.LoadDocument(ctx, a.buckets.Store.Bucket(s.ocrBucket), s.outputs[0])
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if !complete {
+		writeError(w, r, &httpError{code: http.StatusConflict, msg: "document shards pending"})
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, doc.GetText())
+}
+
+// getEntities writes the NLP entities of a document.
+func (a *api) getEntities(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	s, err := a.jobDocument(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if s.Status != statusDone {
+		writeError(w, r, &httpError{code: http.StatusConflict, msg: fmt.Sprintf("document not analyzed: %s", s.Status)})
+		return
+	}
+
+	rd, err := a.buckets.NLPDst.Object(s.nlpName).NewReader(ctx)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("(%s) failed to read nlp output: %w", s.nlpName, err))
+		return
+	}
+	defer rd.Close()
+
+	// the entities are passed through as written by the nlp-worker
+	var out struct {
+		Entities json.RawMessage `json:"entities"`
+	}
+	if err := json.NewDecoder(rd).Decode(&out); err != nil {
+		writeError(w, r, fmt.Errorf("(%s) failed to decode nlp output: %w", s.nlpName, err))
+		return
+	}
+	if out.Entities == nil {
+		out.Entities = json.RawMessage("[]")
+	}
+	server.WriteJSON(w, http.StatusOK, out)
+}
+
+// jobDocument returns the status of the document {n} of the job {id}.
+func (a *api) jobDocument(r *http.Request) (documentStatus, error) {
+	j, err := a.readJob(r.Context(), r.PathValue("id"))
+	if err != nil {
+		return documentStatus{}, err
+	}
+	n, err := documentIndex(r, len(j.Documents))
+	if err != nil {
+		return documentStatus{}, err
+	}
+	return a.documentStatus(r.Context(), j.Documents[n])
+}
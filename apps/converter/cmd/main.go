@@ -0,0 +1,17 @@
+// Package main is the main application for the converter local cmd
+package main
+
+import (
+	"github.com/rs/zerolog/log"
+
+	"github.com/GoogleCloudPlatform/functions-framework-go/funcframework"
+	_ "github.com/cyber-nic/go-gcp-doc-ai/apps/converter"
+)
+
+func main() {
+	// The server will run on port 8080
+	port := "8080"
+	if err := funcframework.Start(port); err != nil {
+		log.Fatal().Err(err).Caller().Msg("funcframework.Start")
+	}
+}
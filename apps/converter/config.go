@@ -0,0 +1,61 @@
+package converter
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/convert"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/utils"
+)
+
+type appConfig struct {
+	Debug          bool
+	DstBucketName  string
+	ErrBucketName  string
+	RefsBucketName string
+	// Formats are the output formats, see convert.Formats.
+	Formats []convert.Format
+	// PDFDPI is the resolution of the source images, sizing the searchable pdf pages.
+	PDFDPI int
+	// MaxImageBytes bounds the source images read for the searchable pdf.
+	MaxImageBytes int64
+	// Timeout is the processing budget of an invocation, under the function timeout.
+	Timeout time.Duration
+}
+
+// getConfig reads the converter config from the env. All the invalid env vars are reported
+// together, see utils.EnvReader.
+func getConfig() (appConfig, error) {
+	var env utils.EnvReader
+
+	debug := utils.GetBoolEnvVar("DEBUG", false)
+
+	// buckets
+	dstBucketName := env.Mandatory("DST_BUCKET_NAME")
+	errBucketName := env.Mandatory("ERR_BUCKET_NAME")
+	// refsBucketName is the ocr-worker refs bucket, holding the operation manifests
+	refsBucketName := env.Mandatory("REFS_BUCKET_NAME")
+
+	// formats
+	formats, err := convert.ParseFormats(utils.GetStrEnvVar("CONVERT_FORMATS", "txt,md,hocr,alto,pdf"))
+	if err != nil {
+		env.Fail(fmt.Errorf("env var CONVERT_FORMATS: %w", err))
+	}
+	pdfDPI := env.Int("CONVERT_PDF_DPI", convert.DefaultDPI)
+	maxImageBytes := env.Int("CONVERT_MAX_IMAGE_BYTES", 20<<20)
+
+	// timeout, the conversion budget. Under the 120s function timeout, leaving time to write the
+	// error record
+	timeout := env.Int("CONVERT_TIMEOUT_SECONDS", 110)
+
+	return appConfig{
+		Debug:          debug,
+		DstBucketName:  dstBucketName,
+		ErrBucketName:  errBucketName,
+		RefsBucketName: refsBucketName,
+		Formats:        formats,
+		PDFDPI:         pdfDPI,
+		MaxImageBytes:  int64(maxImageBytes),
+		Timeout:        time.Duration(timeout) * time.Second,
+	}, env.Err()
+}
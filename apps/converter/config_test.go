@@ -0,0 +1,47 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/convert"
+)
+
+func TestGetConfig(t *testing.T) {
+	t.Setenv("DST_BUCKET_NAME", "dst")
+	t.Setenv("ERR_BUCKET_NAME", "err")
+	t.Setenv("REFS_BUCKET_NAME", "refs")
+
+	// happy path. defaults
+	cfg, err := getConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Timeout != 110*time.Second || len(cfg.Formats) != len(convert.Formats) || cfg.PDFDPI != convert.DefaultDPI {
+		t.Fatalf("expected: default config, result: %+v", cfg)
+	}
+
+	// every misconfiguration is reported
+	t.Setenv("REFS_BUCKET_NAME", "")
+	t.Setenv("CONVERT_FORMATS", "txt,docx")
+	_, err = getConfig()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, v := range []string{"REFS_BUCKET_NAME", "CONVERT_FORMATS"} {
+		if !strings.Contains(err.Error(), v) {
+			t.Fatalf("expected: %s reported, result: %v", v, err)
+		}
+	}
+}
+
+func TestOutputName(t *testing.T) {
+	name, err := outputName("gs://src/scans/a.jpg", convert.FormatALTO)
+	if err != nil || name != "src/scans/a.jpg.alto.xml" {
+		t.Fatalf("unexpected output name: %s, %v", name, err)
+	}
+	if _, err := outputName("src/a.jpg", convert.FormatText); err == nil {
+		t.Fatal("expected an error")
+	}
+}
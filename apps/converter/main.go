@@ -0,0 +1,230 @@
+// Package converter is the main application for the converter service. It is triggered by a storage bucket Finalize event on the OCR output bucket. It converts the Document AI output into plain text, Markdown, hOCR, ALTO and searchable PDF files, per source image.
+package converter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/convert"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/docai"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/function"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/logging"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/telemetry"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// cfg is the converter config, read when the instance starts. cfgErr is returned by the
+// invocations of a misconfigured instance, so that the reason shows in the function errors.
+var (
+	cfg    appConfig
+	cfgErr error
+)
+
+// storeClient is created by the first invocation and reused by the next ones.
+var storeClient function.StorageClient
+
+func init() {
+	function.Init("converter", handler)
+	if cfg, cfgErr = getConfig(); cfgErr != nil {
+		log.Error().Err(cfgErr).Caller().Msg("invalid config")
+	}
+}
+
+// handler is the cloud function entrypoint
+func handler(ctx context.Context, e event.Event) (err error) {
+	// export this invocation's spans before the instance is frozen
+	defer function.Flush(ctx)
+
+	// app config
+	if cfgErr != nil {
+		return fmt.Errorf("invalid config: %w", cfgErr)
+	}
+
+	// invocation budget
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	// unmarshal event data
+	data, err := function.DecodeFinalized(e)
+	if err != nil {
+		return err
+	}
+
+	store, err := storeClient.Get()
+	if err != nil {
+		return err
+	}
+	errBucket := store.Bucket(cfg.ErrBucketName)
+	s, f := data.GetBucket(), data.GetName()
+
+	// map the document back to its source images and continue the trace of the ocr batch, see the
+	// nlp-worker. Lookup errors are handled once the document is complete.
+	src, srcErr := docai.FindSource(ctx, store.Bucket(cfg.RefsBucketName), s, f)
+	ctx, span := telemetry.Tracer().Start(telemetry.Extract(ctx, src.TraceContext), "converter.handle",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("gcs.bucket", s),
+			attribute.String("gcs.object", f),
+			attribute.Int64("gcs.generation", data.GetGeneration()),
+		),
+	)
+	ctx = log.With().Str(logging.FieldObject, f).Logger().WithContext(ctx)
+	defer func() {
+		if err != nil {
+			log.Error().Err(err).Caller().Str(logging.FieldObject, f).Msg("failed to convert document")
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "failed to convert document")
+		}
+		span.End()
+	}()
+
+	// load the document once all its shards are written, see the nlp-worker
+	doc, complete, err := docai.LoadDocument(ctx, store.Bucket(s), f)
+	if err != nil {
+		m := fmt.Sprintf("failed to load document (%s/%s)", s, f)
+		function.RecordError(ctx, errBucket, types.ErrorStageConvert, s, f, data.GetGeneration(), m, err)
+		return fmt.Errorf("%s: %w", m, err)
+	}
+	if !complete {
+		log.Info().Str(logging.FieldObject, f).Msg("waiting for remaining document shards")
+		return nil
+	}
+
+	err = srcErr
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		// the manifest is written right after the operation is submitted. Let the event be retried.
+		return fmt.Errorf("ocr manifest not found (%s/%s): %w", s, f, err)
+	}
+	if err != nil {
+		m := fmt.Sprintf("failed to map document to its source (%s/%s)", s, f)
+		function.RecordError(ctx, errBucket, types.ErrorStageConvert, s, f, data.GetGeneration(), m, err)
+		return fmt.Errorf("%s: %w", m, err)
+	}
+	sources := src.SourceURIs
+	if len(sources) == 0 {
+		sources = []string{src.URI}
+	}
+
+	// the submitted image, overlaid by the searchable pdf. The sources share its content.
+	var img []byte
+	if needsImage(cfg.Formats) {
+		if img, err = readImage(ctx, store, src.URI, cfg.MaxImageBytes); err != nil {
+			log.Warn().Err(err).Str(logging.FieldObject, f).Str("image", src.URI).Msg("failed to read source image, skipping pdf")
+		}
+	}
+
+	dst := store.Bucket(cfg.DstBucketName)
+	written := 0
+	for _, uri := range sources {
+		for _, format := range cfg.Formats {
+			ok, err := writeOutput(ctx, dst, doc, src.Output, uri, format, img)
+			if err != nil {
+				m := fmt.Sprintf("failed to write %s output of %s (%s/%s)", format, uri, s, f)
+				function.RecordError(ctx, errBucket, types.ErrorStageConvert, s, f, data.GetGeneration(), m, err)
+				return fmt.Errorf("%s: %w", m, err)
+			}
+			if ok {
+				written++
+			}
+		}
+	}
+	span.SetAttributes(attribute.Int("converter.outputs", written))
+	log.Info().Str(logging.FieldObject, f).Int("outputs", written).Int("sources", len(sources)).Msg("document converted")
+	return nil
+}
+
+// writeOutput converts a document to a format and writes it as the output of the source image uri.
+// Outputs already converted from the same, or a later, generation of the OCR document are skipped,
+// as are formats the document cannot be converted to. It reports whether the output was written.
+func writeOutput(ctx context.Context, dst *storage.BucketHandle, doc *docai.Document, ocrOutput, uri string, f convert.Format, img []byte) (bool, error) {
+	name, err := outputName(uri, f)
+	if err != nil {
+		return false, err
+	}
+
+	o := dst.Object(name)
+	conds, processed, err := docai.OutputConditions(ctx, o, ocrOutput, doc.Generation)
+	if err != nil {
+		return false, err
+	}
+	if processed {
+		log.Debug().Str("output", name).Msg("output already converted, skipping")
+		return false, nil
+	}
+
+	b, err := convert.Convert(doc.Document, f, convert.Options{ImageName: path.Base(uri), Image: img, DPI: cfg.PDFDPI})
+	if errors.Is(err, convert.ErrUnsupported) {
+		log.Info().Err(err).Str("output", name).Msg("unsupported conversion, skipping")
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// the preconditions fail if another invocation wrote the output since it was checked
+	wc := o.If(conds).NewWriter(ctx)
+	wc.ContentType = f.ContentType()
+	wc.Metadata = docai.OutputMetadata(ocrOutput, doc.Generation)
+	if _, err := wc.Write(b); err != nil {
+		wc.Close()
+		return false, fmt.Errorf("failed to write (%s): %w", name, err)
+	}
+	if err := wc.Close(); err != nil {
+		if utils.IsPreconditionFailed(err) {
+			log.Info().Str("output", name).Msg("output written concurrently, skipping")
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to close writer (%s): %w", name, err)
+	}
+	return true, nil
+}
+
+// outputName returns the dst bucket name of the output of the source image gs://<bucket>/<path>,
+// <bucket>/<path>.<ext>.
+func outputName(uri string, f convert.Format) (string, error) {
+	bucket, name, ok := strings.Cut(strings.TrimPrefix(uri, "gs://"), "/")
+	if !ok || bucket == "" || name == "" || !strings.HasPrefix(uri, "gs://") {
+		return "", fmt.Errorf("invalid source uri: %s", uri)
+	}
+	return fmt.Sprintf("%s/%s.%s", bucket, name, f.Extension()), nil
+}
+
+// needsImage reports whether a format requires the source image.
+func needsImage(formats []convert.Format) bool {
+	for _, f := range formats {
+		if f == convert.FormatPDF {
+			return true
+		}
+	}
+	return false
+}
+
+// readImage reads the source image gs:// uri, of at most max bytes.
+func readImage(ctx context.Context, store *storage.Client, uri string, max int64) ([]byte, error) {
+	bucket, name, ok := strings.Cut(strings.TrimPrefix(uri, "gs://"), "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid source uri: %s", uri)
+	}
+	r, err := store.Bucket(bucket).Object(name).NewReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reader: %w", err)
+	}
+	defer r.Close()
+	if r.Attrs.Size > max {
+		return nil, fmt.Errorf("image too large: %d bytes", r.Attrs.Size)
+	}
+	return io.ReadAll(r)
+}
@@ -9,10 +9,12 @@ import (
 	"hash"
 	"image"
 	"io"
-	"log"
 	"os"
+	"path/filepath"
 	"slices"
 
+	"github.com/rs/zerolog/log"
+
 	// Import image format packages
 
 	_ "image/jpeg"
@@ -20,8 +22,10 @@ import (
 
 	"cloud.google.com/go/firestore"
 	"cloud.google.com/go/storage"
-	"github.com/cyber-nic/go-gcp-doc-ai/apps/deduper/libs/types"
-	"github.com/cyber-nic/go-gcp-doc-ai/apps/deduper/libs/utils"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/ingest"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/logging"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/utils"
 	"google.golang.org/api/iterator"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -34,6 +38,16 @@ type fileDocument struct {
 func main() {
 	ctx := context.Background()
 
+	// logger
+	logging.Init("deduper")
+
+	// local mode. SRC_PATH is a local directory or a tar or zip archive of images, hashed without
+	// firestore nor buckets
+	if src := utils.GetStrEnvVar("SRC_PATH", ""); src != "" {
+		runLocal(src)
+		return
+	}
+
 	// input
 	projectID := getMandatoryEnvVar("GCP_PROJECT_ID")
 	fireDatabaseID := getMandatoryEnvVar("FIRESTORE_DATABASE_ID")
@@ -52,7 +66,7 @@ func main() {
 	// Initialize Firestore client.
 	fire, err := firestore.NewClientWithDatabase(ctx, projectID, fireDatabaseID)
 	if err != nil {
-		log.Fatalf("failed to create Firestore client: %v", err)
+		log.Fatal().Err(err).Caller().Msg("failed to create Firestore client")
 	}
 	defer fire.Close()
 
@@ -62,7 +76,7 @@ func main() {
 	// Create storage client.
 	store, err := storage.NewClient(ctx)
 	if err != nil {
-		log.Fatalf("failed to create storage client: %v", err)
+		log.Fatal().Err(err).Caller().Msg("failed to create storage client")
 	}
 	defer store.Close()
 
@@ -74,7 +88,7 @@ func main() {
 	checkpointObj := store.Bucket(checkpointBucketName).Object(checkpointFilename)
 	// read value
 	checkpoint := utils.GetValueFromBucketFile(ctx, checkpointObj)
-	log.Printf("(checkpoint) %s\n", checkpoint)
+	log.Info().Str("checkpoint", checkpoint).Msgf("(checkpoint) %s", checkpoint)
 
 	// Iterate through all objects in the bucket.
 	bucket := store.Bucket(bucketName)
@@ -90,22 +104,22 @@ func main() {
 	for {
 		attrs, err := itr.Next()
 		if err == iterator.Done {
-			log.Println("iterator done")
+			log.Info().Msg("iterator done")
 			break
 		}
 		if err != nil {
-			log.Fatalf("failed to iterate bucket objects: %v", err)
+			log.Fatal().Err(err).Caller().Msg("failed to iterate bucket objects")
 		}
 
 		// itr control
 		fileIdx++
 		if maxFiles > 0 && fileIdx >= maxFiles {
-			log.Printf("MAX FILES REACHED: %d of %d\n", fileIdx, maxFiles)
+			log.Info().Int("files", fileIdx).Int("max", maxFiles).Msg("MAX FILES REACHED")
 			break
 		}
 
 		if !checkpointReached && fileIdx%progressCount == 0 {
-			log.Printf("%d files processed (%d skipped)\n", fileIdx, skippedIdx)
+			log.Info().Int("files", fileIdx).Int("skipped", skippedIdx).Msgf("%d files processed (%d skipped)", fileIdx, skippedIdx)
 		}
 
 		// if checkpoint, skip until checkpoint
@@ -118,21 +132,45 @@ func main() {
 
 		// update checkpoint every `progressCount` files (ie. ~1,000)
 		if fileIdx%progressCount == 0 && checkpoint != attrs.Name {
-			log.Printf("%d files processed (%d skipped) : (checkpoint) next: %s\n", fileIdx, skippedIdx, attrs.Name)
+			log.Info().Int("files", fileIdx).Int("skipped", skippedIdx).Str("next", attrs.Name).Msgf("%d files processed (%d skipped) : (checkpoint) next: %s", fileIdx, skippedIdx, attrs.Name)
 			utils.SetBucketFileValue(ctx, checkpointObj, attrs.Name)
 		}
 
 		// process
 		err = processFile(ctx, hasher, images, files, bucket, attrs)
 		if err != nil && status.Code(err) == codes.PermissionDenied {
-			log.Fatalf("%v", err)
+			log.Fatal().Err(err).Caller().Str(logging.FieldObject, attrs.Name).Msg("permission denied")
 		}
 
 		// reset hasher
 		hasher.Reset()
 	}
 
-	log.Println("done")
+	log.Info().Msg("done")
+}
+
+// runLocal writes the index of the unique images of a local source to OUT_DIR, see ingest.Index.
+func runLocal(src string) {
+	outDir := utils.GetStrEnvVar("OUT_DIR", "out")
+	pattern := utils.GetStrEnvVar("SRC_GLOB", "**/*.jpg")
+
+	docs, err := ingest.Index(src, pattern)
+	if err != nil {
+		log.Fatal().Err(err).Caller().Str("src", src).Msg("failed to index source")
+	}
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		log.Fatal().Err(err).Caller().Str("dir", outDir).Msg("failed to create output dir")
+	}
+	index := filepath.Join(outDir, ingest.IndexFile)
+	if err := ingest.WriteIndex(index, docs); err != nil {
+		log.Fatal().Err(err).Caller().Msg("failed to write index")
+	}
+
+	files := 0
+	for _, d := range docs {
+		files += len(d.ImagePaths)
+	}
+	log.Info().Int("files", files).Int("images", len(docs)).Str("index", index).Msg("done")
 }
 
 func processFile(
@@ -151,28 +189,28 @@ func processFile(
 	fileRef := files.Doc(filename)
 	_, err := fileRef.Get(ctx)
 	if err == nil {
-		// log.Printf("Skip %s", attrs.Name)
+		log.Debug().Str(logging.FieldObject, attrs.Name).Msg("skip")
 		return nil
 	}
 	// fail if err but continue on NotFound
 	if err != nil && status.Code(err) != codes.NotFound {
-		log.Printf("failed to get document (%s): %s %v", filename, status.Code(err), err)
+		log.Error().Err(err).Caller().Str(logging.FieldObject, attrs.Name).Str("code", status.Code(err).String()).Msg("failed to get document")
 		return err
 	}
 
 	// skip a few empty files
 	if attrs.Size == 0 {
-		// log.Printf("Skip empty %s", attrs.Name)
+		log.Debug().Str(logging.FieldObject, attrs.Name).Msg("skip empty")
 		return nil
 	}
 
 	// Compute image hash.
-	// log.Printf("Process %s", attrs.Name)
+	log.Debug().Str(logging.FieldObject, attrs.Name).Msg("process")
 
 	// mime type
 	mimeType, err := utils.GetMimeTypeFromExt(attrs.Name)
 	if err != nil {
-		log.Print(err)
+		log.Error().Err(err).Caller().Str(logging.FieldObject, attrs.Name).Msg("failed to get mime type")
 		return err
 	}
 
@@ -182,7 +220,7 @@ func processFile(
 	// Creates a Reader to enable reading te object contents.
 	reader, err := obj.NewReader(ctx)
 	if err != nil {
-		log.Printf("Failed to download object: %v (%s)", err, attrs.Name)
+		log.Error().Err(err).Caller().Str(logging.FieldObject, attrs.Name).Msg("failed to download object")
 		return err
 	}
 	defer reader.Close()
@@ -191,7 +229,7 @@ func processFile(
 	buf := new(bytes.Buffer)
 	_, err = io.Copy(buf, reader)
 	if err != nil {
-		log.Printf("Failed to read image content: %v (%s)", err, attrs.Name)
+		log.Error().Err(err).Caller().Str(logging.FieldObject, attrs.Name).Msg("failed to read image content")
 		return err
 	}
 	// if used directly, the buffer pointer will be at the end of the buffer at the end of the read.
@@ -205,7 +243,7 @@ func processFile(
 	img, _, err := image.Decode(bytes.NewReader(buf.Bytes()))
 	if err != nil {
 		// todo: Printf
-		log.Printf("failed to decode image: %v (%s)", err, attrs.Name)
+		log.Error().Err(err).Caller().Str(logging.FieldObject, attrs.Name).Msg("failed to decode image")
 		return err
 	}
 
@@ -217,13 +255,13 @@ func processFile(
 	// get hash
 	hash := computeHash(hasher, bytes.NewReader(buf.Bytes()))
 
-	// log.Println("hash", hash, "width", width, "height", height, "pixels", pixels)
+	log.Debug().Str(logging.FieldObject, attrs.Name).Str(logging.FieldHash, hash).Int("width", width).Int("height", height).Int("pixels", pixels).Msg("hashed")
 
 	// Check if hash exists in Firestore.
 	imgRef := images.Doc(hash)
 	imgSnap, err := imgRef.Get(ctx)
 	if err != nil && status.Code(err) != codes.NotFound {
-		log.Printf("failed to get processed document: %v (%s)", err, attrs.Name)
+		log.Error().Err(err).Caller().Str(logging.FieldObject, attrs.Name).Str(logging.FieldHash, hash).Msg("failed to get processed document")
 		return err
 	}
 
@@ -237,24 +275,28 @@ func processFile(
 			Pixels:     pixels,
 			Size:       attrs.Size,
 			ImagePaths: []string{attrs.Name},
+			Created:    attrs.Created,
 		})
 		if err != nil {
-			log.Printf("failed to set fire doc: %v (%s)", err, attrs.Name)
+			log.Error().Err(err).Caller().Str(logging.FieldObject, attrs.Name).Str(logging.FieldHash, hash).Msg("failed to set fire doc")
 			return err
 		}
 	} else {
 		imageDoc := &types.ImageDocument{}
 		err = imgSnap.DataTo(imageDoc)
 		if err != nil {
-			log.Printf("failed to decode fire doc: %v (%s)", err, attrs.Name)
+			log.Error().Err(err).Caller().Str(logging.FieldObject, attrs.Name).Str(logging.FieldHash, hash).Msg("failed to decode fire doc")
 			return err
 			// break
 		}
 		if !slices.Contains(imageDoc.ImagePaths, attrs.Name) {
 			imageDoc.ImagePaths = append(imageDoc.ImagePaths, attrs.Name)
+			if imageDoc.Created.IsZero() || attrs.Created.Before(imageDoc.Created) {
+				imageDoc.Created = attrs.Created
+			}
 			_, err = imgRef.Set(ctx, imageDoc)
 			if err != nil {
-				log.Printf("failed to set fire doc: %v (%s)", err, attrs.Name)
+				log.Error().Err(err).Caller().Str(logging.FieldObject, attrs.Name).Str(logging.FieldHash, hash).Msg("failed to set fire doc")
 				return err
 			}
 		}
@@ -264,7 +306,7 @@ func processFile(
 	if _, err = fileRef.Set(ctx, &fileDocument{
 		hash,
 	}); err != nil {
-		log.Printf("failed to create file ref: %v (%s)", err, attrs.Name)
+		log.Error().Err(err).Caller().Str(logging.FieldObject, attrs.Name).Str(logging.FieldHash, hash).Msg("failed to create file ref")
 		return err
 	}
 
@@ -274,7 +316,7 @@ func processFile(
 func computeHash(hasher hash.Hash, r *bytes.Reader) string {
 	_, err := io.Copy(hasher, r)
 	if err != nil {
-		log.Printf("Failed to compute hash: %v", err)
+		log.Error().Err(err).Caller().Msg("failed to compute hash")
 		return ""
 	}
 
@@ -284,7 +326,7 @@ func computeHash(hasher hash.Hash, r *bytes.Reader) string {
 func getMandatoryEnvVar(n string) string {
 	v, ok := os.LookupEnv(n)
 	if !ok || v == "" {
-		log.Printf("env var %s required", n)
+		log.Error().Caller().Msgf("env var %s required", n)
 	}
 	return v
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/cost"
+)
+
+// pagesPerImage is the number of pages of an image document. The deduper only indexes single
+// frame raster images.
+const pagesPerImage = 1
+
+// budget tracks the work dispatched by a run and caps it. Zero caps are unlimited.
+type budget struct {
+	prices   cost.Prices
+	usage    cost.Usage
+	maxPages int64
+	maxCost  float64
+}
+
+func newBudget(cfg appConfig) *budget {
+	return &budget{
+		prices: cfg.Prices,
+		usage: cost.Usage{
+			CharactersPerPage: int64(cfg.CharactersPerPage),
+			Analyses:          cfg.NLPAnalyses,
+		},
+		maxPages: int64(cfg.BudgetPages),
+		maxCost:  cfg.BudgetCost,
+	}
+}
+
+// add adds a document of pages to the usage. It returns false, leaving the usage unchanged, when
+// the document would exceed the budget.
+func (b *budget) add(pages int64) bool {
+	u := b.usage
+	u.Documents++
+	u.Pages += pages
+	if b.maxPages > 0 && u.Pages > b.maxPages {
+		return false
+	}
+	if b.maxCost > 0 && b.prices.Estimate(u).Total > b.maxCost {
+		return false
+	}
+	b.usage = u
+	return true
+}
+
+// estimate returns the estimated cost of the usage.
+func (b *budget) estimate() cost.Estimate {
+	return b.prices.Estimate(b.usage)
+}
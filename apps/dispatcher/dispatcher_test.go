@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/cost"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/dispatch"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+)
+
+func testConfig() appConfig {
+	return appConfig{
+		Prices:            cost.Prices{Currency: "USD", OCR: []cost.Tier{{Price: 1000}}},
+		CharactersPerPage: 2000,
+	}
+}
+
+func TestBudget(t *testing.T) {
+	tests := map[string]struct {
+		pages  int
+		cost   float64
+		expect int64
+	}{
+		"unlimited": {expect: 10},
+		"pages":     {pages: 3, expect: 3},
+		// a page costs 1
+		"cost":       {cost: 4.5, expect: 4},
+		"both":       {pages: 2, cost: 4.5, expect: 2},
+		"first page": {cost: 0.5, expect: 0},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.BudgetPages, cfg.BudgetCost = tc.pages, tc.cost
+			b := newBudget(cfg)
+			var n int64
+			for range 10 {
+				if !b.add(pagesPerImage) {
+					break
+				}
+				n++
+			}
+			if n != tc.expect || b.usage.Pages != tc.expect || b.usage.Documents != tc.expect {
+				t.Fatalf("expected: %d, result: %d, usage: %+v", tc.expect, n, b.usage)
+			}
+		})
+	}
+}
+
+func TestPlanReport(t *testing.T) {
+	cfg := testConfig()
+	cfg.BudgetPages = 2
+	r := newPlanReport(cfg, "h0")
+
+	r.add(types.ImageDocument{Hash: "h1", MimeType: "image/png", ImagePaths: []string{"a.png"}}, true)
+	for _, img := range []types.ImageDocument{
+		{Hash: "h2", MimeType: "image/png", ImagePaths: []string{"b.png", "copy/b.png"}, Size: 10},
+		{Hash: "h3", MimeType: "image/jpeg", ImagePaths: []string{"c.jpg"}, Size: 20},
+		{Hash: "h4", MimeType: "image/png", ImagePaths: []string{"d.png"}, Size: 30},
+	} {
+		r.add(img, false)
+	}
+	r.finish()
+
+	if r.Scanned != 4 || r.Dispatched != 1 || r.Images != 3 || r.Files != 4 || r.Pages != 3 || r.Bytes != 60 {
+		t.Fatalf("unexpected report: %+v", r)
+	}
+	if r.MimeTypes["image/png"] != 2 || r.MimeTypes["image/jpeg"] != 1 {
+		t.Fatalf("unexpected mime types: %v", r.MimeTypes)
+	}
+	if r.Estimate.Total != 3 || r.Budget == nil || r.Budget.Images != 2 || r.Budget.Estimate.Total != 2 {
+		t.Fatalf("unexpected estimates: %+v, budget: %+v", r.Estimate, r.Budget)
+	}
+
+	// no budget
+	if r := newPlanReport(testConfig(), ""); r.Budget != nil {
+		t.Fatalf("unexpected budget: %+v", r.Budget)
+	}
+
+	// filtered
+	cfg = testConfig()
+	cfg.Filter = filter{MimeTypes: []string{"image/jpeg"}}
+	r = newPlanReport(cfg, "")
+	r.add(types.ImageDocument{Hash: "h1", MimeType: "image/png"}, false)
+	r.add(types.ImageDocument{Hash: "h2", MimeType: "image/jpeg"}, false)
+	if r.Scanned != 2 || r.Filtered != 1 || r.Images != 1 {
+		t.Fatalf("unexpected report: %+v", r)
+	}
+}
+
+func TestSampler(t *testing.T) {
+	// 1000 images: 900 png under a/, 100 jpeg under b/c/
+	var imgs []types.ImageDocument
+	for i := range 1000 {
+		img := types.ImageDocument{Hash: fmt.Sprintf("h%04d", i), MimeType: "image/png", ImagePaths: []string{fmt.Sprintf("a/x/%d.png", i)}}
+		if i%10 == 0 {
+			img.MimeType, img.ImagePaths = "image/jpeg", []string{fmt.Sprintf("b/c/%d.jpg", i)}
+		}
+		imgs = append(imgs, img)
+	}
+	sample := func(cfg appConfig) map[string]int {
+		res := map[string]int{}
+		s := newSampler(cfg)
+		for _, img := range imgs {
+			if s.keep(img) {
+				res[img.MimeType]++
+			}
+		}
+		return res
+	}
+
+	// no sampling
+	if s := newSampler(appConfig{}); s != nil {
+		t.Fatalf("unexpected sampler: %+v", s)
+	}
+
+	// random, the same images for a seed
+	cfg := appConfig{SampleRate: 0.1, SampleBy: sampleByNone, SampleSeed: "s"}
+	res := sample(cfg)
+	if n := res["image/png"] + res["image/jpeg"]; n < 50 || n > 150 {
+		t.Fatalf("unexpected random sample: %v", res)
+	}
+	if again := sample(cfg); fmt.Sprint(again) != fmt.Sprint(res) {
+		t.Fatalf("expected the same sample: %v, result: %v", res, again)
+	}
+
+	// stratified, in proportion and the first image of each stratum
+	tests := map[string]struct {
+		cfg    appConfig
+		expect map[string]int
+	}{
+		"mime type": {cfg: appConfig{SampleRate: 0.01, SampleBy: sampleByMimeType}, expect: map[string]int{"image/png": 9, "image/jpeg": 1}},
+		"prefix":    {cfg: appConfig{SampleRate: 0.1, SampleBy: sampleByPrefix, SamplePrefixDepth: 1}, expect: map[string]int{"image/png": 90, "image/jpeg": 10}},
+		"all":       {cfg: appConfig{SampleRate: 1, SampleBy: sampleByPrefix, SamplePrefixDepth: 2}, expect: map[string]int{"image/png": 900, "image/jpeg": 100}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if res := sample(tc.cfg); fmt.Sprint(tc.expect) != fmt.Sprint(res) {
+				t.Fatalf("expected: %v, result: %v", tc.expect, res)
+			}
+		})
+	}
+}
+
+func TestSamplerStratum(t *testing.T) {
+	s := &sampler{by: sampleByPrefix, depth: 2}
+	tests := map[string]string{"a/b/c/d.png": "a/b", "a/d.png": "a", "d.png": ""}
+	for p, expect := range tests {
+		if res := s.stratum(types.ImageDocument{ImagePaths: []string{p}}); res != expect {
+			t.Fatalf("%s: expected: %q, result: %q", p, expect, res)
+		}
+	}
+}
+
+func TestDryRunOutput(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "dry-run.ndjson")
+	out, err := newDryRunOutput(name, "high")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 2; i++ {
+		if err := out.write([]dispatch.Document{{URI: fmt.Sprintf("gs://src/%d.png", i), Hash: fmt.Sprint(i)}}, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := out.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var batches []dryRunBatch
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var b dryRunBatch
+		if err := json.Unmarshal(sc.Bytes(), &b); err != nil {
+			t.Fatal(err)
+		}
+		batches = append(batches, b)
+	}
+	if len(batches) != 2 || batches[1].BatchID != 2 || batches[1].Documents[0].URI != "gs://src/2.png" {
+		t.Fatalf("unexpected batches: %+v", batches)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	created := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	img := types.ImageDocument{
+		Hash:       "h1",
+		MimeType:   "image/png",
+		ImagePaths: []string{"misc/a.png", "customers/acme/2024/a.png"},
+		Size:       1000,
+		Created:    created,
+	}
+	date := func(s string) time.Time {
+		d, err := parseTime(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	tests := map[string]struct {
+		filter filter
+		expect bool
+	}{
+		"empty":            {filter: filter{}, expect: true},
+		"prefix":           {filter: filter{Prefixes: []string{"other/", "customers/acme/"}}, expect: true},
+		"prefix mismatch":  {filter: filter{Prefixes: []string{"customers/other/"}}, expect: false},
+		"glob":             {filter: filter{Globs: []string{"customers/**/*.png"}}, expect: true},
+		"glob mismatch":    {filter: filter{Globs: []string{"customers/*.png"}}, expect: false},
+		"mime type":        {filter: filter{MimeTypes: []string{"image/jpeg", "image/png"}}, expect: true},
+		"mime mismatch":    {filter: filter{MimeTypes: []string{"image/jpeg"}}, expect: false},
+		"size range":       {filter: filter{MinSize: 1000, MaxSize: 2000}, expect: true},
+		"too small":        {filter: filter{MinSize: 1001}, expect: false},
+		"too large":        {filter: filter{MaxSize: 999}, expect: false},
+		"created range":    {filter: filter{CreatedAfter: date("2024-06-01"), CreatedBefore: date("2024-07-01")}, expect: true},
+		"created before":   {filter: filter{CreatedBefore: date("2024-06-01T12:00:00Z")}, expect: false},
+		"created after":    {filter: filter{CreatedAfter: date("2024-06-02")}, expect: false},
+		"all criteria":     {filter: filter{Prefixes: []string{"customers/"}, MimeTypes: []string{"image/png"}, MaxSize: 2000}, expect: true},
+		"one criterion ko": {filter: filter{Prefixes: []string{"customers/"}, MimeTypes: []string{"image/jpeg"}}, expect: false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if res := tc.filter.match(img); res != tc.expect {
+				t.Fatalf("expected: %v, result: %v", tc.expect, res)
+			}
+			if res := tc.filter.empty(); res != (name == "empty") {
+				t.Fatalf("unexpected empty: %v", res)
+			}
+		})
+	}
+
+	// images indexed without creation time never match a date filter
+	if (filter{CreatedAfter: date("2000-01-01")}).match(types.ImageDocument{}) {
+		t.Fatal("expected no match without creation time")
+	}
+
+	if err := validateGlob("a/[/*.png"); err == nil {
+		t.Fatal("expected an invalid glob")
+	}
+	if _, err := parseTime("2024-13-01"); err == nil {
+		t.Fatal("expected an invalid date")
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/dispatch"
+)
+
+// dryRunBatch is a batch a dry run would have published.
+type dryRunBatch struct {
+	BatchID   int                 `json:"batch_id"`
+	Priority  string              `json:"priority"`
+	Documents []dispatch.Document `json:"documents"`
+}
+
+// dryRunOutput writes the batches of a dry run as newline-delimited JSON.
+type dryRunOutput struct {
+	w        io.WriteCloser
+	enc      *json.Encoder
+	priority string
+}
+
+// newDryRunOutput writes to the DRY_RUN_OUTPUT file, or to stdout for "-".
+func newDryRunOutput(name, priority string) (*dryRunOutput, error) {
+	var w io.WriteCloser = os.Stdout
+	if name != "-" {
+		f, err := os.Create(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create dry run output (%s): %w", name, err)
+		}
+		w = f
+	}
+	return &dryRunOutput{w: w, enc: json.NewEncoder(w), priority: priority}, nil
+}
+
+func (o *dryRunOutput) write(docs []dispatch.Document, batchID int) error {
+	if err := o.enc.Encode(dryRunBatch{BatchID: batchID, Priority: o.priority, Documents: docs}); err != nil {
+		return fmt.Errorf("failed to write dry run batch %d: %w", batchID, err)
+	}
+	return nil
+}
+
+func (o *dryRunOutput) close() error {
+	if o.w == os.Stdout {
+		return nil
+	}
+	return o.w.Close()
+}
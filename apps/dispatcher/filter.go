@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/ingest"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+)
+
+// filter selects the image documents dispatched, e.g. the folder of a customer. An image matches
+// when all the criteria set match. Path criteria match when any copy of the image matches.
+type filter struct {
+	// Prefixes and Globs match the source paths, relative to the src bucket. Globs follow
+	// ingest.Match: `**` matches any number of directories.
+	Prefixes  []string
+	Globs     []string
+	MimeTypes []string
+	// MinSize and MaxSize bound the size in bytes. Zero is unbounded.
+	MinSize, MaxSize int64
+	// CreatedAfter and CreatedBefore bound the creation time. Images without one never match.
+	CreatedAfter, CreatedBefore time.Time
+}
+
+// empty reports whether the filter matches all images.
+func (f filter) empty() bool {
+	return len(f.Prefixes) == 0 && len(f.Globs) == 0 && len(f.MimeTypes) == 0 &&
+		f.MinSize == 0 && f.MaxSize == 0 && f.CreatedAfter.IsZero() && f.CreatedBefore.IsZero()
+}
+
+// match reports whether an image matches the filter.
+func (f filter) match(img types.ImageDocument) bool {
+	if len(f.MimeTypes) > 0 && !slices.Contains(f.MimeTypes, img.MimeType) {
+		return false
+	}
+	if (f.MinSize > 0 && img.Size < f.MinSize) || (f.MaxSize > 0 && img.Size > f.MaxSize) {
+		return false
+	}
+	if !f.CreatedAfter.IsZero() || !f.CreatedBefore.IsZero() {
+		if img.Created.IsZero() || img.Created.Before(f.CreatedAfter) || (!f.CreatedBefore.IsZero() && !img.Created.Before(f.CreatedBefore)) {
+			return false
+		}
+	}
+	if len(f.Prefixes) > 0 && !slices.ContainsFunc(img.ImagePaths, func(p string) bool {
+		return slices.ContainsFunc(f.Prefixes, func(prefix string) bool { return strings.HasPrefix(p, prefix) })
+	}) {
+		return false
+	}
+	if len(f.Globs) > 0 && !slices.ContainsFunc(img.ImagePaths, func(p string) bool {
+		return slices.ContainsFunc(f.Globs, func(g string) bool { return ingest.Match(g, p) })
+	}) {
+		return false
+	}
+	return true
+}
+
+// validateGlob reports malformed glob patterns.
+func validateGlob(g string) error {
+	for _, part := range strings.Split(g, "/") {
+		if _, err := path.Match(part, ""); err != nil {
+			return fmt.Errorf("invalid glob (%s): %w", g, err)
+		}
+	}
+	return nil
+}
+
+// parseTime parses an RFC 3339 time or a 2006-01-02 date, in UTC. Empty is the zero time.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, s)
+}
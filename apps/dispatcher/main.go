@@ -7,23 +7,58 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/rs/zerolog/log"
 
 	"cloud.google.com/go/firestore"
 	"cloud.google.com/go/pubsub"
 	"cloud.google.com/go/storage"
-	"github.com/cyber-nic/go-gcp-doc-ai/apps/dispatcher/libs/types"
-	"github.com/cyber-nic/go-gcp-doc-ai/apps/dispatcher/libs/utils"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/cost"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/dispatch"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/logging"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/nlp"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/telemetry"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+const usage = `usage: dispatcher <command>
+
+commands:
+  dispatch  publish the image documents after the checkpoint, within the budget (default)
+  plan      print the images left to dispatch and their estimated cost, as JSON, without dispatching
+`
+
 // Dispatcher is an HTTP handler
 func main() {
 	// context
 	ctx := context.Background()
 
+	// logger
+	logging.Init("dispatcher")
+
+	// command
+	cmd := "dispatch"
+	if len(os.Args) > 1 {
+		cmd = os.Args[1]
+	}
+	if cmd != "dispatch" && cmd != "plan" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
 	// app config
-	cfg := getConfig()
+	cfg := getConfig(cmd)
+
+	// tracing
+	shutdown, err := telemetry.Init(ctx, "dispatcher")
+	if err != nil {
+		log.Fatal().Err(err).Caller().Msg("failed to init tracing")
+	}
+	defer shutdown(context.Background())
 
 	// create storage client
 	store, err := storage.NewClient(ctx)
@@ -45,14 +80,6 @@ func main() {
 	}
 	defer db.Close()
 
-	// create pubsub client and topic handler
-	ps, err := pubsub.NewClient(ctx, cfg.ProjectID)
-	if err != nil {
-		log.Fatal().Err(err).Caller().Msg("failed to create Pub/Sub client")
-	}
-	topic := ps.Topic(cfg.PubsubTopicID)
-	defer topic.Stop()
-
 	// checkpoint
 	checkpointBucket := store.Bucket(cfg.CheckpointBucketName)
 	if _, err := checkpointBucket.Attrs(ctx); err != nil {
@@ -70,6 +97,58 @@ func main() {
 			}
 		}())
 
+	if cmd == "plan" {
+		r, err := plan(ctx, cfg, db.Collection(cfg.FireCollectionName), refsBucket, checkpoint)
+		if err != nil {
+			log.Fatal().Err(err).Caller().Msg("failed to plan")
+		}
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			log.Fatal().Err(err).Caller().Msg("failed to encode plan")
+		}
+		fmt.Println(string(b))
+		return
+	}
+
+	// publish batches to pubsub, or to the dry run output
+	var publish func(docs []dispatch.Document, batchID int) error
+	if cfg.DryRun {
+		out, err := newDryRunOutput(cfg.DryRunOutput, cfg.Priority)
+		if err != nil {
+			log.Fatal().Err(err).Caller().Msg("failed to create dry run output")
+		}
+		defer out.close()
+		publish = out.write
+	} else {
+		// create pubsub client and topic handler
+		ps, err := pubsub.NewClient(ctx, cfg.ProjectID)
+		if err != nil {
+			log.Fatal().Err(err).Caller().Msg("failed to create Pub/Sub client")
+		}
+		topic := ps.Topic(cfg.PubsubTopicID)
+		defer topic.Stop()
+		publish = func(docs []dispatch.Document, batchID int) error {
+			return publishBatch(ctx, topic, docs, batchID, cfg.Priority)
+		}
+	}
+
+	// sample. Dry and sampling runs write neither refs nor checkpoint, so that the next runs still
+	// dispatch every image. Filtered runs write refs but not the checkpoint, past the images left out
+	smp := newSampler(cfg)
+	track := !cfg.DryRun && smp == nil
+	advance := track && cfg.Filter.empty()
+	log.Info().
+		Bool("dry run", cfg.DryRun).
+		Float64("sample rate", cfg.SampleRate).
+		Str("sample by", cfg.SampleBy).
+		Bool("filtered", !cfg.Filter.empty()).
+		Str("priority", cfg.Priority).
+		Msg("dispatching")
+
+	// budget
+	bud := newBudget(cfg)
+	budgetReached := false
+
 	// build query
 	query := db.Collection(cfg.FireCollectionName).OrderBy("hash", firestore.Asc).StartAfter(checkpoint).Limit(cfg.BatchSize)
 
@@ -79,72 +158,21 @@ func main() {
 	batchIdx := 0
 
 	// init doc batch
-	docs := []string{}
+	docs := []dispatch.Document{}
 	imgIDs := []string{}
+	newCheckpoint := ""
 
-	// Iterate through all objects in the firestore collection
-Batch:
-	for {
-		// fmt.Println(batchIdx, fileIdx, "batch")
-		snaps, err := query.Documents(ctx).GetAll()
-		if err != nil {
-			break Batch
-		}
-		if len(snaps) == 0 {
-			break Batch // No more documents
-		}
-
-		// new checkpoint var
-		newCheckpoint := ""
-
-		// process batch
-	Snap:
-		for _, snap := range snaps {
-			// fmt.Println(batchIdx, fileIdx, "snap", snap.Ref.ID)
-
-			fileIdx++
-
-			// Check if file was already processed
-			if ok, err := existsInRefsBucket(ctx, refsBucket, snap.Ref.ID); err != nil || ok {
-				// todo: if err write to src-err
-				continue Snap
-			}
-
-			// Marshal the map to a JSON byte slice
-			jsonBytes, err := json.Marshal(snap.Data())
-			if err != nil {
-				log.Fatal().Err(err).Caller().Msg("failed to marshal firestore document")
-			}
-
-			// Unmarshal the JSON data into the struct
-			var imgdoc types.ImageDocument
-			err = json.Unmarshal(jsonBytes, &imgdoc)
-			if err != nil {
-				log.Fatal().Err(err).Caller().Msg("failed to unmarshal firestore document")
-			}
-
-			// add file to batch
-			docs = append(docs, fmt.Sprintf("gs://%s/%s", cfg.SrcBucketName, imgdoc.ImagePaths[0]))
-			imgIDs = append(imgIDs, snap.Ref.ID)
-			newCheckpoint = snap.Ref.ID
-		}
-
-		// in the odd event all docs returned from firestore were already processed
-		if len(docs) == 0 {
-			continue Batch
-		}
-
-		if cfg.Debug {
-			for i := range docs {
-				fmt.Printf("%d  %s     %s\n", i, imgIDs[i], docs[i])
-			}
+	// flush publishes the batch, writes its refs and checkpoint, and reports whether a limit is
+	// reached. Failed batches are kept and published with the next documents.
+	flush := func() bool {
+		for i := range docs {
+			log.Debug().Int("index", i).Str(logging.FieldHash, imgIDs[i]).Str(logging.FieldObject, docs[i].URI).Msg("batched")
 		}
 
 		// send batch
-		_, err = publishFilenameBatch(ctx, topic, docs)
-		if err != nil {
+		if err := publish(docs, batchIdx+1); err != nil {
 			log.Error().Err(err).Caller().Msg("failed to publish pubsub batch")
-			continue Batch
+			return false
 		}
 
 		// inc batch count and log
@@ -153,17 +181,21 @@ Batch:
 		log.Info().
 			Int("files processed", fileIdx).
 			Int("files sent", batchedFilesCnt).
-			Int("batch id", batchIdx).
+			Int(logging.FieldBatchID, batchIdx).
 			Int("files in latest batch", len(docs)).
 			Msgf("batch %d published (%d files)", batchIdx, batchedFilesCnt)
 
 		// write refs to refs bucket
-		if errs := writeRefs(ctx, refsBucket, imgIDs); len(errs) > 0 {
-			log.Error().Err(err).Caller().Msg("failed to write refs")
+		if track {
+			if errs := writeRefs(ctx, refsBucket, imgIDs); len(errs) > 0 {
+				for _, err := range errs {
+					log.Error().Err(err).Caller().Msg("failed to write ref")
+				}
+			}
 		}
 
 		// update checkpoint
-		if checkpoint != newCheckpoint {
+		if advance && checkpoint != newCheckpoint {
 			log.Info().
 				Int("files", fileIdx).
 				Str("checkpoint", shortStr(checkpoint, 12)).
@@ -174,7 +206,7 @@ Batch:
 		}
 
 		// reset docs
-		docs = []string{}
+		docs = []dispatch.Document{}
 		imgIDs = []string{}
 
 		// Limit file count
@@ -184,13 +216,110 @@ Batch:
 				Int("max", cfg.MaxFiles).
 				Int("sent files", batchedFilesCnt).
 				Msg("MAX FILES REACHED")
-			// exit the Batch loop
-			break Batch
+			return true
 		}
 
 		// Limit batch count
 		if cfg.MaxBatch > 0 && batchIdx >= cfg.MaxBatch {
-			log.Info().Int("files", fileIdx).Int("batch", batchIdx).Msg("MAX BATCH REACHED")
+			log.Info().Int("files", fileIdx).Int(logging.FieldBatchID, batchIdx).Msg("MAX BATCH REACHED")
+			return true
+		}
+		return false
+	}
+
+	// Iterate through all objects in the firestore collection
+Batch:
+	for {
+		// fmt.Println(batchIdx, fileIdx, "batch")
+		snaps, err := query.Documents(ctx).GetAll()
+		if err != nil {
+			break Batch
+		}
+		if len(snaps) == 0 {
+			break Batch // No more documents
+		}
+
+		// process batch
+	Snap:
+		for _, snap := range snaps {
+			// fmt.Println(batchIdx, fileIdx, "snap", snap.Ref.ID)
+
+			fileIdx++
+
+			// Check if file was already processed
+			ok, err := existsInRefsBucket(ctx, refsBucket, snap.Ref.ID)
+			if err != nil {
+				log.Fatal().Err(err).Caller().Msg("failed to check refs bucket")
+			}
+			if ok {
+				continue Snap
+			}
+
+			imgdoc, err := decodeImage(snap)
+			if err != nil {
+				log.Fatal().Err(err).Caller().Msg("failed to decode firestore document")
+			}
+
+			if !cfg.Filter.match(imgdoc) || (smp != nil && !smp.keep(imgdoc)) {
+				continue Snap
+			}
+
+			// stop before the document exceeding the budget, it is dispatched by the next run
+			if !bud.add(pagesPerImage) {
+				budgetReached = true
+				break Snap
+			}
+
+			// add file to batch. The first image is submitted for OCR, all its duplicates are carried
+			// along so that the NLP output can be joined back to them.
+			sources := make([]string, len(imgdoc.ImagePaths))
+			for i, p := range imgdoc.ImagePaths {
+				sources[i] = fmt.Sprintf("gs://%s/%s", cfg.SrcBucketName, p)
+			}
+			docs = append(docs, dispatch.Document{
+				URI:        sources[0],
+				Hash:       snap.Ref.ID,
+				MimeType:   imgdoc.MimeType,
+				SourceURIs: sources,
+				Size:       imgdoc.Size,
+				Label:      imgdoc.Label,
+			})
+			imgIDs = append(imgIDs, snap.Ref.ID)
+			newCheckpoint = snap.Ref.ID
+
+			// sampled and filtered docs are batched across pages: publish as soon as the batch is
+			// full, so that batches never exceed the batch size
+			if len(docs) >= cfg.BatchSize && flush() {
+				break Batch
+			}
+		}
+
+		// next page
+		query = query.StartAfter(snaps[len(snaps)-1].Ref.ID)
+
+		// in the odd event all docs returned from firestore were already processed. Sampled and
+		// filtered docs are batched across pages
+		if len(docs) == 0 || ((smp != nil || !cfg.Filter.empty()) && !budgetReached) {
+			if budgetReached {
+				break Batch
+			}
+			continue Batch
+		}
+
+		if flush() {
+			break Batch
+		}
+
+		// Limit cost
+		if budgetReached {
+			e := bud.estimate()
+			log.Info().
+				Int("files", fileIdx).
+				Int64("pages", e.Pages).
+				Float64("cost", e.Total).
+				Int("budget pages", cfg.BudgetPages).
+				Float64("budget cost", cfg.BudgetCost).
+				Msg("BUDGET REACHED")
 			break Batch
 		}
 	}
@@ -198,26 +327,58 @@ Batch:
 	// Send any remaining files in a final batch
 	if len(docs) > 0 {
 		// Send batch
-		_, err = publishFilenameBatch(ctx, topic, docs)
+		err = publish(docs, batchIdx+1)
 		if err != nil {
 			log.Error().Err(err).Caller().Msg("failed to publish pubsub batch")
 		} else {
+			batchIdx++
+			batchedFilesCnt += len(docs)
 			// write refs to refs bucket
-			if errs := writeRefs(ctx, refsBucket, imgIDs); len(errs) > 0 {
-				for _, err := range errs {
-					log.Error().Err(err).Caller().Msg("failed to write ref")
+			if track {
+				if errs := writeRefs(ctx, refsBucket, imgIDs); len(errs) > 0 {
+					for _, err := range errs {
+						log.Error().Err(err).Caller().Msg("failed to write ref")
+					}
 				}
 			}
 		}
 	}
 
+	e := bud.estimate()
 	log.Info().
 		Int("files processed", fileIdx).
 		Int("files sent", batchedFilesCnt).
 		Int("batch count", batchIdx).
+		Int64("pages", e.Pages).
+		Float64("estimated cost", e.Total).
+		Str("currency", e.Currency).
 		Msg("done")
 }
 
+// publishBatch publishes a batch within its own span. The span is the root of the trace followed by
+// the batch documents through the ocr-worker and nlp-worker.
+func publishBatch(ctx context.Context, topic *pubsub.Topic, docs []dispatch.Document, batchID int, priority string) error {
+	ctx, span := telemetry.Tracer().Start(ctx, "dispatcher.publish_batch",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.Int("batch.id", batchID),
+			attribute.Int("batch.files", len(docs)),
+			attribute.String("batch.priority", priority),
+			attribute.String("messaging.destination.name", topic.ID()),
+		),
+	)
+	defer span.End()
+
+	id, err := dispatch.PublishBatchWithAttributes(ctx, topic, docs, map[string]string{dispatch.AttrPriority: priority})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to publish batch")
+		return err
+	}
+	span.SetAttributes(attribute.String("messaging.message.id", id))
+	return nil
+}
+
 func shortStr(s string, i int) string {
 	if len(s) > i {
 		return s[:i]
@@ -247,38 +408,17 @@ func writeRef(ctx context.Context, bucket *storage.BucketHandle, k string, v str
 }
 
 func existsInRefsBucket(ctx context.Context, bucket *storage.BucketHandle, filename string) (bool, error) {
-	_, err := bucket.Object(filename).NewReader(ctx)
+	_, err := bucket.Object(filename).Attrs(ctx)
 	if err != nil && err == storage.ErrObjectNotExist {
 		return false, nil
 	}
 	if err != nil {
-		log.Fatal().Err(err).Caller().Msg("failed to check refs bucket")
+		return false, fmt.Errorf("failed to check refs bucket (%s): %w", filename, err)
 	}
 
 	return true, nil
 }
 
-func publishFilenameBatch(ctx context.Context, t *pubsub.Topic, f []string) (string, error) {
-	var id string
-	enc, err := utils.EncodeToBase64(f)
-	if err != nil {
-		return id, err
-	}
-
-	result := t.Publish(ctx, &pubsub.Message{
-		Data: []byte(enc),
-	})
-
-	// Block until the result is returned and a server-generated
-	// ID is returned for the published message.
-	id, err = result.Get(ctx)
-	if err != nil {
-		return id, err
-	}
-
-	return id, nil
-}
-
 func getMandatoryEnvVar(n string) string {
 	v, ok := os.LookupEnv(n)
 	if !ok || v == "" {
@@ -299,9 +439,22 @@ type appConfig struct {
 	MaxFiles             int
 	MaxBatch             int
 	PubsubTopicID        string
+	Prices               cost.Prices
+	NLPAnalyses          []string
+	CharactersPerPage    int
+	BudgetPages          int
+	BudgetCost           float64
+	DryRun               bool
+	DryRunOutput         string
+	SampleRate           float64
+	SampleBy             string
+	SamplePrefixDepth    int
+	SampleSeed           string
+	Filter               filter
+	Priority             string
 }
 
-func getConfig() appConfig {
+func getConfig(cmd string) appConfig {
 	debug := utils.GetBoolEnvVar("DEBUG", false)
 
 	// gcp
@@ -316,8 +469,16 @@ func getConfig() appConfig {
 	fireDatabaseID := getMandatoryEnvVar("FIRESTORE_DATABASE_ID")
 	fireCollectionName := getMandatoryEnvVar("FIRESTORE_COLLECTION_NAME")
 
-	// pubsub
-	pubsubTopicID := getMandatoryEnvVar("PUBSUB_TOPIC_ID")
+	// dryRun scans and batches the images as a dispatch does, writing the batches to the
+	// DRY_RUN_OUTPUT file, or to stdout with "-", without publishing nor writing refs or checkpoint
+	dryRun := utils.GetBoolEnvVar("DRY_RUN", false)
+	dryRunOutput := utils.GetStrEnvVar("DRY_RUN_OUTPUT", "dry-run.ndjson")
+
+	// pubsub. plan and dry runs do not publish
+	pubsubTopicID := utils.GetStrEnvVar("PUBSUB_TOPIC_ID", "")
+	if cmd != "plan" && !dryRun {
+		pubsubTopicID = getMandatoryEnvVar("PUBSUB_TOPIC_ID")
+	}
 
 	// limits
 	batchSize := utils.GetIntEnvVar("BATCH_SIZE", 100)
@@ -328,6 +489,60 @@ func getConfig() appConfig {
 	// before terminating. Mainly used for testing/sampling. Zero means no limit.
 	maxBatch := utils.GetIntEnvVar("MAX_BATCH", 0)
 
+	// cost. PRICES is a JSON price table, inline or in a file, overriding the list prices
+	prices, err := cost.LoadPrices(utils.GetStrEnvVar("PRICES", ""))
+	if err != nil {
+		log.Fatal().Err(err).Caller().Msg("invalid PRICES")
+	}
+	// nlpAnalyses are the analyses of the nlp-worker, see its NLP_ANALYSES
+	nlpAnalyses, err := nlp.ParseAnalyses(utils.GetListEnvVar("NLP_ANALYSES", []string{nlp.AnalysisEntities}))
+	if err != nil {
+		log.Fatal().Err(err).Caller().Msg("invalid NLP_ANALYSES")
+	}
+	// charactersPerPage is the average OCR text length of a page, for the NLP estimate
+	charactersPerPage := utils.GetIntEnvVar("CHARACTERS_PER_PAGE", 2000)
+	// budgetPages and budgetCost cap the pages and estimated cost, in the price table currency,
+	// dispatched by a run. Zero means no limit.
+	budgetPages := utils.GetIntEnvVar("BUDGET_PAGES", 0)
+	budgetCost := utils.GetFloatEnvVar("BUDGET_COST", 0)
+
+	// sampling. sampleRate is the share of the images dispatched, for quality evaluation runs.
+	// Zero means no sampling. Images are sampled at random, the same ones for a SAMPLE_SEED, or by
+	// stratum, the first SAMPLE_PREFIX_DEPTH directories of their path or their mime type.
+	var env utils.EnvReader
+	sampleRate := env.Ratio("SAMPLE_RATE", 0)
+	sampleBy := env.OneOf("SAMPLE_BY", sampleByNone, sampleByNone, sampleByPrefix, sampleByMimeType)
+	samplePrefixDepth := env.Int("SAMPLE_PREFIX_DEPTH", 1)
+	sampleSeed := utils.GetStrEnvVar("SAMPLE_SEED", "")
+
+	// filters. Only the images matching all of them are dispatched, e.g. the archive of a customer
+	f := filter{
+		Prefixes:  utils.GetListEnvVar("FILTER_PREFIXES", nil),
+		Globs:     utils.GetListEnvVar("FILTER_GLOBS", nil),
+		MimeTypes: utils.GetListEnvVar("FILTER_MIME_TYPES", nil),
+		MinSize:   int64(utils.GetIntEnvVar("FILTER_MIN_SIZE", 0)),
+		MaxSize:   int64(utils.GetIntEnvVar("FILTER_MAX_SIZE", 0)),
+	}
+	for _, g := range f.Globs {
+		if err := validateGlob(g); err != nil {
+			env.Fail(fmt.Errorf("invalid FILTER_GLOBS: %w", err))
+		}
+	}
+	for n, t := range map[string]*time.Time{"FILTER_CREATED_AFTER": &f.CreatedAfter, "FILTER_CREATED_BEFORE": &f.CreatedBefore} {
+		v, err := parseTime(utils.GetStrEnvVar(n, ""))
+		if err != nil {
+			env.Fail(fmt.Errorf("invalid %s value, expected a RFC 3339 time or a date: %w", n, err))
+		}
+		*t = v
+	}
+
+	// priority is carried by the batch messages, see dispatch.AttrPriority
+	priority := env.OneOf("PRIORITY", dispatch.PriorityLow, dispatch.PriorityLow, dispatch.PriorityHigh)
+
+	if err := env.Err(); err != nil {
+		log.Fatal().Err(err).Caller().Msg("invalid config")
+	}
+
 	return appConfig{
 		Debug:                debug,
 		ProjectID:            projectID,
@@ -340,5 +555,18 @@ func getConfig() appConfig {
 		MaxFiles:             maxFiles,
 		MaxBatch:             maxBatch,
 		PubsubTopicID:        pubsubTopicID,
+		Prices:               prices,
+		NLPAnalyses:          nlpAnalyses,
+		CharactersPerPage:    charactersPerPage,
+		BudgetPages:          budgetPages,
+		BudgetCost:           budgetCost,
+		DryRun:               dryRun,
+		DryRunOutput:         dryRunOutput,
+		SampleRate:           sampleRate,
+		SampleBy:             sampleBy,
+		SamplePrefixDepth:    samplePrefixDepth,
+		SampleSeed:           sampleSeed,
+		Filter:               f,
+		Priority:             priority,
 	}
 }
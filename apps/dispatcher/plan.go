@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/storage"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/cost"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+)
+
+// planReport is the work left to dispatch after the checkpoint, and its estimated cost.
+type planReport struct {
+	Checkpoint string `json:"checkpoint"`
+	// Scanned are the image documents after the checkpoint, Dispatched those already in the refs
+	// bucket, Filtered those left out by the filters.
+	Scanned    int64 `json:"scanned"`
+	Dispatched int64 `json:"dispatched"`
+	Filtered   int64 `json:"filtered"`
+	// Images are the unique images left to dispatch, Files their source files, duplicates included.
+	Images    int64            `json:"images"`
+	Files     int64            `json:"files"`
+	Pages     int64            `json:"pages"`
+	Bytes     int64            `json:"bytes"`
+	MimeTypes map[string]int64 `json:"mime_types"`
+	Estimate  cost.Estimate    `json:"estimate"`
+	// Budget is the part of the work a dispatch run would send within BUDGET_PAGES and
+	// BUDGET_COST. Omitted without a budget.
+	Budget *budgetReport `json:"budget,omitempty"`
+
+	// all tracks the usage of the images left, capped the usage within budget
+	all, capped *budget
+	reached     bool
+	filter      filter
+}
+
+type budgetReport struct {
+	Pages    int64         `json:"max_pages,omitempty"`
+	Cost     float64       `json:"max_cost,omitempty"`
+	Images   int64         `json:"images"`
+	Estimate cost.Estimate `json:"estimate"`
+}
+
+// newPlanReport returns an empty report.
+func newPlanReport(cfg appConfig, checkpoint string) *planReport {
+	r := &planReport{Checkpoint: checkpoint, MimeTypes: map[string]int64{}, all: newBudget(cfg), capped: newBudget(cfg), filter: cfg.Filter}
+	r.all.maxPages, r.all.maxCost = 0, 0
+	if cfg.BudgetPages > 0 || cfg.BudgetCost > 0 {
+		r.Budget = &budgetReport{Pages: int64(cfg.BudgetPages), Cost: cfg.BudgetCost}
+	}
+	return r
+}
+
+// add counts an image document. The budget, when set, counts the images up to the first one
+// exceeding it, as the dispatch stops there.
+func (r *planReport) add(img types.ImageDocument, dispatched bool) {
+	r.Scanned++
+	if dispatched {
+		r.Dispatched++
+		return
+	}
+	if !r.filter.match(img) {
+		r.Filtered++
+		return
+	}
+	r.Images++
+	r.Files += int64(len(img.ImagePaths))
+	r.Pages += pagesPerImage
+	r.Bytes += img.Size
+	r.MimeTypes[img.MimeType]++
+	r.all.add(pagesPerImage)
+
+	if r.Budget == nil || r.reached {
+		return
+	}
+	if r.capped.add(pagesPerImage) {
+		r.Budget.Images++
+	} else {
+		r.reached = true
+	}
+}
+
+// finish sets the estimates.
+func (r *planReport) finish() {
+	r.Estimate = r.all.estimate()
+	if r.Budget != nil {
+		r.Budget.Estimate = r.capped.estimate()
+	}
+}
+
+// plan scans the image documents after the checkpoint, as a dispatch would, without publishing nor
+// writing refs or checkpoint, and returns the work left and its estimated cost.
+func plan(ctx context.Context, cfg appConfig, col *firestore.CollectionRef, refs *storage.BucketHandle, checkpoint string) (*planReport, error) {
+	r := newPlanReport(cfg, checkpoint)
+	err := scan(ctx, col, refs, checkpoint, cfg.BatchSize, func(img types.ImageDocument, dispatched bool) error {
+		r.add(img, dispatched)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.finish()
+	return r, nil
+}
+
+// scan calls fn with the image documents after the checkpoint, in hash order, read in pages of
+// pageSize, and whether they were already dispatched.
+func scan(ctx context.Context, col *firestore.CollectionRef, refs *storage.BucketHandle, checkpoint string, pageSize int, fn func(img types.ImageDocument, dispatched bool) error) error {
+	last := checkpoint
+	for {
+		snaps, err := col.OrderBy("hash", firestore.Asc).StartAfter(last).Limit(pageSize).Documents(ctx).GetAll()
+		if err != nil {
+			return fmt.Errorf("failed to read image documents: %w", err)
+		}
+		for _, snap := range snaps {
+			img, err := decodeImage(snap)
+			if err != nil {
+				return err
+			}
+			dispatched, err := existsInRefsBucket(ctx, refs, snap.Ref.ID)
+			if err != nil {
+				return err
+			}
+			if err := fn(img, dispatched); err != nil {
+				return err
+			}
+		}
+		if len(snaps) < pageSize {
+			return nil
+		}
+		last = snaps[len(snaps)-1].Ref.ID
+	}
+}
+
+// decodeImage decodes an image document. The hash is the document id.
+func decodeImage(snap *firestore.DocumentSnapshot) (types.ImageDocument, error) {
+	var img types.ImageDocument
+	b, err := json.Marshal(snap.Data())
+	if err != nil {
+		return img, fmt.Errorf("failed to marshal firestore document (%s): %w", snap.Ref.ID, err)
+	}
+	if err := json.Unmarshal(b, &img); err != nil {
+		return img, fmt.Errorf("failed to unmarshal firestore document (%s): %w", snap.Ref.ID, err)
+	}
+	img.Hash = snap.Ref.ID
+	return img, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"strings"
+
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+)
+
+// Sampling strata, see SAMPLE_BY. Without strata, images are sampled at random.
+const (
+	sampleByNone     = "none"
+	sampleByPrefix   = "prefix"
+	sampleByMimeType = "mime_type"
+)
+
+// sampler selects a sample of the image documents, for quality evaluation runs.
+//
+// Random sampling keeps the images whose seeded hash falls below the rate, so that a seed always
+// selects the same images. Stratified sampling keeps the first image of each stratum, then one
+// every 1/rate images of the stratum, so that every stratum is represented in proportion. As the
+// collection is read in content hash order, the images of a stratum come in random order.
+type sampler struct {
+	rate float64
+	by   string
+	// depth is the number of directories of the prefix strata
+	depth int
+	seed  string
+
+	// seen are the images seen by stratum
+	seen map[string]int64
+}
+
+func newSampler(cfg appConfig) *sampler {
+	if cfg.SampleRate == 0 {
+		return nil
+	}
+	return &sampler{rate: cfg.SampleRate, by: cfg.SampleBy, depth: cfg.SamplePrefixDepth, seed: cfg.SampleSeed, seen: map[string]int64{}}
+}
+
+// keep reports whether an image is part of the sample.
+func (s *sampler) keep(img types.ImageDocument) bool {
+	if s.by == sampleByNone {
+		sum := sha256.Sum256([]byte(s.seed + "/" + img.Hash))
+		return float64(binary.BigEndian.Uint64(sum[:8]))/math.MaxUint64 < s.rate
+	}
+
+	k := s.stratum(img)
+	s.seen[k]++
+	n := float64(s.seen[k])
+	return math.Ceil(n*s.rate) > math.Ceil((n-1)*s.rate)
+}
+
+// stratum returns the stratum of an image: its mime type, or the first depth directories of the
+// path of its first copy.
+func (s *sampler) stratum(img types.ImageDocument) string {
+	if s.by == sampleByMimeType {
+		return img.MimeType
+	}
+	if len(img.ImagePaths) == 0 {
+		return ""
+	}
+	dirs := strings.Split(img.ImagePaths[0], "/")
+	dirs = dirs[:len(dirs)-1]
+	return strings.Join(dirs[:min(s.depth, len(dirs))], "/")
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/export"
+)
+
+// BigQuery write modes: truncate replaces the table rows, append adds the records to them.
+const (
+	bqWriteTruncate = "truncate"
+	bqWriteAppend   = "append"
+)
+
+// load loads ndjson files, gs:// objects or local files, to the BQ_TABLE table, created when it
+// does not exist. Objects are loaded by a single job, local files by a job each.
+func load(ctx context.Context, cfg appConfig, files []string) error {
+	if len(files) == 0 {
+		log.Warn().Msg("no records to load")
+		return nil
+	}
+	project, dataset, table, err := parseTable(cfg.BQTable, cfg.BQProjectID)
+	if err != nil {
+		return err
+	}
+
+	c, err := bigquery.NewClient(ctx, project)
+	if err != nil {
+		return fmt.Errorf("failed to create BigQuery client: %w", err)
+	}
+	defer c.Close()
+	t := c.DatasetInProject(project, dataset).Table(table)
+
+	write := bigquery.WriteTruncate
+	if cfg.BQWrite == bqWriteAppend {
+		write = bigquery.WriteAppend
+	}
+
+	if strings.HasPrefix(files[0], "gs://") {
+		ref := bigquery.NewGCSReference(files...)
+		ref.SourceFormat = bigquery.JSON
+		ref.Schema = export.Schema()
+		return runLoad(ctx, t.LoaderFrom(ref), write)
+	}
+
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			return fmt.Errorf("failed to open (%s): %w", name, err)
+		}
+		src := bigquery.NewReaderSource(f)
+		src.SourceFormat = bigquery.JSON
+		src.Schema = export.Schema()
+		err = runLoad(ctx, t.LoaderFrom(src), write)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to load (%s): %w", name, err)
+		}
+		log.Info().Str("file", name).Msg("file loaded")
+		// the next files add to the first one
+		write = bigquery.WriteAppend
+	}
+	return nil
+}
+
+// runLoad runs a load job and waits for its completion. Columns added to the schema are added to
+// the tables appended to.
+func runLoad(ctx context.Context, l *bigquery.Loader, write bigquery.TableWriteDisposition) error {
+	l.CreateDisposition = bigquery.CreateIfNeeded
+	l.WriteDisposition = write
+	if write == bigquery.WriteAppend {
+		l.SchemaUpdateOptions = []string{"ALLOW_FIELD_ADDITION"}
+	}
+
+	job, err := l.Run(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start load job: %w", err)
+	}
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to wait for load job (%s): %w", job.ID(), err)
+	}
+	if err := status.Err(); err != nil {
+		return fmt.Errorf("load job failed (%s): %w", job.ID(), err)
+	}
+	return nil
+}
+
+// parseTable parses a [project.]dataset.table table name.
+func parseTable(s, defaultProject string) (project, dataset, table string, err error) {
+	parts := strings.Split(s, ".")
+	switch {
+	case len(parts) == 2:
+		project, dataset, table = defaultProject, parts[0], parts[1]
+	case len(parts) == 3:
+		project, dataset, table = parts[0], parts[1], parts[2]
+	default:
+		return "", "", "", fmt.Errorf("invalid table name, expected [project.]dataset.table: %s", s)
+	}
+	if project == "" || dataset == "" || table == "" {
+		return "", "", "", fmt.Errorf("invalid table name, expected [project.]dataset.table: %s", s)
+	}
+	return project, dataset, table, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/docai"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/export"
+)
+
+// writeTree writes the image index and output tree of apps/local: a done, an analyzing, an ocr
+// failed, an nlp failed and a pending image.
+func writeTree(t *testing.T, dir string) {
+	files := map[string]string{
+		"images.json": `[
+			{"hash": "h1", "mime_type": "image/jpeg", "image_paths": ["a.jpg", "copy/a.jpg"], "width": 10, "height": 20, "pixels": 200, "size": 1000},
+			{"hash": "h2", "mime_type": "image/png", "image_paths": ["b.png"]},
+			{"hash": "h3", "mime_type": "image/png", "image_paths": ["c.png"]},
+			{"hash": "h4", "mime_type": "image/png", "image_paths": ["d.png"]},
+			{"hash": "h5", "mime_type": "image/png", "image_paths": ["e.png"]}
+		]`,
+		"ocr/a.jpg.json": `{"text": "Facture", "pages": [{"tokens": [{"layout": {"confidence": 0.9}}]}]}`,
+		"nlp/a.jpg.json": `{"hash": "h1", "ocr_output": "ocr/a.jpg.json", "language": "fr", "entities": [{"name": "Dupont", "type": 1}]}`,
+		"ocr/b.png.json": `{"text": "Invoice", "pages": [{}]}`,
+		"err/c.png.json": `{"stage": "ocr", "code": "InvalidArgument", "message": "unsupported format"}`,
+		"ocr/d.png.json": `{"text": "x"}`,
+		"err/d.png.json": `{"stage": "nlp", "code": "Internal", "message": "failed"}`,
+	}
+	for name, s := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(s), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeTree(t, dir)
+	outDir := filepath.Join(t.TempDir(), "export")
+
+	out := &output{base: outDir, formats: export.Formats, shardRows: 2}
+	st, err := run(ctx, &localSource{dir: dir}, out, 2, 4, 0, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := map[string]int{docai.StatusDone: 1, docai.StatusAnalyzing: 1, docai.StatusOCRFailed: 1, docai.StatusNLPFailed: 1, docai.StatusPending: 1}
+	if st.Records != 5 || st.Failures != 0 || !reflect.DeepEqual(statuses, st.Statuses) {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+
+	// 3 shards of 2 records
+	expect := []string{
+		filepath.Join(outDir, "records-00000.ndjson"), filepath.Join(outDir, "records-00001.ndjson"), filepath.Join(outDir, "records-00002.ndjson"),
+	}
+	if res := out.filesOf(export.FormatNDJSON); !reflect.DeepEqual(expect, res) {
+		t.Fatalf("expected: %v, result: %v", expect, res)
+	}
+	if res := out.filesOf(export.FormatParquet); len(res) != 3 {
+		t.Fatalf("expected 3 parquet files, result: %v", res)
+	}
+
+	// records, in hash order
+	var recs []map[string]any
+	for _, name := range expect {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			var m map[string]any
+			if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+				t.Fatal(err)
+			}
+			recs = append(recs, m)
+		}
+		f.Close()
+	}
+	if len(recs) != 5 {
+		t.Fatalf("expected 5 records, result: %d", len(recs))
+	}
+	h1 := recs[0]
+	if h1["hash"] != "h1" || h1["status"] != docai.StatusDone || h1["ocr_pages"] != 1.0 || h1["ocr_characters"] != 7.0 || h1["language"] != "fr" || h1["source_count"] != 2.0 || h1["width"] != 10.0 {
+		t.Fatalf("unexpected record: %v", h1)
+	}
+	if h3 := recs[2]; h3["status"] != docai.StatusOCRFailed || h3["error_code"] != "InvalidArgument" {
+		t.Fatalf("unexpected record: %v", h3)
+	}
+	if h4 := recs[3]; h4["status"] != docai.StatusNLPFailed || h4["error_stage"] != "nlp" || h4["ocr_output"] != "ocr/d.png.json" {
+		t.Fatalf("unexpected record: %v", h4)
+	}
+
+	// limit
+	out = &output{base: t.TempDir(), formats: []export.Format{export.FormatNDJSON}, shardRows: 10}
+	st, err = run(ctx, &localSource{dir: dir}, out, 2, 4, 3, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Records != 3 || len(out.files) != 1 {
+		t.Fatalf("unexpected stats: %+v, files: %v", st, out.files)
+	}
+}
+
+func TestParseTable(t *testing.T) {
+	tests := map[string]struct {
+		table  string
+		expect []string
+		err    bool
+	}{
+		"default project": {table: "ds.records", expect: []string{"p", "ds", "records"}},
+		"project":         {table: "other.ds.records", expect: []string{"other", "ds", "records"}},
+		"table only":      {table: "records", err: true},
+		"empty part":      {table: "ds.", err: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, d, tb, err := parseTable(tc.table, "p")
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res := []string{p, d, tb}; !reflect.DeepEqual(tc.expect, res) {
+				t.Fatalf("expected: %v, result: %v", tc.expect, res)
+			}
+		})
+	}
+}
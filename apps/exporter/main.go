@@ -0,0 +1,212 @@
+// Package main is the exporter command. It joins the image documents with their OCR status, OCR
+// text statistics and NLP entities into flat records, writes them as newline-delimited JSON and
+// Parquet files and loads them to BigQuery.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/storage"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/docai"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/export"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/logging"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/utils"
+)
+
+const usage = `usage: exporter <command>
+
+commands:
+  export   write the records to OUTPUT, then load them to BigQuery when BQ_TABLE is set (default)
+  schema   print the BigQuery schema of the records, as JSON
+`
+
+func main() {
+	ctx := context.Background()
+
+	// logger
+	logging.Init("exporter")
+
+	// command
+	cmd := "export"
+	if len(os.Args) > 1 {
+		cmd = os.Args[1]
+	}
+
+	switch cmd {
+	case "export":
+	case "schema":
+		b, err := export.Schema().ToJSONFields()
+		if err != nil {
+			log.Fatal().Err(err).Caller().Msg("failed to encode schema")
+		}
+		fmt.Println(string(b))
+		return
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	// app config
+	cfg, err := getConfig()
+	if err != nil {
+		log.Fatal().Err(err).Caller().Msg("invalid config")
+	}
+
+	// storage client, for the gcs source and outputs
+	var store *storage.Client
+	if cfg.LocalDir == "" || strings.HasPrefix(cfg.Output, "gs://") {
+		if store, err = storage.NewClient(ctx); err != nil {
+			log.Fatal().Err(err).Caller().Msg("failed to create storage client")
+		}
+		defer store.Close()
+	}
+
+	// source
+	var src source
+	if cfg.LocalDir != "" {
+		src = &localSource{dir: cfg.LocalDir}
+	} else {
+		db, err := firestore.NewClientWithDatabase(ctx, cfg.ProjectID, cfg.FireDatabaseID)
+		if err != nil {
+			log.Fatal().Err(err).Caller().Msg("failed to create Firestore client")
+		}
+		defer db.Close()
+		src = &gcsSource{
+			images:    db.Collection(cfg.FireCollectionName),
+			srcBucket: cfg.SrcBucketName,
+			buckets: docai.StatusBuckets{
+				Store:  store,
+				Refs:   store.Bucket(cfg.RefsBucketName),
+				OCRErr: store.Bucket(cfg.OCRErrBucketName),
+				NLPDst: store.Bucket(cfg.NLPDstBucketName),
+				NLPErr: store.Bucket(cfg.NLPErrBucketName),
+			},
+			ocrStats: cfg.OCRStats,
+		}
+	}
+
+	// export
+	out := &output{store: store, base: cfg.Output, formats: cfg.Formats, shardRows: cfg.ShardRows}
+	st, err := run(ctx, src, out, cfg.PageSize, cfg.Concurrency, cfg.Limit, time.Now())
+	if err != nil {
+		log.Fatal().Err(err).Caller().Msg("failed to export")
+	}
+	log.Info().Int("records", st.Records).Int("failures", st.Failures).Interface("statuses", st.Statuses).Strs("files", out.files).Msg("exported")
+
+	// bigquery
+	if cfg.BQTable != "" {
+		if err := load(ctx, cfg, out.filesOf(export.FormatNDJSON)); err != nil {
+			log.Fatal().Err(err).Caller().Str("table", cfg.BQTable).Msg("failed to load records to BigQuery")
+		}
+		log.Info().Str("table", cfg.BQTable).Msg("records loaded to BigQuery")
+	}
+}
+
+type appConfig struct {
+	ProjectID          string
+	LocalDir           string
+	FireDatabaseID     string
+	FireCollectionName string
+	SrcBucketName      string
+	RefsBucketName     string
+	OCRErrBucketName   string
+	NLPDstBucketName   string
+	NLPErrBucketName   string
+	OCRStats           bool
+	Output             string
+	Formats            []export.Format
+	ShardRows          int
+	PageSize           int
+	Concurrency        int
+	Limit              int
+	BQProjectID        string
+	BQTable            string
+	BQWrite            string
+}
+
+func getConfig() (appConfig, error) {
+	var env utils.EnvReader
+
+	// localDir is the OUT_DIR of apps/local. The firestore collection and buckets are read otherwise
+	localDir := utils.GetStrEnvVar("LOCAL_DIR", "")
+	projectID := utils.GetStrEnvVar("GCP_PROJECT_ID", "")
+
+	var cfg appConfig
+	if localDir == "" {
+		projectID = env.Mandatory("GCP_PROJECT_ID")
+		cfg = appConfig{
+			FireDatabaseID:     env.Mandatory("FIRESTORE_DATABASE_ID"),
+			FireCollectionName: env.Mandatory("FIRESTORE_COLLECTION_NAME"),
+			SrcBucketName:      env.Mandatory("SRC_BUCKET_NAME"),
+			RefsBucketName:     env.Mandatory("REFS_BUCKET_NAME"),
+			OCRErrBucketName:   env.Mandatory("OCR_ERR_BUCKET_NAME"),
+			NLPDstBucketName:   env.Mandatory("NLP_DST_BUCKET_NAME"),
+			NLPErrBucketName:   env.Mandatory("NLP_ERR_BUCKET_NAME"),
+		}
+	}
+	cfg.ProjectID = projectID
+	cfg.LocalDir = localDir
+	// ocrStats reads the OCR output of every image for its text statistics
+	cfg.OCRStats = utils.GetBoolEnvVar("OCR_STATS", true)
+
+	// output. a local directory or a gs://<bucket>/<prefix> location
+	cfg.Output = utils.GetStrEnvVar("OUTPUT", "export")
+	formats, err := export.ParseFormats(utils.GetListEnvVar("FORMATS", []string{string(export.FormatNDJSON), string(export.FormatParquet)}))
+	if err != nil {
+		env.Fail(fmt.Errorf("invalid FORMATS: %w", err))
+	}
+	cfg.Formats = formats
+	// shardRows is the number of records per file
+	cfg.ShardRows = env.Int("SHARD_ROWS", 100000)
+
+	// pageSize is the number of image documents read at once, exported by concurrency workers
+	cfg.PageSize = env.Int("PAGE_SIZE", 500)
+	cfg.Concurrency = env.Int("CONCURRENCY", 16)
+	// limit is the number of records exported, mainly used for testing. Zero means no limit
+	cfg.Limit = utils.GetIntEnvVar("LIMIT", 0)
+
+	// bigquery. the ndjson files are loaded to the [project.]dataset.table BQ_TABLE when set
+	cfg.BQTable = utils.GetStrEnvVar("BQ_TABLE", "")
+	cfg.BQProjectID = utils.GetStrEnvVar("BQ_PROJECT_ID", projectID)
+	cfg.BQWrite = env.OneOf("BQ_WRITE", bqWriteTruncate, bqWriteTruncate, bqWriteAppend)
+	if cfg.BQTable != "" {
+		if cfg.BQProjectID == "" && strings.Count(cfg.BQTable, ".") < 2 {
+			env.Fail(errors.New("env var BQ_PROJECT_ID or GCP_PROJECT_ID required to load to BigQuery"))
+		}
+		if !hasFormat(cfg.Formats, export.FormatNDJSON) {
+			env.Fail(errors.New("FORMATS must include ndjson to load to BigQuery"))
+		}
+	}
+
+	return cfg, env.Err()
+}
+
+func hasFormat(formats []export.Format, f export.Format) bool {
+	for _, v := range formats {
+		if v == f {
+			return true
+		}
+	}
+	return false
+}
+
+// readJSON reads the JSON file name into v.
+func readJSON(name string, v any) error {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return fmt.Errorf("failed to read (%s): %w", name, err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("failed to parse (%s): %w", name, err)
+	}
+	return nil
+}
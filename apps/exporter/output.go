@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"cloud.google.com/go/storage"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/export"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/logging"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+)
+
+type exportStats struct {
+	Records, Failures int
+	// Statuses are the number of records by status
+	Statuses map[string]int
+}
+
+// run exports the records of the images of a source, in pages of pageSize images whose records are
+// read by concurrency workers. Images whose record cannot be read are logged and counted as
+// failures. At most limit images are exported, zero means no limit.
+func run(ctx context.Context, src source, out *output, pageSize, concurrency, limit int, exportedAt time.Time) (exportStats, error) {
+	st := exportStats{Statuses: map[string]int{}}
+	// errLimit stops the iteration once the limit is reached
+	errLimit := errors.New("limit reached")
+	seen := 0
+
+	err := src.pages(ctx, pageSize, func(imgs []types.ImageDocument) error {
+		if limit > 0 && seen+len(imgs) > limit {
+			imgs = imgs[:limit-seen]
+		}
+		seen += len(imgs)
+
+		recs := make([]export.Record, len(imgs))
+		errs := make([]error, len(imgs))
+		sem := make(chan struct{}, concurrency)
+		var wg sync.WaitGroup
+		for i := range imgs {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int) {
+				defer func() { <-sem; wg.Done() }()
+				recs[i], errs[i] = src.record(ctx, imgs[i], exportedAt)
+			}(i)
+		}
+		wg.Wait()
+
+		// records are written in page order
+		batch := make([]export.Record, 0, len(recs))
+		for i, r := range recs {
+			if errs[i] != nil {
+				st.Failures++
+				log.Error().Err(errs[i]).Caller().Str(logging.FieldHash, imgs[i].Hash).Msg("failed to read record")
+				continue
+			}
+			batch = append(batch, r)
+			st.Statuses[r.Status]++
+		}
+		if err := out.write(ctx, batch); err != nil {
+			return err
+		}
+		st.Records += len(batch)
+		log.Info().Int("records", st.Records).Int("failures", st.Failures).Msg("page exported")
+
+		if limit > 0 && seen >= limit {
+			return errLimit
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errLimit) {
+		out.abort()
+		return st, err
+	}
+	return st, out.close()
+}
+
+// output writes the records to numbered files of at most shardRows records, one per format,
+// records-<shard>.<ext>, in a local directory or a gs://<bucket>/<prefix> location.
+type output struct {
+	store     *storage.Client
+	base      string
+	formats   []export.Format
+	shardRows int
+
+	shard, rows int
+	open        []shardFile
+	// files are the names of the completed files
+	files []string
+}
+
+type shardFile struct {
+	name string
+	wc   io.WriteCloser
+	w    export.Writer
+}
+
+// write writes records, rotating the files every shardRows records.
+func (o *output) write(ctx context.Context, recs []export.Record) error {
+	for len(recs) > 0 {
+		if o.open == nil {
+			if err := o.openShard(ctx); err != nil {
+				return err
+			}
+		}
+		n := min(len(recs), o.shardRows-o.rows)
+		for _, f := range o.open {
+			if err := f.w.Write(recs[:n]...); err != nil {
+				return fmt.Errorf("failed to write (%s): %w", f.name, err)
+			}
+		}
+		o.rows += n
+		recs = recs[n:]
+		if o.rows >= o.shardRows {
+			if err := o.closeShard(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (o *output) openShard(ctx context.Context) error {
+	for _, f := range o.formats {
+		name := o.join(fmt.Sprintf("records-%05d.%s", o.shard, f.Extension()))
+		wc, err := o.create(ctx, name, f.ContentType())
+		if err != nil {
+			return err
+		}
+		w, err := export.NewWriter(wc, f)
+		if err != nil {
+			wc.Close()
+			return err
+		}
+		o.open = append(o.open, shardFile{name: name, wc: wc, w: w})
+	}
+	return nil
+}
+
+func (o *output) closeShard() error {
+	var errs []error
+	for _, f := range o.open {
+		if err := f.w.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to flush (%s): %w", f.name, err))
+		}
+		if err := f.wc.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close (%s): %w", f.name, err))
+			continue
+		}
+		o.files = append(o.files, f.name)
+	}
+	o.open = nil
+	o.shard++
+	o.rows = 0
+	return errors.Join(errs...)
+}
+
+// close completes the last files.
+func (o *output) close() error {
+	if o.open == nil {
+		return nil
+	}
+	return o.closeShard()
+}
+
+// abort closes the open files without completing them. Incomplete objects are not written.
+func (o *output) abort() {
+	for _, f := range o.open {
+		if w, ok := f.wc.(*storage.Writer); ok {
+			w.CloseWithError(errors.New("export aborted"))
+			continue
+		}
+		f.wc.Close()
+	}
+	o.open = nil
+}
+
+// join returns the name of a file in the output location.
+func (o *output) join(name string) string {
+	if strings.HasPrefix(o.base, "gs://") {
+		return strings.TrimSuffix(o.base, "/") + "/" + name
+	}
+	return filepath.Join(o.base, name)
+}
+
+// create creates a gs:// object or a local file, and its directory.
+func (o *output) create(ctx context.Context, name, contentType string) (io.WriteCloser, error) {
+	if s, ok := strings.CutPrefix(name, "gs://"); ok {
+		bucket, key, _ := strings.Cut(s, "/")
+		w := o.store.Bucket(bucket).Object(key).NewWriter(ctx)
+		w.ContentType = contentType
+		return w, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create dir (%s): %w", filepath.Dir(name), err)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create (%s): %w", name, err)
+	}
+	return f, nil
+}
+
+// filesOf returns the completed files of a format.
+func (o *output) filesOf(f export.Format) []string {
+	var res []string
+	for _, n := range o.files {
+		if path.Ext(n) == "."+f.Extension() {
+			res = append(res, n)
+		}
+	}
+	return res
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"cloud.google.com/go/documentai/apiv1/documentaipb"
+	"cloud.google.com/go/firestore"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/docai"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/export"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/ingest"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// source is a store of image documents and of their pipeline outputs.
+type source interface {
+	// pages calls fn with pages of at most size image documents, by hash.
+	pages(ctx context.Context, size int, fn func([]types.ImageDocument) error) error
+	// record returns the record of an image.
+	record(ctx context.Context, img types.ImageDocument, exportedAt time.Time) (export.Record, error)
+}
+
+// newRecord returns the pending record of an image document.
+func newRecord(img types.ImageDocument, sources []string, exportedAt time.Time) export.Record {
+	r := export.NewRecord(img.Hash, sources, exportedAt)
+	r.MimeType = img.MimeType
+	r.Size = img.Size
+	r.Width, r.Height, r.Pixels = int64(img.Width), int64(img.Height), int64(img.Pixels)
+	r.Label = img.Label
+	return r
+}
+
+// gcsSource reads the image documents of the deduper firestore collection and the outputs of the
+// ocr-worker and nlp-worker.
+type gcsSource struct {
+	images    *firestore.CollectionRef
+	srcBucket string
+	buckets   docai.StatusBuckets
+	// ocrStats reads the OCR outputs, for their text statistics
+	ocrStats bool
+}
+
+func (s *gcsSource) pages(ctx context.Context, size int, fn func([]types.ImageDocument) error) error {
+	last := ""
+	for {
+		q := s.images.OrderBy("hash", firestore.Asc).Limit(size)
+		if last != "" {
+			q = q.StartAfter(last)
+		}
+		snaps, err := q.Documents(ctx).GetAll()
+		if err != nil {
+			return fmt.Errorf("failed to read image documents: %w", err)
+		}
+		if len(snaps) == 0 {
+			return nil
+		}
+
+		imgs := make([]types.ImageDocument, len(snaps))
+		for i, snap := range snaps {
+			if err := snap.DataTo(&imgs[i]); err != nil {
+				return fmt.Errorf("failed to decode image document (%s): %w", snap.Ref.ID, err)
+			}
+			if imgs[i].Hash == "" {
+				imgs[i].Hash = snap.Ref.ID
+			}
+		}
+		last = imgs[len(imgs)-1].Hash
+
+		if err := fn(imgs); err != nil {
+			return err
+		}
+		if len(snaps) < size {
+			return nil
+		}
+	}
+}
+
+// record joins an image document with the refs, outputs and error records of its first copy, the
+// one submitted for OCR, see the dispatcher.
+func (s *gcsSource) record(ctx context.Context, img types.ImageDocument, exportedAt time.Time) (export.Record, error) {
+	sources := make([]string, len(img.ImagePaths))
+	for i, p := range img.ImagePaths {
+		sources[i] = fmt.Sprintf("gs://%s/%s", s.srcBucket, p)
+	}
+	r := newRecord(img, sources, exportedAt)
+	if len(img.ImagePaths) == 0 {
+		return r, nil
+	}
+	key := fmt.Sprintf("%s/%s", s.srcBucket, img.ImagePaths[0])
+
+	st, err := docai.ReadStatus(ctx, s.buckets, key, img.Hash)
+	if err != nil {
+		return r, err
+	}
+	switch st.Status {
+	case docai.StatusPending:
+		return r, nil
+	case docai.StatusOCRFailed:
+		r.SetError(types.ErrorStageOCR, st.Error.Code, st.Error.Message)
+		return r, nil
+	}
+
+	var doc *documentaipb.Document
+	if s.ocrStats && len(st.Outputs) > 0 {
+		d, complete, err := docai.LoadDocument(ctx, s.buckets.Store.Bucket(st.OCRBucket), st.Outputs[0])
+		if err != nil {
+			return r, err
+		}
+		if complete {
+			doc = d.Document
+		}
+	}
+	r.SetOCR(st.OCROutput, doc)
+
+	switch st.Status {
+	case docai.StatusDone:
+		b, err := docai.ReadObject(ctx, s.buckets.NLPDst.Object(st.NLPName))
+		if err != nil {
+			return r, err
+		}
+		return r, r.SetNLP(b)
+	case docai.StatusNLPFailed:
+		r.SetError(types.ErrorStageNLP, st.Error.Code, st.Error.Message)
+	}
+	return r, nil
+}
+
+// Output tree directories of apps/local, under its OUT_DIR.
+const (
+	localOCRDir = "ocr"
+	localNLPDir = "nlp"
+	localErrDir = "err"
+)
+
+// localSource reads the image index and the output tree of apps/local.
+type localSource struct {
+	dir string
+}
+
+func (s *localSource) pages(ctx context.Context, size int, fn func([]types.ImageDocument) error) error {
+	var imgs []types.ImageDocument
+	if err := readJSON(filepath.Join(s.dir, ingest.IndexFile), &imgs); err != nil {
+		return err
+	}
+	for len(imgs) > 0 {
+		n := min(size, len(imgs))
+		if err := fn(imgs[:n]); err != nil {
+			return err
+		}
+		imgs = imgs[n:]
+	}
+	return nil
+}
+
+// record joins an image document with the outputs and error record of its first copy, see
+// apps/local.
+func (s *localSource) record(ctx context.Context, img types.ImageDocument, exportedAt time.Time) (export.Record, error) {
+	r := newRecord(img, img.ImagePaths, exportedAt)
+	if len(img.ImagePaths) == 0 {
+		return r, nil
+	}
+	p := img.ImagePaths[0]
+	path := func(dir string) string {
+		return filepath.Join(s.dir, dir, filepath.FromSlash(p)+".json")
+	}
+
+	// ocr
+	b, err := os.ReadFile(path(localOCRDir))
+	if err == nil {
+		var doc documentaipb.Document
+		if err := protojson.Unmarshal(b, &doc); err != nil {
+			return r, fmt.Errorf("failed to parse document JSON (%s): %w", path(localOCRDir), err)
+		}
+		r.SetOCR(localOCRDir+"/"+p+".json", &doc)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return r, err
+	}
+
+	// nlp
+	b, err = os.ReadFile(path(localNLPDir))
+	if err == nil {
+		return r, r.SetNLP(b)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return r, err
+	}
+
+	// errors
+	b, err = os.ReadFile(path(localErrDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return r, err
+	}
+	rec := docai.ParseErrorRecord(b)
+	r.SetError(rec.Stage, rec.Code, rec.Message)
+	return r, nil
+}
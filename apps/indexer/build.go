@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/api/iterator"
+
+	"cloud.google.com/go/documentai/apiv1/documentaipb"
+	"cloud.google.com/go/storage"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/docai"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/logging"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/search"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// source is a store of nlp outputs and of the ocr outputs they were computed from.
+type source interface {
+	// walk calls fn with the name of every nlp output.
+	walk(ctx context.Context, fn func(name string) error) error
+	// read returns an nlp output and its version, which changes when the output is rewritten.
+	read(ctx context.Context, name string) ([]byte, string, error)
+	// text returns the text of an ocr output, see types.NLPOutput.
+	text(ctx context.Context, ocrOutput string) (string, error)
+}
+
+type buildStats struct {
+	Indexed, Unchanged, Failures int
+}
+
+// build indexes the nlp outputs of a source with the text of their ocr outputs, in batches of
+// batchSize documents. Documents already indexed at the same version are skipped, unless reindex
+// is set. Outputs that cannot be read are logged and counted as failures; index errors stop the
+// build.
+func build(ctx context.Context, idx search.Index, src source, batchSize int, reindex bool) (buildStats, error) {
+	var st buildStats
+	var batch []search.Document
+	// pending are the ids of the batch. Copies of an image share their document, see apps/local.
+	pending := map[string]bool{}
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := idx.Index(ctx, batch...); err != nil {
+			return err
+		}
+		st.Indexed += len(batch)
+		log.Info().Int("indexed", st.Indexed).Int("unchanged", st.Unchanged).Int("failures", st.Failures).Msg("batch indexed")
+		batch, pending = batch[:0], map[string]bool{}
+		return nil
+	}
+
+	err := src.walk(ctx, func(name string) error {
+		b, version, err := src.read(ctx, name)
+		if err != nil {
+			st.Failures++
+			log.Error().Err(err).Caller().Str(logging.FieldObject, name).Msg("failed to read nlp output")
+			return nil
+		}
+		d, err := search.NewDocument("", b)
+		if err != nil {
+			st.Failures++
+			log.Error().Err(err).Caller().Str(logging.FieldObject, name).Msg("failed to parse nlp output")
+			return nil
+		}
+		d.Version = version
+
+		if pending[d.ID()] {
+			st.Unchanged++
+			return nil
+		}
+		if !reindex {
+			v, ok, err := idx.Version(ctx, d.ID())
+			if err != nil {
+				return err
+			}
+			if ok && v == version {
+				st.Unchanged++
+				return nil
+			}
+		}
+
+		if d.Text, err = src.text(ctx, d.OCROutput); err != nil {
+			st.Failures++
+			log.Error().Err(err).Caller().Str(logging.FieldObject, name).Str("ocr_output", d.OCROutput).Msg("failed to read ocr output")
+			return nil
+		}
+		batch = append(batch, d)
+		pending[d.ID()] = true
+		if len(batch) >= batchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return st, err
+	}
+	return st, flush()
+}
+
+// gcsSource reads the nlp-worker outputs, keyed by hash, and the ocr-worker outputs.
+type gcsSource struct {
+	store  *storage.Client
+	nlp    *storage.BucketHandle
+	prefix string
+}
+
+func (s *gcsSource) walk(ctx context.Context, fn func(name string) error) error {
+	it := s.nlp.Objects(ctx, &storage.Query{Prefix: s.prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to list nlp outputs (%s): %w", s.prefix, err)
+		}
+		if !strings.HasSuffix(attrs.Name, ".json") {
+			continue
+		}
+		if err := fn(attrs.Name); err != nil {
+			return err
+		}
+	}
+}
+
+// read returns an nlp output, versioned by its generation.
+func (s *gcsSource) read(ctx context.Context, name string) ([]byte, string, error) {
+	r, err := s.nlp.Object(name).NewReader(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create reader (%s): %w", name, err)
+	}
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read (%s): %w", name, err)
+	}
+	return b, strconv.FormatInt(r.Attrs.Generation, 10), nil
+}
+
+// text returns the text of the gs://<bucket>/<op-id>/<index> ocr output, loaded from its output
+// objects, see docai.LoadDocument.
+func (s *gcsSource) text(ctx context.Context, ocrOutput string) (string, error) {
+	bucket, prefix, ok := strings.Cut(strings.TrimPrefix(ocrOutput, "gs://"), "/")
+	if !ok || !strings.HasPrefix(ocrOutput, "gs://") {
+		return "", fmt.Errorf("invalid ocr output: %s", ocrOutput)
+	}
+	b := s.store.Bucket(bucket)
+
+	it := b.Objects(ctx, &storage.Query{Prefix: strings.TrimSuffix(prefix, "/") + "/"})
+	attrs, err := it.Next()
+	if err == iterator.Done {
+		return "", fmt.Errorf("no ocr output objects (%s)", ocrOutput)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to list ocr output objects (%s): %w", ocrOutput, err)
+	}
+
+	doc, complete, err := docai.LoadDocument(ctx, b, attrs.Name)
+	if err != nil {
+		return "", err
+	}
+	if !complete {
+		return "", fmt.Errorf("ocr output shards pending (%s)", ocrOutput)
+	}
+	return doc.GetText(), nil
+}
+
+// localSource reads the output tree of apps/local: the nlp outputs under nlp/, their ocr outputs
+// under ocr/.
+type localSource struct {
+	dir string
+}
+
+func (s *localSource) walk(ctx context.Context, fn func(name string) error) error {
+	root := filepath.Join(s.dir, "nlp")
+	return filepath.WalkDir(root, func(p string, e fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && p == root {
+				return fmt.Errorf("no nlp outputs (%s): %w", root, err)
+			}
+			return err
+		}
+		if e.IsDir() || filepath.Ext(p) != ".json" {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(p)
+	})
+}
+
+// read returns an nlp output, versioned by its content: the copies of an image share their output.
+func (s *localSource) read(ctx context.Context, name string) ([]byte, string, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read (%s): %w", name, err)
+	}
+	sum := sha256.Sum256(b)
+	return b, hex.EncodeToString(sum[:8]), nil
+}
+
+// text returns the text of an ocr output, a path relative to the output tree.
+func (s *localSource) text(ctx context.Context, ocrOutput string) (string, error) {
+	name := filepath.Join(s.dir, filepath.FromSlash(ocrOutput))
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read (%s): %w", name, err)
+	}
+	var doc documentaipb.Document
+	if err := protojson.Unmarshal(b, &doc); err != nil {
+		return "", fmt.Errorf("failed to parse document JSON (%s): %w", name, err)
+	}
+	return doc.GetText(), nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/search"
+)
+
+// writeTree writes the output tree of apps/local: an image and its copy, and a second image.
+func writeTree(t *testing.T, dir string) {
+	files := map[string]string{
+		"ocr/a.jpg.json": `{"text": "Facture de Jean Dupont"}`,
+		"nlp/a.jpg.json": `{"hash": "h1", "source_uris": ["a.jpg", "copy/a.jpg"], "ocr_output": "ocr/a.jpg.json", "language": "fr"}`,
+		// the copy of a.jpg, sharing its output
+		"ocr/copy/a.jpg.json": `{"text": "Facture de Jean Dupont"}`,
+		"nlp/copy/a.jpg.json": `{"hash": "h1", "source_uris": ["a.jpg", "copy/a.jpg"], "ocr_output": "ocr/a.jpg.json", "language": "fr"}`,
+		"ocr/b.png.json":      `{"text": "Invoice"}`,
+		"nlp/b.png.json":      `{"hash": "h2", "source_uris": ["b.png"], "ocr_output": "ocr/b.png.json", "language": "en"}`,
+		// a malformed output
+		"nlp/c.png.json": `{`,
+	}
+	for name, s := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(s), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeTree(t, dir)
+
+	idx, err := search.Open(search.BackendBleve, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	src := &localSource{dir: dir}
+
+	st, err := build(ctx, idx, src, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := (buildStats{Indexed: 2, Unchanged: 1, Failures: 1}); st != expect {
+		t.Fatalf("expected: %+v, result: %+v", expect, st)
+	}
+
+	res, err := idx.Search(ctx, search.Query{Text: "dupont"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Hits) != 1 || res.Hits[0].ID != "h1" || !reflect.DeepEqual(res.Hits[0].SourceURIs, []string{"a.jpg", "copy/a.jpg"}) {
+		t.Fatalf("unexpected hits: %+v", res.Hits)
+	}
+
+	// unchanged outputs are not indexed again, changed ones are
+	nlp := `{"hash": "h2", "source_uris": ["b.png"], "ocr_output": "ocr/b.png.json", "language": "de"}`
+	if err := os.WriteFile(filepath.Join(dir, "nlp", "b.png.json"), []byte(nlp), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	st, err = build(ctx, idx, src, 10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := (buildStats{Indexed: 1, Unchanged: 2, Failures: 1}); st != expect {
+		t.Fatalf("expected: %+v, result: %+v", expect, st)
+	}
+
+	// reindex
+	st, err = build(ctx, idx, src, 10, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := (buildStats{Indexed: 2, Unchanged: 1, Failures: 1}); st != expect {
+		t.Fatalf("expected: %+v, result: %+v", expect, st)
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := map[string]struct {
+		params string
+		expect search.Query
+		err    bool
+	}{
+		"empty": {params: "", expect: search.Query{}},
+		"all": {
+			params: "q=facture&language=fr&source=gs://src/2019/&size=20&from=40&entity.person=jean+dupont",
+			expect: search.Query{Text: "facture", Language: "fr", Source: "gs://src/2019/", Size: 20, From: 40, Entities: map[string]string{"person": "jean dupont"}},
+		},
+		"size":     {params: "size=x", err: true},
+		"negative": {params: "from=-1", err: true},
+		"too many": {params: "size=100000", err: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			v, err := url.ParseQuery(tc.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := parseQuery(v)
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tc.expect, res) {
+				t.Fatalf("expected: %+v, result: %+v", tc.expect, res)
+			}
+		})
+	}
+}
+
+func TestSearchHandler(t *testing.T) {
+	idx, err := search.Open(search.BackendBleve, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	h := routes(idx)
+
+	tests := map[string]struct {
+		target string
+		code   int
+	}{
+		"ok":          {target: "/search?q=facture", code: http.StatusOK},
+		"bad param":   {target: "/search?size=x", code: http.StatusBadRequest},
+		"bad query":   {target: "/search?q=" + url.QueryEscape(`"unterminated`), code: http.StatusBadRequest},
+		"bad method":  {target: "/search", code: http.StatusMethodNotAllowed},
+		"not a route": {target: "/nope", code: http.StatusNotFound},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			method := http.MethodGet
+			if name == "bad method" {
+				method = http.MethodPost
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(method, tc.target, strings.NewReader("")))
+			if w.Code != tc.code {
+				t.Fatalf("expected: %d, result: %d %s", tc.code, w.Code, w.Body.String())
+			}
+		})
+	}
+}
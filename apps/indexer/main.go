@@ -0,0 +1,171 @@
+// Package main is the indexer command. It builds a full-text search index of the OCR text and NLP
+// entities of the documents, keyed by image content hash, searches it and serves it over HTTP.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rs/zerolog/log"
+
+	"cloud.google.com/go/storage"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/logging"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/search"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/server"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/utils"
+)
+
+const usage = `usage: indexer <command>
+
+commands:
+  build           index the nlp outputs, with the text of their ocr outputs, not yet indexed (default)
+  search <query>  print the documents matching a query, e.g. 'facture +entities.person:dupont'
+  serve           serve the index over HTTP, GET /search?q=<query>
+`
+
+func main() {
+	ctx := context.Background()
+
+	// logger
+	logging.Init("indexer")
+
+	// command
+	cmd := "build"
+	if len(os.Args) > 1 {
+		cmd = os.Args[1]
+	}
+
+	// app config
+	cfg, err := getConfig(cmd)
+	if err != nil {
+		log.Fatal().Err(err).Caller().Msg("invalid config")
+	}
+
+	// index
+	idx, err := search.Open(cfg.Backend, cfg.Location)
+	if err != nil {
+		log.Fatal().Err(err).Caller().Str("backend", cfg.Backend).Msg("failed to open index")
+	}
+	defer idx.Close()
+
+	switch cmd {
+	case "build":
+		src, closeSrc, err := newSource(ctx, cfg)
+		if err != nil {
+			log.Fatal().Err(err).Caller().Msg("failed to open source")
+		}
+		defer closeSrc()
+		st, err := build(ctx, idx, src, cfg.BatchSize, cfg.Reindex)
+		if err != nil {
+			// the batches indexed so far are kept, the next build resumes with the changed documents
+			closeSrc()
+			idx.Close()
+			log.Fatal().Err(err).Caller().Int("indexed", st.Indexed).Int("unchanged", st.Unchanged).Int("failures", st.Failures).Msg("failed to build index")
+		}
+		log.Info().Int("indexed", st.Indexed).Int("unchanged", st.Unchanged).Int("failures", st.Failures).Msg("index built")
+	case "search":
+		if len(os.Args) < 3 {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		q := cfg.Query
+		q.Text = strings.Join(os.Args[2:], " ")
+		res, err := idx.Search(ctx, q)
+		if err != nil {
+			log.Fatal().Err(err).Caller().Msg("failed to search")
+		}
+		printResult(res)
+	case "serve":
+		// serve the index until the process is interrupted
+		server.Serve(routes(idx), cfg.Port)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+// newSource returns the source of the documents to index, the local output tree or the nlp
+// bucket, and its close function.
+func newSource(ctx context.Context, cfg appConfig) (source, func(), error) {
+	if cfg.LocalDir != "" {
+		return &localSource{dir: cfg.LocalDir}, func() {}, nil
+	}
+
+	store, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create storage client: %w", err)
+	}
+	src := &gcsSource{store: store, nlp: store.Bucket(cfg.NLPDstBucketName), prefix: cfg.Prefix}
+	return src, func() { store.Close() }, nil
+}
+
+func printResult(res *search.Result) {
+	fmt.Printf("%d documents (%d ms)\n\n", res.Total, res.TookMS)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SCORE\tID\tLANGUAGE\tSOURCES")
+	for _, h := range res.Hits {
+		fmt.Fprintf(w, "%.3f\t%s\t%s\t%s\n", h.Score, h.ID, h.Language, strings.Join(h.SourceURIs, " "))
+		for _, f := range h.Fragments {
+			fmt.Fprintf(w, "\t\t\t  %s\n", strings.Join(strings.Fields(f), " "))
+		}
+	}
+	w.Flush()
+}
+
+type appConfig struct {
+	Backend          string
+	Location         string
+	LocalDir         string
+	NLPDstBucketName string
+	Prefix           string
+	BatchSize        int
+	Reindex          bool
+	Port             string
+	Query            search.Query
+}
+
+func getConfig(cmd string) (appConfig, error) {
+	var env utils.EnvReader
+
+	// index. the location is the index directory of the bleve backend
+	backend := utils.GetStrEnvVar("INDEX_BACKEND", search.BackendBleve)
+	location := utils.GetStrEnvVar("INDEX_LOCATION", "index.bleve")
+
+	// build source. localDir is the OUT_DIR of apps/local, the nlp bucket is read otherwise
+	localDir := utils.GetStrEnvVar("LOCAL_DIR", "")
+	nlpDstBucketName := utils.GetStrEnvVar("NLP_DST_BUCKET_NAME", "")
+	if cmd == "build" && localDir == "" && nlpDstBucketName == "" {
+		env.Fail(errors.New("env var LOCAL_DIR or NLP_DST_BUCKET_NAME required"))
+	}
+	// prefix restricts the build to the nlp outputs under a prefix
+	prefix := utils.GetStrEnvVar("PREFIX", "")
+	batchSize := env.Int("BATCH_SIZE", 100)
+	// reindex indexes every document, changed or not, e.g. after a mapping change
+	reindex := utils.GetBoolEnvVar("REINDEX", false)
+
+	// serve
+	port := utils.GetStrEnvVar("PORT", "8080")
+
+	// search filters of the search command
+	q := search.Query{
+		Language: utils.GetStrEnvVar("SEARCH_LANGUAGE", ""),
+		Source:   utils.GetStrEnvVar("SEARCH_SOURCE", ""),
+		Size:     env.Int("SEARCH_SIZE", search.DefaultSize),
+	}
+
+	return appConfig{
+		Backend:          backend,
+		Location:         location,
+		LocalDir:         localDir,
+		NLPDstBucketName: nlpDstBucketName,
+		Prefix:           prefix,
+		BatchSize:        batchSize,
+		Reindex:          reindex,
+		Port:             port,
+		Query:            q,
+	}, env.Err()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/search"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/server"
+)
+
+// entityParam is the prefix of the entity filter parameters, e.g. entity.person=dupont.
+const entityParam = "entity."
+
+// routes serves the index search and liveness endpoints.
+func routes(idx search.Index) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /search", func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseQuery(r.URL.Query())
+		if err != nil {
+			server.WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		res, err := idx.Search(r.Context(), q)
+		if errors.Is(err, search.ErrInvalidQuery) {
+			server.WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			log.Error().Err(err).Caller().Str("q", q.Text).Msg("search failed")
+			server.WriteError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		server.WriteJSON(w, http.StatusOK, res)
+	})
+	mux.HandleFunc("GET /livez", func(w http.ResponseWriter, r *http.Request) {
+		server.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	return mux
+}
+
+// parseQuery returns the query of the search parameters: q, language, source, size, from and the
+// entity.<type> filters.
+func parseQuery(v url.Values) (search.Query, error) {
+	q := search.Query{
+		Text:     v.Get("q"),
+		Language: v.Get("language"),
+		Source:   v.Get("source"),
+	}
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{{"size", &q.Size}, {"from", &q.From}} {
+		s := v.Get(p.name)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return q, fmt.Errorf("invalid %s: %s", p.name, s)
+		}
+		*p.dst = n
+	}
+	if q.Size > search.MaxSize {
+		return q, fmt.Errorf("invalid size: %d, at most %d", q.Size, search.MaxSize)
+	}
+	for k := range v {
+		if t, ok := strings.CutPrefix(k, entityParam); ok && t != "" {
+			if q.Entities == nil {
+				q.Entities = map[string]string{}
+			}
+			q.Entities[t] = v.Get(k)
+		}
+	}
+	return q, nil
+}
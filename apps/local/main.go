@@ -0,0 +1,127 @@
+// Package main is the local command. It runs the dedup, OCR and NLP flow on a local directory, or
+// a tar or zip archive, of images and writes the results to a local output tree mirroring the
+// source layout. No bucket, topic nor database is used: only the Document AI and Natural Language
+// APIs are called.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+
+	documentai "cloud.google.com/go/documentai/apiv1"
+	language "cloud.google.com/go/language/apiv1"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/ingest"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/logging"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/nlp"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/utils"
+	"google.golang.org/api/option"
+)
+
+func main() {
+	ctx := context.Background()
+
+	// logger
+	logging.Init("local")
+
+	// app config
+	cfg, err := getConfig()
+	if err != nil {
+		log.Fatal().Err(err).Caller().Msg("invalid config")
+	}
+
+	// dedup
+	images, err := ingest.Index(cfg.SrcPath, cfg.SrcGlob)
+	if err != nil {
+		log.Fatal().Err(err).Caller().Str("src", cfg.SrcPath).Msg("failed to index source")
+	}
+	if err := os.MkdirAll(cfg.OutDir, 0o755); err != nil {
+		log.Fatal().Err(err).Caller().Str("dir", cfg.OutDir).Msg("failed to create output dir")
+	}
+	if err := ingest.WriteIndex(filepath.Join(cfg.OutDir, ingest.IndexFile), images); err != nil {
+		log.Fatal().Err(err).Caller().Msg("failed to write index")
+	}
+	log.Info().Int("images", len(images)).Msg("source indexed")
+
+	// doc ai processor
+	endpoint := fmt.Sprintf("%s-documentai.googleapis.com:443", cfg.DocAIProcessorLocation)
+	ai, err := documentai.NewDocumentProcessorClient(ctx, option.WithEndpoint(endpoint))
+	if err != nil {
+		log.Fatal().Err(err).Caller().Msg("failed to create Document AI client")
+	}
+	defer ai.Close()
+
+	// language client
+	lang, err := language.NewClient(ctx)
+	if err != nil {
+		log.Fatal().Err(err).Caller().Msg("failed to create language client")
+	}
+	defer lang.Close()
+
+	p := &pipeline{
+		ai:     ai,
+		proc:   fmt.Sprintf("projects/%s/locations/%s/processors/%s", cfg.ProjectID, cfg.DocAIProcessorLocation, cfg.DocAIProcessorID),
+		lang:   lang,
+		opts:   cfg.Analysis,
+		outDir: cfg.OutDir,
+		images: indexByPath(images),
+	}
+	if err := ingest.Walk(cfg.SrcPath, cfg.SrcGlob, func(f ingest.File) error {
+		p.process(ctx, f)
+		return nil
+	}); err != nil {
+		log.Fatal().Err(err).Caller().Str("src", cfg.SrcPath).Msg("failed to read source")
+	}
+
+	log.Info().
+		Int("images", len(images)).
+		Int("processed", p.processed).
+		Int("skipped", p.skipped).
+		Int("failures", p.failures).
+		Msg("done")
+}
+
+type appConfig struct {
+	SrcPath                string
+	SrcGlob                string
+	OutDir                 string
+	ProjectID              string
+	DocAIProcessorID       string
+	DocAIProcessorLocation string
+	Analysis               nlp.Options
+}
+
+func getConfig() (appConfig, error) {
+	var env utils.EnvReader
+
+	// source, a directory or a tar or zip archive
+	srcPath := env.Mandatory("SRC_PATH")
+	srcGlob := utils.GetStrEnvVar("SRC_GLOB", "**/*.jpg")
+	outDir := utils.GetStrEnvVar("OUT_DIR", "out")
+
+	// gcp
+	projectID := env.Mandatory("GCP_PROJECT_ID")
+
+	// doc ai
+	docAIProcessorID := env.Mandatory("DOC_AI_PROCESSOR_ID")
+	docAIProcessorLocation := env.Mandatory("DOC_AI_PROCESSOR_LOCATION")
+
+	// analysis, see nlp.OptionsFromEnv
+	analysis, err := nlp.OptionsFromEnv()
+	if err != nil {
+		env.Fail(err)
+	}
+
+	return appConfig{
+		SrcPath:                srcPath,
+		SrcGlob:                srcGlob,
+		OutDir:                 outDir,
+		ProjectID:              projectID,
+		DocAIProcessorID:       docAIProcessorID,
+		DocAIProcessorLocation: docAIProcessorLocation,
+		Analysis:               analysis,
+	}, env.Err()
+}
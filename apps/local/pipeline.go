@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+
+	documentai "cloud.google.com/go/documentai/apiv1"
+	"cloud.google.com/go/documentai/apiv1/documentaipb"
+	language "cloud.google.com/go/language/apiv1"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/ingest"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/logging"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/nlp"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Output tree directories, under OUT_DIR. Each holds a file per source image, at the image path.
+const (
+	ocrDir = "ocr"
+	nlpDir = "nlp"
+	errDir = "err"
+)
+
+// pipeline runs the OCR and NLP of each unique image of a local source.
+type pipeline struct {
+	ai     *documentai.DocumentProcessorClient
+	proc   string
+	lang   *language.Client
+	opts   nlp.Options
+	outDir string
+	// images are the unique images of the source, by path of each copy
+	images map[string]*ingest.Image
+
+	processed, skipped, failures int
+}
+
+// indexByPath returns the images by source path.
+func indexByPath(images []ingest.Image) map[string]*ingest.Image {
+	m := map[string]*ingest.Image{}
+	for i := range images {
+		for _, p := range images[i].ImagePaths {
+			m[p] = &images[i]
+		}
+	}
+	return m
+}
+
+// outputPath returns the path of the output of a source image in the output tree dir.
+func (p *pipeline) outputPath(dir, src string) string {
+	return filepath.Join(p.outDir, dir, filepath.FromSlash(src)+".json")
+}
+
+// process runs the OCR and NLP of a source file, once per unique image: the results are written at
+// the path of every copy. Images whose NLP output exists are skipped, so that interrupted runs can
+// be resumed. Failures are written to the err tree.
+func (p *pipeline) process(ctx context.Context, f ingest.File) {
+	img, ok := p.images[f.Path]
+	if !ok || img.ImagePaths[0] != f.Path {
+		// not an image, or a copy of an image processed at the path of its first copy
+		return
+	}
+	if _, err := os.Stat(p.outputPath(nlpDir, f.Path)); err == nil {
+		p.skipped++
+		return
+	}
+
+	stage, err := p.run(ctx, f, img)
+	if err != nil {
+		p.failures++
+		log.Error().Err(err).Caller().Str(logging.FieldObject, f.Path).Str("stage", stage).Msg("failed to process image")
+		r := types.NewErrorRecord(stage, "", f.Path, 0, fmt.Sprintf("failed to process image (%s)", f.Path), err)
+		for _, src := range img.ImagePaths {
+			if werr := writeJSON(p.outputPath(errDir, src), r); werr != nil {
+				log.Error().Err(werr).Caller().Str(logging.FieldObject, src).Msg("failed to write error record")
+			}
+		}
+		return
+	}
+	p.processed++
+	for _, src := range img.ImagePaths {
+		// errors of previous runs
+		os.Remove(p.outputPath(errDir, src))
+	}
+	log.Info().Str(logging.FieldObject, f.Path).Str(logging.FieldHash, img.Hash).Msg("processed")
+}
+
+// run performs the OCR and NLP of an image and writes their outputs. It returns the stage that
+// failed.
+func (p *pipeline) run(ctx context.Context, f ingest.File, img *ingest.Image) (string, error) {
+	b, err := ingest.ReadFile(f)
+	if err != nil {
+		return types.ErrorStageOCR, err
+	}
+
+	// ocr
+	resp, err := p.ai.ProcessDocument(ctx, &documentaipb.ProcessRequest{
+		Name:            p.proc,
+		SkipHumanReview: true,
+		Source: &documentaipb.ProcessRequest_RawDocument{
+			RawDocument: &documentaipb.RawDocument{Content: b, MimeType: img.MimeType},
+		},
+	})
+	if err != nil {
+		return types.ErrorStageOCR, fmt.Errorf("failed to process document: %w", err)
+	}
+	doc := resp.GetDocument()
+	jso, err := protojson.Marshal(doc)
+	if err != nil {
+		return types.ErrorStageOCR, fmt.Errorf("failed to encode document: %w", err)
+	}
+	for _, src := range img.ImagePaths {
+		if err := writeFile(p.outputPath(ocrDir, src), jso); err != nil {
+			return types.ErrorStageOCR, err
+		}
+	}
+
+	// nlp
+	res, err := nlp.Analyze(ctx, p.lang, doc, p.opts)
+	if err != nil {
+		return types.ErrorStageNLP, fmt.Errorf("failed to analyze document: %w", err)
+	}
+	out := res.Output()
+	out.Hash = img.Hash
+	out.SourceURIs = img.ImagePaths
+	out.OCROutput = path.Join(ocrDir, f.Path+".json")
+
+	// the nlp output of the first copy is written last: it marks the image as processed
+	for i := len(img.ImagePaths) - 1; i >= 0; i-- {
+		if err := writeJSON(p.outputPath(nlpDir, img.ImagePaths[i]), out); err != nil {
+			return types.ErrorStageNLP, err
+		}
+	}
+	return "", nil
+}
+
+// writeJSON writes v to the file name as JSON, see writeFile.
+func writeJSON(name string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode (%s): %w", name, err)
+	}
+	return writeFile(name, b)
+}
+
+// writeFile writes b to the file name, creating its directory. The file is written to a temporary
+// file first so that interrupted runs do not leave truncated outputs.
+func writeFile(name string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return fmt.Errorf("failed to create dir (%s): %w", filepath.Dir(name), err)
+	}
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return fmt.Errorf("failed to write (%s): %w", name, err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return fmt.Errorf("failed to rename (%s): %w", name, err)
+	}
+	return nil
+}
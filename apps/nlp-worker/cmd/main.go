@@ -2,7 +2,7 @@
 package main
 
 import (
-	"log"
+	"github.com/rs/zerolog/log"
 
 	"github.com/GoogleCloudPlatform/functions-framework-go/funcframework"
 	_ "github.com/cyber-nic/go-gcp-doc-ai/apps/nlp-worker"
@@ -12,6 +12,6 @@ func main() {
 	// The server will run on port 8080
 	port := "8080"
 	if err := funcframework.Start(port); err != nil {
-		log.Fatalf("funcframework.Start: %v\n", err)
+		log.Fatal().Err(err).Caller().Msg("funcframework.Start")
 	}
 }
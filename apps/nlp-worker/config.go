@@ -0,0 +1,56 @@
+package worker
+
+import (
+	"time"
+
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/nlp"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/utils"
+)
+
+type appConfig struct {
+	Debug          bool
+	ProjectID      string
+	DstBucketName  string
+	ErrBucketName  string
+	RefsBucketName string
+	// Timeout is the processing budget of an invocation, under the function timeout.
+	Timeout  time.Duration
+	Analysis nlp.Options
+}
+
+// getConfig reads the app config once, at init. Misconfigurations are returned, joined, rather
+// than exiting, so that every invocation fails with the reason.
+func getConfig() (appConfig, error) {
+	var env utils.EnvReader
+
+	debug := utils.GetBoolEnvVar("DEBUG", false)
+
+	// gcp
+	projectID := env.Mandatory("GCP_PROJECT_ID")
+
+	// buckets
+	dstBucketName := env.Mandatory("DST_BUCKET_NAME")
+	errBucketName := env.Mandatory("ERR_BUCKET_NAME")
+	// refsBucketName is the ocr-worker refs bucket, holding the operation manifests
+	refsBucketName := env.Mandatory("REFS_BUCKET_NAME")
+
+	// timeout. Keep it under the function timeout so that errors are recorded before the instance
+	// is stopped
+	timeout := env.Int("NLP_TIMEOUT_SECONDS", 110)
+
+	// analysis, see nlp.OptionsFromEnv
+	analysis, err := nlp.OptionsFromEnv()
+	if err != nil {
+		env.Fail(err)
+	}
+
+	return appConfig{
+		Debug:          debug,
+		ProjectID:      projectID,
+		DstBucketName:  dstBucketName,
+		ErrBucketName:  errBucketName,
+		RefsBucketName: refsBucketName,
+		Timeout:        time.Duration(timeout) * time.Second,
+		Analysis:       analysis,
+	}, env.Err()
+}
@@ -0,0 +1,39 @@
+package worker
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/nlp"
+)
+
+func TestGetConfig(t *testing.T) {
+	t.Setenv("GCP_PROJECT_ID", "project")
+	t.Setenv("DST_BUCKET_NAME", "dst")
+	t.Setenv("ERR_BUCKET_NAME", "err")
+	t.Setenv("REFS_BUCKET_NAME", "refs")
+
+	// happy path. defaults
+	cfg, err := getConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Timeout != 110*time.Second || cfg.Analysis.Language.Split != nlp.SplitPage || cfg.Analysis.MaxChunkBytes != nlp.DefaultMaxChunkBytes {
+		t.Fatalf("expected: default config, result: %+v", cfg)
+	}
+
+	// every misconfiguration is reported
+	t.Setenv("REFS_BUCKET_NAME", "")
+	t.Setenv("NLP_LANGUAGE_SPLIT", "chapter")
+	t.Setenv("NLP_MIN_TOKEN_CONFIDENCE", "high")
+	_, err = getConfig()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, v := range []string{"REFS_BUCKET_NAME", "NLP_LANGUAGE_SPLIT", "NLP_MIN_TOKEN_CONFIDENCE"} {
+		if !strings.Contains(err.Error(), v) {
+			t.Fatalf("expected: %s reported, result: %v", v, err)
+		}
+	}
+}
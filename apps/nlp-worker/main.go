@@ -4,56 +4,96 @@ package worker
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"log"
-	"os"
-	"time"
+	"sync"
+
+	"github.com/rs/zerolog/log"
 
-	"cloud.google.com/go/documentai/apiv1/documentaipb"
 	language "cloud.google.com/go/language/apiv1"
-	"cloud.google.com/go/language/apiv1/languagepb"
 	"cloud.google.com/go/storage"
 
-	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
 	"github.com/cloudevents/sdk-go/v2/event"
-	"github.com/cyber-nic/go-gcp-doc-ai/apps/nlp-worker/libs/utils"
-	"github.com/googleapis/google-cloudevents-go/cloud/storagedata"
-	"google.golang.org/protobuf/encoding/protojson"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/docai"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/function"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/logging"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/nlp"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/telemetry"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// cfg is read and validated once per instance. cfgErr fails every invocation of a misconfigured
+// instance, with the reason.
+var (
+	cfg    appConfig
+	cfgErr error
+)
+
+// The clients are created by the first invocation and reused by the next ones, see getClients.
+var (
+	clientsMu   sync.Mutex
+	nlpClient   *language.Client
+	storeClient function.StorageClient
 )
 
 func init() {
-	functions.CloudEvent("Handler", handler)
+	function.Init("nlp-worker", handler)
+	if cfg, cfgErr = getConfig(); cfgErr != nil {
+		log.Error().Err(cfgErr).Caller().Msg("invalid config")
+	}
 }
 
-// handler is the cloud function entrypoint
-func handler(ctx context.Context, e event.Event) error {
-	if e.Type() != "google.cloud.storage.object.v1.finalized" {
-		return fmt.Errorf("unsupported event type: %s", e.Type())
+// getClients returns the process-wide language and storage clients, creating them on first use.
+// Failed creations are retried by the next invocation.
+func getClients() (*language.Client, *storage.Client, error) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	// the clients outlive the invocation that creates them
+	ctx := context.Background()
+	if nlpClient == nil {
+		c, err := language.NewClient(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create language client: %w", err)
+		}
+		nlpClient = c
+	}
+	store, err := storeClient.Get()
+	if err != nil {
+		return nil, nil, err
 	}
+	return nlpClient, store, nil
+}
 
-	// app config
-	cfg := getConfig()
+// handler is the cloud function entrypoint
+func handler(ctx context.Context, e event.Event) (err error) {
+	// export this invocation's spans before the instance is frozen
+	defer function.Flush(ctx)
 
-	// unmarshal event data
-	var data storagedata.StorageObjectData
-	if err := protojson.Unmarshal(e.Data(), &data); err != nil {
-		return fmt.Errorf("protojson.Unmarshal: %w", err)
+	// app config
+	if cfgErr != nil {
+		return fmt.Errorf("invalid config: %w", cfgErr)
 	}
 
-	// create language client
-	nlp, err := language.NewClient(ctx)
+	// invocation budget
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	// unmarshal event data
+	data, err := function.DecodeFinalized(e)
 	if err != nil {
-		return fmt.Errorf("failed to create language client: %w", err)
+		return err
 	}
-	defer nlp.Close()
 
-	// create storage client
-	store, err := storage.NewClient(ctx)
+	// language and storage clients
+	lang, store, err := getClients()
 	if err != nil {
-		return fmt.Errorf("failed to create storage client: %w", err)
+		return err
 	}
-	defer store.Close()
 
 	// err bucket
 	errBucket := store.Bucket(cfg.ErrBucketName)
@@ -64,133 +104,119 @@ func handler(ctx context.Context, e event.Event) error {
 	// src filename
 	f := data.GetName()
 
-	// get src object handle
-	reader, err := store.Bucket(s).Object(f).NewReader(ctx)
+	// map the document back to its source images, see the ocr-worker manifest. The manifest is
+	// written when the operation is submitted and carries the trace context of the ocr batch, which
+	// the span continues. Lookup errors are handled once the document is complete.
+	src, srcErr := docai.FindSource(ctx, store.Bucket(cfg.RefsBucketName), s, f)
+	ctx, span := telemetry.Tracer().Start(telemetry.Extract(ctx, src.TraceContext), "nlp-worker.handle",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("gcs.bucket", s),
+			attribute.String("gcs.object", f),
+			attribute.Int64("gcs.generation", data.GetGeneration()),
+		),
+	)
+	ctx = log.With().Str(logging.FieldObject, f).Logger().WithContext(ctx)
+	defer func() {
+		if err != nil {
+			log.Error().Err(err).Caller().Str(logging.FieldObject, f).Msg("failed to process document")
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "failed to process document")
+		}
+		span.End()
+	}()
+
+	// load the document. Long documents are split into several shards by Document AI: each shard
+	// triggers this function, and the document is only analyzed once all its shards are written.
+	doc, complete, err := docai.LoadDocument(ctx, store.Bucket(s), f)
 	if err != nil {
-		m := fmt.Sprintf("failed to create object reader (%s/%s)", s, f)
-		writeErrorResponseToBucketFile(ctx, errBucket, f, m, err)
+		m := fmt.Sprintf("failed to load document (%s/%s)", s, f)
+		function.RecordError(ctx, errBucket, types.ErrorStageNLP, s, f, data.GetGeneration(), m, err)
 		return fmt.Errorf("%s: %w", m, err)
 	}
-	defer reader.Close()
+	if !complete {
+		log.Info().Str(logging.FieldObject, f).Msg("waiting for remaining document shards")
+		span.SetAttributes(attribute.Bool("docai.shards_pending", true))
+		return nil
+	}
 
-	// read object into a byte slice
-	jso, err := io.ReadAll(reader)
+	err = srcErr
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		// the manifest is written right after the operation is submitted. Let the event be retried.
+		return fmt.Errorf("ocr manifest not found (%s/%s): %w", s, f, err)
+	}
 	if err != nil {
-		m := fmt.Sprintf("failed to read file (%s/%s)", s, f)
-		writeErrorResponseToBucketFile(ctx, errBucket, f, m, err)
+		m := fmt.Sprintf("failed to map document to its source (%s/%s)", s, f)
+		function.RecordError(ctx, errBucket, types.ErrorStageNLP, s, f, data.GetGeneration(), m, err)
 		return fmt.Errorf("%s: %w", m, err)
 	}
 
-	// unmarshal protojson to gcp ocr output type
-	var doc documentaipb.Document
-	err = protojson.Unmarshal(jso, &doc)
-	if err != nil {
-		m := fmt.Sprintf("failed to parse document JSON (%s/%s)", s, f)
-		writeErrorResponseToBucketFile(ctx, errBucket, f, m, err)
-		return fmt.Errorf("%s: %w", m, err)
+	// the output is keyed by content hash. Replayed documents have no hash and are keyed by the
+	// name of the logical document, shared by all its shards.
+	name := docai.DocumentName(f)
+	if src.Hash != "" {
+		name = src.Hash + ".json"
 	}
+	span.SetAttributes(
+		attribute.String("docai.document", doc.Name),
+		attribute.Int64("docai.shard_count", max(doc.GetShardInfo().GetShardCount(), 1)),
+		attribute.Int64("docai.generation", doc.Generation),
+		attribute.String("document.hash", src.Hash),
+	)
 
-	// create nlp request
-	req := &languagepb.AnalyzeEntitiesRequest{
-		Document: &languagepb.Document{
-			// https://pkg.go.dev/cloud.google.com/go/language/apiv1/languagepb#Document_Type
-			Type: languagepb.Document_PLAIN_TEXT,
-			Source: &languagepb.Document_Content{
-				Content: doc.Text,
-			},
-			// select most likely language from OCR output
-			Language: doc.Pages[0].DetectedLanguages[0].LanguageCode,
-		},
+	// events are delivered at least once, and every shard of a document may see it complete. Skip
+	// documents whose output was already produced from the same, or a later, generation.
+	dst := store.Bucket(cfg.DstBucketName).Object(name)
+	conds, processed, err := docai.OutputConditions(ctx, dst, src.Output, doc.Generation)
+	if err != nil {
+		return err
+	}
+	if processed {
+		log.Info().
+			Str(logging.FieldObject, f).
+			Int64("generation", doc.Generation).
+			Str("md5", data.GetMd5Hash()).
+			Msg("document already processed, skipping")
+		span.SetAttributes(attribute.Bool("nlp.skipped", true))
+		return nil
 	}
 
-	// perform nlp entities analysis
-	resp, err := nlp.AnalyzeEntities(ctx, req)
+	// perform nlp analyses, per language segment
+	res, err := nlp.Analyze(ctx, lang, doc.Document, cfg.Analysis)
 	if err != nil {
 		m := fmt.Sprintf("failed to analyze nlp entities (%s/%s)", s, f)
-		writeErrorResponseToBucketFile(ctx, errBucket, f, m, err)
+		function.RecordError(ctx, errBucket, types.ErrorStageNLP, s, f, data.GetGeneration(), m, err)
 		return fmt.Errorf("%s: %w", m, err)
 	}
 
-	// write response to file
-	wc := store.Bucket(cfg.DstBucketName).Object(f).NewWriter(ctx)
+	// write response to file. The preconditions fail if another invocation wrote the output since it
+	// was checked.
+	wc := dst.If(conds).NewWriter(ctx)
 	wc.ContentType = "application/json"
+	wc.Metadata = docai.OutputMetadata(src.Output, doc.Generation)
+
+	out := res.Output()
+	out.Hash = src.Hash
+	out.SourceURIs = src.SourceURIs
+	out.OCROutput = src.Output
 
 	// marshal struct to JSON directly into the writer
 	encoder := json.NewEncoder(wc)
-	if err := encoder.Encode(resp); err != nil {
-		m := fmt.Sprintf("failed to json encode nlp resp (%s/%s)", cfg.DstBucketName, f)
-		writeErrorResponseToBucketFile(ctx, errBucket, f, m, err)
+	if err := encoder.Encode(out); err != nil {
+		m := fmt.Sprintf("failed to json encode nlp resp (%s/%s)", cfg.DstBucketName, name)
+		function.RecordError(ctx, errBucket, types.ErrorStageNLP, s, f, data.GetGeneration(), m, err)
 		return fmt.Errorf("%s: %w", m, err)
 	}
 
 	if err := wc.Close(); err != nil {
-		m := fmt.Sprintf("failed to close json writer (%s/%s)", cfg.DstBucketName, f)
-		writeErrorResponseToBucketFile(ctx, errBucket, f, m, err)
+		if utils.IsPreconditionFailed(err) {
+			log.Info().Str(logging.FieldObject, f).Str("output", name).Msg("output written concurrently, skipping")
+			return nil
+		}
+		m := fmt.Sprintf("failed to close json writer (%s/%s)", cfg.DstBucketName, name)
+		function.RecordError(ctx, errBucket, types.ErrorStageNLP, s, f, data.GetGeneration(), m, err)
 		return fmt.Errorf("%s: %w", m, err)
 	}
 
 	return nil
 }
-
-type appConfig struct {
-	Debug         bool
-	ProjectID     string
-	DstBucketName string
-	ErrBucketName string
-}
-
-func getConfig() appConfig {
-	debug := utils.GetBoolEnvVar("DEBUG", false)
-
-	// gcp
-	projectID := getMandatoryEnvVar("GCP_PROJECT_ID")
-
-	// buckets
-	dstBucketName := getMandatoryEnvVar("DST_BUCKET_NAME")
-	errBucketName := getMandatoryEnvVar("ERR_BUCKET_NAME")
-
-	return appConfig{
-		Debug:         debug,
-		ProjectID:     projectID,
-		DstBucketName: dstBucketName,
-		ErrBucketName: errBucketName,
-	}
-}
-
-func getMandatoryEnvVar(n string) string {
-	v, ok := os.LookupEnv(n)
-	if !ok || v == "" {
-		log.Fatalf("env var %s required", n)
-	}
-	return v
-}
-
-// writeErrorResponseToBucketFile writes a Go error response to a bucket file.
-func writeErrorResponseToBucketFile(ctx context.Context, b *storage.BucketHandle, fileName, msg string, err error) error {
-	// Create error response with timestamp and stack trace
-	errorResponse := struct {
-		Timestamp  time.Time `json:"timestamp"`
-		Error      error     `json:"error"`
-		StackTrace string    `json:"stack_trace,omitempty"`
-		Message    string    `json:"message,omitempty"` // Optional custom data
-	}{
-		Timestamp:  time.Now(),
-		Error:      err,
-		StackTrace: fmt.Sprintf("%+v", err), // Capture stack trace
-		Message:    msg,
-	}
-
-	wc := b.Object(fileName).NewWriter(ctx)
-	wc.ContentType = "application/json"
-
-	encoder := json.NewEncoder(wc)
-	if err := encoder.Encode(errorResponse); err != nil {
-		return err
-	}
-
-	if err := wc.Close(); err != nil {
-		return err
-	}
-
-	return nil
-}
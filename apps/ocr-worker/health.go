@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/storage"
+)
+
+// healthCheckTimeout bounds the dependency checks performed by /readyz.
+const healthCheckTimeout = 5 * time.Second
+
+// healthCheck is a named dependency check.
+type healthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// healthResponse is the JSON body returned by the health endpoints.
+type healthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func subscriptionCheck(s *pubsub.Subscription) healthCheck {
+	return healthCheck{
+		Name: "subscription:" + s.ID(),
+		Check: func(ctx context.Context) error {
+			ok, err := s.Exists(ctx)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("subscription %s does not exist", s.ID())
+			}
+			return nil
+		},
+	}
+}
+
+func bucketCheck(b *storage.BucketHandle, name string) healthCheck {
+	return healthCheck{
+		Name: "bucket:" + name,
+		Check: func(ctx context.Context) error {
+			_, err := b.Attrs(ctx)
+			return err
+		},
+	}
+}
+
+// runChecks runs the checks concurrently and returns the status of each of them.
+func runChecks(ctx context.Context, checks []healthCheck) (map[string]string, bool) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	res := make(map[string]string, len(checks))
+	ok := true
+
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c healthCheck) {
+			defer wg.Done()
+			status := "ok"
+			err := c.Check(ctx)
+			if err != nil {
+				status = err.Error()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			res[c.Name] = status
+			if err != nil {
+				ok = false
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	return res, ok
+}
+
+func writeHealth(w http.ResponseWriter, ok bool, resp healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if ok {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// livezHandler reports whether the process is alive. Dependencies are not checked: restarting the
+// container does not fix an unreachable bucket.
+func livezHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, true, healthResponse{Status: "ok"})
+	}
+}
+
+// readyzHandler reports whether the service is receiving messages and its dependencies are reachable.
+func readyzHandler(svc OCRWorkerSvc, checks []healthCheck) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !svc.IsReady() {
+			writeHealth(w, false, healthResponse{Status: "not ready"})
+			return
+		}
+
+		res, ok := runChecks(r.Context(), checks)
+		status := "ready"
+		if !ok {
+			status = "not ready"
+		}
+		writeHealth(w, ok, healthResponse{Status: status, Checks: res})
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeSvc struct {
+	ready bool
+}
+
+func (s fakeSvc) IsReady() bool { return s.ready }
+func (s fakeSvc) Start() error  { return nil }
+func (s fakeSvc) Stop()         {}
+
+func TestReadyzHandler(t *testing.T) {
+	ok := healthCheck{Name: "ok", Check: func(context.Context) error { return nil }}
+	ko := healthCheck{Name: "ko", Check: func(context.Context) error { return errors.New("unreachable") }}
+
+	tests := map[string]struct {
+		ready  bool
+		checks []healthCheck
+		expect int
+	}{
+		// happy path. service ready and dependencies reachable
+		"ready": {ready: true, checks: []healthCheck{ok}, expect: http.StatusOK},
+		// service stopped
+		"stopped": {ready: false, checks: []healthCheck{ok}, expect: http.StatusServiceUnavailable},
+		// dependency unreachable
+		"unreachable": {ready: true, checks: []healthCheck{ok, ko}, expect: http.StatusServiceUnavailable},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			readyzHandler(fakeSvc{ready: tc.ready}, tc.checks).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if rec.Code != tc.expect {
+				t.Fatalf("expected: %v, result: %v", tc.expect, rec.Code)
+			}
+		})
+	}
+}
@@ -16,30 +16,36 @@ import (
 	documentai "cloud.google.com/go/documentai/apiv1"
 	"cloud.google.com/go/pubsub"
 	"cloud.google.com/go/storage"
-	"github.com/cyber-nic/go-gcp-doc-ai/apps/ocr-worker/libs/utils"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/dispatch"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/logging"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/telemetry"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/utils"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"google.golang.org/api/option"
 )
 
 func main() {
+	// logger
+	logging.Init("ocr-worker")
+
 	// app config
 	cfg := getConfig()
 
-	// context and signal handling
-	ctx := context.Background()
-	ctx, cancel := context.WithCancel(ctx)
-	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, os.Interrupt)
-	defer func() {
-		signal.Stop(signalChan)
-		cancel()
-	}()
+	// work context. cancelling it abandons in-flight Document AI operations.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	// interrupt handling
-	done := make(chan error)
-	go func() {
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, syscall.SIGTERM, os.Interrupt)
-	}()
+	// tracing
+	shutdown, err := telemetry.Init(ctx, "ocr-worker")
+	if err != nil {
+		log.Fatal().Err(err).Caller().Msg("failed to init tracing")
+	}
+	defer shutdown(context.Background())
+
+	// signal handling
+	signalChan := make(chan os.Signal, 2)
+	signal.Notify(signalChan, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signalChan)
 
 	// pubsub client
 	c, err := pubsub.NewClient(ctx, cfg.ProjectID)
@@ -67,6 +73,19 @@ func main() {
 			Msg("pubsub subscription failed")
 	}
 
+	// high priority subscription, optional
+	var hs *pubsub.Subscription
+	if cfg.PubsubHighSubscriptionID != "" {
+		hs = c.Subscription(cfg.PubsubHighSubscriptionID)
+		if ok, err := hs.Exists(ctx); err != nil || !ok {
+			log.Fatal().Err(err).
+				Str("project", cfg.ProjectID).
+				Str("topic", cfg.PubsubTopicID).
+				Str("subscription", cfg.PubsubHighSubscriptionID).
+				Msg("pubsub subscription failed")
+		}
+	}
+
 	// doc ai processor
 	endpoint := fmt.Sprintf("%s-documentai.googleapis.com:443", cfg.DocAIProcessorLocation)
 	ai, err := documentai.NewDocumentProcessorClient(ctx, option.WithEndpoint(endpoint))
@@ -74,8 +93,13 @@ func main() {
 		log.Fatal().Err(err).Caller().Msg("failed to create Document AI client")
 	}
 	defer ai.Close()
-	// doc ai processor name
-	proc := fmt.Sprintf("projects/%s/locations/%s/processors/%s", cfg.ProjectID, cfg.DocAIProcessorLocation, cfg.DocAIProcessorID)
+	// doc ai processors: the default processor and the routes to other processors
+	proc := processorName(cfg.ProjectID, cfg.DocAIProcessorLocation, cfg.DocAIProcessorID, cfg.DocAIProcessorVersion)
+	rt, err := newRouter(cfg.ProjectID, cfg.DocAIProcessorLocation, proc, cfg.DocAIRoutes)
+	if err != nil {
+		log.Fatal().Err(err).Caller().Msg("invalid processor routes")
+	}
+	log.Info().Str("processor", proc).Int("routes", len(cfg.DocAIRoutes)).Msg("processor routes loaded")
 
 	// create storage client
 	store, err := storage.NewClient(ctx)
@@ -96,75 +120,141 @@ func main() {
 		log.Fatal().Err(err).Str("bucket", cfg.RefsBucketName).Caller().Msgf("failed to get bucket %s", cfg.RefsBucketName)
 	}
 
+	// dst bucket, written by document ai
+	dstBucketHandle := store.Bucket(cfg.DstBucketName)
+
+	// dependencies checked by /readyz
+	checks := []healthCheck{
+		subscriptionCheck(s),
+		bucketCheck(errBucketHandle, cfg.ErrBucketName),
+		bucketCheck(refsBucketHandle, cfg.RefsBucketName),
+		bucketCheck(dstBucketHandle, cfg.DstBucketName),
+	}
+	if hs != nil {
+		checks = append(checks, subscriptionCheck(hs))
+	}
+
 	// main service
 	svc := NewOCRWorkerSvc(ctx, &SvcOptions{
 		Topic:                   t,
 		Subscription:            s,
+		HighSubscription:        hs,
+		HighPriorityIdle:        cfg.HighPriorityIdle,
 		AIClient:                ai,
-		AIProcessorName:         proc,
+		Router:                  rt,
+		ProcessOptions:          cfg.DocAIProcessOptions,
+		StoreClient:             store,
 		DstBucketName:           cfg.DstBucketName,
+		DstBucketHandle:         dstBucketHandle,
 		ErrBucketHandle:         errBucketHandle,
 		RefsBucketHandle:        refsBucketHandle,
 		DocAIMinAsyncReqSeconds: cfg.DocAIMinAsyncReqSeconds,
+		PendingOpsPrefix:        cfg.PendingOpsPrefix,
+		OnlineMaxDocs:           cfg.DocAIOnlineMaxDocs,
+		OnlineMaxBytes:          int64(cfg.DocAIOnlineMaxBytes),
 	})
+	done := make(chan error, 1)
 	go func() {
 		done <- svc.Start()
 	}()
 
-	// enable context cancelling
+	// metrics and health
+	serverErr := make(chan error, 1)
+	server := startWebServer(svc, checks, serverErr, cfg.Port)
+
+	// wait for a signal or an early exit
+	select {
+	case sig := <-signalChan:
+		log.Info().Str("signal", sig.String()).Msg("shutting down")
+	case err := <-done:
+		log.Error().Err(err).Caller().Msg("service exited")
+		done <- err
+	case err := <-serverErr:
+		log.Error().Err(err).Caller().Msg("web server exited")
+	}
+
+	// stop receiving, readiness flips to not ready
+	svc.Stop()
+
+	// second signal, hard exit
 	go func() {
-		select {
-		case <-signalChan: // first signal, cancel context
-			cancel()
-			svc.Stop()
-		case <-ctx.Done():
-		}
-		<-signalChan // second signal, hard exit
+		<-signalChan
 		os.Exit(2)
 	}()
 
-	// metrics and health
-	startWebServer(svc, done, cfg.Port)
+	// drain in-flight batches. past the drain timeout, abandon them: their operation ids are persisted.
+	select {
+	case <-done:
+	case <-time.After(cfg.DrainTimeout):
+		log.Warn().Dur("timeout", cfg.DrainTimeout).Msg("drain timeout reached, abandoning in-flight batches")
+		cancel()
+		<-done
+	}
+
+	// shut down the web server
+	sctx, scancel := context.WithTimeout(context.Background(), persistTimeout)
+	defer scancel()
+	if err := server.Shutdown(sctx); err != nil {
+		log.Error().Err(err).Caller().Msg("failed to shut down web server")
+	}
 
-	// wait for exit
-	<-done
 	log.Info().Caller().Msg("exit")
 }
 
-func startWebServer(svc OCRWorkerSvc, exit chan error, p string) {
+func startWebServer(svc OCRWorkerSvc, checks []healthCheck, exit chan error, p string) *http.Server {
+	port := ":" + p
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/livez", livezHandler())
+	mux.Handle("/readyz", readyzHandler(svc, checks))
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		if svc.IsReady() {
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte("ready"))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte("not ready"))
+	})
+
+	server := &http.Server{
+		Addr:              port,
+		Handler:           mux,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+
 	go func() {
-		port := ":" + p
-		http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-			if svc.IsReady() {
-				w.WriteHeader(http.StatusOK)
-				_, _ = w.Write([]byte("ready"))
-				return
-			}
-			w.WriteHeader(http.StatusInternalServerError)
-			_, _ = w.Write([]byte("not ready"))
-		})
-		log.Info().Str("port", port).Caller().Msg(fmt.Sprintf("Serving '/health' on port %s", port))
-
-		server := &http.Server{
-			Addr:              port,
-			ReadHeaderTimeout: 30 * time.Second,
+		log.Info().Str("port", port).Caller().Msg(fmt.Sprintf("Serving '/metrics', '/livez', '/readyz' and '/health' on port %s", port))
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			exit <- err
 		}
-		exit <- server.ListenAndServe()
 	}()
+
+	return server
 }
 
 type appConfig struct {
-	Debug                   bool
-	Port                    string
-	ProjectID               string
-	DocAIProcessorID        string
-	DocAIProcessorLocation  string
-	DstBucketName           string
-	ErrBucketName           string
-	RefsBucketName          string
-	PubsubTopicID           string
-	PubsubSubscriptionID    string
-	DocAIMinAsyncReqSeconds int
+	Debug                  bool
+	Port                   string
+	ProjectID              string
+	DocAIProcessorID       string
+	DocAIProcessorLocation string
+	DocAIProcessorVersion  string
+	DocAIRoutes            []route
+	DocAIProcessOptions    dispatch.ProcessOptions
+	DstBucketName          string
+	ErrBucketName          string
+	RefsBucketName         string
+	PubsubTopicID          string
+	PubsubSubscriptionID   string
+	// PubsubHighSubscriptionID is the optional high priority subscription, see priority.go.
+	PubsubHighSubscriptionID string
+	HighPriorityIdle         time.Duration
+	DocAIMinAsyncReqSeconds  int
+	DrainTimeout             time.Duration
+	PendingOpsPrefix         string
+	DocAIOnlineMaxDocs       int
+	DocAIOnlineMaxBytes      int
 }
 
 func getMandatoryEnvVar(n string) string {
@@ -190,27 +280,66 @@ func getConfig() appConfig {
 	// pubsub
 	pubsubTopicID := getMandatoryEnvVar("PUBSUB_TOPIC_ID")
 	pubsubSubID := getMandatoryEnvVar("PUBSUB_SUBSCRIPTION_ID")
+	// pubsubHighSubID, optional, receives the high priority batches. The low priority batches of
+	// PUBSUB_SUBSCRIPTION_ID are only received once it was idle for highPriorityIdle seconds.
+	pubsubHighSubID := utils.GetStrEnvVar("PUBSUB_HIGH_SUBSCRIPTION_ID", "")
+	highPriorityIdle := utils.GetIntEnvVar("HIGH_PRIORITY_IDLE_SECONDS", 30)
 
 	// doc ai
 	docAIProcessorID := getMandatoryEnvVar("DOC_AI_PROCESSOR_ID")
 	docAIProcessorLocation := getMandatoryEnvVar("DOC_AI_PROCESSOR_LOCATION")
+	// docAIProcessorVersion optionally pins the version of the default processor
+	docAIProcessorVersion := utils.GetStrEnvVar("DOC_AI_PROCESSOR_VERSION", "")
+	// docAIRoutes route documents to other processors, by mime type, prefix, size or label. See
+	// routing.go.
+	docAIRoutes, err := readRoutes()
+	if err != nil {
+		log.Fatal().Err(err).Caller().Msg("failed to read processor routes")
+	}
+	// docAIProcessOptions are the default process options, e.g. DOC_AI_LANGUAGE_HINTS. See
+	// options.go.
+	docAIProcessOptions, err := readProcessOptions()
+	if err != nil {
+		log.Fatal().Err(err).Caller().Msg("invalid process options")
+	}
 	// maxDocAIReqPerMinute allows for the controler of the number of doc ai requests per minute
 	// to avoid exceeding the quota of downstream services such as NLP.
 	// the OCR work rate will control the NLP rate, which is the rate limiting factor.
 	// the duration of this work must be >- 60 secs
 	DocAIMinAsyncReqSeconds := utils.GetIntEnvVar("DOC_AI_MIN_REQ_SECONDS", 60)
+	// batches of at most docAIOnlineMaxDocs documents, of at most docAIOnlineMaxBytes each, are
+	// processed online (ProcessDocument) rather than as a batch operation. 0 bytes disables it.
+	// The ocr_mode message attribute overrides the selection.
+	docAIOnlineMaxDocs := utils.GetIntEnvVar("DOC_AI_ONLINE_MAX_DOCS", 1)
+	docAIOnlineMaxBytes := utils.GetIntEnvVar("DOC_AI_ONLINE_MAX_BYTES", 1<<20)
+
+	// shutdown
+	// drainTimeout is how long in-flight batches are given to complete after SIGTERM. Cloud Run
+	// kills the container 10 seconds after SIGTERM.
+	drainTimeout := utils.GetIntEnvVar("DRAIN_TIMEOUT_SECONDS", 8)
+	// pendingOpsPrefix is the refs bucket prefix under which abandoned operation ids are persisted.
+	pendingOpsPrefix := utils.GetStrEnvVar("PENDING_OPS_PREFIX", "ops/")
 
 	return appConfig{
-		Debug:                   debug,
-		Port:                    port,
-		ProjectID:               projectID,
-		DstBucketName:           dstBucketName,
-		RefsBucketName:          refsBucketName,
-		ErrBucketName:           errBucketName,
-		PubsubTopicID:           pubsubTopicID,
-		PubsubSubscriptionID:    pubsubSubID,
-		DocAIMinAsyncReqSeconds: DocAIMinAsyncReqSeconds,
-		DocAIProcessorID:        docAIProcessorID,
-		DocAIProcessorLocation:  docAIProcessorLocation,
+		Debug:                    debug,
+		Port:                     port,
+		ProjectID:                projectID,
+		DstBucketName:            dstBucketName,
+		RefsBucketName:           refsBucketName,
+		ErrBucketName:            errBucketName,
+		PubsubTopicID:            pubsubTopicID,
+		PubsubSubscriptionID:     pubsubSubID,
+		PubsubHighSubscriptionID: pubsubHighSubID,
+		HighPriorityIdle:         time.Duration(highPriorityIdle) * time.Second,
+		DocAIMinAsyncReqSeconds:  DocAIMinAsyncReqSeconds,
+		DocAIProcessorID:         docAIProcessorID,
+		DocAIProcessorLocation:   docAIProcessorLocation,
+		DocAIProcessorVersion:    docAIProcessorVersion,
+		DocAIRoutes:              docAIRoutes,
+		DocAIProcessOptions:      docAIProcessOptions,
+		DrainTimeout:             time.Duration(drainTimeout) * time.Second,
+		PendingOpsPrefix:         pendingOpsPrefix,
+		DocAIOnlineMaxDocs:       docAIOnlineMaxDocs,
+		DocAIOnlineMaxBytes:      docAIOnlineMaxBytes,
 	}
 }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/dispatch"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/docai"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/telemetry"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+)
+
+// newManifest returns the manifest of a submitted operation. Document AI writes the output of the
+// n-th input document under <op-id>/<n>, which is the expected output until the operation completes.
+// The documents carry the trace context of ctx.
+func newManifest(ctx context.Context, opName, dstBucketName string, docs []dispatch.Document) types.OCRManifest {
+	m := types.OCRManifest{Operation: opName}
+	tc := telemetry.Inject(ctx, nil)
+	for i, d := range docs {
+		sources := d.SourceURIs
+		if len(sources) == 0 {
+			sources = []string{d.URI}
+		}
+		m.Documents = append(m.Documents, types.OCRManifestDocument{
+			URI:          d.URI,
+			Hash:         d.Hash,
+			SourceURIs:   sources,
+			Output:       fmt.Sprintf("gs://%s/%s/%d", dstBucketName, docai.OperationID(opName), i),
+			TraceContext: tc,
+		})
+	}
+	return m
+}
+
+// writeManifest writes the manifest of a submitted operation to the refs bucket, before the
+// nlp-worker is triggered by its outputs.
+func writeManifest(ctx context.Context, bucket *storage.BucketHandle, m types.OCRManifest) error {
+	return docai.WriteManifest(ctx, bucket, docai.OperationID(m.Operation), m)
+}
+
+// completeManifest rewrites the manifest of a completed operation with the output destinations
+// reported by Document AI. success is the output of waitDocAIBatch.
+func completeManifest(ctx context.Context, bucket *storage.BucketHandle, opName string, success []KV) error {
+	var m types.OCRManifest
+	if err := docai.ReadManifest(ctx, bucket, docai.OperationID(opName), &m); err != nil {
+		return err
+	}
+
+	outputs := make(map[string]string, len(success))
+	for _, kv := range success {
+		outputs["gs://"+kv.Key] = kv.Value
+	}
+	for i, d := range m.Documents {
+		if o, ok := outputs[d.URI]; ok {
+			m.Documents[i].Output = strings.TrimSuffix(o, "/")
+		}
+	}
+	m.Complete = true
+
+	return writeManifest(ctx, bucket, m)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// metrics exposed on /metrics
+var (
+	messagesReceived = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ocr_worker_messages_received_total",
+		Help: "Number of Pub/Sub messages received.",
+	})
+
+	documentsProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ocr_worker_documents_total",
+		Help: "Number of documents processed by Document AI, by result and status code.",
+	}, []string{"result", "code"})
+
+	batchDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "ocr_worker_batch_duration_seconds",
+		Help:    "Time to process a batch, from message receipt to refs written, excluding throttling.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+	})
+
+	docAIOperationDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "ocr_worker_docai_operation_duration_seconds",
+		Help:    "Time spent waiting for Document AI batch operations to complete.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+	})
+
+	docAIOnlineDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "ocr_worker_docai_online_duration_seconds",
+		Help:    "Time spent in Document AI online (ProcessDocument) requests.",
+		Buckets: prometheus.ExponentialBuckets(0.25, 2, 10),
+	})
+
+	throttleWait = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "ocr_worker_throttle_wait_seconds",
+		Help:    "Time spent sleeping to honour DOC_AI_MIN_REQ_SECONDS.",
+		Buckets: prometheus.LinearBuckets(0, 10, 10),
+	})
+
+	refsBucketHits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ocr_worker_refs_bucket_hits_total",
+		Help: "Number of documents skipped because they were found in the refs bucket.",
+	})
+
+	refsBucketErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ocr_worker_refs_bucket_errors_total",
+		Help: "Number of documents kept because their refs bucket check failed.",
+	})
+)
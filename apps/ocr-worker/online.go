@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"cloud.google.com/go/documentai/apiv1/documentaipb"
+	"cloud.google.com/go/storage"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/dispatch"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/logging"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/telemetry"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// onlineOpPrefix prefixes the pseudo operation ids of online batches. Their outputs and manifests
+// use the pseudo id in place of the Document AI operation id.
+const onlineOpPrefix = "online-"
+
+// onlineOperationID returns the pseudo operation id of the online batch of a message. Redelivered
+// messages rewrite the same outputs.
+func onlineOperationID(msgID string) string {
+	return onlineOpPrefix + msgID
+}
+
+// onlineOutputName returns the name of the output object of the n-th document of an online batch,
+// in the batch output layout: <op-id>/<n>/<source name>-0.json.
+func onlineOutputName(opID string, n int, uri string) string {
+	base := path.Base(uri)
+	return fmt.Sprintf("%s/%d/%s-0.json", opID, n, strings.TrimSuffix(base, path.Ext(base)))
+}
+
+// isOnline reports whether a batch is processed online: when requested by the message mode
+// attribute or, without it, when the batch has at most DOC_AI_ONLINE_MAX_DOCS documents of at most
+// DOC_AI_ONLINE_MAX_BYTES each.
+func (svc *ocrWorkerSvc) isOnline(ctx context.Context, attrs map[string]string, docs []*documentaipb.GcsDocument) bool {
+	switch attrs[dispatch.AttrMode] {
+	case dispatch.ModeOnline:
+		return true
+	case dispatch.ModeBatch:
+		return false
+	}
+
+	if svc.OnlineMaxBytes <= 0 || len(docs) == 0 || len(docs) > svc.OnlineMaxDocs {
+		return false
+	}
+	for _, d := range docs {
+		o, err := svc.object(d.GetGcsUri())
+		if err != nil {
+			return false
+		}
+		a, err := o.Attrs(ctx)
+		if err != nil || a.Size > svc.OnlineMaxBytes {
+			return false
+		}
+	}
+	return true
+}
+
+// object returns the handle of a gs:// uri.
+func (svc *ocrWorkerSvc) object(uri string) (*storage.ObjectHandle, error) {
+	bucket, name, ok := strings.Cut(strings.TrimPrefix(uri, "gs://"), "/")
+	if !ok || !strings.HasPrefix(uri, "gs://") {
+		return nil, fmt.Errorf("invalid gs uri: %s", uri)
+	}
+	return svc.StoreClient.Bucket(bucket).Object(name), nil
+}
+
+// processOnline processes the documents of a processor group synchronously, one ProcessDocument
+// request per document with inline content. Outputs are written to the dst bucket in the batch
+// layout, under the pseudo operation id opID, so that the nlp-worker handles them as batch outputs.
+// The manifest is written, complete, before the outputs.
+func (svc *ocrWorkerSvc) processOnline(ctx context.Context, opID string, g processorGroup, opts dispatch.ProcessOptions) ([]KV, []types.ErrorRecord) {
+	logger := zerolog.Ctx(ctx)
+	po := processOptions(opts, g.OCRConfig, true)
+
+	m := newManifest(ctx, opID, svc.DstBucketName, g.Batch)
+	m.Processor = g.Processor
+	m.Complete = true
+	if err := writeManifest(ctx, svc.RefsBucketHandle, m); err != nil {
+		// without a manifest the nlp-worker cannot map the outputs to their sources
+		logger.Error().Err(err).Caller().Str("operation", opID).Msg("failed to write manifest")
+	}
+
+	var success []KV
+	var failures []types.ErrorRecord
+	for i, d := range g.Documents {
+		uri := d.GetGcsUri()
+		name := onlineOutputName(opID, i, uri)
+		if err := svc.processDocument(ctx, g.Processor, po, d, name); err != nil {
+			bucket, object, _ := strings.Cut(strings.TrimPrefix(uri, "gs://"), "/")
+			r := types.NewErrorRecord(types.ErrorStageOCR, bucket, object, 0, fmt.Sprintf("failed to process document online (%s)", uri), err)
+			failures = append(failures, r)
+			documentsProcessed.WithLabelValues("failure", r.Code).Inc()
+			logger.Error().Err(err).Caller().Str(logging.FieldObject, uri).Msgf("failed to process %s", uri)
+			continue
+		}
+		documentsProcessed.WithLabelValues("success", grpccodes.OK.String()).Inc()
+		success = append(success, KV{Key: strings.TrimPrefix(uri, "gs://"), Value: fmt.Sprintf("gs://%s/%s/%d", svc.DstBucketName, opID, i)})
+	}
+	return success, failures
+}
+
+// processDocument OCRs a document with a ProcessDocument request to the processor proc, with the
+// process options po, and writes the output document to the dst bucket object name.
+func (svc *ocrWorkerSvc) processDocument(ctx context.Context, proc string, po *documentaipb.ProcessOptions, d *documentaipb.GcsDocument, name string) error {
+	o, err := svc.object(d.GetGcsUri())
+	if err != nil {
+		return err
+	}
+	r, err := o.NewReader(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create reader: %w", err)
+	}
+	content, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read: %w", err)
+	}
+
+	start := time.Now()
+	pctx, span := telemetry.Tracer().Start(ctx, "documentai.process",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("gcs.uri", d.GetGcsUri()), attribute.Int("documentai.content_bytes", len(content)), attribute.String("documentai.processor", proc)),
+	)
+	resp, err := svc.AIClient.ProcessDocument(pctx, &documentaipb.ProcessRequest{
+		Name:            proc,
+		SkipHumanReview: true,
+		ProcessOptions:  po,
+		Source: &documentaipb.ProcessRequest_RawDocument{
+			RawDocument: &documentaipb.RawDocument{Content: content, MimeType: d.GetMimeType()},
+		},
+	})
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+	docAIOnlineDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		return fmt.Errorf("failed to process document: %w", err)
+	}
+
+	// a single shard, as written by batch operations
+	doc := resp.GetDocument()
+	doc.ShardInfo = &documentaipb.Document_ShardInfo{ShardIndex: 0, ShardCount: 1}
+	jso, err := protojson.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to encode document: %w", err)
+	}
+
+	wc := svc.DstBucketHandle.Object(name).NewWriter(ctx)
+	wc.ContentType = "application/json"
+	if _, err := wc.Write(jso); err != nil {
+		wc.Close()
+		return fmt.Errorf("failed to write output (%s): %w", name, err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("failed to write output (%s): %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/documentai/apiv1/documentaipb"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/dispatch"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/docai"
+)
+
+func TestOnlineOutputName(t *testing.T) {
+	name := onlineOutputName(onlineOperationID("123"), 0, "gs://src/a/scan.page.jpg")
+	if expect := "online-123/0/scan.page-0.json"; name != expect {
+		t.Fatalf("expected: %s, result: %s", expect, name)
+	}
+
+	// the nlp-worker handles online outputs as batch outputs
+	opID, prefix, ok := docai.OutputPrefix(name)
+	if !ok || opID != "online-123" || prefix != "online-123/0" || docai.DocumentName(name) != "online-123/0/scan.page.json" {
+		t.Fatalf("unexpected output layout: %s, %s", opID, prefix)
+	}
+}
+
+func TestIsOnline(t *testing.T) {
+	docs := []*documentaipb.GcsDocument{{GcsUri: "gs://src/a.jpg"}, {GcsUri: "gs://src/b.jpg"}}
+	svc := &ocrWorkerSvc{OnlineMaxDocs: 1, OnlineMaxBytes: 1 << 20}
+
+	tests := map[string]struct {
+		attrs  map[string]string
+		expect bool
+	}{
+		// the message attribute overrides the size selection
+		"online": {attrs: map[string]string{dispatch.AttrMode: dispatch.ModeOnline}, expect: true},
+		"batch":  {attrs: map[string]string{dispatch.AttrMode: dispatch.ModeBatch}, expect: false},
+		// too many documents, the sizes are not read
+		"size": {attrs: nil, expect: false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if res := svc.isOnline(context.Background(), tc.attrs, docs); res != tc.expect {
+				t.Fatalf("expected: %v, result: %v", tc.expect, res)
+			}
+		})
+	}
+}
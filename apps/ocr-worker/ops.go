@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"cloud.google.com/go/storage"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/logging"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/utils"
+	"google.golang.org/api/iterator"
+)
+
+// persistTimeout bounds the bucket writes performed once the work context is cancelled.
+const persistTimeout = 5 * time.Second
+
+// pendingOpKey returns the refs bucket key of a pending operation, named after its id.
+func pendingOpKey(prefix, name string) string {
+	return prefix + name[strings.LastIndex(name, "/")+1:]
+}
+
+// persistPendingOp records the name of a Document AI operation abandoned before completion.
+func persistPendingOp(ctx context.Context, bucket *storage.BucketHandle, prefix, name string) error {
+	_, err := writeRef(ctx, bucket, pendingOpKey(prefix, name), name)
+	return err
+}
+
+// resumePendingOps waits for the operations abandoned by previous instances and writes their
+// results. Each operation is claimed by deleting its pending object first, so that concurrent
+// instances do not resume the same operation.
+func (svc *ocrWorkerSvc) resumePendingOps(ctx context.Context) {
+	itr := svc.RefsBucketHandle.Objects(ctx, &storage.Query{Prefix: svc.PendingOpsPrefix})
+	for {
+		attrs, err := itr.Next()
+		if err == iterator.Done {
+			return
+		}
+		if err != nil {
+			log.Error().Err(err).Caller().Msg("failed to list pending operations")
+			return
+		}
+
+		name, err := claimPendingOp(ctx, svc.RefsBucketHandle.Object(attrs.Name), attrs.Generation)
+		if err != nil {
+			log.Error().Err(err).Caller().Str(logging.FieldObject, attrs.Name).Msg("failed to claim pending operation")
+			continue
+		}
+		if name == "" {
+			continue
+		}
+
+		log.Info().Str("operation", name).Msg("resuming pending operation")
+		success, failures := svc.handleOperation(ctx, svc.AIClient.BatchProcessDocumentsOperation(name))
+		log.Info().
+			Str("operation", name).
+			Int("failures", len(failures)).
+			Int("success", len(success)).
+			Msg("pending operation resumed")
+	}
+}
+
+// claimPendingOp reads and deletes a pending operation object. It returns an empty name when
+// another instance claimed it first.
+func claimPendingOp(ctx context.Context, o *storage.ObjectHandle, gen int64) (string, error) {
+	o = o.If(storage.Conditions{GenerationMatch: gen})
+
+	r, err := o.NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to create reader: %w", err)
+	}
+	defer r.Close()
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to read: %w", err)
+	}
+
+	if err := o.Delete(ctx); err != nil {
+		if utils.IsPreconditionFailed(err) || errors.Is(err, storage.ErrObjectNotExist) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to delete: %w", err)
+	}
+
+	return strings.TrimSpace(string(b)), nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+
+	"cloud.google.com/go/documentai/apiv1/documentaipb"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/dispatch"
+)
+
+// processOptionsEnv maps the env vars of the default process options to the message attributes
+// overriding them, see dispatch.ProcessOptions.
+var processOptionsEnv = map[string]string{
+	"DOC_AI_LANGUAGE_HINTS":       dispatch.AttrLanguageHints,
+	"DOC_AI_IMAGE_QUALITY_SCORES": dispatch.AttrImageQualityScores,
+	"DOC_AI_NATIVE_PDF_PARSING":   dispatch.AttrNativePDFParsing,
+	"DOC_AI_SYMBOLS":              dispatch.AttrSymbols,
+	"DOC_AI_MATH_OCR":             dispatch.AttrMathOCR,
+	"DOC_AI_SELECTION_MARKS":      dispatch.AttrSelectionMarks,
+	"DOC_AI_PAGES":                dispatch.AttrPages,
+}
+
+// readProcessOptions returns the default process options of the DOC_AI_* env vars, in the format
+// of their message attributes.
+func readProcessOptions() (dispatch.ProcessOptions, error) {
+	attrs := map[string]string{}
+	for env, attr := range processOptionsEnv {
+		if v, ok := os.LookupEnv(env); ok {
+			attrs[attr] = v
+		}
+	}
+	return dispatch.ParseProcessOptions(attrs, dispatch.ProcessOptions{})
+}
+
+// processOptions returns the Document AI process options of a request, nil when none is set. ocr
+// is false for processors rejecting the OCR options, see route.SkipOCRConfig. Document AI only
+// applies the page selection to online requests: pages is false for batch requests.
+func processOptions(o dispatch.ProcessOptions, ocr, pages bool) *documentaipb.ProcessOptions {
+	po := &documentaipb.ProcessOptions{}
+	set := false
+
+	if ocr {
+		c := &documentaipb.OcrConfig{
+			EnableImageQualityScores: o.ImageQualityScores,
+			EnableNativePdfParsing:   o.NativePDFParsing,
+			EnableSymbol:             o.Symbols,
+		}
+		if len(o.LanguageHints) > 0 {
+			c.Hints = &documentaipb.OcrConfig_Hints{LanguageHints: o.LanguageHints}
+		}
+		if o.MathOCR || o.SelectionMarks {
+			c.PremiumFeatures = &documentaipb.OcrConfig_PremiumFeatures{
+				EnableMathOcr:                o.MathOCR,
+				EnableSelectionMarkDetection: o.SelectionMarks,
+			}
+		}
+		if c.Hints != nil || c.PremiumFeatures != nil || c.EnableImageQualityScores || c.EnableNativePdfParsing || c.EnableSymbol {
+			po.OcrConfig = c
+			set = true
+		}
+	}
+
+	if pages {
+		switch {
+		case len(o.Pages) > 0:
+			po.PageRange = &documentaipb.ProcessOptions_IndividualPageSelector_{
+				IndividualPageSelector: &documentaipb.ProcessOptions_IndividualPageSelector{Pages: o.Pages},
+			}
+			set = true
+		case o.FromStart > 0:
+			po.PageRange = &documentaipb.ProcessOptions_FromStart{FromStart: o.FromStart}
+			set = true
+		case o.FromEnd > 0:
+			po.PageRange = &documentaipb.ProcessOptions_FromEnd{FromEnd: o.FromEnd}
+			set = true
+		}
+	}
+
+	if !set {
+		return nil
+	}
+	return po
+}
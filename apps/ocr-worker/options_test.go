@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/dispatch"
+)
+
+func TestProcessOptions(t *testing.T) {
+	o := dispatch.ProcessOptions{LanguageHints: []string{"fr"}, MathOCR: true, Pages: []int32{1, 2}}
+
+	po := processOptions(o, true, true)
+	if hints := po.GetOcrConfig().GetHints().GetLanguageHints(); len(hints) != 1 || hints[0] != "fr" {
+		t.Fatalf("unexpected language hints: %v", hints)
+	}
+	if !po.GetOcrConfig().GetPremiumFeatures().GetEnableMathOcr() {
+		t.Fatal("expected math ocr")
+	}
+	if pages := po.GetIndividualPageSelector().GetPages(); len(pages) != 2 {
+		t.Fatalf("unexpected pages: %v", pages)
+	}
+
+	// batch requests have no page selection
+	if po := processOptions(o, true, false); po.GetPageRange() != nil || po.GetOcrConfig() == nil {
+		t.Fatalf("unexpected batch options: %v", po)
+	}
+
+	// processors rejecting the ocr options, without page selection
+	if po := processOptions(o, false, false); po != nil {
+		t.Fatalf("expected no options, result: %v", po)
+	}
+	if po := processOptions(dispatch.ProcessOptions{}, true, true); po != nil {
+		t.Fatalf("expected no options, result: %v", po)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// priorityGate holds the low priority subscription back while high priority batches are in flight
+// or were received less than idle ago.
+type priorityGate struct {
+	idle time.Duration
+
+	mu       sync.Mutex
+	inflight int
+	last     time.Time
+	// stopLow stops receiving from the low priority subscription, nil when not receiving
+	stopLow context.CancelFunc
+}
+
+// begin records a high priority batch and stops receiving low priority ones. The low priority
+// batches in flight complete, throttle included, see handleMessage.
+func (g *priorityGate) begin() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.inflight++
+	g.last = time.Now()
+	if g.stopLow != nil {
+		g.stopLow()
+		g.stopLow = nil
+	}
+}
+
+// end records the completion of a high priority batch.
+func (g *priorityGate) end() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.inflight--
+	g.last = time.Now()
+}
+
+// wait blocks until the high priority subscription is idle, then returns a context cancelled by
+// the next high priority batch, to receive low priority batches with. It returns ctx's error when
+// ctx is done first.
+func (g *priorityGate) wait(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	for {
+		g.mu.Lock()
+		d := g.idle
+		if g.inflight == 0 {
+			d -= time.Since(g.last)
+		}
+		if d <= 0 {
+			lowCtx, cancel := context.WithCancel(ctx)
+			g.stopLow = cancel
+			g.mu.Unlock()
+			return lowCtx, cancel, nil
+		}
+		g.mu.Unlock()
+
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// receivePriority receives from the high priority subscription, and from the low priority one
+// while the high priority one is idle. It returns once ctx is done and all handlers have returned.
+func (svc *ocrWorkerSvc) receivePriority(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		for ctx.Err() == nil {
+			err := svc.HighSubscription.Receive(ctx, func(ctx context.Context, m *pubsub.Message) {
+				svc.gate.begin()
+				defer svc.gate.end()
+				svc.handleMessage(ctx, m)
+			})
+			if err != nil {
+				log.Error().Err(err).Caller().Str("subscription", svc.HighSubscription.ID()).Msg("failed to receive message")
+			}
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for {
+			lowCtx, cancel, err := svc.gate.wait(ctx)
+			if err != nil {
+				return
+			}
+			log.Debug().Str("subscription", svc.Subscription.ID()).Msg("high priority subscription idle, receiving low priority batches")
+			// Receive returns once the next high priority batch cancels lowCtx and the low priority
+			// batches in flight have completed
+			if err := svc.Subscription.Receive(lowCtx, svc.handleMessage); err != nil {
+				log.Error().Err(err).Caller().Str("subscription", svc.Subscription.ID()).Msg("failed to receive message")
+			}
+			cancel()
+		}
+	}()
+
+	wg.Wait()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPriorityGate(t *testing.T) {
+	ctx := context.Background()
+	g := &priorityGate{idle: 50 * time.Millisecond}
+
+	// no high priority batch yet: low priority batches are received at once
+	lowCtx, cancel, err := g.wait(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	// a high priority batch stops the low priority receive
+	g.begin()
+	select {
+	case <-lowCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected the low priority receive to stop")
+	}
+
+	// the gate stays closed while the high priority batch is in flight, then idle
+	waited := make(chan time.Time, 1)
+	go func() {
+		_, cancel, err := g.wait(ctx)
+		if err == nil {
+			cancel()
+		}
+		waited <- time.Now()
+	}()
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case <-waited:
+		t.Fatal("expected the gate to wait for the high priority batch")
+	default:
+	}
+	ended := time.Now()
+	g.end()
+	if at := <-waited; at.Sub(ended) < g.idle {
+		t.Fatalf("expected the gate to wait %s after the last high priority batch, waited %s", g.idle, at.Sub(ended))
+	}
+
+	// cancelled
+	g.begin()
+	cctx, ccancel := context.WithCancel(ctx)
+	ccancel()
+	if _, _, err := g.wait(cctx); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/documentai/apiv1/documentaipb"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/dispatch"
+)
+
+// route maps documents to a Document AI processor, e.g. an OCR, Form Parser, Invoice or Layout
+// Parser processor. Its criteria are optional: a document matches a route when it matches all the
+// criteria set. A route without criteria matches every document.
+type route struct {
+	// Name identifies the route in the logs.
+	Name string `json:"name"`
+	// MimeTypes are the mime types matched, e.g. application/pdf.
+	MimeTypes []string `json:"mime_types,omitempty"`
+	// Prefix is the gs:// uri prefix matched, e.g. gs://bucket/invoices/.
+	Prefix string `json:"prefix,omitempty"`
+	// MinBytes and MaxBytes bound the size of the documents matched. 0 is unbounded.
+	MinBytes int64 `json:"min_bytes,omitempty"`
+	MaxBytes int64 `json:"max_bytes,omitempty"`
+	// Label is the classification label matched, see dispatch.Document.
+	Label string `json:"label,omitempty"`
+
+	// ProcessorID is the target processor, in the DOC_AI_PROCESSOR_LOCATION location.
+	ProcessorID string `json:"processor_id"`
+	// ProcessorVersion optionally pins the processor version. The default version is used otherwise.
+	ProcessorVersion string `json:"processor_version,omitempty"`
+	// SkipOCRConfig omits the OCR process options, rejected by processors other than OCR and Form
+	// Parser processors, see options.go.
+	SkipOCRConfig bool `json:"skip_ocr_config,omitempty"`
+
+	// processor is the resource name of the target processor, set by newRouter.
+	processor string
+}
+
+// matches reports whether a document matches the route. size returns the document size; it is
+// only called by routes bounding the size.
+func (r route) matches(d dispatch.Document, mimeType string, size func() int64) bool {
+	if len(r.MimeTypes) > 0 && !containsFold(r.MimeTypes, mimeType) {
+		return false
+	}
+	if r.Prefix != "" && !strings.HasPrefix(d.URI, r.Prefix) {
+		return false
+	}
+	if r.Label != "" && !strings.EqualFold(r.Label, d.Label) {
+		return false
+	}
+	if r.MinBytes > 0 || r.MaxBytes > 0 {
+		s := size()
+		if s < 0 || s < r.MinBytes || (r.MaxBytes > 0 && s > r.MaxBytes) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsFold(values []string, v string) bool {
+	for _, s := range values {
+		if strings.EqualFold(s, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// router selects the processor of each document: the target of the first matching route, or the
+// default processor.
+type router struct {
+	routes    []route
+	processor string
+}
+
+// processorName returns the resource name of a processor, or of a pinned processor version.
+func processorName(project, location, id, version string) string {
+	name := fmt.Sprintf("projects/%s/locations/%s/processors/%s", project, location, id)
+	if version != "" {
+		name += "/processorVersions/" + version
+	}
+	return name
+}
+
+// newRouter returns the router of the routes, in order of precedence, falling back to the default
+// processor.
+func newRouter(project, location, defaultProcessor string, routes []route) (*router, error) {
+	for i := range routes {
+		r := &routes[i]
+		if r.ProcessorID == "" {
+			return nil, fmt.Errorf("route %d (%s): processor_id required", i, r.Name)
+		}
+		if r.MaxBytes > 0 && r.MinBytes > r.MaxBytes {
+			return nil, fmt.Errorf("route %d (%s): min_bytes greater than max_bytes", i, r.Name)
+		}
+		r.processor = processorName(project, location, r.ProcessorID, r.ProcessorVersion)
+	}
+	return &router{routes: routes, processor: defaultProcessor}, nil
+}
+
+// parseRoutes decodes a JSON list of routes.
+func parseRoutes(b []byte) ([]route, error) {
+	var routes []route
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&routes); err != nil {
+		return nil, fmt.Errorf("invalid routes: %w", err)
+	}
+	return routes, nil
+}
+
+// readRoutes returns the routes of the DOC_AI_ROUTES env var, a JSON list, or of the
+// DOC_AI_ROUTES_FILE file. Without either, every document goes to the default processor.
+func readRoutes() ([]route, error) {
+	if v := os.Getenv("DOC_AI_ROUTES"); v != "" {
+		return parseRoutes([]byte(v))
+	}
+	if f := os.Getenv("DOC_AI_ROUTES_FILE"); f != "" {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read routes: %w", err)
+		}
+		return parseRoutes(b)
+	}
+	return nil, nil
+}
+
+// route returns the route of a document: the first matching route, or an unnamed route to the
+// default processor.
+func (r *router) route(d dispatch.Document, mimeType string, size func() int64) route {
+	for _, rt := range r.routes {
+		if rt.matches(d, mimeType, size) {
+			return rt
+		}
+	}
+	return route{processor: r.processor}
+}
+
+// processorGroup is the documents of a batch routed to the same processor, submitted together.
+type processorGroup struct {
+	Processor string
+	Route     string
+	// OCRConfig is false when the OCR process options are omitted, see route.SkipOCRConfig.
+	OCRConfig bool
+	// Documents and Batch are in the same order, see formatDocs.
+	Documents []*documentaipb.GcsDocument
+	Batch     []dispatch.Document
+}
+
+// groupKey identifies the documents submitted together: routes to the same processor may differ
+// in their OCR process options.
+type groupKey struct {
+	processor string
+	ocrConfig bool
+}
+
+// group splits the documents of a batch by processor and OCR process options, in order of first
+// appearance. size returns the size of the i-th document, -1 when unknown.
+func (r *router) group(docs []*documentaipb.GcsDocument, batch []dispatch.Document, size func(i int) int64) []processorGroup {
+	var groups []processorGroup
+	index := map[groupKey]int{}
+	for i, d := range docs {
+		rt := r.route(batch[i], d.GetMimeType(), func() int64 { return size(i) })
+		key := groupKey{processor: rt.processor, ocrConfig: !rt.SkipOCRConfig}
+		g, ok := index[key]
+		if !ok {
+			g = len(groups)
+			index[key] = g
+			groups = append(groups, processorGroup{Processor: rt.processor, Route: rt.Name, OCRConfig: !rt.SkipOCRConfig})
+		}
+		groups[g].Documents = append(groups[g].Documents, d)
+		groups[g].Batch = append(groups[g].Batch, batch[i])
+	}
+	return groups
+}
+
+// groupDocs routes the documents of a batch. Sizes missing from the batch are read from the
+// object attributes, only when a route bounds the size.
+func (svc *ocrWorkerSvc) groupDocs(ctx context.Context, docs []*documentaipb.GcsDocument, batch []dispatch.Document) []processorGroup {
+	return svc.Router.group(docs, batch, func(i int) int64 {
+		if batch[i].Size > 0 {
+			return batch[i].Size
+		}
+		o, err := svc.object(docs[i].GetGcsUri())
+		if err != nil {
+			return -1
+		}
+		a, err := o.Attrs(ctx)
+		if err != nil {
+			return -1
+		}
+		batch[i].Size = a.Size
+		return a.Size
+	})
+}
+
+// groupOperationID returns the pseudo operation id of the g-th group of an online batch. A batch
+// routed to a single processor keeps the batch id.
+func groupOperationID(opID string, g, n int) string {
+	if n <= 1 {
+		return opID
+	}
+	return fmt.Sprintf("%s-%d", opID, g)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"testing"
+
+	"cloud.google.com/go/documentai/apiv1/documentaipb"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/dispatch"
+)
+
+const testRoutes = `[
+	{"name": "invoices", "label": "invoice", "processor_id": "inv", "processor_version": "pretrained-invoice-v2.0-2023-12-06"},
+	{"name": "forms", "prefix": "gs://src/forms/", "processor_id": "form"},
+	{"name": "large-pdf", "mime_types": ["application/pdf"], "min_bytes": 1000, "processor_id": "layout", "skip_ocr_config": true},
+	{"name": "tiff", "mime_types": ["image/tiff"], "processor_id": "ocr", "skip_ocr_config": true}
+]`
+
+func testRouter(t *testing.T) *router {
+	t.Helper()
+	routes, err := parseRoutes([]byte(testRoutes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := newRouter("p", "us", processorName("p", "us", "ocr", ""), routes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRoute(t *testing.T) {
+	r := testRouter(t)
+
+	tests := map[string]struct {
+		doc    dispatch.Document
+		mime   string
+		size   int64
+		expect string
+	}{
+		// the label is matched first, with a pinned version
+		"label": {
+			doc:    dispatch.Document{URI: "gs://src/forms/a.jpg", Label: "Invoice"},
+			mime:   "image/jpeg",
+			expect: "projects/p/locations/us/processors/inv/processorVersions/pretrained-invoice-v2.0-2023-12-06",
+		},
+		"prefix": {doc: dispatch.Document{URI: "gs://src/forms/a.jpg"}, mime: "image/jpeg", expect: "projects/p/locations/us/processors/form"},
+		"size":   {doc: dispatch.Document{URI: "gs://src/a.pdf"}, mime: "application/pdf", size: 2000, expect: "projects/p/locations/us/processors/layout"},
+		// too small for the large pdf route
+		"small": {doc: dispatch.Document{URI: "gs://src/a.pdf"}, mime: "application/pdf", size: 10, expect: "projects/p/locations/us/processors/ocr"},
+		// unknown size
+		"unknown": {doc: dispatch.Document{URI: "gs://src/a.pdf"}, mime: "application/pdf", size: -1, expect: "projects/p/locations/us/processors/ocr"},
+		"default": {doc: dispatch.Document{URI: "gs://src/a.jpg"}, mime: "image/jpeg", expect: "projects/p/locations/us/processors/ocr"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			res := r.route(tc.doc, tc.mime, func() int64 { return tc.size }).processor
+			if res != tc.expect {
+				t.Fatalf("expected: %s, result: %s", tc.expect, res)
+			}
+		})
+	}
+}
+
+func TestRouteSizeNotRead(t *testing.T) {
+	r := testRouter(t)
+
+	// the size is only read by routes bounding it, once the other criteria match
+	rt := r.route(dispatch.Document{URI: "gs://src/a.jpg"}, "image/jpeg", func() int64 {
+		t.Fatal("size read")
+		return 0
+	})
+	if rt.Name != "" {
+		t.Fatalf("expected the default processor, result: %s", rt.Name)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	r := testRouter(t)
+	batch := []dispatch.Document{
+		{URI: "gs://src/a.jpg"},
+		{URI: "gs://src/b.jpg", Label: "invoice"},
+		{URI: "gs://src/c.jpg"},
+		{URI: "gs://src/d.jpg", Label: "invoice"},
+	}
+	docs := make([]*documentaipb.GcsDocument, len(batch))
+	for i, d := range batch {
+		docs[i] = &documentaipb.GcsDocument{GcsUri: d.URI, MimeType: "image/jpeg"}
+	}
+
+	groups := r.group(docs, batch, func(int) int64 { return -1 })
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, result: %d", len(groups))
+	}
+	// groups keep the order of first appearance, and their documents the batch order
+	expect := [][]string{{"gs://src/a.jpg", "gs://src/c.jpg"}, {"gs://src/b.jpg", "gs://src/d.jpg"}}
+	for i, g := range groups {
+		for j, uri := range expect[i] {
+			if g.Documents[j].GetGcsUri() != uri || g.Batch[j].URI != uri {
+				t.Fatalf("group %d: expected: %s, result: %s", i, uri, g.Documents[j].GetGcsUri())
+			}
+		}
+	}
+	if groups[1].Route != "invoices" || !groups[1].OCRConfig {
+		t.Fatalf("expected the invoices route, result: %s", groups[1].Route)
+	}
+
+	// routes to the same processor with different OCR options are submitted separately
+	batch = append(batch, dispatch.Document{URI: "gs://src/e.tiff"})
+	docs = append(docs, &documentaipb.GcsDocument{GcsUri: "gs://src/e.tiff", MimeType: "image/tiff"})
+	groups = r.group(docs, batch, func(int) int64 { return -1 })
+	if len(groups) != 3 || groups[2].Processor != groups[0].Processor || groups[2].OCRConfig || len(groups[2].Documents) != 1 {
+		t.Fatalf("expected a group without OCR options, result: %+v", groups)
+	}
+}
+
+func TestNewRouter(t *testing.T) {
+	tests := map[string]string{
+		"processor": `[{"name": "a"}]`,
+		"size":      `[{"name": "a", "processor_id": "x", "min_bytes": 10, "max_bytes": 1}]`,
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			routes, err := parseRoutes([]byte(tc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := newRouter("p", "us", "", routes); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+
+	// unknown fields are rejected, e.g. typos of the criteria
+	if _, err := parseRoutes([]byte(`[{"mime_type": "application/pdf", "processor_id": "x"}]`)); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -14,19 +16,35 @@ import (
 	"cloud.google.com/go/documentai/apiv1/documentaipb"
 	"cloud.google.com/go/pubsub"
 	"cloud.google.com/go/storage"
-	"github.com/cyber-nic/go-gcp-doc-ai/apps/ocr-worker/libs/utils"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/dispatch"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/logging"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/telemetry"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	grpccodes "google.golang.org/grpc/codes"
 )
 
 // SvcOptions is the representation of the options availble to the OCRWorkerSvc service
 type SvcOptions struct {
 	Topic                   *pubsub.Topic
 	Subscription            *pubsub.Subscription
+	HighSubscription        *pubsub.Subscription
+	HighPriorityIdle        time.Duration
 	AIClient                *documentai.DocumentProcessorClient
-	AIProcessorName         string
+	Router                  *router
+	ProcessOptions          dispatch.ProcessOptions
+	StoreClient             *storage.Client
 	DstBucketName           string
+	DstBucketHandle         *storage.BucketHandle
 	ErrBucketHandle         *storage.BucketHandle
 	RefsBucketHandle        *storage.BucketHandle
 	DocAIMinAsyncReqSeconds int
+	PendingOpsPrefix        string
+	OnlineMaxDocs           int
+	OnlineMaxBytes          int64
 }
 
 // OCRWorkerSvc is the interface for the ocrWorkerSvc service.
@@ -37,134 +55,354 @@ type OCRWorkerSvc interface {
 }
 
 // ocrWorkerSvc is a service that will submit a batch of documents to the Document AI API.
+//
+// Context is the work context: cancelling it abandons in-flight Document AI operations, whose ids
+// are then persisted to the refs bucket and resumed on the next start. Stop only cancels the
+// receive context, letting in-flight batches finish.
 type ocrWorkerSvc struct {
-	ready                   bool
-	Context                 context.Context
-	Topic                   *pubsub.Topic
-	Subscription            *pubsub.Subscription
-	AIClient                *documentai.DocumentProcessorClient
-	AIProcessorName         string
+	ready        atomic.Bool
+	receiveCtx   context.Context
+	stopReceive  context.CancelFunc
+	Context      context.Context
+	Topic        *pubsub.Topic
+	Subscription *pubsub.Subscription
+	// HighSubscription, optional, receives the high priority batches, drained before the low
+	// priority ones of Subscription, see priority.go.
+	HighSubscription *pubsub.Subscription
+	gate             *priorityGate
+	AIClient         *documentai.DocumentProcessorClient
+	// Router selects the processor of each document, see routing.go.
+	Router *router
+	// ProcessOptions are the default process options, overridden by the message attributes.
+	ProcessOptions          dispatch.ProcessOptions
+	StoreClient             *storage.Client
 	DstBucketName           string
+	DstBucketHandle         *storage.BucketHandle
 	ErrBucketHandle         *storage.BucketHandle
 	RefsBucketHandle        *storage.BucketHandle
 	DocAIMinAsyncReqSeconds float64
+	PendingOpsPrefix        string
+	// OnlineMaxDocs and OnlineMaxBytes select the batches processed online, see isOnline.
+	OnlineMaxDocs  int
+	OnlineMaxBytes int64
 }
 
 // NewOCRWorkerSvc creates an instance of the OCRWorkerSvc Service.
 func NewOCRWorkerSvc(ctx context.Context, o *SvcOptions) OCRWorkerSvc {
+	receiveCtx, stopReceive := context.WithCancel(ctx)
 	return &ocrWorkerSvc{
-		ready:                   false,
+		receiveCtx:              receiveCtx,
+		stopReceive:             stopReceive,
 		Context:                 ctx,
 		Topic:                   o.Topic,
 		Subscription:            o.Subscription,
+		HighSubscription:        o.HighSubscription,
+		gate:                    &priorityGate{idle: o.HighPriorityIdle},
 		AIClient:                o.AIClient,
-		AIProcessorName:         o.AIProcessorName,
+		Router:                  o.Router,
+		ProcessOptions:          o.ProcessOptions,
+		StoreClient:             o.StoreClient,
 		DstBucketName:           o.DstBucketName,
+		DstBucketHandle:         o.DstBucketHandle,
 		ErrBucketHandle:         o.ErrBucketHandle,
 		RefsBucketHandle:        o.RefsBucketHandle,
 		DocAIMinAsyncReqSeconds: float64(o.DocAIMinAsyncReqSeconds),
+		PendingOpsPrefix:        o.PendingOpsPrefix,
+		OnlineMaxDocs:           o.OnlineMaxDocs,
+		OnlineMaxBytes:          o.OnlineMaxBytes,
 	}
 }
 
 // IsReady returns a bool describing the state of the service.
 // Output:
 //
-//	True when the service is processing SQS messages
+//	True when the service is receiving Pub/Sub messages
 //	Otherwise False
 func (svc *ocrWorkerSvc) IsReady() bool {
-	return svc.ready
+	return svc.ready.Load()
 }
 
 func existsInRefsBucket(ctx context.Context, bucket *storage.BucketHandle, filename string) (bool, error) {
-	_, err := bucket.Object(filename).NewReader(ctx)
+	_, err := bucket.Object(filename).Attrs(ctx)
 	if err != nil && err == storage.ErrObjectNotExist {
 		return false, nil
 	}
 	if err != nil {
-		log.Error().Err(err).Caller().Msg("failed to check refs bucket")
+		return false, fmt.Errorf("failed to check refs bucket (%s): %w", filename, err)
 	}
 
 	return true, nil
 }
 
-// Start is the main business logic loop.
+// Start is the main business logic loop. It returns once Stop is called and all in-flight
+// batches have completed, or once the work context is cancelled.
 func (svc *ocrWorkerSvc) Start() error {
-	svc.ready = true
+	// resume the operations abandoned by a previous instance
+	resumed := make(chan struct{})
+	go func() {
+		defer close(resumed)
+		svc.resumePendingOps(svc.Context)
+	}()
+
+	svc.ready.Store(true)
+
+	// Main service loop. Receive only returns once all handlers have returned.
+	if svc.HighSubscription != nil {
+		svc.receivePriority(svc.receiveCtx)
+	}
+	for svc.receiveCtx.Err() == nil {
+		if err := svc.Subscription.Receive(svc.receiveCtx, svc.handleMessage); err != nil {
+			log.Error().Err(err).Caller().Msg("failed to receive message")
+		}
+	}
+	svc.ready.Store(false)
+
+	<-resumed
+	log.Info().Msg("service task completed")
+	return nil
+}
 
-	msgHandler := func(ctx context.Context, m *pubsub.Message) {
-		start := time.Now()
+// handleMessage processes a batch of filenames. The batch runs on the work context so that it can
+// drain, and its throttle on the receive context. The Receive context is not used: the low priority
+// one is cancelled by high priority batches, which must not cut the throttle short.
+func (svc *ocrWorkerSvc) handleMessage(_ context.Context, m *pubsub.Message) {
+	start := time.Now()
+	messagesReceived.Inc()
+
+	// continue the trace started by the dispatcher
+	wctx, span := telemetry.Tracer().Start(telemetry.Extract(svc.Context, m.Attributes), "ocr-worker.process_batch",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.String("messaging.message.id", m.ID)),
+	)
+	defer span.End()
+
+	// the message id identifies the batch in the logs
+	logger := log.With().Str(logging.FieldBatchID, m.ID).Logger()
+	wctx = logger.WithContext(wctx)
+
+	batch, err := dispatch.DecodeBatch(string(m.Data))
+	if err != nil {
+		// todo: write to err bucket
+		logger.Error().Err(err).Caller().Msg("failed to decode message")
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to decode message")
+		m.Nack()
+		return
+	}
+	priority := m.Attributes[dispatch.AttrPriority]
+	span.SetAttributes(attribute.Int("batch.files", len(batch)), attribute.String("batch.priority", priority))
 
-		var filenames []string
-		if err := utils.DecodeFromBase64(&filenames, string(m.Data)); err != nil {
-			// todo: write to err bucket
-			m.Nack()
-			return
-		}
+	// acknowledge message
+	m.Ack()
+	logger.Info().Int("files", len(batch)).Str("priority", priority).Caller().Msgf("msg acknowledged. processing %d files", len(batch))
 
-		// acknowledge message
-		m.Ack()
-		log.Info().Int("files", len(filenames)).Caller().Msgf("msg acknowledged. processing %d files", len(filenames))
+	// convert []dispatch.Document into []*documentaipb.GcsDocument
+	documents, batch := formatDocs(wctx, svc.RefsBucketHandle, batch)
 
-		// convert []string into []*documentaipb.GcsDocument
-		documents := formatDocs(ctx, svc.RefsBucketHandle, filenames)
-		// build *documentaipb.BatchProcessRequest
-		req := formatDocAIReq(svc.AIProcessorName, svc.DstBucketName, documents)
+	// process options of the batch. Invalid attributes are ignored rather than failing the batch.
+	opts, err := dispatch.ParseProcessOptions(m.Attributes, svc.ProcessOptions)
+	if err != nil {
+		logger.Error().Err(err).Caller().Msg("invalid process options, using defaults")
+		opts = svc.ProcessOptions
+	}
 
-		// perform batch OCR request
-		success, failures, err := submitDocAIBatch(ctx, svc.AIClient, req)
-		if err != nil && err.Error() != "rpc error: code = InvalidArgument desc = Failed to process all documents." {
-			log.Error().Err(err).Caller().Msgf("error submitting batch: %v", err)
-		}
+	// route the documents to their processors. Each processor group is submitted separately.
+	groups := svc.groupDocs(wctx, documents, batch)
 
-		// write success refs
-		if errs := writeKVRefs(ctx, svc.RefsBucketHandle, success); len(errs) > 0 {
-			for _, e := range errs {
-				log.Error().Err(e).Caller().Msg("failed to write success ref")
-			}
+	// small batches and low-latency requests are processed online, without an operation
+	var success []KV
+	var failures []types.ErrorRecord
+	online := svc.isOnline(wctx, m.Attributes, documents)
+	if online {
+		opID := onlineOperationID(m.ID)
+		for i, g := range groups {
+			gID := groupOperationID(opID, i, len(groups))
+			logger.Info().
+				Str("operation", gID).
+				Str("processor", g.Processor).
+				Int("files", len(g.Documents)).
+				Msg("processing batch online")
+			s, f := svc.processOnline(wctx, gID, g, opts)
+			success = append(success, s...)
+			failures = append(failures, f...)
 		}
+		svc.writeResults(wctx, success, failures)
+	} else {
+		if opts.HasPageRange() {
+			// Document AI only applies the page selection to online requests
+			logger.Warn().Str("attribute", dispatch.AttrPages).Msg("page selection ignored by batch requests, processing all pages")
+		}
+		success, failures = svc.processBatches(wctx, groups, opts)
+	}
+	span.SetAttributes(
+		attribute.Bool("batch.online", online),
+		attribute.Int("batch.processors", len(groups)),
+		attribute.Int("batch.success", len(success)),
+		attribute.Int("batch.failures", len(failures)),
+	)
+
+	// the OCR work rate will control the NLP rate, which is the rate limiting factor.
+	elapsed := time.Since(start)
+	batchDuration.Observe(elapsed.Seconds())
+
+	// sleep if the elapsed time is less than x seconds, unless the service is stopping. Online
+	// batches are not throttled.
+	if !online && elapsed.Seconds() < svc.DocAIMinAsyncReqSeconds {
+		sleepDuration := svc.DocAIMinAsyncReqSeconds - elapsed.Seconds()
+		select {
+		case <-time.After(time.Duration(sleepDuration) * time.Second):
+		case <-svc.receiveCtx.Done():
+		}
+		throttleWait.Observe(time.Since(start).Seconds() - elapsed.Seconds())
+	}
+	total := time.Since(start).Seconds()
 
-		// write failure errs
-		if errs := writeKVRefs(ctx, svc.ErrBucketHandle, failures); len(errs) > 0 {
-			for _, e := range errs {
-				log.Error().Err(e).Caller().Msg("failed to write error")
-			}
+	// log the results as info or error if there are failures
+	l := func() *zerolog.Event {
+		if len(failures) > 0 {
+			return logger.Error()
+		} else {
+			return logger.Info()
 		}
+	}()
+	l.Caller().
+		Int("failures", len(failures)).
+		Int("success", len(success)).
+		Float64("ocr duration", elapsed.Seconds()).
+		Float64("total time", total).
+		Msgf("processed %d/%d files in %f seconds", len(success), len(batch), total)
+}
+
+// processBatches submits a Document AI batch operation per processor group and waits for the
+// operations concurrently. Documents of groups that fail to be submitted are failures, with a
+// retryable error record, see processBatch.
+func (svc *ocrWorkerSvc) processBatches(ctx context.Context, groups []processorGroup, opts dispatch.ProcessOptions) ([]KV, []types.ErrorRecord) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var success []KV
+	var failures []types.ErrorRecord
+	for _, g := range groups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s, f := svc.processBatch(ctx, g, opts)
+			mu.Lock()
+			defer mu.Unlock()
+			success = append(success, s...)
+			failures = append(failures, f...)
+		}()
+	}
+	wg.Wait()
+	return success, failures
+}
+
+// processBatch submits the documents of a processor group as a batch operation, writes its manifest
+// and waits for it, see handleOperation. When the batch fails to be submitted, the message is
+// already acknowledged and the documents already have refs from the dispatcher: a retryable error
+// record is written per document so that they can be replayed, see the triage app.
+func (svc *ocrWorkerSvc) processBatch(ctx context.Context, g processorGroup, opts dispatch.ProcessOptions) ([]KV, []types.ErrorRecord) {
+	logger := zerolog.Ctx(ctx).With().Str("processor", g.Processor).Logger()
+	ctx = logger.WithContext(ctx)
+
+	// build *documentaipb.BatchProcessRequest
+	req := formatDocAIReq(g.Processor, svc.DstBucketName, g.Documents, processOptions(opts, g.OCRConfig, false))
+
+	// perform batch OCR request
+	op, err := svc.AIClient.BatchProcessDocuments(ctx, req)
+	if err != nil {
+		logger.Error().Err(err).Caller().Msgf("error submitting batch: %v", err)
+		span := trace.SpanFromContext(ctx)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to submit batch")
+		failures := submitFailures(g, err)
+		svc.writeResults(ctx, nil, failures)
+		return nil, failures
+	}
+	logger.Info().Str("operation", op.Name()).Str("route", g.Route).Int("files", len(g.Documents)).Msg("batch submitted")
 
-		// the OCR work rate will control the NLP rate, which is the rate limiting factor.
-		elapsed := time.Since(start)
+	// map the operation outputs to their sources, for the nlp-worker
+	m := newManifest(ctx, op.Name(), svc.DstBucketName, g.Batch)
+	m.Processor = g.Processor
+	if err := writeManifest(ctx, svc.RefsBucketHandle, m); err != nil {
+		logger.Error().Err(err).Caller().Str("operation", op.Name()).Msg("failed to write manifest")
+	}
+	return svc.handleOperation(ctx, op)
+}
 
-		// sleep if the elapsed time is less than x seconds
-		if elapsed.Seconds() < svc.DocAIMinAsyncReqSeconds {
-			sleepDuration := svc.DocAIMinAsyncReqSeconds - elapsed.Seconds()
-			time.Sleep(time.Duration(sleepDuration) * time.Second)
+// submitFailures returns the error records of the documents of a group that failed to be submitted.
+// The documents were not processed: they are retryable whatever the error.
+func submitFailures(g processorGroup, err error) []types.ErrorRecord {
+	var failures []types.ErrorRecord
+	for _, d := range g.Documents {
+		uri := d.GetGcsUri()
+		bucket, object, _ := strings.Cut(strings.TrimPrefix(uri, "gs://"), "/")
+		r := types.NewErrorRecord(types.ErrorStageOCR, bucket, object, 0, fmt.Sprintf("failed to submit batch (%s)", uri), err)
+		r.Retryable = true
+		failures = append(failures, r)
+		documentsProcessed.WithLabelValues("failure", r.Code).Inc()
+	}
+	return failures
+}
+
+// handleOperation waits for a Document AI batch operation and writes its results to the refs and
+// err buckets. When ctx is cancelled before the operation completes, the operation id is persisted
+// so that it can be resumed.
+func (svc *ocrWorkerSvc) handleOperation(ctx context.Context, op *documentai.BatchProcessDocumentsOperation) ([]KV, []types.ErrorRecord) {
+	logger := zerolog.Ctx(ctx)
+	opStart := time.Now()
+	octx, span := telemetry.Tracer().Start(ctx, "documentai.batch_process",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("documentai.operation", op.Name())),
+	)
+	success, failures, err := waitDocAIBatch(octx, op)
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+
+	if ctx.Err() != nil {
+		// the bucket writes must outlive the cancelled work context
+		pctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), persistTimeout)
+		defer cancel()
+		if err := persistPendingOp(pctx, svc.RefsBucketHandle, svc.PendingOpsPrefix, op.Name()); err != nil {
+			logger.Error().Err(err).Caller().Str("operation", op.Name()).Msg("failed to persist pending operation")
+		} else {
+			logger.Warn().Str("operation", op.Name()).Msg("operation abandoned, id persisted")
 		}
-		total := time.Since(start).Seconds()
-
-		// log the results as info or error if there are failures
-		l := func() *zerolog.Event {
-			if len(failures) > 0 {
-				return log.Error()
-			} else {
-				return log.Info()
-			}
-		}()
-		l.Caller().
-			Int("failures", len(failures)).
-			Int("success", len(success)).
-			Float64("ocr duration", elapsed.Seconds()).
-			Float64("total time", total).
-			Msgf("processed %d/%d files in %f seconds", len(success), len(filenames), total)
+		return success, failures
+	}
+	docAIOperationDuration.Observe(time.Since(opStart).Seconds())
+	if err != nil && err.Error() != "rpc error: code = InvalidArgument desc = Failed to process all documents." {
+		logger.Error().Err(err).Caller().Msgf("error processing batch: %v", err)
 	}
 
-	// Main service loop.
-	for svc.ready {
-		if err := svc.Subscription.Receive(svc.Context, msgHandler); err != nil {
-			log.Error().Err(err).Caller().Msg("failed to receive message")
+	// record the actual outputs in the manifest
+	if err := completeManifest(ctx, svc.RefsBucketHandle, op.Name(), success); err != nil {
+		logger.Error().Err(err).Caller().Str("operation", op.Name()).Msg("failed to complete manifest")
+	}
+
+	svc.writeResults(ctx, success, failures)
+
+	return success, failures
+}
+
+// writeResults writes the success refs and the error records of the failures of a batch.
+func (svc *ocrWorkerSvc) writeResults(ctx context.Context, success []KV, failures []types.ErrorRecord) {
+	logger := zerolog.Ctx(ctx)
+
+	// write success refs
+	if errs := writeKVRefs(ctx, svc.RefsBucketHandle, success); len(errs) > 0 {
+		for _, e := range errs {
+			logger.Error().Err(e).Caller().Msg("failed to write success ref")
 		}
 	}
 
-	log.Info().Msg("service task completed")
-	return nil
+	// write failure errs
+	if errs := writeErrorRecords(ctx, svc.ErrBucketHandle, failures); len(errs) > 0 {
+		for _, e := range errs {
+			logger.Error().Err(e).Caller().Msg("failed to write error record")
+		}
+	}
 }
 
 func writeKVRefs(ctx context.Context, bucket *storage.BucketHandle, docs []KV) []error {
@@ -179,6 +417,23 @@ func writeKVRefs(ctx context.Context, bucket *storage.BucketHandle, docs []KV) [
 	return errs
 }
 
+// writeErrorRecords writes the error records of failed documents, named after the source image
+// (`<bucket>/<path>.log`).
+func writeErrorRecords(ctx context.Context, bucket *storage.BucketHandle, records []types.ErrorRecord) []error {
+	var errs []error
+	for _, r := range records {
+		if err := types.WriteErrorRecord(ctx, bucket.Object(errorRecordKey(r)), r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// errorRecordKey returns the err bucket key of the error record of a source image.
+func errorRecordKey(r types.ErrorRecord) string {
+	return fmt.Sprintf("%s/%s.log", r.Bucket, r.Object)
+}
+
 func writeRef(ctx context.Context, bucket *storage.BucketHandle, k string, v string) (*storage.ObjectAttrs, error) {
 	writer := bucket.Object(k).NewWriter(ctx)
 	defer writer.Close()
@@ -190,33 +445,48 @@ func writeRef(ctx context.Context, bucket *storage.BucketHandle, k string, v str
 	return writer.Attrs(), nil
 }
 
-// Stop instructs the service to stop processing new messages.
+// Stop instructs the service to stop receiving new messages. In-flight batches keep running on
+// the work context.
 func (svc *ocrWorkerSvc) Stop() {
 	log.Info().Msg("stopping service")
-	svc.ready = false
+	svc.ready.Store(false)
+	svc.stopReceive()
 }
 
-func formatDocs(ctx context.Context, b *storage.BucketHandle, filenames []string) []*documentaipb.GcsDocument {
+// formatDocs returns the documents to submit, in the same order as the batch documents kept,
+// i.e. not found in the refs bucket. Documents whose refs check fails are kept: processing one twice
+// is cheaper than losing it.
+func formatDocs(ctx context.Context, b *storage.BucketHandle, batch []dispatch.Document) ([]*documentaipb.GcsDocument, []dispatch.Document) {
 	var documents []*documentaipb.GcsDocument
+	var kept []dispatch.Document
 
-	for _, f := range filenames {
+	for _, d := range batch {
+		f := d.URI
 		// check if file exists in refs bucket
-		if ok, err := existsInRefsBucket(ctx, b, utils.GetFilenameFromPath(f)); err != nil || ok {
-			// todo: if err write to src-err
+		ok, err := existsInRefsBucket(ctx, b, utils.GetFilenameFromPath(f))
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Caller().Str("uri", f).Msg("failed to check refs bucket, keeping document")
+			refsBucketErrors.Inc()
+		}
+		if ok {
+			refsBucketHits.Inc()
 			continue
 		}
 
-		mime := ""
-		mime, err := utils.GetMimeTypeFromExt(f)
-		if err != nil {
-			mime = "image/jpeg"
+		mime := d.MimeType
+		if mime == "" {
+			mime, err = utils.GetMimeTypeFromExt(f)
+			if err != nil {
+				mime = "image/jpeg"
+			}
 		}
 		documents = append(documents, &documentaipb.GcsDocument{
 			GcsUri:   f,
 			MimeType: mime,
 		})
+		kept = append(kept, d)
 	}
-	return documents
+	return documents, kept
 }
 
 type KV struct {
@@ -224,22 +494,15 @@ type KV struct {
 	Value string
 }
 
-func submitDocAIBatch(
-	ctx context.Context,
-	client *documentai.DocumentProcessorClient,
-	req *documentaipb.BatchProcessRequest,
-) ([]KV, []KV, error) {
+func waitDocAIBatch(ctx context.Context, op *documentai.BatchProcessDocumentsOperation) ([]KV, []types.ErrorRecord, error) {
 	var success []KV
-	var failures []KV
-
-	// process request
-	op, err := client.BatchProcessDocuments(ctx, req)
-	if err != nil {
-		return success, failures, fmt.Errorf("op: %w", err)
-	}
+	var failures []types.ErrorRecord
 
 	// Handle the results.
-	_, err = op.Wait(ctx)
+	_, err := op.Wait(ctx)
+	if ctx.Err() != nil {
+		return success, failures, ctx.Err()
+	}
 
 	// get metadata
 	meta, metaErr := op.Metadata()
@@ -249,16 +512,20 @@ func submitDocAIBatch(
 
 	// https://github.com/googleapis/googleapis/blob/master/google/rpc/code.proto
 	// log individual process status
+	logger := zerolog.Ctx(ctx)
 	for _, i := range meta.IndividualProcessStatuses {
 		filename := strings.Replace(i.InputGcsSource, "gs://", "", 1)
-		if i.Status.Code == 0 {
-			success = append(success, KV{Key: filename, Value: ""})
+		code := grpccodes.Code(i.Status.Code)
+		if code == grpccodes.OK {
+			documentsProcessed.WithLabelValues("success", code.String()).Inc()
+			success = append(success, KV{Key: filename, Value: i.OutputGcsDestination})
 		} else {
-			failures = append(failures, KV{Key: fmt.Sprintf("%s.log", filename), Value: i.Status.Message})
+			documentsProcessed.WithLabelValues("failure", code.String()).Inc()
+			failures = append(failures, failureRecord(i, meta.GetUpdateTime().AsTime()))
 			// log
-			log.Error().Err(errors.New(i.Status.Message)).Caller().
+			logger.Error().Err(errors.New(i.Status.Message)).Caller().
 				Int32("StatusCode", i.Status.Code).
-				Str("file", i.InputGcsSource).
+				Str(logging.FieldObject, i.InputGcsSource).
 				Msgf("failed to process %s", i.InputGcsSource)
 		}
 	}
@@ -270,11 +537,28 @@ func submitDocAIBatch(
 	return success, failures, nil
 }
 
-func formatDocAIReq(proc string, target string, docs []*documentaipb.GcsDocument) *documentaipb.BatchProcessRequest {
+// failureRecord returns the error record of a document Document AI failed to process. The failure
+// is remote: the record has no error chain nor stack.
+func failureRecord(s *documentaipb.BatchProcessMetadata_IndividualProcessStatus, t time.Time) types.ErrorRecord {
+	bucket, object, _ := strings.Cut(strings.TrimPrefix(s.InputGcsSource, "gs://"), "/")
+	code := grpccodes.Code(s.GetStatus().GetCode())
+	return types.ErrorRecord{
+		Stage:     types.ErrorStageOCR,
+		Bucket:    bucket,
+		Object:    object,
+		Code:      code.String(),
+		Message:   s.GetStatus().GetMessage(),
+		Retryable: types.IsRetryableCode(code),
+		Timestamp: t.UTC(),
+	}
+}
+
+func formatDocAIReq(proc string, target string, docs []*documentaipb.GcsDocument, opts *documentaipb.ProcessOptions) *documentaipb.BatchProcessRequest {
 	// https://pkg.go.dev/cloud.google.com/go/documentai/apiv1/documentaipb#ProcessRequest
 	return &documentaipb.BatchProcessRequest{
 		Name:            proc,
 		SkipHumanReview: true,
+		ProcessOptions:  opts,
 		InputDocuments: &documentaipb.BatchDocumentsInputConfig{
 			Source: &documentaipb.BatchDocumentsInputConfig_GcsDocuments{
 				GcsDocuments: &documentaipb.GcsDocuments{
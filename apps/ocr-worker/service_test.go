@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"cloud.google.com/go/documentai/apiv1/documentaipb"
+	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSubmitFailures(t *testing.T) {
+	g := processorGroup{Documents: []*documentaipb.GcsDocument{
+		{GcsUri: "gs://src/a/1.png"},
+		{GcsUri: "gs://src/b/2.tif"},
+	}}
+	// a non-retryable code: the documents were not processed
+	failures := submitFailures(g, status.Error(grpccodes.InvalidArgument, "bad request"))
+
+	expect := []string{"src/a/1.png.log", "src/b/2.tif.log"}
+	if len(failures) != len(expect) {
+		t.Fatalf("expected: %d, result: %d", len(expect), len(failures))
+	}
+	for i, r := range failures {
+		if key := errorRecordKey(r); key != expect[i] {
+			t.Fatalf("expected: %s, result: %s", expect[i], key)
+		}
+		if !r.Retryable || r.Code != grpccodes.InvalidArgument.String() {
+			t.Fatalf("expected: retryable %s, result: %+v", grpccodes.InvalidArgument, r)
+		}
+	}
+}
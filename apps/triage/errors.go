@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	stageOCR = types.ErrorStageOCR
+	stageNLP = types.ErrorStageNLP
+
+	// unknownCode is used when the error object does not carry a gRPC status code.
+	unknownCode = "Unknown"
+)
+
+var (
+	// rpcErrRe matches the string representation of a gRPC status error.
+	rpcErrRe = regexp.MustCompile(`code = (\w+) desc = (.*)`)
+	// gcsURIRe matches gs:// uris embedded in error messages.
+	gcsURIRe = regexp.MustCompile(`gs://\S+`)
+	// objectRefRe matches the "(bucket/object)" reference the nlp-worker adds to its messages.
+	objectRefRe = regexp.MustCompile(`\s*\([^()]*/[^()]*\)`)
+)
+
+// errorEntry is a single error object found in one of the err buckets.
+type errorEntry struct {
+	Stage   string
+	Bucket  string
+	Object  string
+	Target  string
+	Code    string
+	Message string
+	Updated time.Time
+}
+
+// nlpErrorResponse is the legacy JSON document written by the nlp-worker, before types.ErrorRecord.
+type nlpErrorResponse struct {
+	Timestamp  time.Time `json:"timestamp"`
+	StackTrace string    `json:"stack_trace"`
+	Message    string    `json:"message"`
+}
+
+// filter selects the error entries an operation applies to. Empty fields match everything.
+type filter struct {
+	Stage  string
+	Code   string
+	Match  string
+	Prefix string
+	Limit  int
+}
+
+func (f filter) matches(e errorEntry) bool {
+	if f.Stage != "" && f.Stage != e.Stage {
+		return false
+	}
+	if f.Code != "" && !strings.EqualFold(f.Code, e.Code) {
+		return false
+	}
+	if f.Match != "" && !strings.Contains(e.Message, f.Match) {
+		return false
+	}
+	return true
+}
+
+// listErrors reads every error object in a bucket and calls fn for each one matching the filter.
+func listErrors(ctx context.Context, b *storage.BucketHandle, bucketName, stage, archivePrefix string, f filter, fn func(errorEntry) error) error {
+	itr := b.Objects(ctx, &storage.Query{Prefix: f.Prefix})
+	for {
+		attrs, err := itr.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to list %s: %w", bucketName, err)
+		}
+
+		// archived errors are not part of the backlog
+		if archivePrefix != "" && strings.HasPrefix(attrs.Name, archivePrefix) {
+			continue
+		}
+
+		body, err := readObject(ctx, b.Object(attrs.Name))
+		if err != nil {
+			return err
+		}
+
+		var e errorEntry
+		switch stage {
+		case stageOCR:
+			e = parseOCRError(attrs.Name, body)
+		case stageNLP:
+			e = parseNLPError(attrs.Name, body)
+		}
+		e.Bucket = bucketName
+		e.Updated = attrs.Updated
+
+		if !f.matches(e) {
+			continue
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
+
+func readObject(ctx context.Context, o *storage.ObjectHandle) ([]byte, error) {
+	r, err := o.NewReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("(%s) failed to create reader: %w", o.ObjectName(), err)
+	}
+	defer r.Close()
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("(%s) failed to read: %w", o.ObjectName(), err)
+	}
+	return b, nil
+}
+
+// parseRecord parses an error record, see types.ErrorRecord. ok is false for legacy error objects.
+func parseRecord(body []byte) (types.ErrorRecord, bool) {
+	var r types.ErrorRecord
+	if err := json.Unmarshal(body, &r); err != nil || r.Stage == "" {
+		return r, false
+	}
+	return r, true
+}
+
+// parseOCRError parses an ocr-worker error object. The object is named after the source image
+// (`<bucket>/<path>.log`) and its content is an error record, or the raw Document AI status message
+// for legacy objects.
+func parseOCRError(name string, body []byte) errorEntry {
+	if r, ok := parseRecord(body); ok {
+		return errorEntry{
+			Stage:   stageOCR,
+			Object:  name,
+			Target:  fmt.Sprintf("gs://%s/%s", r.Bucket, r.Object),
+			Code:    r.Code,
+			Message: r.Message,
+		}
+	}
+
+	msg := strings.TrimSpace(string(body))
+	code, desc := parseStatus(msg)
+	return errorEntry{
+		Stage:   stageOCR,
+		Object:  name,
+		Target:  "gs://" + strings.TrimSuffix(name, ".log"),
+		Code:    code,
+		Message: desc,
+	}
+}
+
+// parseNLPError parses an nlp-worker error object. The object is named after the OCR output
+// object that failed and its content is an error record, or a JSON error response for legacy
+// objects.
+func parseNLPError(name string, body []byte) errorEntry {
+	if r, ok := parseRecord(body); ok {
+		return errorEntry{
+			Stage:   stageNLP,
+			Object:  name,
+			Target:  name,
+			Code:    r.Code,
+			Message: r.Message,
+		}
+	}
+
+	e := errorEntry{
+		Stage:  stageNLP,
+		Object: name,
+		Target: name,
+		Code:   unknownCode,
+	}
+
+	var resp nlpErrorResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		e.Message = strings.TrimSpace(string(body))
+		return e
+	}
+
+	// the underlying error is only available as a string
+	code, desc := parseStatus(resp.StackTrace)
+	e.Code = code
+	e.Message = resp.Message
+	if desc != "" && code != unknownCode {
+		e.Message = fmt.Sprintf("%s: %s", resp.Message, desc)
+	}
+	return e
+}
+
+// parseStatus extracts the gRPC code and description from an error string.
+func parseStatus(s string) (string, string) {
+	if m := rpcErrRe.FindStringSubmatch(s); m != nil {
+		return m[1], m[2]
+	}
+	return unknownCode, s
+}
+
+// normalizeMessage strips the object specific parts of a message so that similar errors aggregate.
+func normalizeMessage(m string) string {
+	m = gcsURIRe.ReplaceAllString(m, "gs://…")
+	m = objectRefRe.ReplaceAllString(m, "")
+	return strings.TrimSpace(m)
+}
+
+// errorGroup is the aggregate of all errors sharing a stage, code and normalized message.
+type errorGroup struct {
+	Stage   string
+	Code    string
+	Message string
+	Count   int
+	Last    time.Time
+}
+
+// aggregate groups errors by stage, code and normalized message, most frequent first.
+func aggregate(entries []errorEntry) []errorGroup {
+	idx := map[string]int{}
+	var groups []errorGroup
+	for _, e := range entries {
+		msg := normalizeMessage(e.Message)
+		k := e.Stage + "\x00" + e.Code + "\x00" + msg
+		i, ok := idx[k]
+		if !ok {
+			i = len(groups)
+			idx[k] = i
+			groups = append(groups, errorGroup{Stage: e.Stage, Code: e.Code, Message: msg})
+		}
+		groups[i].Count++
+		if e.Updated.After(groups[i].Last) {
+			groups[i].Last = e.Updated
+		}
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return groups[i].Stage+groups[i].Code+groups[i].Message < groups[j].Stage+groups[j].Code+groups[j].Message
+	})
+	return groups
+}
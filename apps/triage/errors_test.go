@@ -0,0 +1,121 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseOCRError(t *testing.T) {
+	tests := map[string]struct {
+		name   string
+		body   string
+		expect errorEntry
+	}{
+		// raw document ai status message
+		"message": {
+			name:   "src/a/b.jpg.log",
+			body:   "Unsupported input file format.\n",
+			expect: errorEntry{Stage: stageOCR, Object: "src/a/b.jpg.log", Target: "gs://src/a/b.jpg", Code: unknownCode, Message: "Unsupported input file format."},
+		},
+		// error record
+		"record": {
+			name:   "src/c.jpg.log",
+			body:   `{"stage":"ocr","bucket":"src","object":"c.jpg","code":"InvalidArgument","message":"Unsupported input file format.","retryable":false,"attempt":1,"timestamp":"2024-01-01T00:00:00Z"}`,
+			expect: errorEntry{Stage: stageOCR, Object: "src/c.jpg.log", Target: "gs://src/c.jpg", Code: "InvalidArgument", Message: "Unsupported input file format."},
+		},
+		// grpc status string
+		"status": {
+			name:   "src/b.jpg.log",
+			body:   "rpc error: code = NotFound desc = file not found",
+			expect: errorEntry{Stage: stageOCR, Object: "src/b.jpg.log", Target: "gs://src/b.jpg", Code: "NotFound", Message: "file not found"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			res := parseOCRError(tc.name, []byte(tc.body))
+			if !reflect.DeepEqual(tc.expect, res) {
+				t.Fatalf("expected: %v, result: %v", tc.expect, res)
+			}
+		})
+	}
+}
+
+func TestParseNLPError(t *testing.T) {
+	tests := map[string]struct {
+		body   string
+		expect errorEntry
+	}{
+		// error record
+		"record": {
+			body:   `{"stage":"nlp","bucket":"ocr","object":"1/0/a-0.json","generation":3,"code":"DeadlineExceeded","message":"failed to analyze nlp entities (ocr/1/0/a-0.json)","error":"context deadline exceeded","retryable":true,"attempt":2,"timestamp":"2024-01-01T00:00:00Z"}`,
+			expect: errorEntry{Stage: stageNLP, Object: "1/0/a-0.json", Target: "1/0/a-0.json", Code: "DeadlineExceeded", Message: "failed to analyze nlp entities (ocr/1/0/a-0.json)"},
+		},
+		// legacy error response with a grpc error
+		"status": {
+			body:   `{"timestamp":"2024-01-01T00:00:00Z","error":{},"stack_trace":"rpc error: code = InvalidArgument desc = document too large","message":"failed to analyze nlp entities (ocr/1/0/a-0.json)"}`,
+			expect: errorEntry{Stage: stageNLP, Object: "1/0/a-0.json", Target: "1/0/a-0.json", Code: "InvalidArgument", Message: "failed to analyze nlp entities (ocr/1/0/a-0.json): document too large"},
+		},
+		// error response with a plain error
+		"plain": {
+			body:   `{"timestamp":"2024-01-01T00:00:00Z","error":{},"stack_trace":"unexpected EOF","message":"failed to read file (ocr/1/0/a-0.json)"}`,
+			expect: errorEntry{Stage: stageNLP, Object: "1/0/a-0.json", Target: "1/0/a-0.json", Code: unknownCode, Message: "failed to read file (ocr/1/0/a-0.json)"},
+		},
+		// not json
+		"invalid": {
+			body:   "boom",
+			expect: errorEntry{Stage: stageNLP, Object: "1/0/a-0.json", Target: "1/0/a-0.json", Code: unknownCode, Message: "boom"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			res := parseNLPError("1/0/a-0.json", []byte(tc.body))
+			if !reflect.DeepEqual(tc.expect, res) {
+				t.Fatalf("expected: %v, result: %v", tc.expect, res)
+			}
+		})
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+
+	entries := []errorEntry{
+		{Stage: stageNLP, Code: "Unknown", Message: "failed to read file (ocr/1/0/a-0.json)", Updated: t1},
+		{Stage: stageOCR, Code: "Unknown", Message: "Unsupported input file format.", Updated: t1},
+		{Stage: stageNLP, Code: "Unknown", Message: "failed to read file (ocr/2/0/b-0.json)", Updated: t2},
+	}
+
+	expect := []errorGroup{
+		{Stage: stageNLP, Code: "Unknown", Message: "failed to read file", Count: 2, Last: t2},
+		{Stage: stageOCR, Code: "Unknown", Message: "Unsupported input file format.", Count: 1, Last: t1},
+	}
+
+	res := aggregate(entries)
+	if !reflect.DeepEqual(expect, res) {
+		t.Fatalf("expected: %v, result: %v", expect, res)
+	}
+}
+
+func TestNormalizeMessage(t *testing.T) {
+	tests := map[string]struct {
+		msg    string
+		expect string
+	}{
+		"object ref":   {msg: "failed to analyze nlp entities (ocr/1/0/a-0.json): document too large", expect: "failed to analyze nlp entities: document too large"},
+		"gcs uri":      {msg: "Failed to read gs://src/a.jpg", expect: "Failed to read gs://…"},
+		"no reference": {msg: "Unsupported input file format.", expect: "Unsupported input file format."},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			res := normalizeMessage(tc.msg)
+			if !reflect.DeepEqual(tc.expect, res) {
+				t.Fatalf("expected: %v, result: %v", tc.expect, res)
+			}
+		})
+	}
+}
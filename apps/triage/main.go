@@ -0,0 +1,273 @@
+// Package main is the triage command. It lists and aggregates the errors written to the ocr and nlp
+// err buckets, replays selected failures and clears or archives the error objects.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/storage"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/logging"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/utils"
+)
+
+const usage = `usage: triage <command>
+
+commands:
+  summary   aggregate errors by stage, code and message (default)
+  list      print every matching error
+  replay    re-publish ocr failures to the dispatcher topic, re-trigger nlp for ocr outputs,
+            then dispose of the replayed error objects (see REPLAY_DISPOSE)
+  archive   move matching error objects under ARCHIVE_PREFIX
+  delete    delete matching error objects
+`
+
+func main() {
+	ctx := context.Background()
+
+	// logger
+	logging.Init("triage")
+
+	// command
+	cmd := "summary"
+	if len(os.Args) > 1 {
+		cmd = os.Args[1]
+	}
+
+	// app config
+	cfg := getConfig()
+
+	// create storage client
+	store, err := storage.NewClient(ctx)
+	if err != nil {
+		log.Fatal().Err(err).Caller().Msg("failed to create storage client")
+	}
+	defer store.Close()
+
+	// collect matching errors
+	entries, err := collectErrors(ctx, store, cfg)
+	if err != nil {
+		log.Fatal().Err(err).Caller().Msg("failed to list errors")
+	}
+	log.Info().Int("errors", len(entries)).Str("command", cmd).Msgf("%d matching errors", len(entries))
+
+	switch cmd {
+	case "summary":
+		printSummary(aggregate(entries))
+	case "list":
+		printList(entries)
+	case "replay":
+		replayed := replay(ctx, store, cfg, entries)
+		disposeAll(ctx, store, replayed, cfg.ReplayDispose, cfg.ArchivePrefix)
+	case "archive":
+		disposeAll(ctx, store, entries, disposeArchive, cfg.ArchivePrefix)
+	case "delete":
+		disposeAll(ctx, store, entries, disposeDelete, cfg.ArchivePrefix)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+// collectErrors reads the errors of every configured err bucket, applying the filter and limit.
+func collectErrors(ctx context.Context, store *storage.Client, cfg appConfig) ([]errorEntry, error) {
+	var entries []errorEntry
+
+	sources := []struct {
+		stage  string
+		bucket string
+	}{
+		{stageOCR, cfg.OCRErrBucketName},
+		{stageNLP, cfg.NLPErrBucketName},
+	}
+
+	// errLimit stops the bucket iteration once the limit is reached
+	errLimit := errors.New("limit reached")
+
+	for _, src := range sources {
+		if src.bucket == "" || (cfg.Filter.Stage != "" && cfg.Filter.Stage != src.stage) {
+			continue
+		}
+
+		err := listErrors(ctx, store.Bucket(src.bucket), src.bucket, src.stage, cfg.ArchivePrefix, cfg.Filter, func(e errorEntry) error {
+			entries = append(entries, e)
+			if cfg.Filter.Limit > 0 && len(entries) >= cfg.Filter.Limit {
+				return errLimit
+			}
+			return nil
+		})
+		if errors.Is(err, errLimit) {
+			break
+		}
+		if err != nil {
+			return entries, err
+		}
+	}
+
+	return entries, nil
+}
+
+func replay(ctx context.Context, store *storage.Client, cfg appConfig, entries []errorEntry) []errorEntry {
+	var ocr, nlp []errorEntry
+	for _, e := range entries {
+		switch e.Stage {
+		case stageOCR:
+			ocr = append(ocr, e)
+		case stageNLP:
+			nlp = append(nlp, e)
+		}
+	}
+
+	var replayed []errorEntry
+
+	if len(ocr) > 0 {
+		if cfg.PubsubTopicID == "" {
+			log.Fatal().Caller().Msg("env var PUBSUB_TOPIC_ID required to replay ocr errors")
+		}
+		ps, err := pubsub.NewClient(ctx, cfg.ProjectID)
+		if err != nil {
+			log.Fatal().Err(err).Caller().Msg("failed to create Pub/Sub client")
+		}
+		defer ps.Close()
+		topic := ps.Topic(cfg.PubsubTopicID)
+		defer topic.Stop()
+
+		replayed = append(replayed, replayOCR(ctx, topic, ocr, cfg.BatchSize)...)
+	}
+
+	if len(nlp) > 0 {
+		if cfg.OCRDstBucketName == "" {
+			log.Fatal().Caller().Msg("env var OCR_DST_BUCKET_NAME required to replay nlp errors")
+		}
+		replayed = append(replayed, replayNLP(ctx, store.Bucket(cfg.OCRDstBucketName), nlp)...)
+	}
+
+	log.Info().
+		Int("ocr", len(ocr)).
+		Int("nlp", len(nlp)).
+		Int("replayed", len(replayed)).
+		Msgf("replayed %d/%d errors", len(replayed), len(entries))
+
+	return replayed
+}
+
+func disposeAll(ctx context.Context, store *storage.Client, entries []errorEntry, mode, archivePrefix string) {
+	if mode == disposeKeep {
+		return
+	}
+
+	cnt := 0
+	for _, e := range entries {
+		if err := dispose(ctx, store, e, mode, archivePrefix); err != nil {
+			log.Error().Err(err).Caller().Str("bucket", e.Bucket).Msg("failed to dispose of error")
+			continue
+		}
+		cnt++
+	}
+	log.Info().Str("mode", mode).Int("errors", cnt).Msgf("%d errors disposed (%s)", cnt, mode)
+}
+
+func printSummary(groups []errorGroup) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STAGE\tCODE\tCOUNT\tLAST\tMESSAGE")
+	for _, g := range groups {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", g.Stage, g.Code, g.Count, g.Last.Format(time.RFC3339), g.Message)
+	}
+	w.Flush()
+}
+
+func printList(entries []errorEntry) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STAGE\tCODE\tUPDATED\tTARGET\tMESSAGE")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.Stage, e.Code, e.Updated.Format(time.RFC3339), e.Target, e.Message)
+	}
+	w.Flush()
+}
+
+type appConfig struct {
+	Debug            bool
+	ProjectID        string
+	OCRErrBucketName string
+	NLPErrBucketName string
+	OCRDstBucketName string
+	PubsubTopicID    string
+	ArchivePrefix    string
+	ReplayDispose    string
+	BatchSize        int
+	Filter           filter
+}
+
+func getMandatoryEnvVar(n string) string {
+	v, ok := os.LookupEnv(n)
+	if !ok || v == "" {
+		log.Fatal().Err(errors.New("missing env var")).Caller().Msgf("env var %s required", n)
+	}
+	return v
+}
+
+func getConfig() appConfig {
+	var env utils.EnvReader
+
+	debug := utils.GetBoolEnvVar("DEBUG", false)
+
+	// gcp
+	projectID := getMandatoryEnvVar("GCP_PROJECT_ID")
+
+	// buckets. at least one err bucket is required
+	ocrErrBucketName := utils.GetStrEnvVar("OCR_ERR_BUCKET_NAME", "")
+	nlpErrBucketName := utils.GetStrEnvVar("NLP_ERR_BUCKET_NAME", "")
+	if ocrErrBucketName == "" && nlpErrBucketName == "" {
+		log.Fatal().Err(errors.New("missing env var")).Caller().Msg("env var OCR_ERR_BUCKET_NAME or NLP_ERR_BUCKET_NAME required")
+	}
+	// ocrDstBucketName is the ocr output bucket the nlp-worker is triggered by. Required to replay nlp errors.
+	ocrDstBucketName := utils.GetStrEnvVar("OCR_DST_BUCKET_NAME", "")
+
+	// pubsub. dispatcher topic, required to replay ocr errors.
+	pubsubTopicID := utils.GetStrEnvVar("PUBSUB_TOPIC_ID", "")
+
+	// archivePrefix is the prefix under which archived errors are moved, within their own bucket.
+	archivePrefix := utils.GetStrEnvVar("ARCHIVE_PREFIX", "archive/")
+	// replayDispose is what happens to error objects once replayed: keep, archive or delete.
+	replayDispose := utils.GetStrEnvVar("REPLAY_DISPOSE", disposeArchive)
+	switch replayDispose {
+	case disposeKeep, disposeArchive, disposeDelete:
+	default:
+		log.Fatal().Caller().Msgf("invalid REPLAY_DISPOSE value: %s", replayDispose)
+	}
+	// batchSize is the number of source images per replayed ocr batch
+	batchSize := env.Int("BATCH_SIZE", 100)
+
+	// filters. empty values match all errors
+	f := filter{
+		Stage:  utils.GetStrEnvVar("STAGE", ""),
+		Code:   utils.GetStrEnvVar("CODE", ""),
+		Match:  utils.GetStrEnvVar("MATCH", ""),
+		Prefix: utils.GetStrEnvVar("PREFIX", ""),
+		Limit:  utils.GetIntEnvVar("LIMIT", 0),
+	}
+
+	if err := env.Err(); err != nil {
+		log.Fatal().Err(err).Caller().Msg("invalid config")
+	}
+
+	return appConfig{
+		Debug:            debug,
+		ProjectID:        projectID,
+		OCRErrBucketName: ocrErrBucketName,
+		NLPErrBucketName: nlpErrBucketName,
+		OCRDstBucketName: ocrDstBucketName,
+		PubsubTopicID:    pubsubTopicID,
+		ArchivePrefix:    archivePrefix,
+		ReplayDispose:    replayDispose,
+		BatchSize:        batchSize,
+		Filter:           f,
+	}
+}
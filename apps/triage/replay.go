@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/storage"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/dispatch"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/logging"
+)
+
+const (
+	disposeKeep    = "keep"
+	disposeArchive = "archive"
+	disposeDelete  = "delete"
+)
+
+// replayOCR re-publishes the source images of failed OCR documents to the dispatcher topic, in
+// batches of batchSize. It returns the entries whose batch was published.
+func replayOCR(ctx context.Context, topic *pubsub.Topic, entries []errorEntry, batchSize int) []errorEntry {
+	var sent []errorEntry
+	for start := 0; start < len(entries); start += batchSize {
+		end := min(start+batchSize, len(entries))
+		batch := entries[start:end]
+
+		files := make([]string, len(batch))
+		for i, e := range batch {
+			files[i] = e.Target
+		}
+
+		id, err := dispatch.PublishFilenameBatch(ctx, topic, files)
+		if err != nil {
+			log.Error().Err(err).Caller().Int("files", len(files)).Msg("failed to publish pubsub batch")
+			continue
+		}
+		log.Info().Str("message_id", id).Int("files", len(files)).Msg("ocr batch re-published")
+		sent = append(sent, batch...)
+	}
+	return sent
+}
+
+// replayNLP re-triggers the nlp-worker for failed OCR outputs. Rewriting the OCR output object onto
+// itself creates a new generation, which emits the finalize event the nlp-worker is subscribed to.
+func replayNLP(ctx context.Context, ocrBucket *storage.BucketHandle, entries []errorEntry) []errorEntry {
+	var sent []errorEntry
+	for _, e := range entries {
+		o := ocrBucket.Object(e.Target)
+		if _, err := o.CopierFrom(o).Run(ctx); err != nil {
+			log.Error().Err(err).Caller().Str(logging.FieldObject, e.Target).Msg("failed to rewrite ocr output")
+			continue
+		}
+		log.Info().Str(logging.FieldObject, e.Target).Msg("nlp re-triggered")
+		sent = append(sent, e)
+	}
+	return sent
+}
+
+// dispose removes an error object from the backlog, either by deleting it or by moving it under
+// the archive prefix of its own bucket.
+func dispose(ctx context.Context, store *storage.Client, e errorEntry, mode, archivePrefix string) error {
+	o := store.Bucket(e.Bucket).Object(e.Object)
+	switch mode {
+	case disposeKeep:
+		return nil
+	case disposeArchive:
+		dst := store.Bucket(e.Bucket).Object(archivePrefix + e.Object)
+		if _, err := dst.CopierFrom(o).Run(ctx); err != nil {
+			return fmt.Errorf("(%s) failed to archive: %w", e.Object, err)
+		}
+	case disposeDelete:
+	default:
+		return fmt.Errorf("unsupported dispose mode: %s", mode)
+	}
+
+	if err := o.Delete(ctx); err != nil {
+		return fmt.Errorf("(%s) failed to delete: %w", e.Object, err)
+	}
+	return nil
+}
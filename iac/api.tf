@@ -0,0 +1,134 @@
+## cloud run
+
+resource "google_artifact_registry_repository" "api" {
+  repository_id = "api"
+  location      = local.region
+  description   = "docker repo for api images"
+  format        = "docker"
+}
+
+# service account
+resource "google_service_account" "api" {
+  account_id   = "cloud-run-api-sa"
+  display_name = "API"
+  description  = "Cloud Run API Service Account"
+}
+
+# jobs are published to the ocr-worker topic
+resource "google_pubsub_topic_iam_member" "api_publisher" {
+  topic  = google_pubsub_topic.ocr.name
+  role   = "roles/pubsub.publisher"
+  member = "serviceAccount:${google_service_account.api.email}"
+}
+
+# jobs are recorded in the refs bucket
+resource "google_storage_bucket_iam_member" "api_refs" {
+  bucket = google_storage_bucket.ocr_refs.name
+  role   = "roles/storage.objectUser"
+  member = "serviceAccount:${google_service_account.api.email}"
+}
+
+resource "google_storage_bucket_iam_member" "api_uploads" {
+  bucket = google_storage_bucket.api_uploads.name
+  role   = "roles/storage.objectUser"
+  member = "serviceAccount:${google_service_account.api.email}"
+}
+
+# the uploaded files are OCR'd by the ocr-worker
+resource "google_storage_bucket_iam_member" "ocr_uploads_viewer" {
+  bucket = google_storage_bucket.api_uploads.name
+  role   = "roles/storage.objectViewer"
+  member = "serviceAccount:${google_service_account.ocr.email}"
+}
+
+# the job status is read from the buckets of the ocr-worker and nlp-worker
+resource "google_storage_bucket_iam_member" "api_ocr_err_viewer" {
+  bucket = google_storage_bucket.ocr_err.name
+  role   = "roles/storage.objectViewer"
+  member = "serviceAccount:${google_service_account.api.email}"
+}
+
+resource "google_storage_bucket_iam_member" "api_ocr_data_viewer" {
+  bucket = google_storage_bucket.ocr_data.name
+  role   = "roles/storage.objectViewer"
+  member = "serviceAccount:${google_service_account.api.email}"
+}
+
+resource "google_storage_bucket_iam_member" "api_nlp_data_viewer" {
+  bucket = google_storage_bucket.nlp_data.name
+  role   = "roles/storage.objectViewer"
+  member = "serviceAccount:${google_service_account.api.email}"
+}
+
+resource "google_storage_bucket_iam_member" "api_nlp_err_viewer" {
+  bucket = google_storage_bucket.nlp_err.name
+  role   = "roles/storage.objectViewer"
+  member = "serviceAccount:${google_service_account.api.email}"
+}
+
+# cloud run. Invocations are authenticated: grant roles/run.invoker to the API clients.
+resource "google_cloud_run_v2_service" "api" {
+  name     = "api"
+  location = local.region
+
+  template {
+    scaling {
+      min_instance_count = var.api_min_instances
+      max_instance_count = var.api_max_instances
+    }
+
+    service_account = google_service_account.api.email
+
+    containers {
+      image = "${local.region}-docker.pkg.dev/${var.project_id}/${google_artifact_registry_repository.api.name}/app:${var.api_build_version}"
+      ports {
+        container_port = 8080
+      }
+
+      liveness_probe {
+        http_get {
+          path = "/livez"
+        }
+      }
+
+      env {
+        name  = "GCP_PROJECT_ID"
+        value = var.project_id
+      }
+      env {
+        name  = "PUBSUB_TOPIC_ID"
+        value = google_pubsub_topic.ocr.name
+      }
+      env {
+        name  = "OCR_ERR_BUCKET_NAME"
+        value = google_storage_bucket.ocr_err.name
+      }
+      env {
+        name  = "REFS_BUCKET_NAME"
+        value = google_storage_bucket.ocr_refs.name
+      }
+      env {
+        name  = "NLP_DST_BUCKET_NAME"
+        value = google_storage_bucket.nlp_data.name
+      }
+      env {
+        name  = "NLP_ERR_BUCKET_NAME"
+        value = google_storage_bucket.nlp_err.name
+      }
+      env {
+        name  = "UPLOAD_BUCKET_NAME"
+        value = google_storage_bucket.api_uploads.name
+      }
+    }
+  }
+
+  traffic {
+    percent = 100
+    type    = "TRAFFIC_TARGET_ALLOCATION_TYPE_LATEST"
+  }
+}
+
+# outputs
+output "api_uri" {
+  value = google_cloud_run_v2_service.api.uri
+}
@@ -0,0 +1,127 @@
+## iam
+
+resource "google_service_account" "converter" {
+  account_id   = "converter-sa"
+  display_name = "converter Service Account"
+}
+
+resource "google_storage_bucket_iam_member" "converter_ocr_data_viewer" {
+  // ocr_data is the converter input, as for the nlp-worker
+  bucket = google_storage_bucket.ocr_data.name
+  role   = "roles/storage.objectViewer"
+  member = "serviceAccount:${google_service_account.converter.email}"
+}
+
+resource "google_storage_bucket_iam_member" "converter_refs_viewer" {
+  // ocr_refs holds the ocr operation manifests
+  bucket = google_storage_bucket.ocr_refs.name
+  role   = "roles/storage.objectViewer"
+  member = "serviceAccount:${google_service_account.converter.email}"
+}
+
+resource "google_storage_bucket_iam_member" "converter_src_viewer" {
+  // the source images are overlaid by the searchable pdfs
+  bucket = var.src_bucket_name
+  role   = "roles/storage.objectViewer"
+  member = "serviceAccount:${google_service_account.converter.email}"
+}
+
+resource "google_storage_bucket_iam_member" "converter_data_writer" {
+  bucket = google_storage_bucket.convert_data.name
+  role   = "roles/storage.objectUser"
+  member = "serviceAccount:${google_service_account.converter.email}"
+}
+
+resource "google_storage_bucket_iam_member" "converter_err_writer" {
+  bucket = google_storage_bucket.convert_err.name
+  role   = "roles/storage.objectUser"
+  member = "serviceAccount:${google_service_account.converter.email}"
+}
+
+// allow eventarc to invoke function
+resource "google_project_iam_member" "converter_invoke_func" {
+  project = var.project_id
+  role    = "roles/run.invoker"
+  member  = "serviceAccount:${google_service_account.converter.email}"
+}
+
+resource "google_project_iam_member" "converter_eventarc_receiver" {
+  project = var.project_id
+  role    = "roles/eventarc.eventReceiver"
+  member  = "serviceAccount:${google_service_account.converter.email}"
+}
+
+
+## deploy
+
+resource "google_storage_bucket" "converter_deploy" {
+  name                        = "${var.resource_name_prefix}-func-deploy-converter"
+  location                    = local.region
+  uniform_bucket_level_access = true
+}
+
+data "archive_file" "converter" {
+  type        = "zip"
+  output_path = "/tmp/func-converter-source.zip"
+  source_dir  = "../apps/converter"
+  excludes    = ["local.env", "cmd", "cmd/"]
+}
+
+resource "google_storage_bucket_object" "converter_deploy" {
+  name   = "converter-${data.archive_file.converter.output_sha256}.zip"
+  bucket = google_storage_bucket.converter_deploy.name
+  source = data.archive_file.converter.output_path
+}
+
+resource "google_cloudfunctions2_function" "converter" {
+  name        = "converter"
+  location    = local.region
+  description = "converter converts the ocr outputs into archive formats, per source image"
+  labels = {
+    app = "converter"
+  }
+
+  build_config {
+    runtime           = "go121"
+    entry_point       = "Handler"
+    docker_repository = "projects/${var.project_id}/locations/${local.region}/repositories/gcf-artifacts"
+    source {
+      storage_source {
+        bucket = google_storage_bucket.converter_deploy.name
+        object = google_storage_bucket_object.converter_deploy.name
+      }
+    }
+  }
+
+  service_config {
+    // searchable pdfs hold the source image
+    available_memory   = "512M"
+    timeout_seconds    = 120
+    min_instance_count = 0
+    max_instance_count = 100
+
+    all_traffic_on_latest_revision = true
+    ingress_settings               = "ALLOW_INTERNAL_ONLY"
+    service_account_email          = google_service_account.converter.email
+
+    environment_variables = {
+      DEBUG            = var.converter_debug
+      DST_BUCKET_NAME  = google_storage_bucket.convert_data.name
+      ERR_BUCKET_NAME  = google_storage_bucket.convert_err.name
+      REFS_BUCKET_NAME = google_storage_bucket.ocr_refs.name
+      CONVERT_FORMATS  = var.converter_formats
+    }
+  }
+
+  event_trigger {
+    trigger_region        = local.region
+    event_type            = "google.cloud.storage.object.v1.finalized"
+    retry_policy          = "RETRY_POLICY_RETRY"
+    service_account_email = google_service_account.converter.email
+
+    event_filters {
+      attribute = "bucket"
+      value     = google_storage_bucket.ocr_data.name
+    }
+  }
+}
@@ -0,0 +1,69 @@
+# The exporter is run on demand, e.g. `go run . export` or a scheduled job, with this service
+# account. Its scheduling is not managed here.
+
+resource "google_service_account" "exporter" {
+  account_id   = "exporter-sa"
+  display_name = "exporter Service Account"
+}
+
+# image documents of the deduper
+resource "google_project_iam_member" "exporter_datastore_viewer" {
+  project = var.project_id
+  role    = "roles/datastore.viewer"
+  member  = "serviceAccount:${google_service_account.exporter.email}"
+}
+
+# refs, outputs and error records of the ocr-worker and nlp-worker
+resource "google_storage_bucket_iam_member" "exporter_ocr_refs_viewer" {
+  bucket = google_storage_bucket.ocr_refs.name
+  role   = "roles/storage.objectViewer"
+  member = "serviceAccount:${google_service_account.exporter.email}"
+}
+
+resource "google_storage_bucket_iam_member" "exporter_ocr_err_viewer" {
+  bucket = google_storage_bucket.ocr_err.name
+  role   = "roles/storage.objectViewer"
+  member = "serviceAccount:${google_service_account.exporter.email}"
+}
+
+resource "google_storage_bucket_iam_member" "exporter_ocr_data_viewer" {
+  bucket = google_storage_bucket.ocr_data.name
+  role   = "roles/storage.objectViewer"
+  member = "serviceAccount:${google_service_account.exporter.email}"
+}
+
+resource "google_storage_bucket_iam_member" "exporter_nlp_data_viewer" {
+  bucket = google_storage_bucket.nlp_data.name
+  role   = "roles/storage.objectViewer"
+  member = "serviceAccount:${google_service_account.exporter.email}"
+}
+
+resource "google_storage_bucket_iam_member" "exporter_nlp_err_viewer" {
+  bucket = google_storage_bucket.nlp_err.name
+  role   = "roles/storage.objectViewer"
+  member = "serviceAccount:${google_service_account.exporter.email}"
+}
+
+resource "google_storage_bucket_iam_member" "exporter_exports" {
+  bucket = google_storage_bucket.exports.name
+  role   = "roles/storage.objectUser"
+  member = "serviceAccount:${google_service_account.exporter.email}"
+}
+
+# bigquery. BQ_TABLE=<dataset>.<table>
+resource "google_bigquery_dataset" "exports" {
+  dataset_id = var.exporter_bq_dataset_id
+  location   = local.region
+}
+
+resource "google_bigquery_dataset_iam_member" "exporter_editor" {
+  dataset_id = google_bigquery_dataset.exports.dataset_id
+  role       = "roles/bigquery.dataEditor"
+  member     = "serviceAccount:${google_service_account.exporter.email}"
+}
+
+resource "google_project_iam_member" "exporter_bq_job_user" {
+  project = var.project_id
+  role    = "roles/bigquery.jobUser"
+  member  = "serviceAccount:${google_service_account.exporter.email}"
+}
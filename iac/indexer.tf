@@ -0,0 +1,20 @@
+# The indexer builds an embedded index, on the machine it is run on, with this service account.
+# Hosting the index and its search server is not managed here.
+
+resource "google_service_account" "indexer" {
+  account_id   = "indexer-sa"
+  display_name = "indexer Service Account"
+}
+
+# nlp-worker outputs and the text of their ocr outputs
+resource "google_storage_bucket_iam_member" "indexer_nlp_data_viewer" {
+  bucket = google_storage_bucket.nlp_data.name
+  role   = "roles/storage.objectViewer"
+  member = "serviceAccount:${google_service_account.indexer.email}"
+}
+
+resource "google_storage_bucket_iam_member" "indexer_ocr_data_viewer" {
+  bucket = google_storage_bucket.ocr_data.name
+  role   = "roles/storage.objectViewer"
+  member = "serviceAccount:${google_service_account.indexer.email}"
+}
@@ -61,6 +61,33 @@ resource "google_storage_bucket" "nlp_err" {
   force_destroy = true
 }
 
+// used by converter
+resource "google_storage_bucket" "convert_data" {
+  name          = "${var.resource_name_prefix}-convert-data"
+  location      = local.region
+  force_destroy = true
+}
+
+resource "google_storage_bucket" "convert_err" {
+  name          = "${var.resource_name_prefix}-convert-err"
+  location      = local.region
+  force_destroy = true
+}
+
+// used by api
+resource "google_storage_bucket" "api_uploads" {
+  name          = "${var.resource_name_prefix}-api-uploads"
+  location      = local.region
+  force_destroy = true
+}
+
+// used by exporter
+resource "google_storage_bucket" "exports" {
+  name          = "${var.resource_name_prefix}-exports"
+  location      = local.region
+  force_destroy = true
+}
+
 resource "google_project_iam_custom_role" "bucket_attr_reader" {
   role_id     = "bucketAttrReader"
   title       = "Bucket Attribute Reader"
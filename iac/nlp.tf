@@ -43,6 +43,13 @@ resource "google_storage_bucket_iam_member" "nlp_err_writer" {
   member = "serviceAccount:${google_service_account.nlp.email}"
 }
 
+resource "google_storage_bucket_iam_member" "nlp_refs_viewer" {
+  // ocr_refs holds the ocr operation manifests
+  bucket = google_storage_bucket.ocr_refs.name
+  role   = "roles/storage.objectViewer"
+  member = "serviceAccount:${google_service_account.nlp.email}"
+}
+
 // allow eventarc to invoke function
 resource "google_project_iam_member" "nlp_invoke_func" {
   project = var.project_id
@@ -115,10 +122,11 @@ resource "google_cloudfunctions2_function" "nlp" {
     service_account_email          = google_service_account.nlp.email
 
     environment_variables = {
-      DEBUG           = var.nlp_debug
-      GCP_PROJECT_ID  = var.project_id
-      ERR_BUCKET_NAME = google_storage_bucket.nlp_err.name
-      DST_BUCKET_NAME = google_storage_bucket.nlp_data.name
+      DEBUG            = var.nlp_debug
+      GCP_PROJECT_ID   = var.project_id
+      ERR_BUCKET_NAME  = google_storage_bucket.nlp_err.name
+      DST_BUCKET_NAME  = google_storage_bucket.nlp_data.name
+      REFS_BUCKET_NAME = google_storage_bucket.ocr_refs.name
     }
   }
 
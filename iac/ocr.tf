@@ -8,9 +8,26 @@ resource "google_pubsub_topic" "ocr_dead_letter" {
   name = "ocr-dl"
 }
 
+# low priority batches, and batches without priority. Changing the filter recreates the
+# subscription: drain it first.
 resource "google_pubsub_subscription" "ocr" {
-  name  = "ocr-sub"
-  topic = google_pubsub_topic.ocr.name
+  name   = "ocr-sub"
+  topic  = google_pubsub_topic.ocr.name
+  filter = "NOT attributes.priority = \"high\""
+
+  dead_letter_policy {
+    dead_letter_topic     = google_pubsub_topic.ocr_dead_letter.id
+    max_delivery_attempts = 10
+  }
+
+  ack_deadline_seconds = 10
+}
+
+# high priority batches, drained first by the ocr-worker
+resource "google_pubsub_subscription" "ocr_high" {
+  name   = "ocr-high-sub"
+  topic  = google_pubsub_topic.ocr.name
+  filter = "attributes.priority = \"high\""
 
   dead_letter_policy {
     dead_letter_topic     = google_pubsub_topic.ocr_dead_letter.id
@@ -102,6 +119,43 @@ resource "google_storage_bucket_iam_member" "ocr_refs_attrs" {
   depends_on = [google_project_iam_custom_role.bucket_attr_reader]
 }
 
+# the ocr-worker reads the bucket attrs of the err, refs and dst buckets on start and in /readyz
+resource "google_storage_bucket_iam_member" "ocr_err_attrs_ocr" {
+  bucket     = google_storage_bucket.ocr_err.name
+  member     = "serviceAccount:${google_service_account.ocr.email}"
+  role       = google_project_iam_custom_role.bucket_attr_reader.name
+  depends_on = [google_project_iam_custom_role.bucket_attr_reader]
+}
+
+resource "google_storage_bucket_iam_member" "ocr_refs_attrs_ocr" {
+  bucket     = google_storage_bucket.ocr_refs.name
+  member     = "serviceAccount:${google_service_account.ocr.email}"
+  role       = google_project_iam_custom_role.bucket_attr_reader.name
+  depends_on = [google_project_iam_custom_role.bucket_attr_reader]
+}
+
+resource "google_storage_bucket_iam_member" "ocr_data_attrs_ocr" {
+  bucket     = google_storage_bucket.ocr_data.name
+  member     = "serviceAccount:${google_service_account.ocr.email}"
+  role       = google_project_iam_custom_role.bucket_attr_reader.name
+  depends_on = [google_project_iam_custom_role.bucket_attr_reader]
+}
+
+
+# online requests are processed by the service itself: it reads the source images and writes the
+# outputs, see apps/ocr-worker/online.go
+resource "google_storage_bucket_iam_member" "ocr_src_viewer" {
+  bucket = var.src_bucket_name
+  role   = "roles/storage.objectViewer"
+  member = "serviceAccount:${google_service_account.ocr.email}"
+}
+
+resource "google_storage_bucket_iam_member" "ocr_data_writer" {
+  bucket     = google_storage_bucket.ocr_data.name
+  role       = "roles/storage.objectUser"
+  member     = "serviceAccount:${google_service_account.ocr.email}"
+  depends_on = [google_storage_bucket.ocr_data]
+}
 
 # cloud run
 resource "google_cloud_run_v2_service" "ocr" {
@@ -122,6 +176,12 @@ resource "google_cloud_run_v2_service" "ocr" {
         container_port = 5000
       }
 
+      liveness_probe {
+        http_get {
+          path = "/livez"
+        }
+      }
+
       env {
         name  = "GCP_PROJECT_ID"
         value = var.project_id
@@ -134,6 +194,10 @@ resource "google_cloud_run_v2_service" "ocr" {
         name  = "PUBSUB_SUBSCRIPTION_ID"
         value = var.ocr_pubsub_subscription_id
       }
+      env {
+        name  = "PUBSUB_HIGH_SUBSCRIPTION_ID"
+        value = google_pubsub_subscription.ocr_high.name
+      }
       env {
         name  = "DST_BUCKET_NAME"
         value = var.ocr_dst_bucket_name
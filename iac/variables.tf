@@ -10,6 +10,10 @@ variable "resource_name_prefix" {
   type = string
 }
 
+variable "src_bucket_name" {
+  type = string
+}
+
 # ocr
 variable "ocr_min_instances" {
   type    = number
@@ -67,4 +71,36 @@ variable "ocr_doc_ai_processor_id" {
 variable "nlp_debug" {
   type    = bool
   default = false
-}
\ No newline at end of file
+}
+
+# converter
+variable "converter_debug" {
+  type    = bool
+  default = false
+}
+
+variable "converter_formats" {
+  type    = string
+  default = "txt,md,hocr,alto,pdf"
+}
+
+# api
+variable "api_min_instances" {
+  type    = number
+  default = 0
+}
+
+variable "api_max_instances" {
+  type    = number
+  default = 2
+}
+
+variable "api_build_version" {
+  type = string
+}
+
+# exporter
+variable "exporter_bq_dataset_id" {
+  type    = string
+  default = "ocr"
+}
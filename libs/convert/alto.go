@@ -0,0 +1,135 @@
+package convert
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/documentai/apiv1/documentaipb"
+)
+
+// ALTO v4 elements. Positions are in pixels, see altoDescription.
+type (
+	altoDoc struct {
+		XMLName        xml.Name        `xml:"alto"`
+		Xmlns          string          `xml:"xmlns,attr"`
+		XmlnsXSI       string          `xml:"xmlns:xsi,attr"`
+		SchemaLocation string          `xml:"xsi:schemaLocation,attr"`
+		Description    altoDescription `xml:"Description"`
+		Pages          []altoPage      `xml:"Layout>Page"`
+	}
+	altoDescription struct {
+		MeasurementUnit string         `xml:"MeasurementUnit"`
+		FileName        string         `xml:"sourceImageInformation>fileName,omitempty"`
+		Processing      altoProcessing `xml:"OCRProcessing"`
+	}
+	altoProcessing struct {
+		ID       string `xml:"ID,attr"`
+		Creator  string `xml:"ocrProcessingStep>processingSoftware>softwareCreator"`
+		Software string `xml:"ocrProcessingStep>processingSoftware>softwareName"`
+	}
+	altoPage struct {
+		ID         string         `xml:"ID,attr"`
+		ImageNr    int            `xml:"PHYSICAL_IMG_NR,attr"`
+		Width      int            `xml:"WIDTH,attr"`
+		Height     int            `xml:"HEIGHT,attr"`
+		PrintSpace altoPrintSpace `xml:"PrintSpace"`
+	}
+	altoPrintSpace struct {
+		altoBox
+		Blocks []altoBlock `xml:"TextBlock"`
+	}
+	altoBlock struct {
+		ID string `xml:"ID,attr"`
+		altoBox
+		Lang  string     `xml:"LANG,attr,omitempty"`
+		Lines []altoLine `xml:"TextLine"`
+	}
+	altoLine struct {
+		ID string `xml:"ID,attr"`
+		altoBox
+		// Items are String and SP elements.
+		Items []any
+	}
+	altoString struct {
+		XMLName xml.Name `xml:"String"`
+		ID      string   `xml:"ID,attr"`
+		Content string   `xml:"CONTENT,attr"`
+		altoBox
+		WC string `xml:"WC,attr,omitempty"`
+	}
+	altoSpace struct {
+		XMLName xml.Name `xml:"SP"`
+	}
+	altoBox struct {
+		HPos   int `xml:"HPOS,attr"`
+		VPos   int `xml:"VPOS,attr"`
+		Width  int `xml:"WIDTH,attr"`
+		Height int `xml:"HEIGHT,attr"`
+	}
+)
+
+func toAltoBox(b box) altoBox {
+	return altoBox{HPos: b.X0, VPos: b.Y0, Width: b.Width(), Height: b.Height()}
+}
+
+// ALTO returns the ALTO v4 XML representation of a document. Paragraphs are text blocks, made of
+// lines of words, with their positions in pixels and the word confidences.
+func ALTO(doc *documentaipb.Document, o Options) ([]byte, error) {
+	runes := []rune(doc.GetText())
+	a := altoDoc{
+		Xmlns:          "http://www.loc.gov/standards/alto/ns-v4#",
+		XmlnsXSI:       "http://www.w3.org/2001/XMLSchema-instance",
+		SchemaLocation: "http://www.loc.gov/standards/alto/ns-v4# http://www.loc.gov/standards/alto/v4/alto-4-2.xsd",
+		Description: altoDescription{
+			MeasurementUnit: "pixel",
+			FileName:        o.ImageName,
+			Processing:      altoProcessing{ID: "OCR_0", Creator: "Google", Software: "Document AI"},
+		},
+	}
+
+	for _, p := range pages(doc) {
+		ap := altoPage{
+			ID:      fmt.Sprintf("page_%d", p.number),
+			ImageNr: p.number,
+			Width:   p.width,
+			Height:  p.height,
+		}
+		var space box
+		for _, b := range p.blocks {
+			space = space.union(b.box)
+			for _, para := range b.children {
+				ab := altoBlock{ID: fmt.Sprintf("block_%d_%d", p.number, len(ap.PrintSpace.Blocks)+1), altoBox: toAltoBox(para.box), Lang: p.lang}
+				for _, l := range para.children {
+					al := altoLine{ID: fmt.Sprintf("%s_line_%d", ab.ID, len(ab.Lines)+1), altoBox: toAltoBox(l.box)}
+					n := 0
+					for _, w := range l.children {
+						s := strings.TrimSpace(text(runes, w.start, w.end))
+						if s == "" {
+							continue
+						}
+						if n > 0 {
+							al.Items = append(al.Items, altoSpace{})
+						}
+						n++
+						as := altoString{ID: fmt.Sprintf("%s_string_%d", al.ID, n), Content: s, altoBox: toAltoBox(w.box)}
+						if w.conf > 0 {
+							as.WC = fmt.Sprintf("%.2f", w.conf)
+						}
+						al.Items = append(al.Items, as)
+					}
+					ab.Lines = append(ab.Lines, al)
+				}
+				ap.PrintSpace.Blocks = append(ap.PrintSpace.Blocks, ab)
+			}
+		}
+		ap.PrintSpace.altoBox = toAltoBox(space)
+		a.Pages = append(a.Pages, ap)
+	}
+
+	b, err := xml.MarshalIndent(a, "", " ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode alto: %w", err)
+	}
+	return append([]byte(xml.Header), append(b, '\n')...), nil
+}
@@ -0,0 +1,293 @@
+// Package convert converts Document AI documents into plain text, Markdown, hOCR, ALTO XML and
+// searchable PDF.
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/documentai/apiv1/documentaipb"
+)
+
+// Format is an output format.
+type Format string
+
+// Output formats.
+const (
+	FormatText     Format = "txt"
+	FormatMarkdown Format = "md"
+	FormatHOCR     Format = "hocr"
+	FormatALTO     Format = "alto"
+	FormatPDF      Format = "pdf"
+)
+
+// Formats are the supported output formats.
+var Formats = []Format{FormatText, FormatMarkdown, FormatHOCR, FormatALTO, FormatPDF}
+
+// DefaultDPI is the resolution assumed for images without a known resolution, used to size the
+// pages of searchable PDFs.
+const DefaultDPI = 300
+
+// ErrUnsupported is returned for documents or images a format cannot be produced from, e.g. the
+// searchable PDF of a multi-page document.
+var ErrUnsupported = errors.New("unsupported")
+
+// ParseFormats parses a comma separated list of formats.
+func ParseFormats(s string) ([]Format, error) {
+	var formats []Format
+	for _, v := range strings.Split(s, ",") {
+		f := Format(strings.ToLower(strings.TrimSpace(v)))
+		if f == "" {
+			continue
+		}
+		ok := false
+		for _, s := range Formats {
+			ok = ok || s == f
+		}
+		if !ok {
+			return nil, fmt.Errorf("unsupported format %q, expected one of %v", f, Formats)
+		}
+		formats = append(formats, f)
+	}
+	if len(formats) == 0 {
+		return nil, errors.New("no format")
+	}
+	return formats, nil
+}
+
+// Extension returns the file extension of a format, without the leading dot.
+func (f Format) Extension() string {
+	if f == FormatALTO {
+		return "alto.xml"
+	}
+	return string(f)
+}
+
+// ContentType returns the content type of a format.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatMarkdown:
+		return "text/markdown; charset=utf-8"
+	case FormatHOCR:
+		return "text/html; charset=utf-8"
+	case FormatALTO:
+		return "application/xml"
+	case FormatPDF:
+		return "application/pdf"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// Options are the conversion options.
+type Options struct {
+	// ImageName is the name of the source image, recorded in the hOCR and ALTO outputs.
+	ImageName string
+	// Image is the content of the source image, required by searchable PDFs.
+	Image []byte
+	// DPI is the resolution of the source image. Defaults to DefaultDPI.
+	DPI int
+}
+
+// Convert converts a document to a format.
+func Convert(doc *documentaipb.Document, f Format, o Options) ([]byte, error) {
+	switch f {
+	case FormatText:
+		return Text(doc), nil
+	case FormatMarkdown:
+		return Markdown(doc), nil
+	case FormatHOCR:
+		return HOCR(doc, o)
+	case FormatALTO:
+		return ALTO(doc, o)
+	case FormatPDF:
+		return SearchablePDF(doc, o)
+	}
+	return nil, fmt.Errorf("%w format: %s", ErrUnsupported, f)
+}
+
+// box is a bounding box in pixels.
+type box struct {
+	X0, Y0, X1, Y1 int
+}
+
+func (b box) Width() int  { return b.X1 - b.X0 }
+func (b box) Height() int { return b.Y1 - b.Y0 }
+
+// union returns the box bounding b and o. Empty boxes are ignored.
+func (b box) union(o box) box {
+	if b == (box{}) {
+		return o
+	}
+	if o == (box{}) {
+		return b
+	}
+	return box{min(b.X0, o.X0), min(b.Y0, o.Y0), max(b.X1, o.X1), max(b.Y1, o.Y1)}
+}
+
+// node is a layout element of a page: a block, paragraph, line or word. Its text is the range
+// [start, end) of the document text, in runes.
+type node struct {
+	start, end int
+	box        box
+	conf       float32
+	children   []*node
+}
+
+// page is a document page with its layout hierarchy: blocks, paragraphs, lines and words.
+type page struct {
+	number        int
+	width, height int
+	lang          string
+	start, end    int
+	blocks        []*node
+}
+
+// anchorRange returns the range of a text anchor, in runes.
+func anchorRange(a *documentaipb.Document_TextAnchor) (start, end int, ok bool) {
+	for i, s := range a.GetTextSegments() {
+		if i == 0 || int(s.GetStartIndex()) < start {
+			start = int(s.GetStartIndex())
+		}
+		if int(s.GetEndIndex()) > end {
+			end = int(s.GetEndIndex())
+		}
+		ok = true
+	}
+	return start, end, ok
+}
+
+// layoutBox returns the bounding box of a layout in pixels, from its vertices or its normalized
+// vertices.
+func layoutBox(l *documentaipb.Document_Page_Layout, width, height int) box {
+	var b box
+	first := true
+	add := func(x, y int) {
+		if first {
+			b = box{x, y, x, y}
+			first = false
+			return
+		}
+		b = box{min(b.X0, x), min(b.Y0, y), max(b.X1, x), max(b.Y1, y)}
+	}
+	if v := l.GetBoundingPoly().GetVertices(); len(v) > 0 {
+		for _, p := range v {
+			add(int(p.GetX()), int(p.GetY()))
+		}
+		return b
+	}
+	for _, p := range l.GetBoundingPoly().GetNormalizedVertices() {
+		add(int(p.GetX()*float32(width)+0.5), int(p.GetY()*float32(height)+0.5))
+	}
+	return b
+}
+
+// layoutNodes returns the nodes of the layouts with a text anchor, sorted by start.
+func layoutNodes(layouts []*documentaipb.Document_Page_Layout, width, height int) []*node {
+	var nodes []*node
+	for _, l := range layouts {
+		start, end, ok := anchorRange(l.GetTextAnchor())
+		if !ok || start >= end {
+			continue
+		}
+		nodes = append(nodes, &node{start: start, end: end, box: layoutBox(l, width, height), conf: l.GetConfidence()})
+	}
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].start < nodes[j].start })
+	return nodes
+}
+
+// copyNodes returns childless copies of nodes, standing in for a missing layout level.
+func copyNodes(nodes []*node) []*node {
+	c := make([]*node, len(nodes))
+	for i, n := range nodes {
+		c[i] = &node{start: n.start, end: n.end, box: n.box, conf: n.conf}
+	}
+	return c
+}
+
+// nest assigns each child to the parent containing its start, or else to the closest preceding
+// parent. Parents and children are sorted by start.
+func nest(parents, children []*node) {
+	if len(parents) == 0 {
+		return
+	}
+	for _, c := range children {
+		i := sort.Search(len(parents), func(i int) bool { return parents[i].start > c.start }) - 1
+		if i < 0 {
+			i = 0
+		}
+		parents[i].children = append(parents[i].children, c)
+	}
+	// parents missing a box are bounded by their children
+	for _, p := range parents {
+		if p.box == (box{}) {
+			for _, c := range p.children {
+				p.box = p.box.union(c.box)
+			}
+		}
+	}
+}
+
+// pages returns the pages of a document with their layout hierarchy. Missing layout levels are
+// filled in from the level above, e.g. a paragraph per block for documents without paragraphs.
+func pages(doc *documentaipb.Document) []page {
+	var res []page
+	for i, p := range doc.GetPages() {
+		w, h := int(p.GetDimension().GetWidth()), int(p.GetDimension().GetHeight())
+		pg := page{number: int(p.GetPageNumber()), width: w, height: h}
+		if pg.number == 0 {
+			pg.number = i + 1
+		}
+		if l := p.GetDetectedLanguages(); len(l) > 0 {
+			pg.lang = l[0].GetLanguageCode()
+		}
+		pg.start, pg.end, _ = anchorRange(p.GetLayout().GetTextAnchor())
+
+		var blocks, paras, lines, words []*documentaipb.Document_Page_Layout
+		for _, b := range p.GetBlocks() {
+			blocks = append(blocks, b.GetLayout())
+		}
+		for _, b := range p.GetParagraphs() {
+			paras = append(paras, b.GetLayout())
+		}
+		for _, b := range p.GetLines() {
+			lines = append(lines, b.GetLayout())
+		}
+		for _, b := range p.GetTokens() {
+			words = append(words, b.GetLayout())
+		}
+
+		bn := layoutNodes(blocks, w, h)
+		if len(bn) == 0 && pg.end > pg.start {
+			bn = []*node{{start: pg.start, end: pg.end, box: layoutBox(p.GetLayout(), w, h)}}
+		}
+		pn := layoutNodes(paras, w, h)
+		if len(pn) == 0 {
+			pn = copyNodes(bn)
+		}
+		ln := layoutNodes(lines, w, h)
+		if len(ln) == 0 {
+			ln = copyNodes(pn)
+		}
+		wn := layoutNodes(words, w, h)
+		if len(wn) == 0 {
+			wn = copyNodes(ln)
+		}
+		nest(ln, wn)
+		nest(pn, ln)
+		nest(bn, pn)
+		pg.blocks = bn
+		res = append(res, pg)
+	}
+	return res
+}
+
+// text returns the range [start, end) of runes, clamped.
+func text(runes []rune, start, end int) string {
+	start, end = max(0, min(start, len(runes))), max(0, min(end, len(runes)))
+	if start >= end {
+		return ""
+	}
+	return string(runes[start:end])
+}
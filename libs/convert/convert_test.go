@@ -0,0 +1,176 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/documentai/apiv1/documentaipb"
+)
+
+// layout returns a layout anchored on the runes [start, end) of the text, bounded by a box.
+func layout(start, end int64, x0, y0, x1, y1 int32) *documentaipb.Document_Page_Layout {
+	return &documentaipb.Document_Page_Layout{
+		TextAnchor: &documentaipb.Document_TextAnchor{TextSegments: []*documentaipb.Document_TextAnchor_TextSegment{{StartIndex: start, EndIndex: end}}},
+		BoundingPoly: &documentaipb.BoundingPoly{Vertices: []*documentaipb.Vertex{
+			{X: x0, Y: y0}, {X: x1, Y: y0}, {X: x1, Y: y1}, {X: x0, Y: y1},
+		}},
+		Confidence: 0.9,
+	}
+}
+
+// testDoc returns a single page document of two lines: "Été *1* (a)" and "second-", "line".
+func testDoc() *documentaipb.Document {
+	// runes: Été=0-3 *1*=4-7 (a)=8-11 \n second-=12-19 \n line=20-24 \n
+	text := "Été *1* (a)\nsecond-\nline\n"
+	return &documentaipb.Document{
+		Text: text,
+		Pages: []*documentaipb.Document_Page{{
+			PageNumber:        1,
+			Dimension:         &documentaipb.Document_Page_Dimension{Width: 200, Height: 100},
+			DetectedLanguages: []*documentaipb.Document_Page_DetectedLanguage{{LanguageCode: "fr"}},
+			Layout:            layout(0, 25, 0, 0, 200, 100),
+			Blocks:            []*documentaipb.Document_Page_Block{{Layout: layout(0, 25, 10, 10, 190, 90)}},
+			Paragraphs: []*documentaipb.Document_Page_Paragraph{
+				{Layout: layout(0, 12, 10, 10, 190, 30)},
+				{Layout: layout(12, 25, 10, 40, 190, 90)},
+			},
+			Lines: []*documentaipb.Document_Page_Line{
+				{Layout: layout(0, 12, 10, 10, 190, 30)},
+				{Layout: layout(12, 20, 10, 40, 190, 60)},
+				{Layout: layout(20, 25, 10, 70, 190, 90)},
+			},
+			Tokens: []*documentaipb.Document_Page_Token{
+				{Layout: layout(0, 4, 10, 10, 50, 30)},
+				{Layout: layout(4, 8, 60, 10, 100, 30)},
+				{Layout: layout(8, 12, 110, 10, 150, 30)},
+				{Layout: layout(12, 20, 10, 40, 120, 60)},
+				{Layout: layout(20, 25, 10, 70, 80, 90)},
+			},
+		}},
+	}
+}
+
+func TestText(t *testing.T) {
+	if res := string(Text(testDoc())); res != "Été *1* (a)\nsecond-\nline\n" {
+		t.Fatalf("unexpected text: %q", res)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	expect := "<!-- page 1 -->\n\nÉté \\*1\\* (a)\n\nsecond-line\n"
+	if res := string(Markdown(testDoc())); res != expect {
+		t.Fatalf("expected: %q, result: %q", expect, res)
+	}
+
+	// paragraphs starting with markdown markup
+	for in, expect := range map[string]string{"# a": `\# a`, "1. a": `1\. a`, "- a": `\- a`, "12 a": "12 a"} {
+		if res := escapeMarkdown(in); res != expect {
+			t.Fatalf("expected: %s, result: %s", expect, res)
+		}
+	}
+}
+
+func TestHOCR(t *testing.T) {
+	b, err := HOCR(testDoc(), Options{ImageName: "a.jpg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := string(b)
+	for _, s := range []string{
+		`class="ocr_page" id="page_1" title="image &#34;a.jpg&#34;; bbox 0 0 200 100; ppageno 0" lang="fr"`,
+		`<span class="ocrx_word" id="word_1_1_1_1_1" title="bbox 10 10 50 30; x_wconf 90">Été</span>`,
+		`>(a)</span>`,
+		`id="line_1_1_2_2"`,
+	} {
+		if !strings.Contains(res, s) {
+			t.Fatalf("missing %s in:\n%s", s, res)
+		}
+	}
+	// valid xml
+	if err := xml.Unmarshal(b, new(any)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestALTO(t *testing.T) {
+	b, err := ALTO(testDoc(), Options{ImageName: "a.jpg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var res struct {
+		File  string `xml:"Description>sourceImageInformation>fileName"`
+		Pages []struct {
+			Width  int `xml:"WIDTH,attr"`
+			Blocks []struct {
+				Lines []struct {
+					Strings []struct {
+						Content string `xml:"CONTENT,attr"`
+						HPos    int    `xml:"HPOS,attr"`
+						WC      string `xml:"WC,attr"`
+					} `xml:"String"`
+					Spaces []struct{} `xml:"SP"`
+				} `xml:"TextLine"`
+			} `xml:"PrintSpace>TextBlock"`
+		} `xml:"Layout>Page"`
+	}
+	if err := xml.Unmarshal(b, &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.File != "a.jpg" || len(res.Pages) != 1 || res.Pages[0].Width != 200 || len(res.Pages[0].Blocks) != 2 {
+		t.Fatalf("unexpected alto:\n%s", b)
+	}
+	line := res.Pages[0].Blocks[0].Lines[0]
+	if len(line.Strings) != 3 || len(line.Spaces) != 2 || line.Strings[1].Content != "*1*" || line.Strings[1].HPos != 60 || line.Strings[1].WC != "0.90" {
+		t.Fatalf("unexpected line: %+v", line)
+	}
+}
+
+func TestSearchablePDF(t *testing.T) {
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewGray(image.Rect(0, 0, 400, 200))); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := SearchablePDF(testDoc(), Options{Image: img.Bytes(), DPI: 144})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := string(b)
+	for _, s := range []string{"%PDF-1.4", "/MediaBox [0 0 200.00 100.00]", "/Width 400 /Height 200", "/BaseFont /Helvetica", "%%EOF"} {
+		if !strings.Contains(res, s) {
+			t.Fatalf("missing %s", s)
+		}
+	}
+
+	// multi-page documents and missing images
+	doc := testDoc()
+	doc.Pages = append(doc.Pages, doc.Pages[0])
+	if _, err := SearchablePDF(doc, Options{Image: img.Bytes()}); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("expected unsupported, result: %v", err)
+	}
+	if _, err := SearchablePDF(testDoc(), Options{}); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("expected unsupported, result: %v", err)
+	}
+}
+
+func TestWinAnsi(t *testing.T) {
+	if res := winAnsi("Été œ€ 字"); !bytes.Equal(res, []byte{0xC9, 't', 0xE9, ' ', 0x9C, 0x80, ' ', '?'}) {
+		t.Fatalf("unexpected encoding: %x", res)
+	}
+}
+
+func TestParseFormats(t *testing.T) {
+	f, err := ParseFormats("txt, ALTO,pdf")
+	if err != nil || len(f) != 3 || f[1] != FormatALTO || f[1].Extension() != "alto.xml" {
+		t.Fatalf("unexpected formats: %v, %v", f, err)
+	}
+	if _, err := ParseFormats("docx"); err == nil {
+		t.Fatal("expected an error")
+	}
+}
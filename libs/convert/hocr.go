@@ -0,0 +1,77 @@
+package convert
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strings"
+
+	"cloud.google.com/go/documentai/apiv1/documentaipb"
+)
+
+const hocrHeader = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd">
+<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="en" lang="en">
+<head>
+<title>%s</title>
+<meta http-equiv="Content-Type" content="text/html; charset=utf-8"/>
+<meta name="ocr-system" content="google-document-ai"/>
+<meta name="ocr-capabilities" content="ocr_page ocr_carea ocr_par ocr_line ocrx_word ocrp_lang ocrp_wconf"/>
+</head>
+<body>
+`
+
+// HOCR returns the hOCR representation of a document: pages, blocks (ocr_carea), paragraphs,
+// lines and words, with their bounding boxes in pixels and the word confidences.
+func HOCR(doc *documentaipb.Document, o Options) ([]byte, error) {
+	runes := []rune(doc.GetText())
+	var sb strings.Builder
+	fmt.Fprintf(&sb, hocrHeader, html.EscapeString(o.ImageName))
+
+	for i, p := range pages(doc) {
+		title := fmt.Sprintf("bbox 0 0 %d %d; ppageno %d", p.width, p.height, i)
+		if o.ImageName != "" {
+			title = fmt.Sprintf("image %q; %s", o.ImageName, title)
+		}
+		fmt.Fprintf(&sb, "<div class=\"ocr_page\" id=\"page_%d\" title=\"%s\"%s>\n", p.number, html.EscapeString(title), hocrLang(p.lang))
+		for bi, b := range p.blocks {
+			fmt.Fprintf(&sb, " <div class=\"ocr_carea\" id=\"block_%d_%d\" title=\"%s\">\n", p.number, bi+1, hocrBox(b.box))
+			for pi, para := range b.children {
+				fmt.Fprintf(&sb, "  <p class=\"ocr_par\" id=\"par_%d_%d_%d\" title=\"%s\">\n", p.number, bi+1, pi+1, hocrBox(para.box))
+				for li, l := range para.children {
+					fmt.Fprintf(&sb, "   <span class=\"ocr_line\" id=\"line_%d_%d_%d_%d\" title=\"%s\">", p.number, bi+1, pi+1, li+1, hocrBox(l.box))
+					for wi, w := range l.children {
+						s := strings.TrimSpace(text(runes, w.start, w.end))
+						if s == "" {
+							continue
+						}
+						if wi > 0 {
+							sb.WriteString(" ")
+						}
+						fmt.Fprintf(&sb, "<span class=\"ocrx_word\" id=\"word_%d_%d_%d_%d_%d\" title=\"%s; x_wconf %d\">%s</span>",
+							p.number, bi+1, pi+1, li+1, wi+1, hocrBox(w.box), int(math.Round(float64(w.conf)*100)), html.EscapeString(s))
+					}
+					sb.WriteString("</span>\n")
+				}
+				sb.WriteString("  </p>\n")
+			}
+			sb.WriteString(" </div>\n")
+		}
+		sb.WriteString("</div>\n")
+	}
+
+	sb.WriteString("</body>\n</html>\n")
+	return []byte(sb.String()), nil
+}
+
+func hocrBox(b box) string {
+	return fmt.Sprintf("bbox %d %d %d %d", b.X0, b.Y0, b.X1, b.Y1)
+}
+
+func hocrLang(lang string) string {
+	if lang == "" {
+		return ""
+	}
+	l := html.EscapeString(lang)
+	return fmt.Sprintf(" lang=\"%s\" xml:lang=\"%s\"", l, l)
+}
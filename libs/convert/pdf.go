@@ -0,0 +1,200 @@
+package convert
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"  // decode gif images
+	_ "image/jpeg" // decode jpeg images
+	_ "image/png"  // decode png images
+	"strings"
+
+	"cloud.google.com/go/documentai/apiv1/documentaipb"
+)
+
+// SearchablePDF returns a single-page PDF of the source image, overlaid with the invisible text of
+// the document words at their positions, so that the text can be searched and selected. Only
+// single-page documents of JPEG, PNG and GIF images are supported. The page is sized after the
+// image, at o.DPI.
+func SearchablePDF(doc *documentaipb.Document, o Options) ([]byte, error) {
+	pgs := pages(doc)
+	if len(pgs) != 1 {
+		return nil, fmt.Errorf("%w: searchable pdf of a %d pages document", ErrUnsupported, len(pgs))
+	}
+	if len(o.Image) == 0 {
+		return nil, fmt.Errorf("%w: searchable pdf without source image", ErrUnsupported)
+	}
+	img, err := pdfImage(o.Image)
+	if err != nil {
+		return nil, err
+	}
+
+	dpi := o.DPI
+	if dpi <= 0 {
+		dpi = DefaultDPI
+	}
+	// points per image pixel, and image pixels per document pixel
+	scale := 72 / float64(dpi)
+	p := pgs[0]
+	sx, sy := 1.0, 1.0
+	if p.width > 0 && p.height > 0 {
+		sx, sy = float64(img.width)/float64(p.width), float64(img.height)/float64(p.height)
+	}
+	pw, ph := float64(img.width)*scale, float64(img.height)*scale
+
+	// content stream: the image, then the invisible words
+	var cs bytes.Buffer
+	fmt.Fprintf(&cs, "q %.2f 0 0 %.2f 0 0 cm /Im0 Do Q\n", pw, ph)
+	cs.WriteString("BT 3 Tr\n")
+	runes := []rune(doc.GetText())
+	for _, b := range p.blocks {
+		for _, para := range b.children {
+			for _, l := range para.children {
+				for _, w := range l.children {
+					s := strings.TrimSpace(text(runes, w.start, w.end))
+					if s == "" || w.box.Width() <= 0 || w.box.Height() <= 0 {
+						continue
+					}
+					x := float64(w.box.X0) * sx * scale
+					width := float64(w.box.Width()) * sx * scale
+					size := float64(w.box.Height()) * sy * scale
+					// the baseline, above the descenders
+					y := ph - float64(w.box.Y1)*sy*scale + size*0.2
+					enc := winAnsi(s)
+					// horizontal scaling fitting the word to its box, for an average glyph width of
+					// half the font size
+					tz := 100 * width / (float64(len(enc)) * size * 0.5)
+					fmt.Fprintf(&cs, "/F0 %.2f Tf %.2f Tz 1 0 0 1 %.2f %.2f Tm (%s) Tj\n", size, tz, x, y, pdfEscape(enc))
+				}
+			}
+		}
+	}
+	cs.WriteString("ET\n")
+
+	var w pdfWriter
+	w.header()
+	w.object("<< /Type /Catalog /Pages 2 0 R >>")
+	w.object("<< /Type /Pages /Kids [3 0 R] /Count 1 >>")
+	w.object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Contents 4 0 R /Resources << /XObject << /Im0 5 0 R >> /Font << /F0 6 0 R >> >> >>", pw, ph))
+	w.stream("", compress(cs.Bytes()), "/FlateDecode")
+	w.stream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8", img.width, img.height, img.colorSpace), img.data, img.filter)
+	w.object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	return w.finish(), nil
+}
+
+// pdfImg is an image XObject.
+type pdfImg struct {
+	width, height int
+	colorSpace    string
+	filter        string
+	data          []byte
+}
+
+// pdfImage returns the image XObject of an image. RGB and grayscale JPEG images are embedded as
+// is, other images are decoded and compressed.
+func pdfImage(b []byte) (pdfImg, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return pdfImg{}, fmt.Errorf("%w image: %v", ErrUnsupported, err)
+	}
+	if format == "jpeg" {
+		switch cfg.ColorModel {
+		case color.YCbCrModel:
+			return pdfImg{cfg.Width, cfg.Height, "/DeviceRGB", "/DCTDecode", b}, nil
+		case color.GrayModel:
+			return pdfImg{cfg.Width, cfg.Height, "/DeviceGray", "/DCTDecode", b}, nil
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return pdfImg{}, fmt.Errorf("failed to decode image: %w", err)
+	}
+	r := img.Bounds()
+	raw := make([]byte, 0, r.Dx()*r.Dy()*3)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			raw = append(raw, c.R, c.G, c.B)
+		}
+	}
+	return pdfImg{r.Dx(), r.Dy(), "/DeviceRGB", "/FlateDecode", compress(raw)}, nil
+}
+
+func compress(b []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(b)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// winAnsiRunes are the WinAnsiEncoding codes of the characters outside Latin-1.
+var winAnsiRunes = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87, 'ˆ': 0x88, '‰': 0x89,
+	'Š': 0x8A, '‹': 0x8B, 'Œ': 0x8C, 'Ž': 0x8E, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95,
+	'–': 0x96, '—': 0x97, '˜': 0x98, '™': 0x99, 'š': 0x9A, '›': 0x9B, 'œ': 0x9C, 'ž': 0x9E, 'Ÿ': 0x9F,
+}
+
+// winAnsi encodes a string in WinAnsiEncoding, the encoding of the standard fonts. Characters
+// without a code are replaced by '?'.
+func winAnsi(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r >= 0x20 && r < 0x7F, r >= 0xA0 && r <= 0xFF:
+			b = append(b, byte(r))
+		case winAnsiRunes[r] != 0:
+			b = append(b, winAnsiRunes[r])
+		default:
+			b = append(b, '?')
+		}
+	}
+	return b
+}
+
+// pdfEscape escapes a PDF literal string.
+func pdfEscape(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		if c == '(' || c == ')' || c == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// pdfWriter writes the numbered objects of a PDF file and its cross-reference table.
+type pdfWriter struct {
+	buf     bytes.Buffer
+	offsets []int
+}
+
+func (w *pdfWriter) header() {
+	w.buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+}
+
+func (w *pdfWriter) object(body string) {
+	w.offsets = append(w.offsets, w.buf.Len())
+	fmt.Fprintf(&w.buf, "%d 0 obj\n%s\nendobj\n", len(w.offsets), body)
+}
+
+func (w *pdfWriter) stream(dict string, data []byte, filter string) {
+	w.offsets = append(w.offsets, w.buf.Len())
+	fmt.Fprintf(&w.buf, "%d 0 obj\n<< %s /Filter %s /Length %d >>\nstream\n", len(w.offsets), dict, filter, len(data))
+	w.buf.Write(data)
+	w.buf.WriteString("\nendstream\nendobj\n")
+}
+
+func (w *pdfWriter) finish() []byte {
+	xref := w.buf.Len()
+	fmt.Fprintf(&w.buf, "xref\n0 %d\n0000000000 65535 f \n", len(w.offsets)+1)
+	for _, o := range w.offsets {
+		fmt.Fprintf(&w.buf, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(&w.buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(w.offsets)+1, xref)
+	return w.buf.Bytes()
+}
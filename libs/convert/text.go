@@ -0,0 +1,89 @@
+package convert
+
+import (
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/documentai/apiv1/documentaipb"
+)
+
+// Text returns the text of a document, with pages separated by form feeds.
+func Text(doc *documentaipb.Document) []byte {
+	pgs := pages(doc)
+	if len(pgs) == 0 {
+		return []byte(doc.GetText())
+	}
+
+	runes := []rune(doc.GetText())
+	var sb strings.Builder
+	for i, p := range pgs {
+		if i > 0 {
+			sb.WriteString("\f")
+		}
+		sb.WriteString(text(runes, p.start, p.end))
+	}
+	return []byte(sb.String())
+}
+
+// Markdown returns the paragraphs of a document as Markdown paragraphs. The lines of a paragraph
+// are joined, and each page starts with a page comment.
+func Markdown(doc *documentaipb.Document) []byte {
+	runes := []rune(doc.GetText())
+	var sb strings.Builder
+	for i, p := range pages(doc) {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "<!-- page %d -->\n", p.number)
+		for _, b := range p.blocks {
+			for _, para := range b.children {
+				if s := joinLines(runes, para); s != "" {
+					sb.WriteString("\n")
+					sb.WriteString(escapeMarkdown(s))
+					sb.WriteString("\n")
+				}
+			}
+		}
+	}
+	return []byte(sb.String())
+}
+
+// joinLines returns the text of a paragraph on a single line. Lines ending with a hyphen are joined
+// without a space.
+func joinLines(runes []rune, para *node) string {
+	var sb strings.Builder
+	for _, l := range para.children {
+		s := strings.Join(strings.Fields(text(runes, l.start, l.end)), " ")
+		if s == "" {
+			continue
+		}
+		if sb.Len() > 0 && !strings.HasSuffix(sb.String(), "-") {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(s)
+	}
+	return sb.String()
+}
+
+// markdownEscaper escapes the inline Markdown markup.
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`)
+
+// escapeMarkdown escapes the Markdown markup of a paragraph, inline and at the start of the line,
+// e.g. headings, lists and quotes.
+func escapeMarkdown(s string) string {
+	s = markdownEscaper.Replace(s)
+	switch {
+	case strings.HasPrefix(s, "#"), strings.HasPrefix(s, ">"), strings.HasPrefix(s, "- "),
+		strings.HasPrefix(s, "+ "), strings.HasPrefix(s, "="), strings.HasPrefix(s, "---"):
+		return `\` + s
+	}
+	// ordered lists, e.g. "1. "
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	if i > 0 && i+1 < len(s) && (s[i] == '.' || s[i] == ')') && s[i+1] == ' ' {
+		return s[:i] + `\` + s[i:]
+	}
+	return s
+}
@@ -0,0 +1,155 @@
+// Package cost estimates the Document AI and Natural Language cost of processing images, from tiered
+// price tables.
+package cost
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Tier is a price tier. Tiers apply in order, each to the units left by the previous ones.
+type Tier struct {
+	// Units is the number of units priced by the tier. Zero means all the remaining units.
+	Units int64 `json:"units,omitempty"`
+	// Price is the price of 1000 units.
+	Price float64 `json:"price"`
+}
+
+// Prices is a price table. OCR is priced by page, NLP analyses by unit of 1000 characters.
+type Prices struct {
+	Currency string `json:"currency"`
+	OCR      []Tier `json:"ocr"`
+	// NLP are the prices of the analyses, keyed by NLP_ANALYSES name. Analyses without prices, e.g.
+	// pii which runs in the nlp-worker, are free.
+	NLP map[string][]Tier `json:"nlp"`
+}
+
+// DefaultPrices are the monthly list prices, in USD, of Enterprise Document OCR and of the Natural
+// Language API, see https://cloud.google.com/document-ai/pricing and
+// https://cloud.google.com/natural-language/pricing.
+var DefaultPrices = Prices{
+	Currency: "USD",
+	OCR:      []Tier{{Units: 5_000_000, Price: 1.5}, {Price: 0.6}},
+	NLP: map[string][]Tier{
+		"entities":         {{Units: 5_000}, {Units: 995_000, Price: 1}, {Units: 4_000_000, Price: 0.5}, {Price: 0.25}},
+		"sentiment":        {{Units: 5_000}, {Units: 995_000, Price: 1}, {Units: 4_000_000, Price: 0.5}, {Price: 0.25}},
+		"entity_sentiment": {{Units: 5_000}, {Units: 995_000, Price: 2}, {Units: 4_000_000, Price: 1}, {Price: 0.5}},
+		"syntax":           {{Units: 5_000}, {Units: 995_000, Price: 0.5}, {Units: 4_000_000, Price: 0.25}, {Price: 0.125}},
+		"classify":         {{Units: 30_000}, {Units: 220_000, Price: 2}, {Units: 4_750_000, Price: 0.5}, {Price: 0.1}},
+	},
+}
+
+// LoadPrices returns the default prices overridden by a JSON price table, inline or in a file. The
+// OCR tiers and the tiers of each analysis given replace the default ones.
+func LoadPrices(s string) (Prices, error) {
+	p := DefaultPrices
+	p.NLP = maps.Clone(DefaultPrices.NLP)
+	if s == "" {
+		return p, nil
+	}
+
+	b := []byte(s)
+	if !strings.HasPrefix(strings.TrimSpace(s), "{") {
+		var err error
+		if b, err = os.ReadFile(s); err != nil {
+			return p, fmt.Errorf("failed to read prices (%s): %w", s, err)
+		}
+	}
+	var o Prices
+	if err := json.Unmarshal(b, &o); err != nil {
+		return p, fmt.Errorf("failed to parse prices: %w", err)
+	}
+	if o.Currency != "" {
+		p.Currency = o.Currency
+	}
+	if o.OCR != nil {
+		p.OCR = o.OCR
+	}
+	maps.Copy(p.NLP, o.NLP)
+	return p, p.validate()
+}
+
+func (p Prices) validate() error {
+	var errs []error
+	check := func(name string, tiers []Tier) {
+		for i, t := range tiers {
+			if t.Units < 0 || t.Price < 0 {
+				errs = append(errs, fmt.Errorf("%s: negative tier %d", name, i))
+			}
+			if t.Units == 0 && i < len(tiers)-1 {
+				errs = append(errs, fmt.Errorf("%s: unlimited tier %d is not the last one", name, i))
+			}
+		}
+	}
+	check("ocr", p.OCR)
+	keys := make([]string, 0, len(p.NLP))
+	for k := range p.NLP {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		check("nlp "+k, p.NLP[k])
+	}
+	return errors.Join(errs...)
+}
+
+// price returns the price of n units. Units beyond the last limited tier are priced by it.
+func price(tiers []Tier, n int64) float64 {
+	var total float64
+	for i, t := range tiers {
+		if n <= 0 {
+			break
+		}
+		u := n
+		if t.Units > 0 && t.Units < n && i < len(tiers)-1 {
+			u = t.Units
+		}
+		total += float64(u) * t.Price / 1000
+		n -= u
+	}
+	return total
+}
+
+// Usage is the work estimated.
+type Usage struct {
+	// Documents and Pages are the images submitted for OCR, and their pages.
+	Documents, Pages int64
+	// CharactersPerPage is the average OCR text length of a page.
+	CharactersPerPage int64
+	// Analyses are the NLP analyses performed on the OCR text, see NLP_ANALYSES.
+	Analyses []string
+}
+
+// Estimate is the estimated cost of a usage.
+type Estimate struct {
+	Currency string `json:"currency"`
+	Pages    int64  `json:"pages"`
+	// NLPUnits are the units of 1000 characters of each analysis. Each document is at least a unit.
+	NLPUnits int64              `json:"nlp_units"`
+	OCR      float64            `json:"ocr"`
+	NLP      map[string]float64 `json:"nlp,omitempty"`
+	Total    float64            `json:"total"`
+}
+
+// Estimate returns the estimated cost of a usage.
+func (p Prices) Estimate(u Usage) Estimate {
+	e := Estimate{Currency: p.Currency, Pages: u.Pages, OCR: price(p.OCR, u.Pages)}
+	e.Total = e.OCR
+
+	if u.Documents > 0 && len(u.Analyses) > 0 {
+		chars := float64(u.Pages*u.CharactersPerPage) / float64(u.Documents)
+		e.NLPUnits = u.Documents * max(1, int64(math.Ceil(chars/1000)))
+		e.NLP = map[string]float64{}
+		for _, a := range u.Analyses {
+			e.NLP[a] = price(p.NLP[a], e.NLPUnits)
+			e.Total += e.NLP[a]
+		}
+	}
+	return e
+}
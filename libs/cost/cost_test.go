@@ -0,0 +1,85 @@
+package cost
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestPrice(t *testing.T) {
+	tiers := []Tier{{Units: 1000}, {Units: 9000, Price: 2}, {Price: 1}}
+	tests := map[string]struct {
+		units  int64
+		expect float64
+	}{
+		"none":       {units: 0, expect: 0},
+		"free tier":  {units: 1000, expect: 0},
+		"second":     {units: 4000, expect: 6},
+		"unlimited":  {units: 20000, expect: 18 + 10},
+		"last limit": {units: 10000, expect: 18},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if res := price(tiers, tc.units); !near(tc.expect, res) {
+				t.Fatalf("expected: %v, result: %v", tc.expect, res)
+			}
+		})
+	}
+
+	// units beyond the last limited tier are priced by it
+	if res := price([]Tier{{Units: 1000, Price: 1}}, 3000); !near(3, res) {
+		t.Fatalf("expected: 3, result: %v", res)
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	e := DefaultPrices.Estimate(Usage{Documents: 10_000, Pages: 10_000, CharactersPerPage: 1500, Analyses: []string{"entities", "pii"}})
+	if e.Pages != 10_000 || !near(15, e.OCR) {
+		t.Fatalf("unexpected ocr estimate: %+v", e)
+	}
+	// 2 units per document, the first 5000 free
+	if e.NLPUnits != 20_000 || !near(15, e.NLP["entities"]) || e.NLP["pii"] != 0 || !near(30, e.Total) {
+		t.Fatalf("unexpected nlp estimate: %+v", e)
+	}
+
+	// ocr only
+	e = DefaultPrices.Estimate(Usage{Documents: 1, Pages: 6_000_000})
+	if !near(7500+600, e.Total) || e.NLP != nil {
+		t.Fatalf("unexpected estimate: %+v", e)
+	}
+}
+
+func TestLoadPrices(t *testing.T) {
+	p, err := LoadPrices(`{"currency": "EUR", "ocr": [{"price": 1.4}], "nlp": {"entities": [{"price": 0.9}]}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Currency != "EUR" || len(p.OCR) != 1 || p.NLP["entities"][0].Price != 0.9 || len(p.NLP["classify"]) != 4 {
+		t.Fatalf("unexpected prices: %+v", p)
+	}
+	// the defaults are not modified
+	if DefaultPrices.Currency != "USD" || DefaultPrices.OCR[0].Price != 1.5 || len(DefaultPrices.NLP["entities"]) != 4 {
+		t.Fatalf("defaults modified: %+v", DefaultPrices)
+	}
+
+	// file
+	name := filepath.Join(t.TempDir(), "prices.json")
+	if err := os.WriteFile(name, []byte(`{"ocr": [{"units": 10, "price": 2}, {"price": 1}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if p, err = LoadPrices(name); err != nil || len(p.OCR) != 2 || p.Currency != "USD" {
+		t.Fatalf("unexpected prices: %+v, err: %v", p, err)
+	}
+
+	// invalid
+	for _, s := range []string{`{"ocr": [{"price": 1}, {"units": 10, "price": 1}]}`, `{"ocr": [{"price": -1}]}`, `{"ocr": `, "missing.json"} {
+		if _, err := LoadPrices(s); err == nil {
+			t.Fatalf("expected an error: %s", s)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package dispatch
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Batch message attributes carrying the Document AI process options of a batch, see ProcessOptions.
+const (
+	// AttrLanguageHints is a comma separated list of BCP-47 language codes, e.g. "fr,en".
+	AttrLanguageHints = "ocr_language_hints"
+	// AttrImageQualityScores, AttrNativePDFParsing, AttrSymbols, AttrMathOCR and
+	// AttrSelectionMarks are booleans, e.g. "true".
+	AttrImageQualityScores = "ocr_image_quality_scores"
+	AttrNativePDFParsing   = "ocr_native_pdf_parsing"
+	AttrSymbols            = "ocr_symbols"
+	AttrMathOCR            = "ocr_math"
+	AttrSelectionMarks     = "ocr_selection_marks"
+	// AttrPages selects the pages processed: a comma separated list of pages, e.g. "1,3", the
+	// first pages, e.g. "first:2", or the last pages, e.g. "last:2".
+	AttrPages = "ocr_pages"
+)
+
+// ProcessOptions are the Document AI process options of a batch. The OCR options only apply to
+// OCR and Form Parser processors.
+type ProcessOptions struct {
+	LanguageHints      []string `json:"language_hints,omitempty"`
+	ImageQualityScores bool     `json:"image_quality_scores,omitempty"`
+	NativePDFParsing   bool     `json:"native_pdf_parsing,omitempty"`
+	Symbols            bool     `json:"symbols,omitempty"`
+	// MathOCR and SelectionMarks are premium features.
+	MathOCR        bool `json:"math_ocr,omitempty"`
+	SelectionMarks bool `json:"selection_marks,omitempty"`
+	// Pages selects the pages processed, 1-indexed. FromStart and FromEnd select the first or last
+	// pages instead. At most one of them is set.
+	Pages     []int32 `json:"pages,omitempty"`
+	FromStart int32   `json:"from_start,omitempty"`
+	FromEnd   int32   `json:"from_end,omitempty"`
+}
+
+// IsZero reports whether no option is set.
+func (o ProcessOptions) IsZero() bool {
+	return len(o.LanguageHints) == 0 && !o.ImageQualityScores && !o.NativePDFParsing && !o.Symbols &&
+		!o.MathOCR && !o.SelectionMarks && !o.HasPageRange()
+}
+
+// HasPageRange reports whether a subset of pages is selected.
+func (o ProcessOptions) HasPageRange() bool {
+	return len(o.Pages) > 0 || o.FromStart > 0 || o.FromEnd > 0
+}
+
+// Validate checks the page selection.
+func (o ProcessOptions) Validate() error {
+	n := 0
+	if len(o.Pages) > 0 {
+		n++
+	}
+	if o.FromStart > 0 {
+		n++
+	}
+	if o.FromEnd > 0 {
+		n++
+	}
+	if n > 1 {
+		return errors.New("at most one of pages, from_start and from_end can be set")
+	}
+	if o.FromStart < 0 || o.FromEnd < 0 {
+		return errors.New("page counts must be positive")
+	}
+	for _, p := range o.Pages {
+		if p < 1 {
+			return fmt.Errorf("invalid page %d, pages start at 1", p)
+		}
+	}
+	return nil
+}
+
+// Attributes returns the message attributes of the options set.
+func (o ProcessOptions) Attributes() map[string]string {
+	attrs := map[string]string{}
+	if len(o.LanguageHints) > 0 {
+		attrs[AttrLanguageHints] = strings.Join(o.LanguageHints, ",")
+	}
+	for k, v := range map[string]bool{
+		AttrImageQualityScores: o.ImageQualityScores,
+		AttrNativePDFParsing:   o.NativePDFParsing,
+		AttrSymbols:            o.Symbols,
+		AttrMathOCR:            o.MathOCR,
+		AttrSelectionMarks:     o.SelectionMarks,
+	} {
+		if v {
+			attrs[k] = "true"
+		}
+	}
+	switch {
+	case len(o.Pages) > 0:
+		pages := make([]string, len(o.Pages))
+		for i, p := range o.Pages {
+			pages[i] = strconv.Itoa(int(p))
+		}
+		attrs[AttrPages] = strings.Join(pages, ",")
+	case o.FromStart > 0:
+		attrs[AttrPages] = fmt.Sprintf("first:%d", o.FromStart)
+	case o.FromEnd > 0:
+		attrs[AttrPages] = fmt.Sprintf("last:%d", o.FromEnd)
+	}
+	return attrs
+}
+
+// ParseProcessOptions returns the defaults overridden by the options of the message attributes.
+func ParseProcessOptions(attrs map[string]string, defaults ProcessOptions) (ProcessOptions, error) {
+	o := defaults
+
+	if v, ok := attrs[AttrLanguageHints]; ok {
+		o.LanguageHints = nil
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				o.LanguageHints = append(o.LanguageHints, s)
+			}
+		}
+	}
+
+	for k, p := range map[string]*bool{
+		AttrImageQualityScores: &o.ImageQualityScores,
+		AttrNativePDFParsing:   &o.NativePDFParsing,
+		AttrSymbols:            &o.Symbols,
+		AttrMathOCR:            &o.MathOCR,
+		AttrSelectionMarks:     &o.SelectionMarks,
+	} {
+		v, ok := attrs[k]
+		if !ok {
+			continue
+		}
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return o, fmt.Errorf("invalid %s: %q", k, v)
+		}
+		*p = b
+	}
+
+	if v, ok := attrs[AttrPages]; ok {
+		if err := parsePages(&o, strings.TrimSpace(v)); err != nil {
+			return o, fmt.Errorf("invalid %s: %w", AttrPages, err)
+		}
+	}
+
+	return o, o.Validate()
+}
+
+// parsePages sets the page selection of an AttrPages value. An empty value selects all pages.
+func parsePages(o *ProcessOptions, v string) error {
+	o.Pages, o.FromStart, o.FromEnd = nil, 0, 0
+	if v == "" {
+		return nil
+	}
+
+	count := func(s string) (int32, error) {
+		n, err := strconv.ParseInt(s, 10, 32)
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("invalid page count %q", s)
+		}
+		return int32(n), nil
+	}
+
+	var err error
+	if s, ok := strings.CutPrefix(v, "first:"); ok {
+		o.FromStart, err = count(s)
+		return err
+	}
+	if s, ok := strings.CutPrefix(v, "last:"); ok {
+		o.FromEnd, err = count(s)
+		return err
+	}
+	for _, s := range strings.Split(v, ",") {
+		p, err := count(strings.TrimSpace(s))
+		if err != nil {
+			return err
+		}
+		o.Pages = append(o.Pages, p)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package dispatch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseProcessOptions(t *testing.T) {
+	defaults := ProcessOptions{LanguageHints: []string{"en"}, ImageQualityScores: true}
+
+	tests := map[string]struct {
+		attrs  map[string]string
+		expect ProcessOptions
+		err    bool
+	}{
+		// happy path. no attributes
+		"defaults": {attrs: nil, expect: defaults},
+		// attributes override the defaults
+		"override": {
+			attrs:  map[string]string{AttrLanguageHints: "fr, en", AttrImageQualityScores: "false", AttrMathOCR: "true"},
+			expect: ProcessOptions{LanguageHints: []string{"fr", "en"}, MathOCR: true},
+		},
+		"pages": {
+			attrs:  map[string]string{AttrPages: "1, 3"},
+			expect: ProcessOptions{LanguageHints: []string{"en"}, ImageQualityScores: true, Pages: []int32{1, 3}},
+		},
+		"first": {
+			attrs:  map[string]string{AttrPages: "first:2"},
+			expect: ProcessOptions{LanguageHints: []string{"en"}, ImageQualityScores: true, FromStart: 2},
+		},
+		"last": {
+			attrs:  map[string]string{AttrPages: "last:1"},
+			expect: ProcessOptions{LanguageHints: []string{"en"}, ImageQualityScores: true, FromEnd: 1},
+		},
+		// errors
+		"bool":      {attrs: map[string]string{AttrSymbols: "yes please"}, err: true},
+		"page zero": {attrs: map[string]string{AttrPages: "0,1"}, err: true},
+		"count":     {attrs: map[string]string{AttrPages: "first:x"}, err: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			res, err := ParseProcessOptions(tc.attrs, defaults)
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tc.expect, res) {
+				t.Fatalf("expected: %+v, result: %+v", tc.expect, res)
+			}
+		})
+	}
+}
+
+func TestProcessOptionsAttributes(t *testing.T) {
+	o := ProcessOptions{LanguageHints: []string{"fr"}, NativePDFParsing: true, SelectionMarks: true, FromEnd: 3}
+
+	// the attributes round trip
+	res, err := ParseProcessOptions(o.Attributes(), ProcessOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(o, res) {
+		t.Fatalf("expected: %+v, result: %+v", o, res)
+	}
+
+	if !(ProcessOptions{}).IsZero() || o.IsZero() {
+		t.Fatal("unexpected IsZero")
+	}
+	if err := (ProcessOptions{Pages: []int32{1}, FromStart: 1}).Validate(); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,123 @@
+// Package dispatch contains the helpers used to hand batches of documents over to the ocr-worker.
+package dispatch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/telemetry"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/utils"
+)
+
+// Document is a document of a batch published to the ocr-worker.
+type Document struct {
+	// URI is the gs:// uri of the image submitted to Document AI.
+	URI string `json:"uri"`
+	// Hash is the content hash of the image, see types.ImageDocument. Empty for replayed documents.
+	Hash     string `json:"hash,omitempty"`
+	MimeType string `json:"mime_type,omitempty"`
+	// SourceURIs are the gs:// uris of all the images sharing the hash.
+	SourceURIs []string `json:"source_uris,omitempty"`
+	// Size is the size of the image in bytes, 0 when unknown.
+	Size int64 `json:"size,omitempty"`
+	// Label is the classification label of the image, see types.ImageDocument.
+	Label string `json:"label,omitempty"`
+}
+
+// AttrMode is the batch message attribute selecting how the ocr-worker processes a batch: ModeBatch
+// or ModeOnline. Without it, the ocr-worker selects the mode from the batch size.
+const AttrMode = "ocr_mode"
+
+// OCR modes, see AttrMode.
+const (
+	// ModeBatch submits the batch as a Document AI batch operation.
+	ModeBatch = "batch"
+	// ModeOnline processes each document synchronously, for low-latency requests.
+	ModeOnline = "online"
+)
+
+// AttrPriority is the batch message attribute carrying the dispatch priority: PriorityHigh or
+// PriorityLow. The ocr-worker receives the high priority batches from a subscription of their own,
+// filtered on it, and drains it first. Without it, batches are low priority.
+const AttrPriority = "priority"
+
+// Dispatch priorities, see AttrPriority.
+const (
+	PriorityHigh = "high"
+	PriorityLow  = "low"
+)
+
+// PublishBatch publishes a batch of documents to the ocr-worker topic, with the trace context of ctx
+// in the message attributes. It blocks until the server-generated message id is returned.
+func PublishBatch(ctx context.Context, t *pubsub.Topic, docs []Document) (string, error) {
+	return publish(ctx, t, docs, nil)
+}
+
+// PublishOnlineBatch publishes a batch of documents to be processed online, see ModeOnline.
+func PublishOnlineBatch(ctx context.Context, t *pubsub.Topic, docs []Document) (string, error) {
+	return publish(ctx, t, docs, map[string]string{AttrMode: ModeOnline})
+}
+
+// PublishBatchWithAttributes publishes a batch of documents with additional message attributes,
+// e.g. AttrMode or the process options, see ProcessOptions.Attributes.
+func PublishBatchWithAttributes(ctx context.Context, t *pubsub.Topic, docs []Document, attrs map[string]string) (string, error) {
+	return publish(ctx, t, docs, attrs)
+}
+
+func publish(ctx context.Context, t *pubsub.Topic, docs []Document, attrs map[string]string) (string, error) {
+	var id string
+	enc, err := utils.EncodeToBase64(docs)
+	if err != nil {
+		return id, err
+	}
+
+	result := t.Publish(ctx, &pubsub.Message{
+		Data:       []byte(enc),
+		Attributes: telemetry.Inject(ctx, attrs),
+	})
+
+	// Block until the result is returned and a server-generated
+	// ID is returned for the published message.
+	id, err = result.Get(ctx)
+	if err != nil {
+		return id, err
+	}
+
+	return id, nil
+}
+
+// PublishFilenameBatch publishes a batch of gs:// filenames whose hash and sources are unknown,
+// e.g. replayed documents. See PublishBatch.
+func PublishFilenameBatch(ctx context.Context, t *pubsub.Topic, f []string) (string, error) {
+	docs := make([]Document, len(f))
+	for i, uri := range f {
+		docs[i] = Document{URI: uri}
+	}
+	return PublishBatch(ctx, t, docs)
+}
+
+// DecodeBatch decodes the data of a batch message. Batches published as a list of gs:// filenames,
+// before documents carried their hash and sources, are still accepted.
+func DecodeBatch(data string) ([]Document, error) {
+	var raw json.RawMessage
+	if err := utils.DecodeFromBase64(&raw, data); err != nil {
+		return nil, err
+	}
+
+	var docs []Document
+	if err := json.Unmarshal(raw, &docs); err == nil {
+		return docs, nil
+	}
+
+	var filenames []string
+	if err := json.Unmarshal(raw, &filenames); err != nil {
+		return nil, fmt.Errorf("unsupported batch format: %w", err)
+	}
+	docs = make([]Document, len(filenames))
+	for i, uri := range filenames {
+		docs[i] = Document{URI: uri}
+	}
+	return docs, nil
+}
@@ -0,0 +1,38 @@
+package dispatch
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/utils"
+)
+
+func TestDecodeBatch(t *testing.T) {
+	docs := []Document{{URI: "gs://src/a.jpg", Hash: "abc", SourceURIs: []string{"gs://src/a.jpg", "gs://src/b.jpg"}}}
+
+	tests := map[string]struct {
+		data   any
+		expect []Document
+	}{
+		// happy path. batch documents
+		"documents": {data: docs, expect: docs},
+		// legacy list of filenames
+		"filenames": {data: []string{"gs://src/a.jpg"}, expect: []Document{{URI: "gs://src/a.jpg"}}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			enc, err := utils.EncodeToBase64(tc.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := DecodeBatch(enc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tc.expect, res) {
+				t.Fatalf("expected: %v, result: %v", tc.expect, res)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package docai
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"cloud.google.com/go/documentai/apiv1/documentaipb"
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Document is a logical document, merged from its shards.
+type Document struct {
+	*documentaipb.Document
+	// Name is the name of the logical document, see DocumentName.
+	Name string
+	// Generation is the highest generation of the shards. It changes whenever a shard is rewritten.
+	Generation int64
+}
+
+// ReadDocument reads and parses a Document AI output object.
+func ReadDocument(ctx context.Context, o *storage.ObjectHandle) (*documentaipb.Document, error) {
+	doc, _, err := readDocument(ctx, o)
+	return doc, err
+}
+
+// readDocument reads and parses a Document AI output object, and returns its generation.
+func readDocument(ctx context.Context, o *storage.ObjectHandle) (*documentaipb.Document, int64, error) {
+	reader, err := o.NewReader(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create object reader (%s/%s): %w", o.BucketName(), o.ObjectName(), err)
+	}
+	defer reader.Close()
+
+	jso, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read file (%s/%s): %w", o.BucketName(), o.ObjectName(), err)
+	}
+
+	var doc documentaipb.Document
+	if err := protojson.Unmarshal(jso, &doc); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse document JSON (%s/%s): %w", o.BucketName(), o.ObjectName(), err)
+	}
+
+	return &doc, reader.Attrs.Generation, nil
+}
+
+// LoadDocument reads the document the output object name belongs to. Documents split into several
+// shards are merged, see MergeShards. complete is false, and the document nil, while some shards
+// are not yet written: the finalize event of the last shard loads the complete document.
+func LoadDocument(ctx context.Context, b *storage.BucketHandle, name string) (*Document, bool, error) {
+	doc, gen, err := readDocument(ctx, b.Object(name))
+	if err != nil {
+		return nil, false, err
+	}
+
+	count := doc.GetShardInfo().GetShardCount()
+	if count <= 1 {
+		return &Document{Document: doc, Name: DocumentName(name), Generation: gen}, true, nil
+	}
+
+	base, _, ok := ParseShardName(name)
+	if !ok {
+		return nil, false, fmt.Errorf("sharded document with unexpected name: %s", name)
+	}
+
+	// list the sibling shards
+	var names []string
+	it := b.Objects(ctx, &storage.Query{Prefix: shardPrefix(name)})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to list shards (%s): %w", base, err)
+		}
+		if isSibling(base, attrs.Name) {
+			names = append(names, attrs.Name)
+		}
+	}
+	if int64(len(names)) < count {
+		return nil, false, nil
+	}
+
+	shards := make([]*documentaipb.Document, 0, len(names))
+	for _, n := range names {
+		if n == name {
+			shards = append(shards, doc)
+			continue
+		}
+		s, sgen, err := readDocument(ctx, b.Object(n))
+		if err != nil {
+			return nil, false, err
+		}
+		shards = append(shards, s)
+		gen = max(gen, sgen)
+	}
+
+	merged, err := MergeShards(shards)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to merge shards (%s): %w", base, err)
+	}
+	return &Document{Document: merged, Name: DocumentName(name), Generation: gen}, true, nil
+}
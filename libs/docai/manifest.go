@@ -0,0 +1,95 @@
+package docai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+)
+
+// ManifestPrefix is the refs bucket prefix of the batch operation manifests.
+const ManifestPrefix = "manifests/"
+
+// OperationID returns the id of a Document AI operation name, the last segment of
+// "projects/<project>/locations/<location>/operations/<id>".
+func OperationID(name string) string {
+	return name[strings.LastIndex(name, "/")+1:]
+}
+
+// ManifestKey returns the refs bucket key of the manifest of an operation.
+func ManifestKey(opID string) string {
+	return ManifestPrefix + opID + ".json"
+}
+
+// OutputPrefix splits the name of a batch output object, "<op-id>/<index>/<file>", into the
+// operation id and the "<op-id>/<index>" output prefix of the document.
+func OutputPrefix(name string) (opID, prefix string, ok bool) {
+	parts := strings.SplitN(name, "/", 3)
+	if len(parts) != 3 {
+		return "", "", false
+	}
+	return parts[0], parts[0] + "/" + parts[1], true
+}
+
+// WriteManifest writes the manifest of an operation, see types.OCRManifest, to the refs bucket.
+func WriteManifest(ctx context.Context, b *storage.BucketHandle, opID string, m any) error {
+	key := ManifestKey(opID)
+	wc := b.Object(key).NewWriter(ctx)
+	wc.ContentType = "application/json"
+
+	if err := json.NewEncoder(wc).Encode(m); err != nil {
+		wc.Close()
+		return fmt.Errorf("(%s) failed to encode manifest: %w", key, err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("(%s) failed to write manifest: %w", key, err)
+	}
+	return nil
+}
+
+// ReadManifest reads the manifest of an operation from the refs bucket into m. The error wraps
+// storage.ErrObjectNotExist when the manifest is not written yet.
+func ReadManifest(ctx context.Context, b *storage.BucketHandle, opID string, m any) error {
+	key := ManifestKey(opID)
+
+	reader, err := b.Object(key).NewReader(ctx)
+	if err != nil {
+		return fmt.Errorf("(%s) failed to read manifest: %w", key, err)
+	}
+	defer reader.Close()
+
+	jso, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("(%s) failed to read manifest: %w", key, err)
+	}
+	if err := json.Unmarshal(jso, m); err != nil {
+		return fmt.Errorf("(%s) failed to parse manifest: %w", key, err)
+	}
+	return nil
+}
+
+// FindSource returns the manifest document of the OCR output object name, written by the
+// ocr-worker to the refs bucket.
+func FindSource(ctx context.Context, refs *storage.BucketHandle, bucket, name string) (types.OCRManifestDocument, error) {
+	opID, prefix, ok := OutputPrefix(name)
+	if !ok {
+		return types.OCRManifestDocument{}, fmt.Errorf("unexpected ocr output name: %s", name)
+	}
+
+	var m types.OCRManifest
+	if err := ReadManifest(ctx, refs, opID, &m); err != nil {
+		return types.OCRManifestDocument{}, err
+	}
+
+	output := fmt.Sprintf("gs://%s/%s", bucket, prefix)
+	for _, d := range m.Documents {
+		if d.Output == output {
+			return d, nil
+		}
+	}
+	return types.OCRManifestDocument{}, fmt.Errorf("(%s) output not found in manifest of operation %s", output, opID)
+}
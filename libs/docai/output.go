@@ -0,0 +1,49 @@
+package docai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"cloud.google.com/go/storage"
+)
+
+// Output object metadata, recording the OCR document an output was produced from. Outputs derived
+// from OCR documents, e.g. by the nlp-worker, carry it to skip documents already processed.
+const (
+	MetaOCROutput     = "ocr-output"
+	MetaOCRGeneration = "ocr-generation"
+)
+
+// OutputMetadata returns the metadata of an output of the OCR document output, at generation gen.
+func OutputMetadata(output string, gen int64) map[string]string {
+	return map[string]string{
+		MetaOCROutput:     output,
+		MetaOCRGeneration: strconv.FormatInt(gen, 10),
+	}
+}
+
+// IsProcessed reports whether an output, with metadata md, was produced from the OCR document
+// output at generation gen or later.
+func IsProcessed(md map[string]string, output string, gen int64) bool {
+	if md[MetaOCROutput] != output {
+		return false
+	}
+	g, err := strconv.ParseInt(md[MetaOCRGeneration], 10, 64)
+	return err == nil && g >= gen
+}
+
+// OutputConditions returns the write preconditions of the output object o, and whether it was
+// already produced from the OCR document output at generation gen. The conditions fail the write
+// if the output is created or updated concurrently.
+func OutputConditions(ctx context.Context, o *storage.ObjectHandle, output string, gen int64) (storage.Conditions, bool, error) {
+	attrs, err := o.Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return storage.Conditions{DoesNotExist: true}, false, nil
+	}
+	if err != nil {
+		return storage.Conditions{}, false, fmt.Errorf("failed to read output attrs (%s/%s): %w", o.BucketName(), o.ObjectName(), err)
+	}
+	return storage.Conditions{GenerationMatch: attrs.Generation}, IsProcessed(attrs.Metadata, output, gen), nil
+}
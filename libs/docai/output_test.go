@@ -0,0 +1,28 @@
+package docai
+
+import "testing"
+
+func TestIsProcessed(t *testing.T) {
+	const output = "gs://dst/123/0"
+
+	tests := map[string]struct {
+		md     map[string]string
+		gen    int64
+		expect bool
+	}{
+		"same generation":    {md: OutputMetadata(output, 5), gen: 5, expect: true},
+		"older document":     {md: OutputMetadata(output, 5), gen: 4, expect: true},
+		"rewritten document": {md: OutputMetadata(output, 5), gen: 6, expect: false},
+		"other document":     {md: OutputMetadata("gs://dst/123/1", 5), gen: 5, expect: false},
+		"no metadata":        {md: nil, gen: 5, expect: false},
+		"invalid generation": {md: map[string]string{MetaOCROutput: output, MetaOCRGeneration: "x"}, gen: 5, expect: false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if res := IsProcessed(tc.md, output, tc.gen); res != tc.expect {
+				t.Fatalf("expected: %v, result: %v", tc.expect, res)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+// Package docai contains helpers to read the output of Document AI batch operations.
+package docai
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"cloud.google.com/go/documentai/apiv1/documentaipb"
+	"google.golang.org/protobuf/reflect/protopath"
+	"google.golang.org/protobuf/reflect/protorange"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// shardRe matches the name of a batch output shard, e.g. "<op-id>/0/scan-1.json".
+var shardRe = regexp.MustCompile(`^(.+)-(\d+)\.json$`)
+
+// ParseShardName splits the name of a batch output shard into the name shared by all the shards of
+// the document, e.g. "<op-id>/0/scan", and the shard index. ok is false for names that do not
+// follow the shard naming.
+func ParseShardName(name string) (base string, index int, ok bool) {
+	m := shardRe.FindStringSubmatch(name)
+	if m == nil {
+		return name, 0, false
+	}
+	i, err := strconv.Atoi(m[2])
+	if err != nil {
+		return name, 0, false
+	}
+	return m[1], i, true
+}
+
+// DocumentName returns the name of the logical document a shard belongs to, e.g. "<op-id>/0/scan.json"
+// for "<op-id>/0/scan-1.json". Names that do not follow the shard naming are returned as is.
+func DocumentName(name string) string {
+	base, _, ok := ParseShardName(name)
+	if !ok {
+		return name
+	}
+	return base + ".json"
+}
+
+// shardPrefix returns the object prefix shared by all the shards of the document the shard belongs to.
+func shardPrefix(name string) string {
+	base, _, _ := ParseShardName(name)
+	return base + "-"
+}
+
+// isSibling reports whether name is a shard of the same document as base.
+func isSibling(base, name string) bool {
+	b, _, ok := ParseShardName(name)
+	return ok && b == base
+}
+
+// MergeShards reassembles the shards of a document into a single document. The shards may be given
+// in any order. Their text is concatenated in shard order, and the text anchors of each shard are
+// shifted by the shard text offset so that they index the merged text.
+func MergeShards(shards []*documentaipb.Document) (*documentaipb.Document, error) {
+	if len(shards) == 0 {
+		return nil, fmt.Errorf("no shards")
+	}
+	if len(shards) == 1 {
+		return shards[0], nil
+	}
+
+	shards = slices.Clone(shards)
+	slices.SortFunc(shards, func(a, b *documentaipb.Document) int {
+		return int(a.GetShardInfo().GetShardIndex() - b.GetShardInfo().GetShardIndex())
+	})
+
+	count := shards[0].GetShardInfo().GetShardCount()
+	if int64(len(shards)) != count {
+		return nil, fmt.Errorf("expected %d shards, got %d", count, len(shards))
+	}
+
+	merged := &documentaipb.Document{
+		Source:    shards[0].GetSource(),
+		MimeType:  shards[0].GetMimeType(),
+		ShardInfo: &documentaipb.Document_ShardInfo{ShardIndex: 0, ShardCount: 1},
+	}
+
+	var text strings.Builder
+	var offset int64
+	for i, s := range shards {
+		if idx := s.GetShardInfo().GetShardIndex(); idx != int64(i) {
+			return nil, fmt.Errorf("missing shard %d", i)
+		}
+		if c := s.GetShardInfo().GetShardCount(); c != count {
+			return nil, fmt.Errorf("shard %d: expected shard count %d, got %d", i, count, c)
+		}
+
+		// text anchors index unicode characters. Prefer the offset reported by Document AI.
+		if o := s.GetShardInfo().GetTextOffset(); o > 0 {
+			offset = o
+		}
+		shiftTextAnchors(s, offset)
+
+		text.WriteString(s.GetText())
+		merged.Pages = append(merged.Pages, s.GetPages()...)
+		merged.Entities = append(merged.Entities, s.GetEntities()...)
+		merged.EntityRelations = append(merged.EntityRelations, s.GetEntityRelations()...)
+		merged.TextChanges = append(merged.TextChanges, s.GetTextChanges()...)
+
+		offset += int64(utf8.RuneCountInString(s.GetText()))
+	}
+	merged.Text = text.String()
+
+	return merged, nil
+}
+
+// shiftTextAnchors adds offset to every text segment of doc: pages, blocks, paragraphs, lines,
+// tokens, symbols, tables, form fields, entities, etc.
+func shiftTextAnchors(doc *documentaipb.Document, offset int64) {
+	if offset == 0 {
+		return
+	}
+	protorange.Range(doc.ProtoReflect(), func(v protopath.Values) error {
+		m, ok := v.Index(-1).Value.Interface().(protoreflect.Message)
+		if !ok {
+			return nil
+		}
+		if seg, ok := m.Interface().(*documentaipb.Document_TextAnchor_TextSegment); ok {
+			seg.StartIndex += offset
+			seg.EndIndex += offset
+		}
+		return nil
+	})
+}
@@ -0,0 +1,112 @@
+package docai
+
+import (
+	"testing"
+
+	"cloud.google.com/go/documentai/apiv1/documentaipb"
+)
+
+func TestParseShardName(t *testing.T) {
+	tests := map[string]struct {
+		name    string
+		base    string
+		index   int
+		ok      bool
+		logical string
+	}{
+		// happy path. first shard
+		"first": {name: "123/0/scan-0.json", base: "123/0/scan", index: 0, ok: true, logical: "123/0/scan.json"},
+		// dashes in the input name
+		"dashes": {name: "123/4/my-scan-12.json", base: "123/4/my-scan", index: 12, ok: true, logical: "123/4/my-scan.json"},
+		// not a shard
+		"plain": {name: "123/0/scan.json", base: "123/0/scan.json", ok: false, logical: "123/0/scan.json"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			base, index, ok := ParseShardName(tc.name)
+			if base != tc.base || index != tc.index || ok != tc.ok {
+				t.Fatalf("expected: %v %v %v, result: %v %v %v", tc.base, tc.index, tc.ok, base, index, ok)
+			}
+			if res := DocumentName(tc.name); res != tc.logical {
+				t.Fatalf("expected: %v, result: %v", tc.logical, res)
+			}
+		})
+	}
+}
+
+func TestIsSibling(t *testing.T) {
+	if !isSibling("123/0/scan", "123/0/scan-1.json") {
+		t.Fatal("expected scan-1.json to be a shard of scan")
+	}
+	// shard of another input whose name starts with the same prefix
+	if isSibling("123/0/scan", "123/0/scan-1-0.json") {
+		t.Fatal("expected scan-1-0.json not to be a shard of scan")
+	}
+}
+
+// shard returns a single page shard whose page layout anchors its whole text.
+func shard(index, count int64, text string) *documentaipb.Document {
+	return &documentaipb.Document{
+		Text:      text,
+		ShardInfo: &documentaipb.Document_ShardInfo{ShardIndex: index, ShardCount: count},
+		Pages: []*documentaipb.Document_Page{{
+			PageNumber: int32(index + 1),
+			Layout: &documentaipb.Document_Page_Layout{
+				TextAnchor: &documentaipb.Document_TextAnchor{
+					TextSegments: []*documentaipb.Document_TextAnchor_TextSegment{{StartIndex: 0, EndIndex: int64(len([]rune(text)))}},
+				},
+			},
+		}},
+	}
+}
+
+func TestMergeShards(t *testing.T) {
+	// out of order, with a multi-byte character in the first shard
+	doc, err := MergeShards([]*documentaipb.Document{
+		shard(2, 3, "ghi"),
+		shard(0, 3, "é b\n"),
+		shard(1, 3, "def\n"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := "é b\ndef\nghi"; doc.Text != expect {
+		t.Fatalf("expected: %q, result: %q", expect, doc.Text)
+	}
+	if len(doc.Pages) != 3 {
+		t.Fatalf("expected: 3 pages, result: %d", len(doc.Pages))
+	}
+
+	expect := []string{"é b\n", "def\n", "ghi"}
+	text := []rune(doc.Text)
+	for i, p := range doc.Pages {
+		seg := p.Layout.TextAnchor.TextSegments[0]
+		if res := string(text[seg.StartIndex:seg.EndIndex]); res != expect[i] {
+			t.Fatalf("page %d: expected: %q, result: %q", i, expect[i], res)
+		}
+	}
+}
+
+func TestMergeShardsMissing(t *testing.T) {
+	if _, err := MergeShards([]*documentaipb.Document{shard(0, 3, "a"), shard(2, 3, "c")}); err == nil {
+		t.Fatal("expected an error for missing shards")
+	}
+	if _, err := MergeShards([]*documentaipb.Document{shard(0, 2, "a"), shard(0, 2, "a")}); err == nil {
+		t.Fatal("expected an error for duplicate shards")
+	}
+}
+
+func TestOutputPrefix(t *testing.T) {
+	opID, prefix, ok := OutputPrefix("123/4/scan-0.json")
+	if !ok || opID != "123" || prefix != "123/4" {
+		t.Fatalf("expected: 123 123/4 true, result: %v %v %v", opID, prefix, ok)
+	}
+	if _, _, ok := OutputPrefix("scan-0.json"); ok {
+		t.Fatal("expected no output prefix for a top level object")
+	}
+	if res := OperationID("projects/p/locations/us/operations/123"); res != "123" {
+		t.Fatalf("expected: 123, result: %v", res)
+	}
+}
@@ -0,0 +1,166 @@
+package docai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+	"google.golang.org/api/iterator"
+)
+
+// Document statuses, the progress of a source image through the pipeline, see ReadStatus.
+const (
+	// StatusPending documents are not OCR'd yet.
+	StatusPending = "pending"
+	// StatusOCRFailed documents have an ocr-worker error record.
+	StatusOCRFailed = "ocr_failed"
+	// StatusAnalyzing documents are OCR'd and not analyzed yet.
+	StatusAnalyzing = "analyzing"
+	// StatusNLPFailed documents have an nlp-worker error record.
+	StatusNLPFailed = "nlp_failed"
+	// StatusDone documents are OCR'd and analyzed.
+	StatusDone = "done"
+)
+
+// StatusBuckets are the buckets the status of a document is read from: the refs and err buckets of
+// the ocr-worker and the dst and err buckets of the nlp-worker. The OCR outputs are read from the
+// bucket of their destination, with Store.
+type StatusBuckets struct {
+	Store  *storage.Client
+	Refs   *storage.BucketHandle
+	OCRErr *storage.BucketHandle
+	NLPDst *storage.BucketHandle
+	NLPErr *storage.BucketHandle
+}
+
+// Status is the status of a document, joined from the pipeline buckets.
+type Status struct {
+	Status string
+	// OCROutput is the gs://<bucket>/<op-id>/<index> Document AI output of the document, and
+	// OCRBucket its bucket. Set once OCR'd.
+	OCROutput string
+	OCRBucket string
+	// Outputs are the OCR output objects, one per shard, in OCRBucket.
+	Outputs []string
+	// NLPName is the nlp-worker output object name, set once the OCR outputs are written.
+	NLPName string
+	// Error is the error record of failed documents.
+	Error *types.ErrorRecord
+}
+
+// ReadStatus joins a source image, whose refs object is key, "<bucket>/<name>", with the outputs
+// and error records of the ocr-worker and nlp-worker. hash is the content hash keying the
+// nlp-worker output; when empty, it is read from the manifest of the OCR output.
+func ReadStatus(ctx context.Context, b StatusBuckets, key, hash string) (Status, error) {
+	s := Status{Status: StatusPending}
+
+	// ocr. the refs object holds the output destination, see the ocr-worker
+	out, err := ReadObject(ctx, b.Refs.Object(key))
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		rec, err := ReadErrorRecord(ctx, b.OCRErr.Object(key+".log"))
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return s, nil
+		}
+		if err != nil {
+			return s, err
+		}
+		s.Status, s.Error = StatusOCRFailed, &rec
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	s.OCROutput = strings.TrimSuffix(strings.TrimSpace(string(out)), "/")
+	s.Status = StatusAnalyzing
+
+	// the output objects, "<op-id>/<index>/<name>-<shard>.json"
+	bucket, prefix, ok := strings.Cut(strings.TrimPrefix(s.OCROutput, "gs://"), "/")
+	if !ok {
+		return s, fmt.Errorf("invalid ocr output (%s): %s", key, s.OCROutput)
+	}
+	s.OCRBucket = bucket
+	itr := b.Store.Bucket(bucket).Objects(ctx, &storage.Query{Prefix: prefix + "/"})
+	for {
+		attrs, err := itr.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return s, fmt.Errorf("(%s) failed to list outputs: %w", prefix, err)
+		}
+		s.Outputs = append(s.Outputs, attrs.Name)
+	}
+	if len(s.Outputs) == 0 {
+		return s, nil
+	}
+
+	// nlp. the output is keyed by hash, see the ocr-worker manifest, or by document name
+	s.NLPName = DocumentName(s.Outputs[0])
+	if hash == "" {
+		if d, err := FindSource(ctx, b.Refs, bucket, s.Outputs[0]); err == nil {
+			hash = d.Hash
+		}
+	}
+	if hash != "" {
+		s.NLPName = hash + ".json"
+	}
+	if _, err := b.NLPDst.Object(s.NLPName).Attrs(ctx); err == nil {
+		s.Status = StatusDone
+		return s, nil
+	} else if !errors.Is(err, storage.ErrObjectNotExist) {
+		return s, fmt.Errorf("(%s) failed to read nlp output: %w", s.NLPName, err)
+	}
+
+	// nlp errors are named after the output object of a shard
+	for _, o := range s.Outputs {
+		rec, err := ReadErrorRecord(ctx, b.NLPErr.Object(o))
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			continue
+		}
+		if err != nil {
+			return s, err
+		}
+		s.Status, s.Error = StatusNLPFailed, &rec
+		break
+	}
+	return s, nil
+}
+
+// ReadObject reads the content of an object. The error is storage.ErrObjectNotExist, unwrapped,
+// when the object does not exist.
+func ReadObject(ctx context.Context, o *storage.ObjectHandle) ([]byte, error) {
+	rd, err := o.NewReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+	b, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, fmt.Errorf("(%s) failed to read: %w", o.ObjectName(), err)
+	}
+	return b, nil
+}
+
+// ReadErrorRecord reads an error record, see ParseErrorRecord.
+func ReadErrorRecord(ctx context.Context, o *storage.ObjectHandle) (types.ErrorRecord, error) {
+	b, err := ReadObject(ctx, o)
+	if err != nil {
+		return types.ErrorRecord{}, err
+	}
+	return ParseErrorRecord(b), nil
+}
+
+// ParseErrorRecord parses an error record. Legacy error objects are returned as a record with their
+// content as message.
+func ParseErrorRecord(b []byte) types.ErrorRecord {
+	var r types.ErrorRecord
+	if err := json.Unmarshal(b, &r); err != nil || r.Stage == "" {
+		return types.ErrorRecord{Code: "Unknown", Message: strings.TrimSpace(string(b))}
+	}
+	return r
+}
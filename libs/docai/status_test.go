@@ -0,0 +1,30 @@
+package docai
+
+import (
+	"testing"
+
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+)
+
+func TestParseErrorRecord(t *testing.T) {
+	tests := map[string]struct {
+		content string
+		expect  types.ErrorRecord
+	}{
+		"record": {
+			content: `{"stage":"nlp","code":"InvalidArgument","message":"bad"}`,
+			expect:  types.ErrorRecord{Stage: "nlp", Code: "InvalidArgument", Message: "bad"},
+		},
+		"legacy": {content: "failed to load document\n", expect: types.ErrorRecord{Code: "Unknown", Message: "failed to load document"}},
+		// json without a stage is not a record
+		"no stage": {content: `{"code":"x"}`, expect: types.ErrorRecord{Code: "Unknown", Message: `{"code":"x"}`}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if res := ParseErrorRecord([]byte(tc.content)); res.Stage != tc.expect.Stage || res.Code != tc.expect.Code || res.Message != tc.expect.Message {
+				t.Fatalf("expected: %v, result: %v", tc.expect, res)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/documentai/apiv1/documentaipb"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/docai"
+	"github.com/parquet-go/parquet-go"
+)
+
+const nlpOutput = `{
+	"hash": "h1",
+	"ocr_output": "gs://ocr/op/0",
+	"language": "fr",
+	"languages": [{"code": "fr", "confidence": 0.9}, {"code": "en", "confidence": 0.1}],
+	"entities": [{"name": "Jean Dupont", "type": 1, "salience": 0.5, "mentions": [{}, {}]}],
+	"categories": [{"name": "/Finance"}],
+	"contains_pii": true
+}`
+
+var exportedAt = time.Date(2024, 10, 1, 12, 0, 0, 123456789, time.UTC)
+
+func TestRecord(t *testing.T) {
+	r := NewRecord("h1", []string{"gs://src/a.jpg", "gs://src/b/a.jpg"}, exportedAt)
+	if r.Status != docai.StatusPending || r.SourceCount != 2 || !r.ExportedAt.Equal(exportedAt.Truncate(time.Microsecond)) {
+		t.Fatalf("unexpected record: %+v", r)
+	}
+
+	r.SetError("ocr", "InvalidArgument", "unsupported format")
+	if r.Status != docai.StatusOCRFailed || *r.ErrorStage != "ocr" || *r.ErrorCode != "InvalidArgument" {
+		t.Fatalf("unexpected record: %+v", r)
+	}
+
+	// ocr
+	r = NewRecord("h1", nil, exportedAt)
+	doc := &documentaipb.Document{
+		Text: "Été 2024",
+		Pages: []*documentaipb.Document_Page{
+			{Tokens: []*documentaipb.Document_Page_Token{
+				{Layout: &documentaipb.Document_Page_Layout{Confidence: 0.5}},
+				{Layout: &documentaipb.Document_Page_Layout{Confidence: 1}},
+			}},
+			{Tokens: []*documentaipb.Document_Page_Token{
+				{Layout: &documentaipb.Document_Page_Layout{Confidence: 0.75}},
+			}},
+		},
+	}
+	r.SetOCR("gs://ocr/op/0", doc)
+	if r.Status != docai.StatusAnalyzing || *r.OCROutput != "gs://ocr/op/0" || *r.OCRPages != 2 || *r.OCRCharacters != 8 || *r.OCRMeanConfidence != 0.75 {
+		t.Fatalf("unexpected record: %+v", r)
+	}
+
+	// pages without tokens
+	r.SetOCR("", &documentaipb.Document{Pages: []*documentaipb.Document_Page{{Layout: &documentaipb.Document_Page_Layout{Confidence: 0.5}}}})
+	if *r.OCRMeanConfidence != 0.5 {
+		t.Fatalf("expected: 0.5, result: %v", *r.OCRMeanConfidence)
+	}
+
+	// nlp
+	r = NewRecord("h1", nil, exportedAt)
+	r.SetError("nlp", "Internal", "failed")
+	if r.Status != docai.StatusNLPFailed {
+		t.Fatalf("expected: %s, result: %s", docai.StatusNLPFailed, r.Status)
+	}
+	if err := r.SetNLP([]byte(nlpOutput)); err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != docai.StatusDone || r.ErrorStage != nil || *r.OCROutput != "gs://ocr/op/0" || *r.Language != "fr" || *r.EntityCount != 1 || !*r.ContainsPII {
+		t.Fatalf("unexpected record: %+v", r)
+	}
+	if !reflect.DeepEqual(r.Languages, []string{"fr", "en"}) || !reflect.DeepEqual(r.Categories, []string{"/Finance"}) {
+		t.Fatalf("unexpected record: %+v", r)
+	}
+	if expect := []Entity{{Name: "Jean Dupont", Type: "PERSON", Salience: 0.5, Mentions: 2}}; !reflect.DeepEqual(expect, r.Entities) {
+		t.Fatalf("expected: %+v, result: %+v", expect, r.Entities)
+	}
+	if err := r.SetNLP([]byte("{")); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestParseFormats(t *testing.T) {
+	res, err := ParseFormats([]string{"ndjson", " Parquet", "ndjson"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res, []Format{FormatNDJSON, FormatParquet}) {
+		t.Fatalf("unexpected formats: %v", res)
+	}
+	for _, s := range [][]string{nil, {"csv"}} {
+		if _, err := ParseFormats(s); err == nil {
+			t.Fatalf("expected an error: %v", s)
+		}
+	}
+}
+
+// records returns a pending and a done record.
+func records(t *testing.T) []Record {
+	pending := NewRecord("h0", []string{"gs://src/b.jpg"}, exportedAt)
+	done := NewRecord("h1", []string{"gs://src/a.jpg"}, exportedAt)
+	done.SetOCR("", &documentaipb.Document{Text: "abc", Pages: []*documentaipb.Document_Page{{}}})
+	if err := done.SetNLP([]byte(nlpOutput)); err != nil {
+		t.Fatal(err)
+	}
+	return []Record{pending, done}
+}
+
+func TestNDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, FormatNDJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(records(t)...); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, result: %d", len(lines))
+	}
+	var m map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &m); err != nil {
+		t.Fatal(err)
+	}
+	// null scalars, empty arrays
+	if v, ok := m["ocr_pages"]; !ok || v != nil {
+		t.Fatalf("expected null ocr_pages, result: %v", v)
+	}
+	if v, ok := m["entities"].([]any); !ok || len(v) != 0 {
+		t.Fatalf("expected empty entities, result: %v", m["entities"])
+	}
+	if m["exported_at"] != "2024-10-01T12:00:00.123456Z" {
+		t.Fatalf("unexpected exported_at: %v", m["exported_at"])
+	}
+}
+
+func TestParquet(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, FormatParquet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs := records(t)
+	if err := w.Write(recs...); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := parquet.Read[Record](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 {
+		t.Fatalf("expected 2 records, result: %d", len(res))
+	}
+	if res[0].OCRPages != nil || *res[1].OCRPages != 1 || *res[1].Language != "fr" || !reflect.DeepEqual(res[1].Entities, recs[1].Entities) {
+		t.Fatalf("unexpected records: %+v", res)
+	}
+	if !res[1].ExportedAt.Equal(recs[1].ExportedAt) {
+		t.Fatalf("expected: %v, result: %v", recs[1].ExportedAt, res[1].ExportedAt)
+	}
+}
+
+// fieldNames returns the sorted names of the fields of a schema, with their nested fields.
+func fieldNames(s bigquery.Schema, prefix string) []string {
+	var names []string
+	for _, f := range s {
+		names = append(names, prefix+f.Name)
+		names = append(names, fieldNames(f.Schema, prefix+f.Name+".")...)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TestSchema checks that the BigQuery schema, the JSON records and the Parquet schema have the
+// same columns.
+func TestSchema(t *testing.T) {
+	expect := fieldNames(Schema(), "")
+
+	r := records(t)[1]
+	r.normalize()
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	var jsonNames []string
+	for k, v := range m {
+		jsonNames = append(jsonNames, k)
+		if a, ok := v.([]any); ok && len(a) > 0 {
+			if o, ok := a[0].(map[string]any); ok {
+				for sk := range o {
+					jsonNames = append(jsonNames, k+"."+sk)
+				}
+			}
+		}
+	}
+	sort.Strings(jsonNames)
+	if !reflect.DeepEqual(expect, jsonNames) {
+		t.Fatalf("expected: %v, json: %v", expect, jsonNames)
+	}
+
+	var parquetNames []string
+	for _, f := range parquet.SchemaOf(Record{}).Fields() {
+		parquetNames = append(parquetNames, f.Name())
+	}
+	sort.Strings(parquetNames)
+	var top []string
+	for _, f := range Schema() {
+		top = append(top, f.Name)
+	}
+	sort.Strings(top)
+	if !reflect.DeepEqual(top, parquetNames) {
+		t.Fatalf("expected: %v, parquet: %v", top, parquetNames)
+	}
+}
@@ -0,0 +1,175 @@
+// Package export flattens the pipeline results, the image documents, their OCR status and text
+// statistics and their NLP entities, into records of a stable schema. Records are written as
+// newline-delimited JSON and Parquet, and loaded to BigQuery, see Schema.
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"cloud.google.com/go/documentai/apiv1/documentaipb"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/docai"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+)
+
+// Record is the flat record of a unique image. Fields of the stages an image has not been through
+// yet are null. The json and parquet field names are the BigQuery column names, see Schema.
+type Record struct {
+	// image document, see types.ImageDocument
+	Hash     string `json:"hash" parquet:"hash"`
+	MimeType string `json:"mime_type" parquet:"mime_type"`
+	Size     int64  `json:"size" parquet:"size"`
+	Width    int64  `json:"width" parquet:"width"`
+	Height   int64  `json:"height" parquet:"height"`
+	Pixels   int64  `json:"pixels" parquet:"pixels"`
+	Label    string `json:"label" parquet:"label"`
+	// SourceURIs are the gs:// uris, or local paths, of every copy of the image.
+	SourceURIs  []string `json:"source_uris" parquet:"source_uris,list"`
+	SourceCount int64    `json:"source_count" parquet:"source_count"`
+
+	// status, see docai.ReadStatus, and error record of the failed stage
+	Status       string  `json:"status" parquet:"status"`
+	ErrorStage   *string `json:"error_stage" parquet:"error_stage,optional"`
+	ErrorCode    *string `json:"error_code" parquet:"error_code,optional"`
+	ErrorMessage *string `json:"error_message" parquet:"error_message,optional"`
+
+	// ocr. OCRMeanConfidence is the mean confidence of the tokens, or of the pages when the
+	// document has no tokens.
+	OCROutput         *string  `json:"ocr_output" parquet:"ocr_output,optional"`
+	OCRPages          *int64   `json:"ocr_pages" parquet:"ocr_pages,optional"`
+	OCRCharacters     *int64   `json:"ocr_characters" parquet:"ocr_characters,optional"`
+	OCRMeanConfidence *float64 `json:"ocr_mean_confidence" parquet:"ocr_mean_confidence,optional"`
+
+	// nlp, see types.NLPOutput
+	Language    *string  `json:"language" parquet:"language,optional"`
+	Languages   []string `json:"languages" parquet:"languages,list"`
+	EntityCount *int64   `json:"entity_count" parquet:"entity_count,optional"`
+	Entities    []Entity `json:"entities" parquet:"entities,list"`
+	Categories  []string `json:"categories" parquet:"categories,list"`
+	ContainsPII *bool    `json:"contains_pii" parquet:"contains_pii,optional"`
+
+	ExportedAt time.Time `json:"exported_at" parquet:"exported_at,timestamp(microsecond)"`
+}
+
+// Entity is an NLP entity of a record.
+type Entity struct {
+	Name string `json:"name" parquet:"name"`
+	// Type is the Natural Language API entity type, e.g. PERSON, LOCATION.
+	Type     string  `json:"type" parquet:"type"`
+	Salience float64 `json:"salience" parquet:"salience"`
+	Mentions int64   `json:"mentions" parquet:"mentions"`
+}
+
+// NewRecord returns the record of an image, pending until its OCR and NLP outputs are set. The
+// export time is truncated to microseconds, the BigQuery timestamp precision.
+func NewRecord(hash string, sourceURIs []string, exportedAt time.Time) Record {
+	return Record{
+		Hash:        hash,
+		SourceURIs:  sourceURIs,
+		SourceCount: int64(len(sourceURIs)),
+		Status:      docai.StatusPending,
+		ExportedAt:  exportedAt.UTC().Truncate(time.Microsecond),
+	}
+}
+
+// SetError sets the status and error of the stage an image failed, see types.ErrorRecord.
+func (r *Record) SetError(stage, code, message string) {
+	switch stage {
+	case types.ErrorStageNLP:
+		r.Status = docai.StatusNLPFailed
+	default:
+		r.Status = docai.StatusOCRFailed
+	}
+	r.ErrorStage, r.ErrorCode, r.ErrorMessage = &stage, &code, &message
+}
+
+// SetOCR sets the OCR output of an image and the statistics of its Document AI document. Images
+// without NLP output are analyzing.
+func (r *Record) SetOCR(output string, doc *documentaipb.Document) {
+	if r.Status == docai.StatusPending {
+		r.Status = docai.StatusAnalyzing
+	}
+	if output != "" {
+		r.OCROutput = &output
+	}
+	if doc == nil {
+		return
+	}
+
+	pages := int64(len(doc.GetPages()))
+	chars := int64(utf8.RuneCountInString(doc.GetText()))
+	r.OCRPages, r.OCRCharacters = &pages, &chars
+
+	var sum float64
+	var n int
+	for _, p := range doc.GetPages() {
+		for _, t := range p.GetTokens() {
+			sum += float64(t.GetLayout().GetConfidence())
+			n++
+		}
+	}
+	if n == 0 {
+		for _, p := range doc.GetPages() {
+			if l := p.GetLayout(); l != nil {
+				sum += float64(l.GetConfidence())
+				n++
+			}
+		}
+	}
+	if n > 0 {
+		mean := sum / float64(n)
+		r.OCRMeanConfidence = &mean
+	}
+}
+
+// SetNLP sets the JSON encoded NLP output of an image, see types.NLPOutput. The image is done.
+func (r *Record) SetNLP(b []byte) error {
+	var out types.NLPOutput
+	if err := json.Unmarshal(b, &out); err != nil {
+		return fmt.Errorf("failed to decode nlp output: %w", err)
+	}
+
+	r.Status = docai.StatusDone
+	r.ErrorStage, r.ErrorCode, r.ErrorMessage = nil, nil, nil
+	if r.OCROutput == nil && out.OCROutput != "" {
+		r.OCROutput = &out.OCROutput
+	}
+	if out.Language != "" {
+		r.Language = &out.Language
+	}
+	r.Languages = nil
+	for _, l := range out.Languages {
+		r.Languages = append(r.Languages, l.Code)
+	}
+	count := int64(len(out.Entities))
+	r.EntityCount = &count
+	r.Entities = nil
+	for _, e := range out.Entities {
+		r.Entities = append(r.Entities, Entity{
+			Name:     e.GetName(),
+			Type:     e.GetType().String(),
+			Salience: float64(e.GetSalience()),
+			Mentions: int64(len(e.GetMentions())),
+		})
+	}
+	r.Categories = nil
+	for _, c := range out.Categories {
+		r.Categories = append(r.Categories, c.GetName())
+	}
+	r.ContainsPII = &out.ContainsPII
+	return nil
+}
+
+// normalize replaces the nil repeated fields with empty ones: BigQuery rejects null arrays.
+func (r *Record) normalize() {
+	for _, s := range []*[]string{&r.SourceURIs, &r.Languages, &r.Categories} {
+		if *s == nil {
+			*s = []string{}
+		}
+	}
+	if r.Entities == nil {
+		r.Entities = []Entity{}
+	}
+}
@@ -0,0 +1,55 @@
+package export
+
+import "cloud.google.com/go/bigquery"
+
+// Schema returns the BigQuery schema of the records. Columns are only ever added to it, so that
+// tables loaded by earlier exports remain compatible.
+func Schema() bigquery.Schema {
+	str := func(name, desc string) *bigquery.FieldSchema {
+		return &bigquery.FieldSchema{Name: name, Type: bigquery.StringFieldType, Description: desc}
+	}
+	integer := func(name, desc string) *bigquery.FieldSchema {
+		return &bigquery.FieldSchema{Name: name, Type: bigquery.IntegerFieldType, Description: desc}
+	}
+	repeated := func(name, desc string) *bigquery.FieldSchema {
+		return &bigquery.FieldSchema{Name: name, Type: bigquery.StringFieldType, Repeated: true, Description: desc}
+	}
+
+	hash := str("hash", "content hash of the image")
+	hash.Required = true
+	status := str("status", "pending, ocr_failed, analyzing, nlp_failed or done")
+	status.Required = true
+	exportedAt := &bigquery.FieldSchema{Name: "exported_at", Type: bigquery.TimestampFieldType, Required: true, Description: "time of the export"}
+
+	return bigquery.Schema{
+		hash,
+		str("mime_type", "MIME type of the image"),
+		integer("size", "size of the image in bytes"),
+		integer("width", "width of the image in pixels"),
+		integer("height", "height of the image in pixels"),
+		integer("pixels", "number of pixels of the image"),
+		str("label", "classification label of the image, used to route it to a processor"),
+		repeated("source_uris", "uris of every copy of the image"),
+		integer("source_count", "number of copies of the image"),
+		status,
+		str("error_stage", "stage of the failure, ocr or nlp"),
+		str("error_code", "gRPC code of the failure"),
+		str("error_message", "message of the failure"),
+		str("ocr_output", "gs:// uri of the Document AI output"),
+		integer("ocr_pages", "number of OCR pages"),
+		integer("ocr_characters", "number of characters of the OCR text"),
+		{Name: "ocr_mean_confidence", Type: bigquery.FloatFieldType, Description: "mean OCR token confidence"},
+		str("language", "dominant language"),
+		repeated("languages", "languages detected by OCR, by decreasing confidence"),
+		integer("entity_count", "number of NLP entities"),
+		{Name: "entities", Type: bigquery.RecordFieldType, Repeated: true, Description: "NLP entities", Schema: bigquery.Schema{
+			str("name", "entity name"),
+			str("type", "Natural Language API entity type, e.g. PERSON"),
+			{Name: "salience", Type: bigquery.FloatFieldType, Description: "entity salience"},
+			integer("mentions", "number of mentions of the entity"),
+		}},
+		repeated("categories", "NLP content categories"),
+		{Name: "contains_pii", Type: bigquery.BooleanFieldType, Description: "whether personal data was found"},
+		exportedAt,
+	}
+}
@@ -0,0 +1,114 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Format is an export file format.
+type Format string
+
+// Export file formats.
+const (
+	FormatNDJSON  Format = "ndjson"
+	FormatParquet Format = "parquet"
+)
+
+// Formats are the supported export file formats.
+var Formats = []Format{FormatNDJSON, FormatParquet}
+
+// ParseFormats parses a list of formats, e.g. "ndjson,parquet".
+func ParseFormats(s []string) ([]Format, error) {
+	var res []Format
+	seen := map[Format]bool{}
+	for _, v := range s {
+		f := Format(strings.ToLower(strings.TrimSpace(v)))
+		if f == "" || seen[f] {
+			continue
+		}
+		if f != FormatNDJSON && f != FormatParquet {
+			return nil, fmt.Errorf("unsupported export format: %s", v)
+		}
+		seen[f] = true
+		res = append(res, f)
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("no export format")
+	}
+	return res, nil
+}
+
+// Extension returns the file name extension of a format.
+func (f Format) Extension() string {
+	return string(f)
+}
+
+// ContentType returns the MIME type of a format.
+func (f Format) ContentType() string {
+	if f == FormatParquet {
+		return "application/vnd.apache.parquet"
+	}
+	return "application/x-ndjson"
+}
+
+// Writer writes records to a file. Close flushes the records, it does not close the file.
+type Writer interface {
+	Write(recs ...Record) error
+	Close() error
+}
+
+// NewWriter returns the writer of a format.
+func NewWriter(w io.Writer, f Format) (Writer, error) {
+	switch f {
+	case FormatNDJSON:
+		bw := bufio.NewWriter(w)
+		return &ndjsonWriter{w: bw, enc: json.NewEncoder(bw)}, nil
+	case FormatParquet:
+		return &parquetWriter{w: parquet.NewGenericWriter[Record](w, parquet.Compression(&parquet.Snappy))}, nil
+	}
+	return nil, fmt.Errorf("unsupported export format: %s", f)
+}
+
+// ndjsonWriter writes a JSON record per line, the BigQuery NEWLINE_DELIMITED_JSON format.
+type ndjsonWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (n *ndjsonWriter) Write(recs ...Record) error {
+	for _, r := range recs {
+		r.normalize()
+		if err := n.enc.Encode(r); err != nil {
+			return fmt.Errorf("failed to write record (%s): %w", r.Hash, err)
+		}
+	}
+	return nil
+}
+
+func (n *ndjsonWriter) Close() error {
+	return n.w.Flush()
+}
+
+// parquetWriter writes snappy compressed Parquet row groups.
+type parquetWriter struct {
+	w *parquet.GenericWriter[Record]
+}
+
+func (p *parquetWriter) Write(recs ...Record) error {
+	for i := range recs {
+		recs[i].normalize()
+	}
+	if _, err := p.w.Write(recs); err != nil {
+		return fmt.Errorf("failed to write %d records: %w", len(recs), err)
+	}
+	return nil
+}
+
+func (p *parquetWriter) Close() error {
+	return p.w.Close()
+}
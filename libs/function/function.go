@@ -0,0 +1,94 @@
+// Package function is the scaffolding of the cloud functions triggered by the Finalize events of a
+// storage bucket, the nlp-worker and the converter: instance setup, client reuse across
+// invocations, event decoding and error records.
+package function
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/logging"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/telemetry"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+	"github.com/googleapis/google-cloudevents-go/cloud/storagedata"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// EventFinalized is the type of the storage Finalize events.
+const EventFinalized = "google.cloud.storage.object.v1.finalized"
+
+// ErrorWriteTimeout bounds the error record writes, performed once the invocation budget is spent.
+const ErrorWriteTimeout = 10 * time.Second
+
+// Init sets up the logging and tracing of the function instance of app, and registers handler as
+// its Handler entrypoint.
+func Init(app string, handler func(context.Context, event.Event) error) {
+	logging.Init(app)
+	if _, err := telemetry.Init(context.Background(), app); err != nil {
+		log.Error().Err(err).Caller().Msg("failed to init tracing")
+	}
+	functions.CloudEvent("Handler", handler)
+}
+
+// Flush exports the spans of the invocation before the instance is frozen. Errors are logged.
+func Flush(ctx context.Context) {
+	if err := telemetry.Flush(context.WithoutCancel(ctx)); err != nil {
+		log.Error().Err(err).Caller().Msg("failed to flush spans")
+	}
+}
+
+// DecodeFinalized returns the object of a storage Finalize event.
+func DecodeFinalized(e event.Event) (*storagedata.StorageObjectData, error) {
+	if e.Type() != EventFinalized {
+		return nil, fmt.Errorf("unsupported event type: %s", e.Type())
+	}
+	var data storagedata.StorageObjectData
+	if err := protojson.Unmarshal(e.Data(), &data); err != nil {
+		return nil, fmt.Errorf("protojson.Unmarshal: %w", err)
+	}
+	return &data, nil
+}
+
+// StorageClient is the storage client of an instance, created by the first invocation and reused
+// by the next ones. Failed creations are retried by the next invocation.
+type StorageClient struct {
+	mu sync.Mutex
+	c  *storage.Client
+}
+
+// Get returns the storage client, creating it on first use.
+func (s *StorageClient) Get() (*storage.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.c == nil {
+		// the client outlives the invocation that creates it
+		c, err := storage.NewClient(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create storage client: %w", err)
+		}
+		s.c = c
+	}
+	return s.c, nil
+}
+
+// RecordError writes the error record of the object bucket/name, failed at stage, to the err
+// bucket b under the object name. The write outlives the invocation budget, so that timeouts are
+// recorded too. Write failures are logged.
+func RecordError(ctx context.Context, b *storage.BucketHandle, stage, bucket, name string, gen int64, msg string, err error) {
+	wctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ErrorWriteTimeout)
+	defer cancel()
+
+	r := types.NewErrorRecord(stage, bucket, name, gen, msg, err)
+	if werr := types.WriteErrorRecord(wctx, b.Object(name), r); werr != nil {
+		log.Error().Err(werr).Caller().Str(logging.FieldObject, name).Msg("failed to write error record")
+	}
+}
@@ -0,0 +1,37 @@
+package function
+
+import (
+	"testing"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+func TestDecodeFinalized(t *testing.T) {
+	tests := map[string]struct {
+		typ    string
+		data   string
+		expect string
+		err    bool
+	}{
+		"finalized":    {typ: EventFinalized, data: `{"bucket": "ocr", "name": "1/0/a-0.json"}`, expect: "ocr/1/0/a-0.json"},
+		"deleted":      {typ: "google.cloud.storage.object.v1.deleted", data: `{"bucket": "ocr", "name": "1/0/a-0.json"}`, err: true},
+		"invalid data": {typ: EventFinalized, data: `{"bucket": 1}`, err: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			e := event.New()
+			e.SetType(tc.typ)
+			if err := e.SetData(event.ApplicationJSON, []byte(tc.data)); err != nil {
+				t.Fatal(err)
+			}
+			data, err := DecodeFinalized(e)
+			if (err != nil) != tc.err {
+				t.Fatalf("expected: error %v, result: %v", tc.err, err)
+			}
+			if err == nil && data.GetBucket()+"/"+data.GetName() != tc.expect {
+				t.Fatalf("expected: %s, result: %s/%s", tc.expect, data.GetBucket(), data.GetName())
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package ingest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"io"
+
+	// Import image format packages
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/utils"
+)
+
+// Describe returns the image document of the image content b, named name: its SHA-256 hash, mime
+// type and dimensions. ImagePaths is left empty.
+func Describe(name string, b []byte) (types.ImageDocument, error) {
+	mimeType, err := utils.GetMimeTypeFromExt(name)
+	if err != nil {
+		return types.ImageDocument{}, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return types.ImageDocument{}, fmt.Errorf("failed to decode image (%s): %w", name, err)
+	}
+	width := img.Bounds().Max.X
+	height := img.Bounds().Max.Y
+
+	sum := sha256.Sum256(b)
+	return types.ImageDocument{
+		Hash:     hex.EncodeToString(sum[:]),
+		MimeType: mimeType,
+		Width:    width,
+		Height:   height,
+		Pixels:   width * height,
+		Size:     int64(len(b)),
+	}, nil
+}
+
+// ReadFile reads the content of a source file.
+func ReadFile(f File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open (%s): %w", f.Path, err)
+	}
+	defer r.Close()
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read (%s): %w", f.Path, err)
+	}
+	return b, nil
+}
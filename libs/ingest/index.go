@@ -0,0 +1,86 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+)
+
+// IndexFile is the name of the image index in a local output tree.
+const IndexFile = "images.json"
+
+// Image is a unique image of a local source. ImagePaths are the source paths of its copies.
+type Image = types.ImageDocument
+
+// Index hashes the images of src matching pattern and returns one image document per unique
+// image, sorted by hash, with the source paths of all its copies. Empty files and images that
+// cannot be decoded are logged and skipped.
+func Index(src, pattern string) ([]Image, error) {
+	byHash := map[string]*Image{}
+	err := Walk(src, pattern, func(f File) error {
+		if f.Size == 0 {
+			log.Debug().Str("path", f.Path).Msg("skip empty")
+			return nil
+		}
+		b, err := ReadFile(f)
+		if err != nil {
+			return err
+		}
+		d, err := Describe(f.Path, b)
+		if err != nil {
+			log.Error().Err(err).Caller().Str("path", f.Path).Msg("failed to describe image")
+			return nil
+		}
+
+		if e, ok := byHash[d.Hash]; ok {
+			if !slices.Contains(e.ImagePaths, f.Path) {
+				e.ImagePaths = append(e.ImagePaths, f.Path)
+			}
+			return nil
+		}
+		d.ImagePaths = []string{f.Path}
+		byHash[d.Hash] = &d
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]Image, 0, len(byHash))
+	for _, d := range byHash {
+		docs = append(docs, *d)
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].Hash < docs[j].Hash })
+	return docs, nil
+}
+
+// WriteIndex writes the image index to path, as JSON.
+func WriteIndex(path string, docs []Image) error {
+	b, err := json.MarshalIndent(docs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode index: %w", err)
+	}
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		return fmt.Errorf("failed to write index (%s): %w", path, err)
+	}
+	return nil
+}
+
+// ReadIndex reads an image index written by WriteIndex.
+func ReadIndex(path string) ([]Image, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index (%s): %w", path, err)
+	}
+	var docs []Image
+	if err := json.Unmarshal(b, &docs); err != nil {
+		return nil, fmt.Errorf("failed to parse index (%s): %w", path, err)
+	}
+	return docs, nil
+}
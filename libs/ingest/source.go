@@ -0,0 +1,174 @@
+// Package ingest reads images from local sources, a directory or a tar or zip archive, so that the
+// pipeline can run without a src bucket.
+package ingest
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// File is a regular file of a local source.
+type File struct {
+	// Path is the slash separated path of the file, relative to the source root.
+	Path string
+	Size int64
+	// Open opens the file content. Files of tar archives can only be opened during the WalkFunc call.
+	Open func() (io.ReadCloser, error)
+}
+
+// WalkFunc is called for each file of a source, in lexical order for directories and in archive
+// order for archives. Returning an error stops the walk.
+type WalkFunc func(f File) error
+
+// Walk calls fn for each regular file of src matching the glob pattern, e.g. `**/*.jpg`. src is a
+// directory, or a .tar, .tar.gz, .tgz or .zip archive. An empty pattern matches every file.
+func Walk(src string, pattern string, fn WalkFunc) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("failed to stat source (%s): %w", src, err)
+	}
+
+	match := func(p string) bool {
+		return pattern == "" || Match(pattern, p)
+	}
+
+	name := strings.ToLower(src)
+	switch {
+	case info.IsDir():
+		return walkDir(src, match, fn)
+	case strings.HasSuffix(name, ".zip"):
+		return walkZip(src, match, fn)
+	case strings.HasSuffix(name, ".tar"), strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return walkTar(src, match, fn)
+	}
+	return fmt.Errorf("unsupported source, expected a directory or a tar or zip archive: %s", src)
+}
+
+func walkDir(root string, match func(string) bool, fn WalkFunc) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !match(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(File{
+			Path: rel,
+			Size: info.Size(),
+			Open: func() (io.ReadCloser, error) { return os.Open(p) },
+		})
+	})
+}
+
+func walkZip(src string, match func(string) bool, fn WalkFunc) error {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return fmt.Errorf("failed to open zip archive (%s): %w", src, err)
+	}
+	defer r.Close()
+
+	for _, zf := range r.File {
+		p, ok := entryPath(zf.Name)
+		if !ok || !zf.Mode().IsRegular() || !match(p) {
+			continue
+		}
+		if err := fn(File{Path: p, Size: int64(zf.UncompressedSize64), Open: zf.Open}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkTar(src string, match func(string) bool, fn WalkFunc) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open tar archive (%s): %w", src, err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if name := strings.ToLower(src); strings.HasSuffix(name, ".gz") || strings.HasSuffix(name, ".tgz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("failed to open gzip stream (%s): %w", src, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar archive (%s): %w", src, err)
+		}
+		p, ok := entryPath(h.Name)
+		if !ok || h.Typeflag != tar.TypeReg || !match(p) {
+			continue
+		}
+		if err := fn(File{Path: p, Size: h.Size, Open: func() (io.ReadCloser, error) { return io.NopCloser(tr), nil }}); err != nil {
+			return err
+		}
+	}
+}
+
+// entryPath returns the cleaned path of an archive entry. ok is false for entries outside of the
+// archive root.
+func entryPath(name string) (string, bool) {
+	p := path.Clean(strings.TrimPrefix(filepath.ToSlash(name), "/"))
+	if p == "." || p == ".." || strings.HasPrefix(p, "../") {
+		return "", false
+	}
+	return p, true
+}
+
+// Match reports whether the slash separated path p matches the glob pattern. `**` matches any
+// number of directories, the other wildcards follow path.Match.
+func Match(pattern, p string) bool {
+	return matchParts(strings.Split(pattern, "/"), strings.Split(p, "/"))
+}
+
+func matchParts(pattern, parts []string) bool {
+	if len(pattern) == 0 {
+		return len(parts) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if matchParts(pattern[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	if ok, err := path.Match(pattern[0], parts[0]); err != nil || !ok {
+		return false
+	}
+	return matchParts(pattern[1:], parts[1:])
+}
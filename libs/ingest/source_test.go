@@ -0,0 +1,157 @@
+package ingest
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := map[string]struct {
+		pattern string
+		path    string
+		expect  bool
+	}{
+		"root":      {pattern: "**/*.jpg", path: "a.jpg", expect: true},
+		"nested":    {pattern: "**/*.jpg", path: "a/b/c.jpg", expect: true},
+		"extension": {pattern: "**/*.jpg", path: "a/b/c.png", expect: false},
+		"dir":       {pattern: "scans/*.png", path: "scans/a.png", expect: true},
+		"depth":     {pattern: "scans/*.png", path: "scans/x/a.png", expect: false},
+		"middle":    {pattern: "scans/**/a.png", path: "scans/x/y/a.png", expect: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if res := Match(tc.pattern, tc.path); res != tc.expect {
+				t.Fatalf("expected: %v, result: %v", tc.expect, res)
+			}
+		})
+	}
+}
+
+// testImage returns a png image of the given width.
+func testImage(t *testing.T, width int) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, 2))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWalk(t *testing.T) {
+	files := map[string][]byte{
+		"a.png":       testImage(t, 1),
+		"x/b.png":     testImage(t, 2),
+		"x/notes.txt": []byte("notes"),
+	}
+	expect := []string{"a.png", "x/b.png"}
+
+	dir := t.TempDir()
+
+	// directory
+	src := filepath.Join(dir, "src")
+	for p, b := range files {
+		name := filepath.Join(src, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// zip
+	var zbuf bytes.Buffer
+	zw := zip.NewWriter(&zbuf)
+	for _, p := range []string{"a.png", "x/b.png", "x/notes.txt"} {
+		w, err := zw.Create(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(files[p])
+	}
+	zw.Close()
+	zipPath := filepath.Join(dir, "src.zip")
+	os.WriteFile(zipPath, zbuf.Bytes(), 0o644)
+
+	// tar, with an entry outside of the root
+	var tbuf bytes.Buffer
+	tw := tar.NewWriter(&tbuf)
+	for _, p := range []string{"a.png", "x/b.png", "x/notes.txt", "../evil.png"} {
+		b := files[p]
+		if b == nil {
+			b = files["a.png"]
+		}
+		tw.WriteHeader(&tar.Header{Name: p, Mode: 0o644, Size: int64(len(b)), Typeflag: tar.TypeReg})
+		tw.Write(b)
+	}
+	tw.Close()
+	tarPath := filepath.Join(dir, "src.tar")
+	os.WriteFile(tarPath, tbuf.Bytes(), 0o644)
+
+	for _, src := range []string{src, zipPath, tarPath} {
+		t.Run(filepath.Base(src), func(t *testing.T) {
+			var res []string
+			err := Walk(src, "**/*.png", func(f File) error {
+				b, err := ReadFile(f)
+				if err != nil {
+					return err
+				}
+				if !bytes.Equal(b, files[f.Path]) {
+					t.Fatalf("unexpected content: %s", f.Path)
+				}
+				res = append(res, f.Path)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(expect, res) {
+				t.Fatalf("expected: %v, result: %v", expect, res)
+			}
+		})
+	}
+
+	if err := Walk(filepath.Join(src, "a.png"), "", func(File) error { return nil }); err == nil {
+		t.Fatal("expected an unsupported source error")
+	}
+}
+
+func TestIndex(t *testing.T) {
+	src := t.TempDir()
+	img := testImage(t, 3)
+	for _, p := range []string{"a.png", "b.png"} {
+		os.WriteFile(filepath.Join(src, p), img, 0o644)
+	}
+	os.WriteFile(filepath.Join(src, "c.png"), testImage(t, 4), 0o644)
+	// not an image
+	os.WriteFile(filepath.Join(src, "d.png"), []byte("png"), 0o644)
+
+	res, err := Index(src, "*.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 {
+		t.Fatalf("expected: 2 images, result: %+v", res)
+	}
+	for _, d := range res {
+		switch d.Width {
+		case 3:
+			if !reflect.DeepEqual([]string{"a.png", "b.png"}, d.ImagePaths) || d.Pixels != 6 || d.MimeType != "image/png" {
+				t.Fatalf("unexpected duplicate image: %+v", d)
+			}
+		case 4:
+			if !reflect.DeepEqual([]string{"c.png"}, d.ImagePaths) {
+				t.Fatalf("unexpected image: %+v", d)
+			}
+		default:
+			t.Fatalf("unexpected image: %+v", d)
+		}
+	}
+}
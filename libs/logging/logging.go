@@ -0,0 +1,141 @@
+// Package logging sets up the zerolog logger shared by all the apps, so that log formats, levels
+// and field names are the same across the pipeline.
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	stdlog "log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-isatty"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/utils"
+)
+
+// Standard field names. Use them rather than ad-hoc names so that log-based alerts match across apps.
+const (
+	FieldApp     = "app"
+	FieldRunID   = "run_id"
+	FieldBatchID = "batch_id"
+	FieldHash    = "hash"
+	FieldObject  = "object"
+)
+
+// Log formats.
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+// Config is the logger configuration.
+type Config struct {
+	App    string
+	RunID  string
+	Level  zerolog.Level
+	Format string
+}
+
+// GetConfig reads the logger configuration from the environment:
+//
+//	LOG_LEVEL   trace, debug, info, warn or error. Defaults to debug when DEBUG is true, info otherwise.
+//	LOG_FORMAT  json or console. Defaults to console on a terminal, json otherwise (e.g. Cloud Run).
+//	RUN_ID      identifies the run across processes. Defaults to a random id.
+func GetConfig(app string) Config {
+	level := zerolog.InfoLevel
+	if utils.GetBoolEnvVar("DEBUG", false) {
+		level = zerolog.DebugLevel
+	}
+	if v := utils.GetStrEnvVar("LOG_LEVEL", ""); v != "" {
+		if l, err := zerolog.ParseLevel(strings.ToLower(v)); err == nil && l != zerolog.NoLevel {
+			level = l
+		}
+	}
+
+	format := FormatJSON
+	if isatty.IsTerminal(os.Stdout.Fd()) {
+		format = FormatConsole
+	}
+	format = utils.GetStrEnvVar("LOG_FORMAT", format)
+
+	runID := utils.GetStrEnvVar("RUN_ID", "")
+	if runID == "" {
+		runID = newRunID()
+	}
+
+	return Config{
+		App:    app,
+		RunID:  runID,
+		Level:  level,
+		Format: format,
+	}
+}
+
+// Init configures the global zerolog logger from the environment (see GetConfig) and redirects the
+// standard library logger to it.
+func Init(app string) zerolog.Logger {
+	return InitWithConfig(GetConfig(app))
+}
+
+// InitWithConfig configures the global zerolog logger and redirects the standard library logger to it.
+func InitWithConfig(cfg Config) zerolog.Logger {
+	zerolog.SetGlobalLevel(cfg.Level)
+
+	var l zerolog.Logger
+	if cfg.Format == FormatConsole {
+		l = zerolog.New(zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.TimeOnly})
+	} else {
+		// https://cloud.google.com/logging/docs/structured-logging#special-payload-fields
+		zerolog.TimeFieldFormat = time.RFC3339Nano
+		zerolog.LevelFieldName = "severity"
+		zerolog.LevelFieldMarshalFunc = Severity
+		l = zerolog.New(os.Stdout)
+	}
+
+	l = l.With().
+		Timestamp().
+		Str(FieldApp, cfg.App).
+		Str(FieldRunID, cfg.RunID).
+		Logger()
+	log.Logger = l
+	// loggers retrieved from a context without one, see zerolog.Ctx
+	zerolog.DefaultContextLogger = &log.Logger
+
+	// route the standard library logger, used by some dependencies, through zerolog
+	stdlog.SetFlags(0)
+	stdlog.SetOutput(l)
+
+	return l
+}
+
+// Severity maps a zerolog level to a Cloud Logging severity.
+func Severity(l zerolog.Level) string {
+	switch l {
+	case zerolog.TraceLevel, zerolog.DebugLevel:
+		return "DEBUG"
+	case zerolog.InfoLevel:
+		return "INFO"
+	case zerolog.WarnLevel:
+		return "WARNING"
+	case zerolog.ErrorLevel:
+		return "ERROR"
+	case zerolog.FatalLevel:
+		return "CRITICAL"
+	case zerolog.PanicLevel:
+		return "ALERT"
+	default:
+		return "DEFAULT"
+	}
+}
+
+func newRunID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestSeverity(t *testing.T) {
+	tests := map[string]struct {
+		level  zerolog.Level
+		expect string
+	}{
+		"trace": {level: zerolog.TraceLevel, expect: "DEBUG"},
+		"debug": {level: zerolog.DebugLevel, expect: "DEBUG"},
+		"info":  {level: zerolog.InfoLevel, expect: "INFO"},
+		"warn":  {level: zerolog.WarnLevel, expect: "WARNING"},
+		"error": {level: zerolog.ErrorLevel, expect: "ERROR"},
+		"fatal": {level: zerolog.FatalLevel, expect: "CRITICAL"},
+		"none":  {level: zerolog.NoLevel, expect: "DEFAULT"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			res := Severity(tc.level)
+			if !reflect.DeepEqual(tc.expect, res) {
+				t.Fatalf("expected: %v, result: %v", tc.expect, res)
+			}
+		})
+	}
+}
+
+func TestGetConfigLevel(t *testing.T) {
+	tests := map[string]struct {
+		env    map[string]string
+		expect zerolog.Level
+	}{
+		// nothing set
+		"default": {expect: zerolog.InfoLevel},
+		// DEBUG enables debug logs
+		"debug": {env: map[string]string{"DEBUG": "true"}, expect: zerolog.DebugLevel},
+		// LOG_LEVEL takes precedence over DEBUG
+		"level": {env: map[string]string{"DEBUG": "true", "LOG_LEVEL": "WARN"}, expect: zerolog.WarnLevel},
+		// invalid LOG_LEVEL is ignored
+		"invalid": {env: map[string]string{"LOG_LEVEL": "loud"}, expect: zerolog.InfoLevel},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			for k, v := range tc.env {
+				os.Setenv(k, v)
+				defer os.Unsetenv(k)
+			}
+			res := GetConfig("test").Level
+			if !reflect.DeepEqual(tc.expect, res) {
+				t.Fatalf("expected: %v, result: %v", tc.expect, res)
+			}
+		})
+	}
+}
@@ -0,0 +1,398 @@
+// Package nlp analyzes the text of Document AI documents with the Natural Language API.
+package nlp
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rs/zerolog"
+
+	"cloud.google.com/go/documentai/apiv1/documentaipb"
+	language "cloud.google.com/go/language/apiv1"
+	"cloud.google.com/go/language/apiv1/languagepb"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/telemetry"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Analyses, see NLP_ANALYSES.
+const (
+	AnalysisEntities        = "entities"
+	AnalysisEntitySentiment = "entity_sentiment"
+	AnalysisSentiment       = "sentiment"
+	AnalysisClassify        = "classify"
+	AnalysisSyntax          = "syntax"
+	AnalysisPII             = "pii"
+)
+
+var supportedAnalyses = []string{AnalysisEntities, AnalysisEntitySentiment, AnalysisSentiment, AnalysisClassify, AnalysisSyntax, AnalysisPII}
+
+// Options controls the analysis of a document.
+type Options struct {
+	Language LanguageOptions
+	Filter   FilterOptions
+	// Analyses are the analyses performed, see NLP_ANALYSES.
+	Analyses []string
+	// MaxChunkBytes is the largest text sent in a single language API request.
+	MaxChunkBytes int
+}
+
+// Result is the result of the analysis of a document.
+type Result struct {
+	// Analyses are the analyses performed.
+	Analyses []string
+	// Languages are the languages detected by OCR, by decreasing confidence.
+	Languages  []types.LanguageScore
+	Segments   []types.NLPSegment
+	Entities   []*languagepb.Entity
+	Sentiment  *languagepb.Sentiment
+	Categories []*languagepb.ClassificationCategory
+	Sentences  []*languagepb.Sentence
+	Tokens     []*languagepb.Token
+	PII        []types.PIIMatch
+	Filter     *types.NLPFilterStats
+}
+
+// features returns the language API features of the analyses. nil when none of the analyses
+// uses the language API.
+func features(analyses []string) *languagepb.AnnotateTextRequest_Features {
+	f := &languagepb.AnnotateTextRequest_Features{}
+	for _, a := range analyses {
+		switch a {
+		case AnalysisEntities:
+			f.ExtractEntities = true
+		case AnalysisEntitySentiment:
+			f.ExtractEntitySentiment = true
+		case AnalysisSentiment:
+			f.ExtractDocumentSentiment = true
+		case AnalysisClassify:
+			f.ClassifyText = true
+		case AnalysisSyntax:
+			f.ExtractSyntax = true
+		}
+	}
+	if !f.ExtractEntities && !f.ExtractEntitySentiment && !f.ExtractDocumentSentiment && !f.ClassifyText && !f.ExtractSyntax {
+		return nil
+	}
+	return f
+}
+
+// Analyze runs the analyses of each language segment of doc, see splitSegments. Segments
+// larger than MaxChunkBytes are analyzed in chunks, see splitChunks, and the results of all the
+// chunks are merged. Chunks are filtered, see filterText, before analysis. Offsets are UTF-8 byte
+// offsets in the document text.
+func Analyze(ctx context.Context, nlp *language.Client, doc *documentaipb.Document, o Options) (Result, error) {
+	logger := zerolog.Ctx(ctx)
+	text := doc.GetText()
+	offsets := byteOffsets(text)
+	boundaries := textBoundaries(doc, offsets)
+
+	res := Result{Analyses: o.Analyses, Languages: AggregateLanguages(doc)}
+
+	// personal data is detected in the whole text, headers and footers included
+	if slices.Contains(o.Analyses, AnalysisPII) {
+		res.PII = detectPII(text)
+	}
+
+	f := features(o.Analyses)
+	if f == nil {
+		return res, nil
+	}
+
+	res.Filter = &types.NLPFilterStats{}
+	dropped := droppedRanges(doc, offsets, o.Filter, res.Filter)
+
+	var entities []*languagepb.Entity
+	var sentiment weightedSentiment
+	for _, s := range splitSegments(doc, o.Language) {
+		seg := types.NLPSegment{
+			DetectedLanguage: s.Language,
+			Pages:            s.Pages,
+			Offset:           offsets[s.Start],
+			Length:           offsets[s.End] - offsets[s.Start],
+		}
+		res.Filter.TextBytes += seg.Length
+
+		lang, skipped := resolveLanguage(s.Language, o.Language)
+		if skipped != "" {
+			logger.Info().Ints("pages", s.Pages).Str("reason", skipped).Msg("segment skipped")
+			seg.Skipped = skipped
+			res.Segments = append(res.Segments, seg)
+			continue
+		}
+
+		var chunkRes []chunkResult
+		for _, c := range splitChunks(text, seg.Offset, seg.Offset+seg.Length, boundaries, o.MaxChunkBytes) {
+			content, orig := filterText(text, c.Start, c.End, dropped, o.Filter.Normalize)
+			if strings.TrimSpace(content) == "" {
+				continue
+			}
+			res.Filter.AnalyzedBytes += len(content)
+
+			resp, err := annotateText(ctx, nlp, content, lang, f)
+			if isUnsupportedLanguage(err) {
+				// auto-detected languages may not be supported either. The analyses the language
+				// supports are performed, see annotateText: none is.
+				seg.Skipped = status.Convert(err).Message()
+				break
+			}
+			if err != nil {
+				return res, err
+			}
+			chunkRes = append(chunkRes, chunkResult{orig: orig, resp: resp})
+		}
+		if seg.Skipped == "" && len(chunkRes) == 0 {
+			seg.Skipped = "no text"
+		}
+		if seg.Skipped != "" {
+			logger.Info().Ints("pages", s.Pages).Str("reason", seg.Skipped).Msg("segment skipped")
+			res.Segments = append(res.Segments, seg)
+			continue
+		}
+
+		var segSentiment weightedSentiment
+		for _, cr := range chunkRes {
+			resp := cr.resp
+			if seg.Language == "" {
+				seg.Language = resp.GetLanguage()
+			}
+			remapMentions(resp.GetEntities(), cr.orig)
+			entities = append(entities, resp.GetEntities()...)
+			res.Categories = append(res.Categories, resp.GetCategories()...)
+
+			// syntax offsets and token indexes are relative to the chunk
+			remapSyntax(resp, cr.orig, len(res.Tokens))
+			res.Sentences = append(res.Sentences, resp.GetSentences()...)
+			res.Tokens = append(res.Tokens, resp.GetTokens()...)
+
+			if s := resp.GetDocumentSentiment(); s != nil {
+				segSentiment.add(s, len(cr.orig)-1)
+				sentiment.add(s, len(cr.orig)-1)
+			}
+		}
+		seg.Chunks = len(chunkRes)
+		seg.Sentiment = segSentiment.sentiment()
+		res.Segments = append(res.Segments, seg)
+	}
+
+	res.Entities = mergeEntities(entities)
+	res.Categories = mergeCategories(res.Categories)
+	res.Sentiment = sentiment.sentiment()
+	return res, nil
+}
+
+// Output returns the output document of the analysis. The fields identifying the document, e.g.
+// Hash, are left to the caller.
+func (r Result) Output() types.NLPOutput {
+	out := types.NLPOutput{
+		Analyses:    r.Analyses,
+		Languages:   r.Languages,
+		Filter:      r.Filter,
+		Segments:    r.Segments,
+		Entities:    r.Entities,
+		Sentiment:   r.Sentiment,
+		Categories:  r.Categories,
+		Sentences:   r.Sentences,
+		Tokens:      r.Tokens,
+		ContainsPII: len(r.PII) > 0,
+		PIICounts:   CountPII(r.PII),
+		PII:         r.PII,
+	}
+	if len(r.Languages) > 0 {
+		out.Language = r.Languages[0].Code
+	}
+	return out
+}
+
+// chunkResult is the language API response of a filtered chunk. orig maps the offsets of the
+// filtered chunk to the document text, see filterText.
+type chunkResult struct {
+	orig []int
+	resp *languagepb.AnnotateTextResponse
+}
+
+// annotateText performs the analyses of a text. An empty language lets the language API detect it.
+// Texts too short to be classified are annotated again without classification, and texts in a
+// language some analyses do not support are annotated again without them, see dropUnsupported.
+func annotateText(ctx context.Context, nlp *language.Client, content, lang string, f *languagepb.AnnotateTextRequest_Features) (*languagepb.AnnotateTextResponse, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "language.annotate_text",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("language.code", lang), attribute.Int("language.content_bytes", len(content))),
+	)
+	defer span.End()
+
+	req := &languagepb.AnnotateTextRequest{
+		Document: &languagepb.Document{
+			// https://pkg.go.dev/cloud.google.com/go/language/apiv1/languagepb#Document_Type
+			Type: languagepb.Document_PLAIN_TEXT,
+			Source: &languagepb.Document_Content{
+				Content: content,
+			},
+			Language: lang,
+		},
+		Features: f,
+		// offsets are byte offsets, see shiftMentions
+		EncodingType: languagepb.EncodingType_UTF8,
+	}
+
+	for {
+		resp, err := nlp.AnnotateText(ctx, req)
+		if req.Features.ClassifyText && isUnclassifiable(err) {
+			nf := proto.Clone(req.Features).(*languagepb.AnnotateTextRequest_Features)
+			nf.ClassifyText = false
+			req.Features = nf
+			continue
+		}
+		if isUnsupportedLanguage(err) {
+			if nf := dropUnsupported(req.Features, err); nf != nil {
+				zerolog.Ctx(ctx).Info().Str("language", lang).Str("reason", status.Convert(err).Message()).Msg("analysis not supported, retrying without it")
+				req.Features = nf
+				continue
+			}
+		}
+		return resp, err
+	}
+}
+
+// dropUnsupported returns the features f without the one the unsupported language error err is
+// about, or without all but entity extraction when err does not tell. nil when entity extraction
+// itself is unsupported or no feature is left.
+func dropUnsupported(f *languagepb.AnnotateTextRequest_Features, err error) *languagepb.AnnotateTextRequest_Features {
+	nf := proto.Clone(f).(*languagepb.AnnotateTextRequest_Features)
+	msg := strings.ToLower(status.Convert(err).Message())
+	switch {
+	case strings.Contains(msg, "entity_sentiment") || strings.Contains(msg, "entity sentiment"):
+		nf.ExtractEntitySentiment = false
+	case strings.Contains(msg, "sentiment"):
+		nf.ExtractDocumentSentiment = false
+	case strings.Contains(msg, "classif"):
+		nf.ClassifyText = false
+	case strings.Contains(msg, "syntax"):
+		nf.ExtractSyntax = false
+	case strings.Contains(msg, "entit"):
+		return nil
+	default:
+		nf = &languagepb.AnnotateTextRequest_Features{ExtractEntities: f.ExtractEntities}
+	}
+	if proto.Equal(nf, f) || !(nf.ExtractEntities || nf.ExtractEntitySentiment || nf.ExtractDocumentSentiment || nf.ClassifyText || nf.ExtractSyntax) {
+		return nil
+	}
+	return nf
+}
+
+// isUnsupportedLanguage reports whether err is the language API rejecting the document language.
+func isUnsupportedLanguage(err error) bool {
+	s, ok := status.FromError(err)
+	return ok && s.Code() == codes.InvalidArgument && strings.Contains(s.Message(), "not supported")
+}
+
+// isUnclassifiable reports whether err is the language API rejecting a text too short to classify.
+func isUnclassifiable(err error) bool {
+	s, ok := status.FromError(err)
+	return ok && s.Code() == codes.InvalidArgument && strings.Contains(s.Message(), "too few tokens")
+}
+
+// remapOffset maps a text span offset of a filtered chunk to the document text.
+func remapOffset(s *languagepb.TextSpan, orig []int) {
+	if s != nil {
+		s.BeginOffset = int32(orig[min(max(int(s.GetBeginOffset()), 0), len(orig)-1)])
+	}
+}
+
+// remapMentions maps the mention offsets of entities to the document text.
+func remapMentions(entities []*languagepb.Entity, orig []int) {
+	for _, e := range entities {
+		for _, m := range e.GetMentions() {
+			remapOffset(m.GetText(), orig)
+		}
+	}
+}
+
+// remapSyntax maps the sentence and token offsets of resp to the document text, and adds tokens
+// to the dependency head token indexes.
+func remapSyntax(resp *languagepb.AnnotateTextResponse, orig []int, tokens int) {
+	for _, s := range resp.GetSentences() {
+		remapOffset(s.GetText(), orig)
+	}
+	for _, t := range resp.GetTokens() {
+		remapOffset(t.GetText(), orig)
+		if t.GetDependencyEdge() != nil {
+			t.DependencyEdge.HeadTokenIndex += int32(tokens)
+		}
+	}
+}
+
+// weightedSentiment averages sentiment scores weighted by text length, and sums magnitudes.
+type weightedSentiment struct {
+	score     float64
+	magnitude float32
+	weight    int
+}
+
+func (w *weightedSentiment) add(s *languagepb.Sentiment, weight int) {
+	w.score += float64(s.GetScore()) * float64(weight)
+	w.magnitude += s.GetMagnitude()
+	w.weight += weight
+}
+
+func (w *weightedSentiment) sentiment() *languagepb.Sentiment {
+	if w.weight == 0 {
+		return nil
+	}
+	return &languagepb.Sentiment{Score: float32(w.score / float64(w.weight)), Magnitude: w.magnitude}
+}
+
+// mergeCategories keeps the highest confidence of each category, sorted by decreasing confidence.
+func mergeCategories(categories []*languagepb.ClassificationCategory) []*languagepb.ClassificationCategory {
+	var merged []*languagepb.ClassificationCategory
+	index := map[string]*languagepb.ClassificationCategory{}
+	for _, c := range categories {
+		if m, ok := index[c.GetName()]; ok {
+			m.Confidence = max(m.GetConfidence(), c.GetConfidence())
+			continue
+		}
+		index[c.GetName()] = c
+		merged = append(merged, c)
+	}
+	slices.SortStableFunc(merged, func(a, b *languagepb.ClassificationCategory) int {
+		switch {
+		case a.GetConfidence() > b.GetConfidence():
+			return -1
+		case a.GetConfidence() < b.GetConfidence():
+			return 1
+		}
+		return 0
+	})
+	return merged
+}
+
+// ParseAnalyses validates the analyses of NLP_ANALYSES.
+func ParseAnalyses(analyses []string) ([]string, error) {
+	var ret []string
+	for _, a := range analyses {
+		a = strings.ToLower(a)
+		if !slices.Contains(supportedAnalyses, a) {
+			return nil, fmt.Errorf("unsupported analysis: %s", a)
+		}
+		if !slices.Contains(ret, a) {
+			ret = append(ret, a)
+		}
+	}
+	return ret, nil
+}
+
+// byteOffsets returns the byte offset of each rune of s, followed by len(s).
+func byteOffsets(s string) []int {
+	offsets := make([]int, 0, utf8.RuneCountInString(s)+1)
+	for i := range s {
+		offsets = append(offsets, i)
+	}
+	return append(offsets, len(s))
+}
@@ -0,0 +1,90 @@
+package nlp
+
+import (
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/language/apiv1/languagepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestParseAnalyses(t *testing.T) {
+	res, err := ParseAnalyses([]string{"entities", "PII", "entities"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []string{AnalysisEntities, AnalysisPII}; !reflect.DeepEqual(expect, res) {
+		t.Fatalf("expected: %v, result: %v", expect, res)
+	}
+	if _, err := ParseAnalyses([]string{"moderate"}); err == nil {
+		t.Fatal("expected an error for an unsupported analysis")
+	}
+}
+
+func TestFeatures(t *testing.T) {
+	// pii only. the language API is not called
+	if f := features([]string{AnalysisPII}); f != nil {
+		t.Fatalf("expected: no features, result: %v", f)
+	}
+	f := features([]string{AnalysisEntitySentiment, AnalysisClassify})
+	if f == nil || !f.ExtractEntitySentiment || !f.ClassifyText || f.ExtractEntities || f.ExtractSyntax {
+		t.Fatalf("expected: entity sentiment and classification, result: %v", f)
+	}
+}
+
+func TestDropUnsupported(t *testing.T) {
+	all := features([]string{AnalysisEntities, AnalysisEntitySentiment, AnalysisSentiment, AnalysisClassify, AnalysisSyntax})
+	unsupported := func(feature string) error {
+		return status.Errorf(codes.InvalidArgument, "The language xx is not supported for %s analysis.", feature)
+	}
+
+	tests := map[string]struct {
+		f      *languagepb.AnnotateTextRequest_Features
+		err    error
+		expect *languagepb.AnnotateTextRequest_Features
+	}{
+		"entity sentiment": {f: all, err: unsupported("entity_sentiment"), expect: &languagepb.AnnotateTextRequest_Features{ExtractEntities: true, ExtractDocumentSentiment: true, ClassifyText: true, ExtractSyntax: true}},
+		"sentiment":        {f: all, err: unsupported("document_sentiment"), expect: &languagepb.AnnotateTextRequest_Features{ExtractEntities: true, ExtractEntitySentiment: true, ClassifyText: true, ExtractSyntax: true}},
+		"classify":         {f: all, err: status.Error(codes.InvalidArgument, "The language xx is not supported for text classification."), expect: &languagepb.AnnotateTextRequest_Features{ExtractEntities: true, ExtractEntitySentiment: true, ExtractDocumentSentiment: true, ExtractSyntax: true}},
+		"unknown":          {f: all, err: status.Error(codes.InvalidArgument, "The language xx is not supported."), expect: &languagepb.AnnotateTextRequest_Features{ExtractEntities: true}},
+		"entities":         {f: all, err: unsupported("entity")},
+		"entities only":    {f: &languagepb.AnnotateTextRequest_Features{ExtractEntities: true}, err: status.Error(codes.InvalidArgument, "The language xx is not supported.")},
+		"last feature":     {f: &languagepb.AnnotateTextRequest_Features{ExtractSyntax: true}, err: unsupported("syntax")},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if res := dropUnsupported(tc.f, tc.err); !proto.Equal(tc.expect, res) {
+				t.Fatalf("expected: %v, result: %v", tc.expect, res)
+			}
+		})
+	}
+}
+
+func TestRemapSyntax(t *testing.T) {
+	resp := &languagepb.AnnotateTextResponse{
+		Sentences: []*languagepb.Sentence{{Text: &languagepb.TextSpan{BeginOffset: 0}}},
+		Tokens: []*languagepb.Token{
+			{Text: &languagepb.TextSpan{BeginOffset: 0}, DependencyEdge: &languagepb.DependencyEdge{HeadTokenIndex: 1}},
+			{Text: &languagepb.TextSpan{BeginOffset: 4}, DependencyEdge: &languagepb.DependencyEdge{HeadTokenIndex: 1}},
+		},
+	}
+	// "abc def" filtered from "abc   def" at offset 100
+	orig := []int{100, 101, 102, 103, 106, 107, 108, 109}
+	remapSyntax(resp, orig, 10)
+	if resp.Sentences[0].Text.BeginOffset != 100 || resp.Tokens[1].Text.BeginOffset != 106 || resp.Tokens[0].DependencyEdge.HeadTokenIndex != 11 {
+		t.Fatalf("expected: offsets remapped and head token indexes shifted, result: %v", resp)
+	}
+}
+
+func TestCombineSentiment(t *testing.T) {
+	s := combineSentiment(&languagepb.Sentiment{Score: 0.8, Magnitude: 3}, &languagepb.Sentiment{Score: -0.4, Magnitude: 1})
+	if s.Magnitude != 4 || s.Score < 0.49 || s.Score > 0.51 {
+		t.Fatalf("expected: score 0.5, magnitude 4, result: %v", s)
+	}
+	if s := combineSentiment(nil, &languagepb.Sentiment{Score: 0.1}); s.Score != 0.1 {
+		t.Fatalf("expected: the non nil sentiment, result: %v", s)
+	}
+}
@@ -0,0 +1,146 @@
+package nlp
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"cloud.google.com/go/documentai/apiv1/documentaipb"
+	"cloud.google.com/go/language/apiv1/languagepb"
+)
+
+// DefaultMaxChunkBytes is the default chunk size, under the 1,000,000 bytes content limit of the
+// language API. https://cloud.google.com/natural-language/quotas#content
+const DefaultMaxChunkBytes = 900_000
+
+// chunk is a [Start, End) range of the document text, in bytes.
+type chunk struct {
+	Start int
+	End   int
+}
+
+// textBoundaries returns the byte offsets of the ends of the paragraphs and pages of doc, sorted.
+// offsets maps rune offsets to byte offsets, see byteOffsets.
+func textBoundaries(doc *documentaipb.Document, offsets []int) []int {
+	n := len(offsets) - 1
+	var b []int
+	add := func(a *documentaipb.Document_TextAnchor) {
+		if _, end, ok := anchorRange(a); ok {
+			b = append(b, offsets[min(max(end, 0), n)])
+		}
+	}
+	for _, p := range doc.GetPages() {
+		add(p.GetLayout().GetTextAnchor())
+		for _, para := range p.GetParagraphs() {
+			add(para.GetLayout().GetTextAnchor())
+		}
+	}
+	slices.Sort(b)
+	return slices.Compact(b)
+}
+
+// splitChunks splits the [start, end) byte range of text into chunks of at most maxBytes. Chunks
+// end on the last paragraph or page boundary that fits, else on the last whitespace, else on the
+// last complete character.
+func splitChunks(text string, start, end int, boundaries []int, maxBytes int) []chunk {
+	var chunks []chunk
+	for start < end {
+		limit := start + maxBytes
+		if limit >= end {
+			chunks = append(chunks, chunk{Start: start, End: end})
+			break
+		}
+
+		cut := 0
+		// last boundary within the limit
+		if i, _ := slices.BinarySearch(boundaries, limit+1); i > 0 && boundaries[i-1] > start {
+			cut = boundaries[i-1]
+		}
+		// last whitespace within the limit
+		if cut == 0 {
+			if i := strings.LastIndexFunc(text[start:limit], unicode.IsSpace); i > 0 {
+				_, size := utf8.DecodeRuneInString(text[start+i:])
+				cut = start + i + size
+			}
+		}
+		// last complete character within the limit
+		if cut == 0 {
+			cut = limit
+			for cut > start && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+			if cut == start {
+				// maxBytes is smaller than a character
+				_, size := utf8.DecodeRuneInString(text[start:])
+				cut = start + size
+			}
+		}
+
+		chunks = append(chunks, chunk{Start: start, End: cut})
+		start = cut
+	}
+	return chunks
+}
+
+// mergeEntities merges the entities sharing a name and type, e.g. found in several chunks. Their
+// salience is summed, their sentiments combined and their mentions, already remapped to the
+// document text, are concatenated.
+// The merged entities are sorted by decreasing salience.
+func mergeEntities(entities []*languagepb.Entity) []*languagepb.Entity {
+	type key struct {
+		name string
+		typ  languagepb.Entity_Type
+	}
+
+	var merged []*languagepb.Entity
+	index := map[key]*languagepb.Entity{}
+	for _, e := range entities {
+		k := key{name: strings.ToLower(e.GetName()), typ: e.GetType()}
+		m, ok := index[k]
+		if !ok {
+			index[k] = e
+			merged = append(merged, e)
+			continue
+		}
+
+		m.Salience += e.GetSalience()
+		m.Mentions = append(m.Mentions, e.GetMentions()...)
+		m.Sentiment = combineSentiment(m.GetSentiment(), e.GetSentiment())
+		for mk, mv := range e.GetMetadata() {
+			if _, ok := m.GetMetadata()[mk]; !ok {
+				if m.Metadata == nil {
+					m.Metadata = map[string]string{}
+				}
+				m.Metadata[mk] = mv
+			}
+		}
+	}
+
+	slices.SortStableFunc(merged, func(a, b *languagepb.Entity) int {
+		switch {
+		case a.GetSalience() > b.GetSalience():
+			return -1
+		case a.GetSalience() < b.GetSalience():
+			return 1
+		}
+		return 0
+	})
+	return merged
+}
+
+// combineSentiment sums the magnitudes and averages the scores weighted by magnitude.
+func combineSentiment(a, b *languagepb.Sentiment) *languagepb.Sentiment {
+	if a == nil || b == nil {
+		if a == nil {
+			return b
+		}
+		return a
+	}
+	magnitude := a.GetMagnitude() + b.GetMagnitude()
+	score := (a.GetScore() + b.GetScore()) / 2
+	if magnitude > 0 {
+		score = (a.GetScore()*a.GetMagnitude() + b.GetScore()*b.GetMagnitude()) / magnitude
+	}
+	return &languagepb.Sentiment{Score: score, Magnitude: magnitude}
+}
@@ -0,0 +1,78 @@
+package nlp
+
+import (
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/documentai/apiv1/documentaipb"
+	"cloud.google.com/go/language/apiv1/languagepb"
+)
+
+func TestSplitChunks(t *testing.T) {
+	tests := map[string]struct {
+		text       string
+		boundaries []int
+		max        int
+		expect     []chunk
+	}{
+		// happy path. the text fits
+		"single": {text: "aaaa bbbb", max: 20, expect: []chunk{{0, 9}}},
+		// chunks end on the last boundary that fits
+		"boundaries": {text: "aaa\nbbb\nccc\n", boundaries: []int{4, 8, 12}, max: 9, expect: []chunk{{0, 8}, {8, 12}}},
+		// no boundary fits. chunks end on whitespace
+		"whitespace": {text: "aaa bbb ccc", max: 5, expect: []chunk{{0, 4}, {4, 8}, {8, 11}}},
+		// no whitespace. chunks end on complete characters
+		"characters": {text: "ééé", max: 3, expect: []chunk{{0, 2}, {2, 4}, {4, 6}}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			res := splitChunks(tc.text, 0, len(tc.text), tc.boundaries, tc.max)
+			if !reflect.DeepEqual(tc.expect, res) {
+				t.Fatalf("expected: %v, result: %v", tc.expect, res)
+			}
+		})
+	}
+}
+
+func TestTextBoundaries(t *testing.T) {
+	p := page(1, 0, 9, "fr", 1)
+	p.Paragraphs = []*documentaipb.Document_Page_Paragraph{
+		{Layout: page(0, 0, 4, "", 0).Layout},
+		{Layout: page(0, 4, 9, "", 0).Layout},
+	}
+	doc := &documentaipb.Document{Text: "été\naaaa\n", Pages: []*documentaipb.Document_Page{p}}
+
+	// rune offsets are converted to byte offsets
+	expect := []int{6, 11}
+	if res := textBoundaries(doc, byteOffsets(doc.Text)); !reflect.DeepEqual(expect, res) {
+		t.Fatalf("expected: %v, result: %v", expect, res)
+	}
+}
+
+func TestMergeEntities(t *testing.T) {
+	mention := func(offset int32) *languagepb.EntityMention {
+		return &languagepb.EntityMention{Text: &languagepb.TextSpan{BeginOffset: offset}}
+	}
+	entities := []*languagepb.Entity{
+		{Name: "Paris", Type: languagepb.Entity_LOCATION, Salience: 0.2, Mentions: []*languagepb.EntityMention{mention(0)}},
+		{Name: "ACME", Type: languagepb.Entity_ORGANIZATION, Salience: 0.3, Mentions: []*languagepb.EntityMention{mention(10)}},
+		{Name: "paris", Type: languagepb.Entity_LOCATION, Salience: 0.25, Mentions: []*languagepb.EntityMention{mention(100)}, Metadata: map[string]string{"mid": "/m/05qtj"}},
+		{Name: "Paris", Type: languagepb.Entity_PERSON, Salience: 0.1},
+	}
+
+	res := mergeEntities(entities)
+	if len(res) != 3 {
+		t.Fatalf("expected: 3 entities, result: %d", len(res))
+	}
+	paris := res[0]
+	if paris.Name != "Paris" || paris.Type != languagepb.Entity_LOCATION || len(paris.Mentions) != 2 || paris.Metadata["mid"] != "/m/05qtj" {
+		t.Fatalf("expected: merged Paris location first, result: %v", paris)
+	}
+	if paris.Salience < 0.449 || paris.Salience > 0.451 {
+		t.Fatalf("expected: 0.45 salience, result: %v", paris.Salience)
+	}
+	if res[1].Name != "ACME" || res[2].Type != languagepb.Entity_PERSON {
+		t.Fatalf("expected: entities sorted by salience, result: %v", res)
+	}
+}
@@ -0,0 +1,53 @@
+package nlp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/utils"
+)
+
+// OptionsFromEnv reads the analysis options from the NLP_* env vars. All the invalid values are
+// returned, joined.
+func OptionsFromEnv() (Options, error) {
+	var env utils.EnvReader
+
+	// language. Mixed-language documents are split by page, or block, and each part is analyzed in
+	// its own language. Languages detected with a lower confidence are left to the language API.
+	split := env.OneOf("NLP_LANGUAGE_SPLIT", SplitPage, SplitNone, SplitPage, SplitBlock)
+	fallback := env.OneOf("NLP_LANGUAGE_FALLBACK", FallbackSkip, FallbackAuto, FallbackSkip)
+	supported := map[string]bool{}
+	for _, l := range utils.GetListEnvVar("NLP_SUPPORTED_LANGUAGES", DefaultSupportedLanguages) {
+		supported[strings.ToLower(l)] = true
+	}
+
+	// maxChunkBytes is the largest text sent in a single language API request
+	maxChunkBytes := env.Int("NLP_MAX_CHUNK_BYTES", DefaultMaxChunkBytes)
+
+	// analyses. entities, entity_sentiment, sentiment, classify and syntax use the language API,
+	// pii is performed locally
+	analyses, err := ParseAnalyses(utils.GetListEnvVar("NLP_ANALYSES", []string{AnalysisEntities}))
+	if err != nil {
+		env.Fail(fmt.Errorf("invalid NLP_ANALYSES value: %w", err))
+	}
+
+	// filtering. Low confidence tokens, repeated headers and footers and page numbers are dropped and
+	// whitespace is normalized before analysis
+	filter := FilterOptions{
+		MinTokenConfidence: float32(env.Ratio("NLP_MIN_TOKEN_CONFIDENCE", 0.5)),
+		StripHeaders:       utils.GetBoolEnvVar("NLP_STRIP_HEADERS", true),
+		Normalize:          utils.GetBoolEnvVar("NLP_NORMALIZE_TEXT", true),
+	}
+
+	return Options{
+		Language: LanguageOptions{
+			Split:         split,
+			MinConfidence: float32(env.Ratio("NLP_MIN_LANGUAGE_CONFIDENCE", 0.5)),
+			Supported:     supported,
+			Fallback:      fallback,
+		},
+		Filter:        filter,
+		Analyses:      analyses,
+		MaxChunkBytes: maxChunkBytes,
+	}, env.Err()
+}
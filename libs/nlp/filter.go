@@ -0,0 +1,268 @@
+package nlp
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"cloud.google.com/go/documentai/apiv1/documentaipb"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+)
+
+// edgeLines is the number of lines at the top and bottom of each page checked for headers,
+// footers and page numbers.
+const edgeLines = 2
+
+// pageNumberRe matches page number lines, e.g. "12", "- 12 -", "Page 3 of 10" or "p. 3/10".
+var pageNumberRe = regexp.MustCompile(`(?i)^[\s\-–—]*(?:page|p\.?)?\s*\d{1,4}\s*(?:(?:/|of|sur|de)\s*\d{1,4})?[\s\-–—]*$`)
+
+// bareNumberRe matches the page number lines made of a number only. They may be content as well,
+// e.g. an amount, and are only dropped when they are the page index or repeat at the same position
+// across pages.
+var bareNumberRe = regexp.MustCompile(`^\s*(\d{1,4})\s*$`)
+
+// FilterOptions controls the text filtering performed before analysis.
+type FilterOptions struct {
+	// MinTokenConfidence drops the tokens recognized with a lower confidence. 0 keeps all tokens.
+	MinTokenConfidence float32
+	// StripHeaders drops the headers and footers repeated across pages, and page numbers.
+	StripHeaders bool
+	// Normalize collapses whitespace and joins words hyphenated across line breaks.
+	Normalize bool
+}
+
+// droppedRanges returns the byte ranges of the document text removed by the filter, sorted and
+// merged. offsets maps rune offsets to byte offsets, see byteOffsets.
+func droppedRanges(doc *documentaipb.Document, offsets []int, o FilterOptions, stats *types.NLPFilterStats) []chunk {
+	n := len(offsets) - 1
+	var dropped []chunk
+	drop := func(a *documentaipb.Document_TextAnchor) {
+		for _, s := range a.GetTextSegments() {
+			start, end := min(max(int(s.GetStartIndex()), 0), n), min(max(int(s.GetEndIndex()), 0), n)
+			if end > start {
+				dropped = append(dropped, chunk{Start: offsets[start], End: offsets[end]})
+			}
+		}
+	}
+
+	if o.MinTokenConfidence > 0 {
+		for _, p := range doc.GetPages() {
+			for _, t := range p.GetTokens() {
+				// a zero confidence is unset
+				if c := t.GetLayout().GetConfidence(); c > 0 && c < o.MinTokenConfidence {
+					drop(t.GetLayout().GetTextAnchor())
+					stats.LowConfidenceTokens++
+				}
+			}
+		}
+	}
+
+	if o.StripHeaders {
+		text := doc.GetText()
+		lineText := func(l *documentaipb.Document_Page_Line) string {
+			start, end, ok := anchorRange(l.GetLayout().GetTextAnchor())
+			if !ok {
+				return ""
+			}
+			start, end = min(max(start, 0), n), min(max(end, 0), n)
+			return text[offsets[start]:offsets[end]]
+		}
+
+		// count on how many pages each edge line appears, and each edge position holds a bare number
+		counts := map[string]int{}
+		numbers := map[int]int{}
+		for _, p := range doc.GetPages() {
+			seen := map[string]bool{}
+			for _, e := range edges(p.GetLines()) {
+				t := lineText(e.line)
+				if k := lineKey(t); k != "" && !seen[k] {
+					seen[k] = true
+					counts[k]++
+				}
+				if bareNumberRe.MatchString(t) {
+					numbers[e.pos]++
+				}
+			}
+		}
+
+		pages := len(doc.GetPages())
+		repeated := func(n int) bool {
+			return pages > 1 && n >= max(2, (pages+1)/2)
+		}
+		isPageNumber := func(p *documentaipb.Document_Page, e edgeLine, t string) bool {
+			m := bareNumberRe.FindStringSubmatch(t)
+			if m == nil {
+				return pageNumberRe.MatchString(t)
+			}
+			n, _ := strconv.Atoi(m[1])
+			return n == int(p.GetPageNumber()) || repeated(numbers[e.pos])
+		}
+		for _, p := range doc.GetPages() {
+			for _, e := range edges(p.GetLines()) {
+				t := lineText(e.line)
+				switch {
+				case isPageNumber(p, e, t):
+					drop(e.line.GetLayout().GetTextAnchor())
+					stats.PageNumbers++
+				case repeated(counts[lineKey(t)]):
+					drop(e.line.GetLayout().GetTextAnchor())
+					stats.HeaderFooterLines++
+				}
+			}
+		}
+	}
+
+	return mergeRanges(dropped)
+}
+
+// edgeLine is a first or last line of a page. pos is its position: 0 for the first line, 1 for the
+// second, -1 for the last line, -2 for the one before.
+type edgeLine struct {
+	line *documentaipb.Document_Page_Line
+	pos  int
+}
+
+// edges returns the first and last edgeLines lines of a page. The lines of shorter pages are split
+// between the first and last lines.
+func edges(lines []*documentaipb.Document_Page_Line) []edgeLine {
+	n := len(lines)
+	var res []edgeLine
+	for i, l := range lines {
+		switch {
+		case i < min(edgeLines, (n+1)/2):
+			res = append(res, edgeLine{line: l, pos: i})
+		case i >= n-edgeLines:
+			res = append(res, edgeLine{line: l, pos: i - n})
+		}
+	}
+	return res
+}
+
+// lineKey normalizes a line to compare headers and footers across pages: case, whitespace and
+// digits, e.g. dates or page numbers, are ignored.
+func lineKey(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return '#'
+		}
+		return unicode.ToLower(r)
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// mergeRanges sorts and merges overlapping ranges.
+func mergeRanges(ranges []chunk) []chunk {
+	slices.SortFunc(ranges, func(a, b chunk) int { return a.Start - b.Start })
+	var merged []chunk
+	for _, r := range ranges {
+		if len(merged) > 0 && r.Start <= merged[len(merged)-1].End {
+			merged[len(merged)-1].End = max(merged[len(merged)-1].End, r.End)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// filterText returns the [start, end) byte range of text without the dropped ranges, normalized
+// when normalize is set, and the byte offset in text of each byte of the filtered text, followed
+// by end, to map offsets in the filtered text back to the document text.
+func filterText(text string, start, end int, dropped []chunk, normalize bool) (string, []int) {
+	type char struct {
+		r   rune
+		pos int
+	}
+
+	// kept characters
+	var chars []char
+	d := 0
+	for i := start; i < end; {
+		for d < len(dropped) && dropped[d].End <= i {
+			d++
+		}
+		if d < len(dropped) && dropped[d].Start <= i {
+			i = dropped[d].End
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(text[i:])
+		chars = append(chars, char{r: r, pos: i})
+		i += size
+	}
+
+	var b strings.Builder
+	var orig []int
+	emit := func(r rune, pos int) {
+		n, _ := b.WriteRune(r)
+		for k := range n {
+			orig = append(orig, pos+k)
+		}
+	}
+
+	if !normalize {
+		for _, c := range chars {
+			emit(c.r, c.pos)
+		}
+		return b.String(), append(orig, end)
+	}
+
+	isSpace := func(r rune) bool { return r != '\n' && unicode.IsSpace(r) }
+	newlines, space := 0, -1
+	var prev rune
+	for i := 0; i < len(chars); i++ {
+		c := chars[i]
+
+		// join words hyphenated across a line break: "exam-\nple" is "example"
+		if (c.r == '-' || c.r == '\u00ad') && unicode.IsLetter(prev) {
+			j := i + 1
+			for j < len(chars) && isSpace(chars[j].r) {
+				j++
+			}
+			if j < len(chars) && chars[j].r == '\n' {
+				j++
+				for j < len(chars) && isSpace(chars[j].r) {
+					j++
+				}
+				if j < len(chars) && unicode.IsLower(chars[j].r) {
+					i = j - 1
+					continue
+				}
+			}
+		}
+
+		switch {
+		case c.r == '\n':
+			if newlines == 0 {
+				space = c.pos
+			}
+			newlines++
+			continue
+		case isSpace(c.r):
+			if space < 0 {
+				space = c.pos
+			}
+			continue
+		}
+
+		// collapse whitespace runs: at most one blank line, single spaces, none at the start
+		if b.Len() > 0 && space >= 0 {
+			switch {
+			case newlines > 1:
+				emit('\n', space)
+				emit('\n', space)
+			case newlines == 1:
+				emit('\n', space)
+			default:
+				emit(' ', space)
+			}
+		}
+		newlines, space = 0, -1
+
+		emit(c.r, c.pos)
+		prev = c.r
+	}
+
+	return b.String(), append(orig, end)
+}
@@ -0,0 +1,125 @@
+package nlp
+
+import (
+	"testing"
+
+	"cloud.google.com/go/documentai/apiv1/documentaipb"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+)
+
+func TestFilterText(t *testing.T) {
+	tests := map[string]struct {
+		text      string
+		dropped   []chunk
+		normalize bool
+		expect    string
+	}{
+		// happy path. dropped ranges are removed
+		"dropped": {text: "abc XYZ def", dropped: []chunk{{4, 8}}, expect: "abc def"},
+		// whitespace is collapsed, at most one blank line is kept
+		"whitespace": {text: "  abc \t def\n\n\n\nghi  ", normalize: true, expect: "abc def\n\nghi"},
+		// hyphenated line breaks are joined, hyphenated words are kept
+		"hyphenation": {text: "exam-\n ple, well-known\nX-\nRay", normalize: true, expect: "example, well-known\nX-\nRay"},
+		// whitespace left around a dropped range is collapsed
+		"dropped whitespace": {text: "abc 0.1 def", dropped: []chunk{{4, 7}}, normalize: true, expect: "abc def"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			res, orig := filterText(tc.text, 0, len(tc.text), tc.dropped, tc.normalize)
+			if res != tc.expect {
+				t.Fatalf("expected: %q, result: %q", tc.expect, res)
+			}
+			if len(orig) != len(res)+1 || orig[len(res)] != len(tc.text) {
+				t.Fatalf("expected: %d offsets, result: %v", len(res)+1, orig)
+			}
+		})
+	}
+}
+
+func TestFilterTextOffsets(t *testing.T) {
+	text := "éa  b"
+	res, orig := filterText(text, 0, len(text), nil, true)
+	if res != "éa b" {
+		t.Fatalf("expected: %q, result: %q", "éa b", res)
+	}
+	// "b" is the 5th byte of the result and the 6th of the text
+	if orig[4] != 5 || text[orig[4]:orig[4]+1] != "b" {
+		t.Fatalf("expected: b mapped to offset 5, result: %v", orig)
+	}
+}
+
+// line returns a line anchoring [start, end) of the document text.
+func line(start, end int64) *documentaipb.Document_Page_Line {
+	return &documentaipb.Document_Page_Line{Layout: page(0, start, end, "", 0).Layout}
+}
+
+func TestDroppedRanges(t *testing.T) {
+	//        0         1         2         3         4         5
+	//        0123456789012345678901234567890123456789012345678901234567
+	text := "ACME report\nfirst page\n1\nACME report\nsecond page\n2 / 2\n"
+	p1 := page(1, 0, 26, "en", 1)
+	p1.Lines = []*documentaipb.Document_Page_Line{line(0, 12), line(12, 23), line(23, 25)}
+	p1.Tokens = []*documentaipb.Document_Page_Token{
+		{Layout: &documentaipb.Document_Page_Layout{TextAnchor: line(12, 17).Layout.TextAnchor, Confidence: 0.9}},
+		{Layout: &documentaipb.Document_Page_Layout{TextAnchor: line(18, 22).Layout.TextAnchor, Confidence: 0.2}},
+	}
+	p2 := page(2, 25, 56, "en", 1)
+	p2.Lines = []*documentaipb.Document_Page_Line{line(25, 37), line(37, 49), line(49, 55)}
+	doc := &documentaipb.Document{Text: text, Pages: []*documentaipb.Document_Page{p1, p2}}
+
+	var stats types.NLPFilterStats
+	dropped := droppedRanges(doc, byteOffsets(text), FilterOptions{MinTokenConfidence: 0.5, StripHeaders: true}, &stats)
+	res, _ := filterText(text, 0, len(text), dropped, true)
+
+	if expect := "first\nsecond page"; res != expect {
+		t.Fatalf("expected: %q, result: %q", expect, res)
+	}
+	if stats.LowConfidenceTokens != 1 || stats.HeaderFooterLines != 2 || stats.PageNumbers != 2 {
+		t.Fatalf("expected: 1 token, 2 header lines and 2 page numbers dropped, result: %+v", stats)
+	}
+}
+
+// linesDoc returns a document of pages of lines, numbered from first.
+func linesDoc(first int32, pages ...[]string) *documentaipb.Document {
+	doc := &documentaipb.Document{}
+	for i, lines := range pages {
+		start := int64(len(doc.Text))
+		p := page(first+int32(i), start, 0, "en", 1)
+		for _, l := range lines {
+			s := int64(len(doc.Text))
+			doc.Text += l + "\n"
+			p.Lines = append(p.Lines, line(s, s+int64(len(l))))
+		}
+		p.Layout.TextAnchor.TextSegments[0].EndIndex = int64(len(doc.Text))
+		doc.Pages = append(doc.Pages, p)
+	}
+	return doc
+}
+
+func TestDroppedPageNumbers(t *testing.T) {
+	tests := map[string]struct {
+		doc    *documentaipb.Document
+		expect int
+	}{
+		// the page index
+		"index": {doc: linesDoc(1, []string{"intro", "text", "1"}), expect: 1},
+		// a bare number that is not the page index is content, e.g. a total
+		"amount": {doc: linesDoc(1, []string{"total", "text", "1250"}), expect: 0},
+		// printed page numbers offset from the page index, at the same position on every page
+		"positional": {doc: linesDoc(1, []string{"a", "text", "b", "12"}, []string{"c", "text", "d", "13"}), expect: 2},
+		// bare numbers at different positions
+		"not positional": {doc: linesDoc(1, []string{"12", "text", "b", "c"}, []string{"a", "text", "d", "13"}), expect: 0},
+		"decorated":      {doc: linesDoc(1, []string{"text", "more", "Page 7 of 10"}), expect: 1},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var stats types.NLPFilterStats
+			droppedRanges(tc.doc, byteOffsets(tc.doc.Text), FilterOptions{StripHeaders: true}, &stats)
+			if stats.PageNumbers != tc.expect {
+				t.Fatalf("expected: %v, result: %v", tc.expect, stats.PageNumbers)
+			}
+		})
+	}
+}
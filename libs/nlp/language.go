@@ -0,0 +1,200 @@
+package nlp
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"cloud.google.com/go/documentai/apiv1/documentaipb"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+)
+
+// Language split modes, see NLP_LANGUAGE_SPLIT.
+const (
+	SplitNone  = "none"
+	SplitPage  = "page"
+	SplitBlock = "block"
+)
+
+// Fallbacks for segments in an unsupported language, see NLP_LANGUAGE_FALLBACK.
+const (
+	FallbackAuto = "auto"
+	FallbackSkip = "skip"
+)
+
+// DefaultSupportedLanguages are the languages supported by entity analysis.
+// https://cloud.google.com/natural-language/docs/languages
+var DefaultSupportedLanguages = []string{"en", "fr", "de", "es", "it", "ja", "ko", "pt", "ru", "zh", "zh-Hant"}
+
+// LanguageOptions controls how documents are split and analyzed by language.
+type LanguageOptions struct {
+	// Split is none, page or block.
+	Split string
+	// MinConfidence is the confidence below which an OCR detected language is ignored.
+	MinConfidence float32
+	// Supported are the lower case language codes the analysis is requested in.
+	Supported map[string]bool
+	// Fallback is what happens to segments in an unsupported language: auto or skip.
+	Fallback string
+}
+
+// supports reports whether the language code, or its base language, is supported.
+func (o LanguageOptions) supports(code string) bool {
+	code = strings.ToLower(code)
+	if o.Supported[code] {
+		return true
+	}
+	base, _, _ := strings.Cut(code, "-")
+	return o.Supported[base]
+}
+
+// segment is a run of pages or blocks in the same language, [Start, End) in runes of the document text.
+type segment struct {
+	Language string
+	Pages    []int
+	Start    int
+	End      int
+}
+
+// AggregateLanguages returns the languages detected across the pages of doc, by decreasing
+// confidence. The confidence of each page is weighted by its text length.
+func AggregateLanguages(doc *documentaipb.Document) []types.LanguageScore {
+	scores := map[string]float32{}
+	var total float32
+	for _, p := range doc.GetPages() {
+		weight := float32(1)
+		if start, end, ok := anchorRange(p.GetLayout().GetTextAnchor()); ok && end > start {
+			weight = float32(end - start)
+		}
+		total += weight
+		for _, l := range p.GetDetectedLanguages() {
+			scores[l.GetLanguageCode()] += l.GetConfidence() * weight
+		}
+	}
+
+	langs := make([]types.LanguageScore, 0, len(scores))
+	for code, s := range scores {
+		langs = append(langs, types.LanguageScore{Code: code, Confidence: s / total})
+	}
+	slices.SortFunc(langs, func(a, b types.LanguageScore) int {
+		if a.Confidence != b.Confidence {
+			if a.Confidence > b.Confidence {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Code, b.Code)
+	})
+	return langs
+}
+
+// topLanguage returns the most confident language, or an empty string when none reaches min.
+func topLanguage(langs []*documentaipb.Document_Page_DetectedLanguage, min float32) string {
+	var code string
+	best := min
+	for _, l := range langs {
+		if l.GetConfidence() >= best && l.GetLanguageCode() != "" {
+			code, best = l.GetLanguageCode(), l.GetConfidence()
+		}
+	}
+	return code
+}
+
+// anchorRange returns the smallest [start, end) range covering all the segments of a text anchor.
+func anchorRange(a *documentaipb.Document_TextAnchor) (start, end int, ok bool) {
+	for i, s := range a.GetTextSegments() {
+		if i == 0 || int(s.GetStartIndex()) < start {
+			start = int(s.GetStartIndex())
+		}
+		if int(s.GetEndIndex()) > end {
+			end = int(s.GetEndIndex())
+		}
+		ok = true
+	}
+	return start, end, ok
+}
+
+// splitSegments splits doc into runs of consecutive pages, or blocks, in the same language.
+// Documents without pages, or with split none, are a single segment in their dominant language,
+// if any.
+func splitSegments(doc *documentaipb.Document, o LanguageOptions) []segment {
+	n := utf8.RuneCountInString(doc.GetText())
+
+	var units []segment
+	if o.Split != SplitNone {
+		for i, p := range doc.GetPages() {
+			num := int(p.GetPageNumber())
+			if num == 0 {
+				num = i + 1
+			}
+			lang := topLanguage(p.GetDetectedLanguages(), o.MinConfidence)
+
+			if o.Split == SplitBlock && len(p.GetBlocks()) > 0 {
+				for _, b := range p.GetBlocks() {
+					start, end, ok := anchorRange(b.GetLayout().GetTextAnchor())
+					if !ok {
+						continue
+					}
+					blang := topLanguage(b.GetDetectedLanguages(), o.MinConfidence)
+					if blang == "" {
+						blang = lang
+					}
+					units = append(units, segment{Language: blang, Pages: []int{num}, Start: start, End: end})
+				}
+				continue
+			}
+
+			start, end, ok := anchorRange(p.GetLayout().GetTextAnchor())
+			if !ok {
+				continue
+			}
+			units = append(units, segment{Language: lang, Pages: []int{num}, Start: start, End: end})
+		}
+	}
+
+	if len(units) == 0 {
+		// the aggregated confidence is diluted by the other languages, it is not thresholded
+		var lang string
+		if langs := AggregateLanguages(doc); len(langs) > 0 {
+			lang = langs[0].Code
+		}
+		var pages []int
+		for i := range doc.GetPages() {
+			pages = append(pages, i+1)
+		}
+		return []segment{{Language: lang, Pages: pages, Start: 0, End: n}}
+	}
+
+	// merge consecutive units in the same language
+	var segs []segment
+	for _, u := range units {
+		u.Start, u.End = min(max(u.Start, 0), n), min(max(u.End, 0), n)
+		if len(segs) > 0 && segs[len(segs)-1].Language == u.Language {
+			last := &segs[len(segs)-1]
+			last.Start = min(last.Start, u.Start)
+			last.End = max(last.End, u.End)
+			if p := u.Pages[0]; last.Pages[len(last.Pages)-1] != p {
+				last.Pages = append(last.Pages, p)
+			}
+			continue
+		}
+		segs = append(segs, u)
+	}
+	return segs
+}
+
+// resolveLanguage returns the language to request the analysis in, empty for auto-detection, or
+// the reason the segment is skipped.
+func resolveLanguage(detected string, o LanguageOptions) (lang, skipped string) {
+	switch {
+	case detected == "":
+		return "", ""
+	case o.supports(detected):
+		return detected, ""
+	case o.Fallback == FallbackAuto:
+		return "", ""
+	default:
+		return "", fmt.Sprintf("unsupported language: %s", detected)
+	}
+}
@@ -0,0 +1,131 @@
+package nlp
+
+import (
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/documentai/apiv1/documentaipb"
+)
+
+// page returns a page anchoring [start, end) of the document text, in the given language.
+func page(num int32, start, end int64, lang string, conf float32) *documentaipb.Document_Page {
+	return &documentaipb.Document_Page{
+		PageNumber: num,
+		Layout: &documentaipb.Document_Page_Layout{
+			TextAnchor: &documentaipb.Document_TextAnchor{
+				TextSegments: []*documentaipb.Document_TextAnchor_TextSegment{{StartIndex: start, EndIndex: end}},
+			},
+		},
+		DetectedLanguages: []*documentaipb.Document_Page_DetectedLanguage{{LanguageCode: lang, Confidence: conf}},
+	}
+}
+
+func TestAggregateLanguages(t *testing.T) {
+	doc := &documentaipb.Document{
+		Text:  "un deux trois quatre\none two\n",
+		Pages: []*documentaipb.Document_Page{page(1, 0, 21, "fr", 1), page(2, 21, 29, "en", 1)},
+	}
+	langs := AggregateLanguages(doc)
+	if len(langs) != 2 || langs[0].Code != "fr" || langs[1].Code != "en" {
+		t.Fatalf("expected: fr, en, result: %v", langs)
+	}
+	if langs[0].Confidence < 0.7 || langs[0].Confidence > 0.75 {
+		t.Fatalf("expected: fr confidence weighted by text length, result: %v", langs[0].Confidence)
+	}
+
+	// no pages
+	if langs := AggregateLanguages(&documentaipb.Document{Text: "abc"}); len(langs) != 0 {
+		t.Fatalf("expected: no language, result: %v", langs)
+	}
+}
+
+func TestSplitSegments(t *testing.T) {
+	opts := LanguageOptions{Split: SplitPage, MinConfidence: 0.5}
+	doc := &documentaipb.Document{
+		Text: "aaaa\nbbbb\ncccc\ndddd\n",
+		Pages: []*documentaipb.Document_Page{
+			page(1, 0, 5, "fr", 0.9),
+			page(2, 5, 10, "fr", 0.8),
+			page(3, 10, 15, "en", 0.9),
+			page(4, 15, 20, "de", 0.1),
+		},
+	}
+
+	tests := map[string]struct {
+		doc    *documentaipb.Document
+		split  string
+		expect []segment
+	}{
+		// happy path. consecutive pages in the same language are merged, unconfident languages are left empty
+		"pages": {doc: doc, split: SplitPage, expect: []segment{
+			{Language: "fr", Pages: []int{1, 2}, Start: 0, End: 10},
+			{Language: "en", Pages: []int{3}, Start: 10, End: 15},
+			{Language: "", Pages: []int{4}, Start: 15, End: 20},
+		}},
+		// a single segment in the dominant language
+		"none": {doc: doc, split: SplitNone, expect: []segment{
+			{Language: "fr", Pages: []int{1, 2, 3, 4}, Start: 0, End: 20},
+		}},
+		// no pages. the whole text is auto-detected
+		"no pages": {doc: &documentaipb.Document{Text: "abc"}, split: SplitPage, expect: []segment{
+			{Language: "", Start: 0, End: 3},
+		}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			o := opts
+			o.Split = tc.split
+			res := splitSegments(tc.doc, o)
+			if !reflect.DeepEqual(tc.expect, res) {
+				t.Fatalf("expected: %v, result: %v", tc.expect, res)
+			}
+		})
+	}
+}
+
+func TestSplitSegmentsBlocks(t *testing.T) {
+	p := page(1, 0, 10, "fr", 0.9)
+	p.Blocks = []*documentaipb.Document_Page_Block{
+		{Layout: page(0, 0, 5, "", 0).Layout},
+		{Layout: page(0, 5, 10, "", 0).Layout, DetectedLanguages: []*documentaipb.Document_Page_DetectedLanguage{{LanguageCode: "en", Confidence: 0.9}}},
+	}
+	doc := &documentaipb.Document{Text: "aaaa\nbbbb\n", Pages: []*documentaipb.Document_Page{p}}
+
+	expect := []segment{
+		{Language: "fr", Pages: []int{1}, Start: 0, End: 5},
+		{Language: "en", Pages: []int{1}, Start: 5, End: 10},
+	}
+	if res := splitSegments(doc, LanguageOptions{Split: SplitBlock, MinConfidence: 0.5}); !reflect.DeepEqual(expect, res) {
+		t.Fatalf("expected: %v, result: %v", expect, res)
+	}
+}
+
+func TestResolveLanguage(t *testing.T) {
+	supported := map[string]bool{"en": true, "fr": true}
+
+	tests := map[string]struct {
+		detected string
+		fallback string
+		lang     string
+		skipped  bool
+	}{
+		// happy path. supported language, regional variants included
+		"supported": {detected: "fr-CA", fallback: FallbackSkip, lang: "fr-CA"},
+		// no confident language
+		"undetected": {detected: "", fallback: FallbackSkip, lang: ""},
+		// unsupported language
+		"skip": {detected: "sq", fallback: FallbackSkip, skipped: true},
+		// unsupported language left to the language API
+		"auto": {detected: "sq", fallback: FallbackAuto, lang: ""},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			lang, skipped := resolveLanguage(tc.detected, LanguageOptions{Supported: supported, Fallback: tc.fallback})
+			if lang != tc.lang || (skipped != "") != tc.skipped {
+				t.Fatalf("expected: %q %v, result: %q %q", tc.lang, tc.skipped, lang, skipped)
+			}
+		})
+	}
+}
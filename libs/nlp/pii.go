@@ -0,0 +1,185 @@
+package nlp
+
+import (
+	"math/big"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+)
+
+// PII types.
+const (
+	piiEmail = "email"
+	piiPhone = "phone"
+	piiIBAN  = "iban"
+	piiFRNIR = "fr_nir"
+	piiUSSSN = "us_ssn"
+)
+
+// piiDetector finds candidates with a pattern and keeps those passing validation.
+type piiDetector struct {
+	Type     string
+	Pattern  *regexp.Regexp
+	Validate func(string) bool
+}
+
+// piiDetectors are run in order. A match overlapping a match of an earlier detector is dropped,
+// so the most specific, checksummed, detectors come first.
+var piiDetectors = []piiDetector{
+	{
+		Type:     piiIBAN,
+		Pattern:  regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,3})?\b`),
+		Validate: validIBAN,
+	},
+	{
+		// french social security number: sex, year, month, department, commune, order and key
+		Type:     piiFRNIR,
+		Pattern:  regexp.MustCompile(`\b[12] ?\d{2} ?(?:0[1-9]|1[0-2]|[2-9]\d) ?(?:\d{2}|2[AB]) ?\d{3} ?\d{3} ?\d{2}\b`),
+		Validate: validNIR,
+	},
+	{
+		Type:     piiUSSSN,
+		Pattern:  regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+		Validate: validSSN,
+	},
+	{
+		Type:    piiEmail,
+		Pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	},
+	{
+		Type:     piiPhone,
+		Pattern:  regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{1,4}\)[ .-]?)?\d{1,4}(?:[ .-]?\d{2,4}){2,5}`),
+		Validate: validPhone,
+	},
+}
+
+// detectPII returns the personal data found in text, by offset. Values are masked.
+func detectPII(text string) []types.PIIMatch {
+	var matches []types.PIIMatch
+	overlaps := func(start, end int) bool {
+		for _, m := range matches {
+			if start < m.Offset+m.Length && m.Offset < end {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, d := range piiDetectors {
+		for _, loc := range d.Pattern.FindAllStringIndex(text, -1) {
+			v := text[loc[0]:loc[1]]
+			if (d.Validate != nil && !d.Validate(v)) || overlaps(loc[0], loc[1]) {
+				continue
+			}
+			matches = append(matches, types.PIIMatch{
+				Type:   d.Type,
+				Offset: loc[0],
+				Length: loc[1] - loc[0],
+				Masked: maskPII(v),
+			})
+		}
+	}
+
+	slices.SortFunc(matches, func(a, b types.PIIMatch) int { return a.Offset - b.Offset })
+	return matches
+}
+
+// CountPII returns the number of matches per type.
+func CountPII(matches []types.PIIMatch) map[string]int {
+	if len(matches) == 0 {
+		return nil
+	}
+	counts := map[string]int{}
+	for _, m := range matches {
+		counts[m.Type]++
+	}
+	return counts
+}
+
+// maskPII keeps the first and last two letters or digits of a value, enough to check a match
+// without copying personal data to the output.
+func maskPII(v string) string {
+	r := []rune(v)
+	var b strings.Builder
+	for i, c := range r {
+		if i < 2 || i >= len(r)-2 || !(unicode.IsLetter(c) || unicode.IsDigit(c)) {
+			b.WriteRune(c)
+			continue
+		}
+		b.WriteRune('*')
+	}
+	return b.String()
+}
+
+// digits returns the digits of v.
+func digits(v string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, v)
+}
+
+// validIBAN checks the ISO 13616 mod 97 checksum.
+func validIBAN(v string) bool {
+	v = strings.ReplaceAll(v, " ", "")
+	if len(v) < 15 || len(v) > 34 {
+		return false
+	}
+	var num strings.Builder
+	for _, c := range v[4:] + v[:4] {
+		switch {
+		case c >= '0' && c <= '9':
+			num.WriteRune(c)
+		case c >= 'A' && c <= 'Z':
+			num.WriteString(strconv.Itoa(int(c-'A') + 10))
+		default:
+			return false
+		}
+	}
+	n, ok := new(big.Int).SetString(num.String(), 10)
+	return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+// validNIR checks the key of a french social security number, 97 - (number mod 97). Corsica
+// departments 2A and 2B count as 19 and 18.
+func validNIR(v string) bool {
+	v = strings.ReplaceAll(v, " ", "")
+	if len(v) != 15 {
+		return false
+	}
+	num := v[:13]
+	switch num[5:7] {
+	case "2A":
+		num = num[:5] + "19" + num[7:]
+	case "2B":
+		num = num[:5] + "18" + num[7:]
+	}
+	n, ok := new(big.Int).SetString(num, 10)
+	key, kok := new(big.Int).SetString(v[13:], 10)
+	if !ok || !kok {
+		return false
+	}
+	return 97-new(big.Int).Mod(n, big.NewInt(97)).Int64() == key.Int64()
+}
+
+// validSSN rejects the never assigned area, group and serial numbers.
+func validSSN(v string) bool {
+	area, group, serial := v[0:3], v[4:6], v[7:11]
+	return area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+}
+
+// validPhone requires an international prefix and 9 to 15 digits, or 10 digits national numbers
+// written with separators or a leading 0, so that amounts or references do not match.
+func validPhone(v string) bool {
+	d := digits(v)
+	if strings.HasPrefix(v, "+") {
+		return len(d) >= 9 && len(d) <= 15
+	}
+	return len(d) == 10 && (d[0] == '0' || strings.ContainsAny(v, " .-()"))
+}
@@ -0,0 +1,49 @@
+package nlp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectPII(t *testing.T) {
+	tests := map[string]struct {
+		text   string
+		expect []string
+	}{
+		// happy path. one of each type
+		"email":    {text: "contact: jean.dupont@example.fr.", expect: []string{piiEmail}},
+		"phone":    {text: "tél. 01 23 45 67 89 ou +33 6 12 34 56 78", expect: []string{piiPhone, piiPhone}},
+		"iban":     {text: "IBAN FR76 3000 6000 0112 3456 7890 189", expect: []string{piiIBAN}},
+		"fr nir":   {text: "n° sécu 1 84 12 76 451 089 46", expect: []string{piiFRNIR}},
+		"us ssn":   {text: "SSN 123-45-6789", expect: []string{piiUSSSN}},
+		"us phone": {text: "call (555) 123-4567", expect: []string{piiPhone}},
+		// invalid checksums and numbers that are not phone numbers
+		"invalid iban": {text: "FR76 3000 6000 0112 3456 7890 188", expect: nil},
+		"invalid nir":  {text: "1 84 12 76 451 089 47", expect: nil},
+		"invalid ssn":  {text: "666-45-6789", expect: nil},
+		"amount":       {text: "total 1234567890 EUR, ref 2024", expect: nil},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var res []string
+			for _, m := range detectPII(tc.text) {
+				res = append(res, m.Type)
+			}
+			if !reflect.DeepEqual(tc.expect, res) {
+				t.Fatalf("expected: %v, result: %v (%v)", tc.expect, res, detectPII(tc.text))
+			}
+		})
+	}
+}
+
+func TestDetectPIIOffsets(t *testing.T) {
+	text := "é mail: a.b@example.com"
+	m := detectPII(text)
+	if len(m) != 1 || text[m[0].Offset:m[0].Offset+m[0].Length] != "a.b@example.com" {
+		t.Fatalf("expected: byte offsets of the email, result: %v", m)
+	}
+	if m[0].Masked != "a.*@*******.*om" {
+		t.Fatalf("expected: masked email, result: %v", m[0].Masked)
+	}
+}
@@ -0,0 +1,233 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/v2/analysis/char/asciifolding"
+	"github.com/blevesearch/bleve/v2/analysis/char/regexp"
+	"github.com/blevesearch/bleve/v2/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/v2/analysis/tokenizer/unicode"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/query"
+)
+
+// BackendBleve is the embedded Bleve backend. Its location is the index directory, created on
+// first use. The index is kept in memory when the location is empty.
+const BackendBleve = "bleve"
+
+func init() {
+	Register(BackendBleve, openBleve)
+}
+
+// foldedAnalyzer splits text into unicode words, lowercased and without accents, so that "l'Été"
+// matches "ete". It is language independent: documents mix French, English and other languages.
+// Apostrophes split words, see elisionFilter.
+const (
+	foldedAnalyzer = "folded"
+	elisionFilter  = "elision"
+)
+
+// hitFields are the stored fields returned with the hits.
+var hitFields = []string{"hash", "language", "source_uris", "ocr_output"}
+
+type bleveIndex struct {
+	idx bleve.Index
+}
+
+func openBleve(location string) (Index, error) {
+	if location == "" {
+		idx, err := bleve.NewMemOnly(bleveMapping())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create index: %w", err)
+		}
+		return &bleveIndex{idx: idx}, nil
+	}
+
+	idx, err := bleve.Open(location)
+	if errors.Is(err, bleve.ErrorIndexPathDoesNotExist) {
+		idx, err = bleve.New(location, bleveMapping())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index (%s): %w", location, err)
+	}
+	return &bleveIndex{idx: idx}, nil
+}
+
+// bleveMapping returns the mapping of Document. Text, entities, categories and paths are searchable
+// text, the other fields are exact keywords.
+func bleveMapping() mapping.IndexMapping {
+	im := bleve.NewIndexMapping()
+	if err := im.AddCustomCharFilter(elisionFilter, map[string]interface{}{
+		"type":    regexp.Name,
+		"regexp":  `['’]`,
+		"replace": " ",
+	}); err != nil {
+		panic(err)
+	}
+	if err := im.AddCustomAnalyzer(foldedAnalyzer, map[string]interface{}{
+		"type":          custom.Name,
+		"char_filters":  []string{elisionFilter, asciifolding.Name},
+		"tokenizer":     unicode.Name,
+		"token_filters": []string{lowercase.Name},
+	}); err != nil {
+		panic(err)
+	}
+	im.DefaultAnalyzer = foldedAnalyzer
+
+	text := func(store bool) *mapping.FieldMapping {
+		f := bleve.NewTextFieldMapping()
+		f.Analyzer = foldedAnalyzer
+		f.Store = store
+		f.IncludeTermVectors = store
+		return f
+	}
+	keyword := func(store bool) *mapping.FieldMapping {
+		f := bleve.NewKeywordFieldMapping()
+		f.Store = store
+		f.IncludeInAll = false
+		return f
+	}
+
+	dm := bleve.NewDocumentStaticMapping()
+	dm.AddFieldMappingsAt("hash", keyword(true))
+	// the text is stored for the hit fragments
+	dm.AddFieldMappingsAt("text", text(true))
+	dm.AddFieldMappingsAt("language", keyword(true))
+	dm.AddFieldMappingsAt("languages", keyword(false))
+	dm.AddFieldMappingsAt("categories", text(false))
+	dm.AddFieldMappingsAt("source_uris", keyword(true))
+	dm.AddFieldMappingsAt("paths", text(false))
+	dm.AddFieldMappingsAt("ocr_output", keyword(true))
+	pii := bleve.NewBooleanFieldMapping()
+	pii.IncludeInAll = false
+	dm.AddFieldMappingsAt("contains_pii", pii)
+	version := keyword(true)
+	version.Index = false
+	dm.AddFieldMappingsAt("version", version)
+
+	// entities.<type> fields, for every entity type
+	entities := bleve.NewDocumentMapping()
+	entities.DefaultAnalyzer = foldedAnalyzer
+	dm.AddSubDocumentMapping("entities", entities)
+
+	im.DefaultMapping = dm
+	return im
+}
+
+func (b *bleveIndex) Index(ctx context.Context, docs ...Document) error {
+	batch := b.idx.NewBatch()
+	for _, d := range docs {
+		if err := batch.Index(d.ID(), d); err != nil {
+			return fmt.Errorf("failed to index document (%s): %w", d.ID(), err)
+		}
+	}
+	if err := b.idx.Batch(batch); err != nil {
+		return fmt.Errorf("failed to index %d documents: %w", len(docs), err)
+	}
+	return nil
+}
+
+func (b *bleveIndex) Version(ctx context.Context, id string) (string, bool, error) {
+	req := bleve.NewSearchRequest(bleve.NewDocIDQuery([]string{id}))
+	req.Fields = []string{"version"}
+	res, err := b.idx.SearchInContext(ctx, req)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read document (%s): %w", id, err)
+	}
+	if len(res.Hits) == 0 {
+		return "", false, nil
+	}
+	v, _ := res.Hits[0].Fields["version"].(string)
+	return v, true, nil
+}
+
+func (b *bleveIndex) Search(ctx context.Context, q Query) (*Result, error) {
+	bq, err := bleveQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	req := bleve.NewSearchRequestOptions(bq, q.size(), q.From, false)
+	req.Fields = hitFields
+	if strings.TrimSpace(q.Text) != "" {
+		req.Highlight = bleve.NewHighlight()
+		req.Highlight.AddField("text")
+	}
+
+	res, err := b.idx.SearchInContext(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search: %w", err)
+	}
+
+	r := &Result{Total: res.Total, Hits: make([]Hit, 0, len(res.Hits)), TookMS: res.Took.Milliseconds()}
+	for _, h := range res.Hits {
+		hit := Hit{ID: h.ID, Score: h.Score, Fragments: h.Fragments["text"]}
+		hit.Hash, _ = h.Fields["hash"].(string)
+		hit.Language, _ = h.Fields["language"].(string)
+		hit.OCROutput, _ = h.Fields["ocr_output"].(string)
+		// single values of array fields are returned as is
+		switch v := h.Fields["source_uris"].(type) {
+		case string:
+			hit.SourceURIs = []string{v}
+		case []interface{}:
+			for _, s := range v {
+				if s, ok := s.(string); ok {
+					hit.SourceURIs = append(hit.SourceURIs, s)
+				}
+			}
+		}
+		r.Hits = append(r.Hits, hit)
+	}
+	return r, nil
+}
+
+// bleveQuery returns the conjunction of the query string and the filters of a query.
+func bleveQuery(q Query) (query.Query, error) {
+	var qs []query.Query
+	if s := strings.TrimSpace(q.Text); s != "" {
+		qsq, err := bleve.NewQueryStringQuery(s).Parse()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+		}
+		qs = append(qs, qsq)
+	}
+	if q.Language != "" {
+		t := bleve.NewTermQuery(q.Language)
+		t.SetField("languages")
+		qs = append(qs, t)
+	}
+	for typ, s := range q.Entities {
+		m := bleve.NewMatchQuery(s)
+		m.SetField("entities." + strings.ToLower(typ))
+		m.SetOperator(query.MatchQueryOperatorAnd)
+		qs = append(qs, m)
+	}
+	if q.Source != "" {
+		p := bleve.NewPrefixQuery(q.Source)
+		p.SetField("source_uris")
+		qs = append(qs, p)
+	}
+	if len(qs) == 0 {
+		return bleve.NewMatchAllQuery(), nil
+	}
+	return bleve.NewConjunctionQuery(qs...), nil
+}
+
+func (b *bleveIndex) Delete(ctx context.Context, ids ...string) error {
+	batch := b.idx.NewBatch()
+	for _, id := range ids {
+		batch.Delete(id)
+	}
+	if err := b.idx.Batch(batch); err != nil {
+		return fmt.Errorf("failed to delete %d documents: %w", len(ids), err)
+	}
+	return nil
+}
+
+func (b *bleveIndex) Close() error {
+	return b.idx.Close()
+}
@@ -0,0 +1,219 @@
+// Package search indexes the OCR text and NLP entities of the documents, keyed by image content
+// hash, and searches them. Indexes are opened by backend name, see Register: the embedded Bleve
+// backend is built in.
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/types"
+)
+
+// Document is an indexed document, the OCR text and NLP output of a unique image.
+type Document struct {
+	// Hash is the content hash of the image, see types.ImageDocument. Empty for replayed documents.
+	Hash string `json:"hash"`
+	Text string `json:"text"`
+	// Entities are the names of the NLP entities by lowercase entity type, e.g. person, location.
+	Entities map[string][]string `json:"entities,omitempty"`
+	// Language is the dominant language, Languages all the languages detected.
+	Language   string   `json:"language,omitempty"`
+	Languages  []string `json:"languages,omitempty"`
+	Categories []string `json:"categories,omitempty"`
+	// SourceURIs are the gs:// uris, or local paths, of every copy of the image. Paths are the same
+	// without the gs://<bucket>/ prefix, indexed as text so that folders and file names are
+	// searchable.
+	SourceURIs []string `json:"source_uris"`
+	Paths      []string `json:"paths"`
+	// OCROutput is the OCR output the NLP output was computed from, see types.NLPOutput.
+	OCROutput   string `json:"ocr_output"`
+	ContainsPII bool   `json:"contains_pii"`
+	// Version identifies the indexed outputs, e.g. the NLP output generation. Documents whose
+	// outputs did not change are not indexed again.
+	Version string `json:"version"`
+}
+
+// ID returns the index id of a document: its hash, or its OCR output when it has none.
+func (d Document) ID() string {
+	if d.Hash != "" {
+		return d.Hash
+	}
+	return d.OCROutput
+}
+
+// NewDocument returns the document of the OCR text of an image and of its JSON encoded NLP output,
+// see types.NLPOutput.
+func NewDocument(text string, nlp []byte) (Document, error) {
+	var out types.NLPOutput
+	if err := json.Unmarshal(nlp, &out); err != nil {
+		return Document{}, fmt.Errorf("failed to decode nlp output: %w", err)
+	}
+
+	d := Document{
+		Hash:        out.Hash,
+		Text:        text,
+		Language:    out.Language,
+		SourceURIs:  out.SourceURIs,
+		OCROutput:   out.OCROutput,
+		ContainsPII: out.ContainsPII,
+	}
+
+	langs := map[string]bool{}
+	addLang := func(l string) {
+		if l != "" && !langs[l] {
+			langs[l] = true
+			d.Languages = append(d.Languages, l)
+		}
+	}
+	addLang(out.Language)
+	for _, l := range out.Languages {
+		addLang(l.Code)
+	}
+	for _, s := range out.Segments {
+		addLang(s.Language)
+	}
+
+	for _, e := range out.Entities {
+		if e.GetName() == "" {
+			continue
+		}
+		if d.Entities == nil {
+			d.Entities = map[string][]string{}
+		}
+		t := strings.ToLower(e.GetType().String())
+		d.Entities[t] = append(d.Entities[t], e.GetName())
+	}
+	for _, c := range out.Categories {
+		d.Categories = append(d.Categories, c.GetName())
+	}
+	for _, u := range out.SourceURIs {
+		d.Paths = append(d.Paths, sourcePath(u))
+	}
+	return d, nil
+}
+
+// sourcePath returns the object path of a gs://<bucket>/<path> uri, and local paths as is.
+func sourcePath(uri string) string {
+	if s, ok := strings.CutPrefix(uri, "gs://"); ok {
+		if _, p, ok := strings.Cut(s, "/"); ok {
+			return p
+		}
+	}
+	return uri
+}
+
+// Query is a search request.
+type Query struct {
+	// Text is a query string, e.g. `invoice +entities.person:dupont -language:de`. Terms without a
+	// field match any field. Empty matches all documents.
+	Text string `json:"q"`
+	// Language restricts the results to the documents of a language, dominant or not.
+	Language string `json:"language,omitempty"`
+	// Entities restricts the results to the documents with an entity of a type matching a text,
+	// e.g. {"person": "jean dupont"}.
+	Entities map[string]string `json:"entities,omitempty"`
+	// Source restricts the results to the documents with a source uri starting with a prefix.
+	Source string `json:"source,omitempty"`
+	Size   int    `json:"size,omitempty"`
+	From   int    `json:"from,omitempty"`
+}
+
+// ErrInvalidQuery is returned by searches of malformed query strings.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// DefaultSize and MaxSize are the default and maximum number of hits per search.
+const (
+	DefaultSize = 10
+	MaxSize     = 1000
+)
+
+// Result is the result of a search.
+type Result struct {
+	// Total is the number of matching documents, Hits the requested page of them.
+	Total uint64 `json:"total"`
+	Hits  []Hit  `json:"hits"`
+	// TookMS is the search duration in milliseconds.
+	TookMS int64 `json:"took_ms"`
+}
+
+// Hit is a matching document.
+type Hit struct {
+	ID         string   `json:"id"`
+	Score      float64  `json:"score"`
+	Hash       string   `json:"hash,omitempty"`
+	Language   string   `json:"language,omitempty"`
+	SourceURIs []string `json:"source_uris"`
+	OCROutput  string   `json:"ocr_output"`
+	// Fragments are the text excerpts matching the query, with the matches highlighted.
+	Fragments []string `json:"fragments,omitempty"`
+}
+
+// Index is a search index backend.
+type Index interface {
+	// Index adds documents to the index, replacing the documents with the same id.
+	Index(ctx context.Context, docs ...Document) error
+	// Version returns the version of an indexed document, and false when it is not indexed.
+	Version(ctx context.Context, id string) (string, bool, error)
+	Search(ctx context.Context, q Query) (*Result, error)
+	Delete(ctx context.Context, ids ...string) error
+	Close() error
+}
+
+// Opener opens the index of a backend at a location, e.g. a directory or a service url, creating it
+// when it does not exist.
+type Opener func(location string) (Index, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[string]Opener{}
+)
+
+// Register makes a backend available by name. It panics when the name is already registered.
+func Register(name string, open Opener) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if _, ok := backends[name]; ok {
+		panic("search: backend registered twice: " + name)
+	}
+	backends[name] = open
+}
+
+// Backends returns the names of the registered backends.
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	names := make([]string, 0, len(backends))
+	for n := range backends {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open opens the index of the backend name at a location.
+func Open(name, location string) (Index, error) {
+	backendsMu.RLock()
+	open, ok := backends[name]
+	backendsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown search backend %q, expected one of %s", name, strings.Join(Backends(), ", "))
+	}
+	return open(location)
+}
+
+// size returns the number of hits of a query, within DefaultSize and MaxSize.
+func (q Query) size() int {
+	switch {
+	case q.Size <= 0:
+		return DefaultSize
+	case q.Size > MaxSize:
+		return MaxSize
+	}
+	return q.Size
+}
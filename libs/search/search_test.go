@@ -0,0 +1,167 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+const nlpOutput = `{
+	"hash": "h1",
+	"source_uris": ["gs://src/2019/factures/f-001.jpg", "gs://src/copies/f-001.jpg"],
+	"ocr_output": "gs://ocr/op/0",
+	"language": "fr",
+	"languages": [{"code": "fr", "confidence": 0.9}, {"code": "en", "confidence": 0.1}],
+	"segments": [{"language": "fr", "offset": 0, "length": 10}],
+	"entities": [{"name": "Jean Dupont", "type": 1}, {"name": "Lyon", "type": 2}, {"name": "Marie Curie", "type": 1}],
+	"categories": [{"name": "/Finance/Accounting"}],
+	"contains_pii": true
+}`
+
+func TestNewDocument(t *testing.T) {
+	d, err := NewDocument("Facture d'été", []byte(nlpOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := Document{
+		Hash:        "h1",
+		Text:        "Facture d'été",
+		Entities:    map[string][]string{"person": {"Jean Dupont", "Marie Curie"}, "location": {"Lyon"}},
+		Language:    "fr",
+		Languages:   []string{"fr", "en"},
+		Categories:  []string{"/Finance/Accounting"},
+		SourceURIs:  []string{"gs://src/2019/factures/f-001.jpg", "gs://src/copies/f-001.jpg"},
+		Paths:       []string{"2019/factures/f-001.jpg", "copies/f-001.jpg"},
+		OCROutput:   "gs://ocr/op/0",
+		ContainsPII: true,
+	}
+	if !reflect.DeepEqual(expect, d) {
+		t.Fatalf("expected: %+v, result: %+v", expect, d)
+	}
+
+	if _, err := NewDocument("", []byte("{")); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestDocumentID(t *testing.T) {
+	if id := (Document{Hash: "h", OCROutput: "o"}).ID(); id != "h" {
+		t.Fatalf("expected: h, result: %s", id)
+	}
+	if id := (Document{OCROutput: "o"}).ID(); id != "o" {
+		t.Fatalf("expected: o, result: %s", id)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	if _, err := Open("nope", ""); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestBleveIndex(t *testing.T) {
+	ctx := context.Background()
+	idx, err := Open(BackendBleve, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+
+	fr, err := NewDocument("Facture d'été, payée à Lyon", []byte(nlpOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fr.Version = "1"
+	en := Document{
+		Hash:       "h2",
+		Text:       "Summer invoice, paid in London",
+		Entities:   map[string][]string{"location": {"London"}},
+		Language:   "en",
+		Languages:  []string{"en"},
+		SourceURIs: []string{"gs://src/2020/invoices/i-001.jpg"},
+		Paths:      []string{"2020/invoices/i-001.jpg"},
+		OCROutput:  "gs://ocr/op/1",
+	}
+	if err := idx.Index(ctx, fr, en); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		q      Query
+		expect []string
+	}{
+		"all": {q: Query{}, expect: []string{"h1", "h2"}},
+		// accents and case are ignored
+		"text":   {q: Query{Text: "ETE"}, expect: []string{"h1"}},
+		"either": {q: Query{Text: "invoice facture"}, expect: []string{"h1", "h2"}},
+		"field":  {q: Query{Text: "entities.person:dupont"}, expect: []string{"h1"}},
+		"path":   {q: Query{Text: "paths:invoices"}, expect: []string{"h2"}},
+		// filters
+		"language":   {q: Query{Language: "en"}, expect: []string{"h1", "h2"}},
+		"dominant":   {q: Query{Text: "+language:en"}, expect: []string{"h2"}},
+		"entity":     {q: Query{Entities: map[string]string{"location": "london"}}, expect: []string{"h2"}},
+		"entity all": {q: Query{Entities: map[string]string{"person": "jean lyon"}}, expect: nil},
+		"source":     {q: Query{Source: "gs://src/2019/"}, expect: []string{"h1"}},
+		"no match":   {q: Query{Text: "invoice", Language: "fr"}, expect: nil},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			res, err := idx.Search(ctx, tc.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, h := range res.Hits {
+				ids = append(ids, h.ID)
+			}
+			sort.Strings(ids)
+			if !reflect.DeepEqual(tc.expect, ids) {
+				t.Fatalf("expected: %v, result: %v", tc.expect, ids)
+			}
+			if res.Total != uint64(len(tc.expect)) {
+				t.Fatalf("expected total: %d, result: %d", len(tc.expect), res.Total)
+			}
+		})
+	}
+
+	if _, err := idx.Search(ctx, Query{Text: `"unterminated`}); !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("expected ErrInvalidQuery, result: %v", err)
+	}
+
+	// hits
+	res, err := idx.Search(ctx, Query{Text: "lyon"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Hits) != 1 {
+		t.Fatalf("expected 1 hit, result: %d", len(res.Hits))
+	}
+	h := res.Hits[0]
+	if h.Hash != "h1" || h.Language != "fr" || h.OCROutput != "gs://ocr/op/0" || !reflect.DeepEqual(fr.SourceURIs, h.SourceURIs) {
+		t.Fatalf("unexpected hit: %+v", h)
+	}
+	if len(h.Fragments) == 0 {
+		t.Fatal("expected fragments")
+	}
+
+	// versions
+	v, ok, err := idx.Version(ctx, "h1")
+	if err != nil || !ok || v != "1" {
+		t.Fatalf("expected version 1, result: %q %v %v", v, ok, err)
+	}
+	if _, ok, err := idx.Version(ctx, "h3"); err != nil || ok {
+		t.Fatalf("expected no version, result: %v %v", ok, err)
+	}
+
+	// delete
+	if err := idx.Delete(ctx, "h1"); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := idx.Search(ctx, Query{}); err != nil || res.Total != 1 {
+		t.Fatalf("expected 1 document, result: %+v %v", res, err)
+	}
+}
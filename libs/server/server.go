@@ -0,0 +1,75 @@
+// Package server serves the HTTP apps, the api and the indexer search server: graceful shutdown
+// on signal and JSON responses.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ShutdownTimeout bounds the completion of in-flight requests on shutdown. Cloud Run kills the
+// container 10s after SIGTERM.
+const ShutdownTimeout = 8 * time.Second
+
+// ErrorResponse is the JSON body of error responses.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Serve serves h on port until SIGTERM or SIGINT, or until the server fails, then shuts down,
+// letting in-flight requests complete for up to ShutdownTimeout.
+func Serve(h http.Handler, port string) {
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           h,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+
+	// signal handling
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signalChan)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Info().Str("port", port).Msg("listening")
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	select {
+	case sig := <-signalChan:
+		log.Info().Str("signal", sig.String()).Msg("shutting down")
+	case err := <-serverErr:
+		log.Error().Err(err).Caller().Msg("web server exited")
+	}
+
+	sctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(sctx); err != nil {
+		log.Error().Err(err).Caller().Msg("failed to shut down web server")
+	}
+}
+
+// WriteJSON writes v as the JSON response body, with the status code.
+func WriteJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error().Err(err).Caller().Msg("failed to write response")
+	}
+}
+
+// WriteError writes msg as the JSON error response body, with the status code.
+func WriteError(w http.ResponseWriter, code int, msg string) {
+	WriteJSON(w, code, ErrorResponse{Error: msg})
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteJSON(t *testing.T) {
+	tests := map[string]struct {
+		write  func(w http.ResponseWriter)
+		code   int
+		expect string
+	}{
+		"value": {
+			write:  func(w http.ResponseWriter) { WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"}) },
+			code:   http.StatusOK,
+			expect: `{"status":"ok"}` + "\n",
+		},
+		"error": {
+			write:  func(w http.ResponseWriter) { WriteError(w, http.StatusBadRequest, "invalid size") },
+			code:   http.StatusBadRequest,
+			expect: `{"error":"invalid size"}` + "\n",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tc.write(w)
+			if w.Code != tc.code || w.Body.String() != tc.expect {
+				t.Fatalf("expected: %d %s, result: %d %s", tc.code, tc.expect, w.Code, w.Body.String())
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Fatalf("expected: application/json, result: %s", ct)
+			}
+		})
+	}
+}
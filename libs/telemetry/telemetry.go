@@ -0,0 +1,84 @@
+// Package telemetry sets up OpenTelemetry tracing and propagates the trace context between the apps,
+// through Pub/Sub message attributes and GCS object metadata.
+package telemetry
+
+import (
+	"context"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of the spans created by the apps.
+const tracerName = "github.com/cyber-nic/go-gcp-doc-ai"
+
+// provider is the tracer provider installed by Init. It is nil when tracing is disabled.
+var provider *sdktrace.TracerProvider
+
+// Init installs the global tracer provider and propagator. Spans are exported via OTLP/gRPC when
+// OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set (e.g. a local collector
+// on http://localhost:4317), otherwise tracing is disabled. The standard OTEL_* env vars apply.
+// The returned function flushes and shuts down the tracer provider.
+func Init(ctx context.Context, service string) (func(context.Context) error, error) {
+	// the trace context is always propagated, even when this app does not export spans
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exp, err := otlptracegrpc.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithAttributes(semconv.ServiceName(service)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Flush exports all ended spans. Used by short-lived invocations such as cloud functions.
+func Flush(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+	return provider.ForceFlush(ctx)
+}
+
+// Tracer returns the tracer used by the apps.
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// Inject writes the trace context of ctx into m, which can be Pub/Sub message attributes or GCS
+// object metadata. A new map is created when m is nil.
+func Inject(ctx context.Context, m map[string]string) map[string]string {
+	if m == nil {
+		m = map[string]string{}
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(m))
+	return m
+}
+
+// Extract returns a copy of ctx carrying the trace context found in m.
+func Extract(ctx context.Context, m map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(m))
+}
@@ -0,0 +1,39 @@
+package telemetry
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInjectExtract(t *testing.T) {
+	os.Unsetenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	os.Unsetenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if _, err := Init(context.Background(), "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+		SpanID:     trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+
+	// attributes already set are kept
+	m := Inject(ctx, map[string]string{"foo": "bar"})
+	if m["foo"] != "bar" {
+		t.Fatalf("expected: %v, result: %v", "bar", m["foo"])
+	}
+	if m["traceparent"] == "" {
+		t.Fatal("expected traceparent to be set")
+	}
+
+	res := trace.SpanContextFromContext(Extract(context.Background(), m))
+	if !reflect.DeepEqual(sc.TraceID(), res.TraceID()) || !reflect.DeepEqual(sc.SpanID(), res.SpanID()) {
+		t.Fatalf("expected: %v, result: %v", sc, res)
+	}
+}
@@ -0,0 +1,105 @@
+package types
+
+import "cloud.google.com/go/language/apiv1/languagepb"
+
+// OCRManifest maps the documents of a Document AI batch operation to their OCR output. It is
+// written by the ocr-worker to the ocr refs bucket, see docai.ManifestKey.
+type OCRManifest struct {
+	// Operation is the Document AI operation name.
+	Operation string `json:"operation"`
+	// Processor is the resource name of the processor, or processor version, of the operation.
+	Processor string                `json:"processor,omitempty"`
+	Documents []OCRManifestDocument `json:"documents"`
+	// Complete is true once the operation completed and Output is the destination reported by
+	// Document AI, rather than the expected one.
+	Complete bool `json:"complete"`
+}
+
+// OCRManifestDocument is a document of an OCRManifest.
+type OCRManifestDocument struct {
+	// URI is the gs:// uri of the image submitted to Document AI.
+	URI string `json:"uri"`
+	// Hash is the content hash of the image, see ImageDocument. Empty for replayed documents.
+	Hash       string   `json:"hash,omitempty"`
+	SourceURIs []string `json:"source_uris,omitempty"`
+	// Output is the gs://<bucket>/<op-id>/<index> output destination of the document.
+	Output string `json:"output"`
+	// TraceContext is the trace context of the ocr-worker batch that submitted the document, for
+	// the nlp-worker and converter to continue the trace.
+	TraceContext map[string]string `json:"trace_context,omitempty"`
+}
+
+// NLPOutput is the nlp-worker output, keyed by content hash. Offsets, in segments, entity mentions,
+// sentences, tokens and PII matches, are UTF-8 byte offsets in the OCR text. Fields of analyses not
+// performed, see NLP_ANALYSES, are empty.
+type NLPOutput struct {
+	Hash       string   `json:"hash,omitempty"`
+	SourceURIs []string `json:"source_uris"`
+	// OCROutput is the gs://<bucket>/<op-id>/<index> OCR output the analysis was performed on.
+	OCROutput string `json:"ocr_output"`
+	// Analyses are the analyses performed.
+	Analyses []string `json:"analyses"`
+	// Language is the dominant language of the document, empty when no language was detected.
+	Language string `json:"language,omitempty"`
+	// Languages are the languages detected by OCR, by decreasing confidence.
+	Languages []LanguageScore `json:"languages,omitempty"`
+	// Filter describes the text removed before analysis, see NLP_MIN_TOKEN_CONFIDENCE.
+	Filter *NLPFilterStats `json:"filter,omitempty"`
+	// Segments are the parts of the document analyzed separately, one per language run.
+	Segments []NLPSegment `json:"segments"`
+	// Entities are the entities of all the segments, merged by name and type.
+	Entities []*languagepb.Entity `json:"entities,omitempty"`
+	// Sentiment is the document sentiment, averaged over the segments weighted by length.
+	Sentiment  *languagepb.Sentiment                `json:"sentiment,omitempty"`
+	Categories []*languagepb.ClassificationCategory `json:"categories,omitempty"`
+	Sentences  []*languagepb.Sentence               `json:"sentences,omitempty"`
+	Tokens     []*languagepb.Token                  `json:"tokens,omitempty"`
+	// ContainsPII is true when personal data was found. Only set by the pii analysis.
+	ContainsPII bool           `json:"contains_pii"`
+	PIICounts   map[string]int `json:"pii_counts,omitempty"`
+	PII         []PIIMatch     `json:"pii,omitempty"`
+}
+
+// LanguageScore is a language detected in a document, with its confidence across the document.
+type LanguageScore struct {
+	Code       string  `json:"code"`
+	Confidence float32 `json:"confidence"`
+}
+
+// NLPSegment is a part of a document, a run of pages or blocks in the same language.
+type NLPSegment struct {
+	// DetectedLanguage is the language detected by OCR, empty when none is confident enough.
+	DetectedLanguage string `json:"detected_language,omitempty"`
+	// Language is the language of the analysis, either requested or detected by the language API.
+	Language string `json:"language,omitempty"`
+	// Pages are the 1-based numbers of the pages the segment spans.
+	Pages  []int `json:"pages,omitempty"`
+	Offset int   `json:"offset"`
+	Length int   `json:"length"`
+	// Chunks is the number of requests the segment was analyzed in, see NLP_MAX_CHUNK_BYTES.
+	Chunks int `json:"chunks,omitempty"`
+	// Sentiment is the segment sentiment, averaged over its chunks weighted by length.
+	Sentiment *languagepb.Sentiment `json:"sentiment,omitempty"`
+	// Skipped is the reason the segment was not analyzed, e.g. an unsupported language.
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// PIIMatch is personal data found in a document by the nlp-worker.
+type PIIMatch struct {
+	// Type is email, phone, iban, fr_nir or us_ssn.
+	Type   string `json:"type"`
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	// Masked is the value with all but its first and last two letters or digits masked.
+	Masked string `json:"masked"`
+}
+
+// NLPFilterStats describes the text filtered out of a document before analysis.
+type NLPFilterStats struct {
+	LowConfidenceTokens int `json:"low_confidence_tokens"`
+	HeaderFooterLines   int `json:"header_footer_lines"`
+	PageNumbers         int `json:"page_numbers"`
+	// TextBytes is the size of the analyzed segments, AnalyzedBytes the size sent to the language API.
+	TextBytes     int `json:"text_bytes"`
+	AnalyzedBytes int `json:"analyzed_bytes"`
+}
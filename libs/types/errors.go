@@ -0,0 +1,151 @@
+package types
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/cyber-nic/go-gcp-doc-ai/libs/utils"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Error record stages, the worker an ErrorRecord was written by.
+const (
+	ErrorStageOCR     = "ocr"
+	ErrorStageNLP     = "nlp"
+	ErrorStageConvert = "convert"
+)
+
+// ErrorRecord is the JSON document written to the err buckets when a worker fails to process an
+// object.
+type ErrorRecord struct {
+	Stage string `json:"stage"`
+	// Bucket and Object are the object that failed, the source image for the ocr stage and the OCR
+	// output for the nlp and convert stages.
+	Bucket     string `json:"bucket"`
+	Object     string `json:"object"`
+	Generation int64  `json:"generation,omitempty"`
+	// Code is the gRPC code name of the error, Unknown for errors without a status.
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Error is the full error chain, empty when the failure is reported by a remote service.
+	Error string `json:"error,omitempty"`
+	// Retryable is true when the error is transient and the object can be replayed as is.
+	Retryable bool `json:"retryable"`
+	// Attempt is the number of failures recorded for the object, including this one.
+	Attempt   int       `json:"attempt"`
+	Timestamp time.Time `json:"timestamp"`
+	// Stack is the stack of the failure, from the caller of NewErrorRecord. Empty when the failure
+	// is reported by a remote service.
+	Stack string `json:"stack,omitempty"`
+}
+
+// stackDepth bounds the frames of ErrorRecord.Stack.
+const stackDepth = 32
+
+// NewErrorRecord returns the record of err, with the stack of its caller, the failure site.
+func NewErrorRecord(stage, bucket, object string, generation int64, msg string, err error) ErrorRecord {
+	code := ErrorCode(err)
+	return ErrorRecord{
+		Stage:      stage,
+		Bucket:     bucket,
+		Object:     object,
+		Generation: generation,
+		Code:       code.String(),
+		Message:    msg,
+		Error:      err.Error(),
+		Retryable:  IsRetryableCode(code),
+		Timestamp:  time.Now().UTC(),
+		Stack:      callers(3),
+	}
+}
+
+// callers formats the stack of the calling goroutine, skipping skip frames as runtime.Callers does,
+// one function and file:line per frame.
+func callers(skip int) string {
+	pcs := make([]uintptr, stackDepth)
+	n := runtime.Callers(skip, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var b strings.Builder
+	for {
+		f, more := frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", f.Function, f.File, f.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+// ErrorCode returns the gRPC code of err. Context errors are mapped to their gRPC equivalent.
+func ErrorCode(err error) codes.Code {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled
+	}
+	return status.Code(err)
+}
+
+// IsRetryableCode reports whether errors with code c are transient.
+func IsRetryableCode(c codes.Code) bool {
+	switch c {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted, codes.Internal, codes.Canceled:
+		return true
+	}
+	return false
+}
+
+// errorRecordWrites bounds the attempts to write an error record, when concurrent failures of the
+// same object race on its attempt counter.
+const errorRecordWrites = 5
+
+// WriteErrorRecord writes an error record to an object. Attempt is set from the record previously
+// written to the object, if any. The record is written on condition that the object did not change
+// since it was read, and read again otherwise, so that concurrent failures are all counted.
+func WriteErrorRecord(ctx context.Context, o *storage.ObjectHandle, r ErrorRecord) error {
+	var err error
+	for range errorRecordWrites {
+		if err = writeErrorRecord(ctx, o, r); !utils.IsPreconditionFailed(err) {
+			return err
+		}
+	}
+	return err
+}
+
+func writeErrorRecord(ctx context.Context, o *storage.ObjectHandle, r ErrorRecord) error {
+	r.Attempt = 1
+	conds := storage.Conditions{DoesNotExist: true}
+	if rd, err := o.NewReader(ctx); err == nil {
+		conds = storage.Conditions{GenerationMatch: rd.Attrs.Generation}
+		var prev ErrorRecord
+		// legacy and unreadable records count as a single failure
+		if json.NewDecoder(rd).Decode(&prev) == nil && prev.Attempt > 0 {
+			r.Attempt = prev.Attempt + 1
+		} else {
+			r.Attempt = 2
+		}
+		rd.Close()
+	} else if !errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("(%s) failed to read error record: %w", o.ObjectName(), err)
+	}
+
+	w := o.If(conds).NewWriter(ctx)
+	w.ContentType = "application/json"
+	if err := json.NewEncoder(w).Encode(r); err != nil {
+		w.Close()
+		return fmt.Errorf("(%s) failed to encode error record: %w", o.ObjectName(), err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("(%s) failed to write error record: %w", o.ObjectName(), err)
+	}
+	return nil
+}
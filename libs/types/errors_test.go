@@ -0,0 +1,41 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestNewErrorRecord(t *testing.T) {
+	tests := map[string]struct {
+		err       error
+		code      string
+		retryable bool
+	}{
+		"status":    {fmt.Errorf("analyze: %w", status.Error(codes.InvalidArgument, "document too large")), "InvalidArgument", false},
+		"transient": {status.Error(codes.Unavailable, "try again"), "Unavailable", true},
+		"deadline":  {fmt.Errorf("analyze: %w", context.DeadlineExceeded), "DeadlineExceeded", true},
+		"plain":     {errors.New("unexpected EOF"), "Unknown", false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := NewErrorRecord(ErrorStageNLP, "ocr", "1/0/a-0.json", 3, "failed", tc.err)
+			if r.Code != tc.code || r.Retryable != tc.retryable {
+				t.Fatalf("expected: %s/%v, result: %s/%v", tc.code, tc.retryable, r.Code, r.Retryable)
+			}
+			if r.Error != tc.err.Error() || r.Timestamp.IsZero() {
+				t.Fatalf("incomplete record: %+v", r)
+			}
+			// the stack starts at the failure site, the caller of NewErrorRecord
+			if !strings.HasPrefix(r.Stack, "github.com/cyber-nic/go-gcp-doc-ai/libs/types.TestNewErrorRecord.") {
+				t.Fatalf("expected: stack of TestNewErrorRecord, result: %s", r.Stack)
+			}
+		})
+	}
+}
@@ -1,7 +1,11 @@
 // Package types contains the types used by more then one application in this repo.
 package types
 
-import "cloud.google.com/go/storage"
+import (
+	"time"
+
+	"cloud.google.com/go/storage"
+)
 
 // https://cloud.google.com/eventarc/docs/workflows/cloudevents
 // {
@@ -30,11 +34,17 @@ type CloudEventMessage struct {
 
 // ImageDocument represents the computed hash and its associated image paths, along with additional metadata.
 type ImageDocument struct {
-	Hash       string   `firestore:"hash" `
+	Hash       string   `firestore:"hash"        json:"hash"`
 	MimeType   string   `firestore:"mime_type"   json:"mime_type"`
 	ImagePaths []string `firestore:"image_paths" json:"image_paths"`
-	Width      int      `firestore:"width"`
-	Height     int      `firestore:"height"`
-	Pixels     int      `firestore:"pixels"`
-	Size       int64    `firestore:"size" `
+	Width      int      `firestore:"width"       json:"width"`
+	Height     int      `firestore:"height"      json:"height"`
+	Pixels     int      `firestore:"pixels"      json:"pixels"`
+	Size       int64    `firestore:"size"        json:"size"`
+	// Label is an optional classification label, e.g. "invoice", used by the ocr-worker to route
+	// the image to a Document AI processor.
+	Label string `firestore:"label,omitempty" json:"label,omitempty"`
+	// Created is the creation time of the earliest source object, zero for images indexed before
+	// it was recorded. The dispatcher filters on it.
+	Created time.Time `firestore:"created,omitempty" json:"created,omitempty"`
 }
@@ -2,9 +2,14 @@
 package utils
 
 import (
-	"log"
+	"errors"
+	"fmt"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
 )
 
 // GetIntEnvVar returns an int from an environment variable
@@ -12,7 +17,7 @@ func GetIntEnvVar(key string, fallback int) int {
 	if value, ok := os.LookupEnv(key); ok {
 		i, err := strconv.Atoi(value)
 		if err != nil {
-			log.Fatal("Invalid value for environment variable: " + key)
+			log.Fatal().Err(err).Str("key", key).Msg("invalid value for environment variable")
 		}
 		return i
 	}
@@ -36,3 +41,94 @@ func GetBoolEnvVar(key string, fallback bool) bool {
 	}
 	return ret
 }
+
+// GetFloatEnvVar returns a float from an environment variable
+func GetFloatEnvVar(key string, fallback float64) float64 {
+	if value, ok := os.LookupEnv(key); ok {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			log.Fatal().Err(err).Str("key", key).Msg("invalid value for environment variable")
+		}
+		return f
+	}
+	return fallback
+}
+
+// GetListEnvVar returns the comma separated values of an environment variable, trimmed and
+// without empty values
+func GetListEnvVar(key string, fallback []string) []string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	var ret []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// EnvReader reads env vars, collecting the missing and invalid ones rather than exiting, so that
+// all the misconfigurations are reported at once.
+type EnvReader struct {
+	errs []error
+}
+
+// Err returns the missing and invalid env vars, joined. nil when all were valid.
+func (e *EnvReader) Err() error {
+	return errors.Join(e.errs...)
+}
+
+// Fail records an invalid env var.
+func (e *EnvReader) Fail(err error) {
+	e.errs = append(e.errs, err)
+}
+
+// Mandatory returns the value of a required env var.
+func (e *EnvReader) Mandatory(n string) string {
+	v, ok := os.LookupEnv(n)
+	if !ok || v == "" {
+		e.Fail(fmt.Errorf("env var %s required", n))
+	}
+	return v
+}
+
+// Int returns the value of a positive int env var.
+func (e *EnvReader) Int(n string, fallback int) int {
+	v, ok := os.LookupEnv(n)
+	if !ok {
+		return fallback
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil || i <= 0 {
+		e.Fail(fmt.Errorf("invalid %s value: %s", n, v))
+		return fallback
+	}
+	return i
+}
+
+// Ratio returns the value of a float env var, between 0 and 1.
+func (e *EnvReader) Ratio(n string, fallback float64) float64 {
+	v, ok := os.LookupEnv(n)
+	if !ok {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 || f > 1 {
+		e.Fail(fmt.Errorf("invalid %s value: %s", n, v))
+		return fallback
+	}
+	return f
+}
+
+// OneOf returns the value of an env var restricted to values.
+func (e *EnvReader) OneOf(n, fallback string, values ...string) string {
+	v := GetStrEnvVar(n, fallback)
+	if !slices.Contains(values, v) {
+		e.Fail(fmt.Errorf("invalid %s value: %s", n, v))
+		return fallback
+	}
+	return v
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -94,3 +95,85 @@ func TestGetBoolEnvVar(t *testing.T) {
 		})
 	}
 }
+
+func TestGetFloatEnvVar(t *testing.T) {
+	tests := map[string]struct {
+		key      string
+		fallback float64
+		value    string
+		expect   float64
+	}{
+		// happy path. env var is set
+		"value": {key: "FOO_BAR", expect: 0.5, fallback: 1, value: "0.5"},
+		// env var is not set. fallback is returned
+		"fallback": {key: "BAR_FOO", expect: 1, fallback: 1},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// set env var if value is not empty
+			if ok := tc.value != ""; ok {
+				os.Setenv(tc.key, tc.value)
+				defer os.Unsetenv(tc.key)
+			}
+			// test
+			res := GetFloatEnvVar(tc.key, tc.fallback)
+			if !reflect.DeepEqual(tc.expect, res) {
+				t.Fatalf("expected: %v, result: %v", tc.expect, res)
+			}
+		})
+	}
+}
+
+func TestGetListEnvVar(t *testing.T) {
+	tests := map[string]struct {
+		key      string
+		fallback []string
+		value    string
+		expect   []string
+	}{
+		// happy path. env var is set, values are trimmed
+		"value": {key: "FOO_BAR", expect: []string{"en", "fr"}, fallback: []string{"de"}, value: "en, fr,"},
+		// env var is not set. fallback is returned
+		"fallback": {key: "BAR_FOO", expect: []string{"de"}, fallback: []string{"de"}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// set env var if value is not empty
+			if ok := tc.value != ""; ok {
+				os.Setenv(tc.key, tc.value)
+				defer os.Unsetenv(tc.key)
+			}
+			// test
+			res := GetListEnvVar(tc.key, tc.fallback)
+			if !reflect.DeepEqual(tc.expect, res) {
+				t.Fatalf("expected: %v, result: %v", tc.expect, res)
+			}
+		})
+	}
+}
+
+func TestEnvReader(t *testing.T) {
+	t.Setenv("ENV_READER_INT", "0")
+	t.Setenv("ENV_READER_RATIO", "0.2")
+	t.Setenv("ENV_READER_ONE_OF", "b")
+
+	var env EnvReader
+	if v := env.Int("ENV_READER_INT", 5); v != 5 {
+		t.Fatalf("expected: fallback, result: %d", v)
+	}
+	if v := env.Ratio("ENV_READER_RATIO", 0.5); v != 0.2 {
+		t.Fatalf("expected: 0.2, result: %f", v)
+	}
+	if v := env.OneOf("ENV_READER_ONE_OF", "a", "a", "b"); v != "b" {
+		t.Fatalf("expected: b, result: %s", v)
+	}
+	env.Mandatory("ENV_READER_MISSING")
+
+	// the invalid int and the missing var are reported
+	err := env.Err()
+	if err == nil || !strings.Contains(err.Error(), "ENV_READER_INT") || !strings.Contains(err.Error(), "ENV_READER_MISSING") {
+		t.Fatalf("expected: 2 errors, result: %v", err)
+	}
+}
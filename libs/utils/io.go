@@ -3,14 +3,18 @@ package utils
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"mime"
+	"net/http"
 	"path/filepath"
 	"strings"
 
+	"github.com/rs/zerolog/log"
+
 	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
 )
 
 // PrintStruct prints a struct as JSON.
@@ -66,21 +70,21 @@ func GetValueFromBucketFile(ctx context.Context, o *storage.ObjectHandle) string
 		w := o.NewWriter(ctx)
 		defer w.Close()
 		if _, err := w.Write([]byte("")); err != nil {
-			log.Fatalf("failed to write %s: %v\n", o.ObjectName(), err)
+			log.Fatal().Err(err).Str("object", o.ObjectName()).Msg("failed to write object")
 		}
 
 		// Close writer
 		if err := w.Close(); err != nil {
-			log.Fatalf("failed to close object writer: %v", err)
+			log.Fatal().Err(err).Str("object", o.ObjectName()).Msg("failed to close object writer")
 		}
 	} else if err != nil {
 		// fail is unexpected error
-		log.Fatalf("failed to create %s reader: %v", o.ObjectName(), err)
+		log.Fatal().Err(err).Str("object", o.ObjectName()).Msg("failed to create object reader")
 	}
 
 	r, err := o.NewReader(ctx)
 	if err != nil {
-		log.Fatalf("failed to create %s reader: %v", o.ObjectName(), err)
+		log.Fatal().Err(err).Str("object", o.ObjectName()).Msg("failed to create object reader")
 	}
 
 	// var w
@@ -89,13 +93,20 @@ func GetValueFromBucketFile(ctx context.Context, o *storage.ObjectHandle) string
 	// Read the entire object into a byte slice.
 	b, err = io.ReadAll(r)
 	if err != nil {
-		log.Fatalf("failed to read object: %v", err)
+		log.Fatal().Err(err).Str("object", o.ObjectName()).Msg("failed to read object")
 	}
 
 	// Close the reader.
 	if err := r.Close(); err != nil {
-		log.Fatalf("failed to close object reader: %v", err)
+		log.Fatal().Err(err).Str("object", o.ObjectName()).Msg("failed to close object reader")
 	}
 
 	return string(b)
 }
+
+// IsPreconditionFailed reports whether a storage request failed on its preconditions, e.g. a
+// GenerationMatch or DoesNotExist condition.
+func IsPreconditionFailed(err error) bool {
+	var e *googleapi.Error
+	return errors.As(err, &e) && e.Code == http.StatusPreconditionFailed
+}